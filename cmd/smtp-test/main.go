@@ -2,39 +2,46 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"strings"
 
-	"github.com/liut/staffio/pkg/settings"
-	"github.com/wealthworks/csmtp"
+	"github.com/liut/staffio/pkg/backends/mail"
 )
 
 var (
 	toEmail string
+	name    string
+	lang    string
+	dry     bool
 )
 
 func init() {
-	flag.StringVar(&toEmail, "to", "", "")
+	flag.StringVar(&toEmail, "to", "", "send to the address")
+	flag.StringVar(&name, "name", mail.Reset, "template: "+strings.Join(mail.Names, ", "))
+	flag.StringVar(&lang, "lang", "", "language: en or zh-CN, default of STAFFIO_MAIL_LANG")
+	flag.BoolVar(&dry, "dry", false, "print the mail only")
 }
 
 func main() {
-	settings.Parse()
-	if toEmail == "" {
+	flag.Parse()
+	if toEmail == "" && !dry {
 		flag.PrintDefaults()
 		return
 	}
 
-	csmtp.Host = settings.SMTP.Host
-	csmtp.Port = settings.SMTP.Port
-	csmtp.Name = settings.SMTP.SenderName
-	csmtp.From = settings.SMTP.SenderEmail
-	csmtp.Auth(settings.SMTP.SenderPassword)
-
-	subject := "测试主题"
-	body := "我是一封电子邮件!golang发出."
-
-	err := csmtp.SendMail(subject, body, toEmail)
+	m, err := mail.Render(name, lang, mail.Sample(name))
 	if err != nil {
 		log.Fatal(err)
+	}
+	m.To = toEmail
+	if dry {
+		fmt.Printf("Subject: %s\n\n%s\n%s", m.Subject, m.Text, m.HTML)
+		return
+	}
+
+	if err = mail.Send(m); err != nil {
+		log.Fatal(err)
 	} else {
 		log.Print("send OK")
 	}
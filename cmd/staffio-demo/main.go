@@ -3,25 +3,37 @@ package main
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 
+	"github.com/liut/staffio/pkg/backends"
 	"github.com/liut/staffio/pkg/settings"
 	"github.com/liut/staffio/pkg/web"
 )
 
 func main() {
 	log.SetFlags(log.Ltime | log.Lshortfile)
-	settings.Parse()
-	ws := web.Default()
-	if strings.HasPrefix(settings.HttpListen, "localhost") {
+	cfg := settings.Current
+	cfg.Backend = "memory"
+	backends.BaseURL = cfg.BaseURL
+
+	ws := web.New(web.Config{
+		Root:    cfg.Root,
+		FS:      "bind",
+		BaseURI: cfg.BaseURL,
+	})
+	defer ws.StartWorkers()()
+	mux := http.NewServeMux()
+	mux.Handle("/", ws)
+	if strings.HasPrefix(cfg.HTTPListen, "localhost") {
 		d := &demo{
-			prefix: "http://" + settings.HttpListen,
+			prefix: "http://" + cfg.HTTPListen,
 		}
-		d.strap(ws)
+		d.strap(mux)
 	}
 
-	fmt.Printf("Start service %s at addr %s\nRoot: %s\n", settings.Version(), settings.HttpListen, settings.Root)
-	err := ws.Run(settings.HttpListen) // Start the server!
+	fmt.Printf("Start service %s at addr %s\nRoot: %s\n", cfg.Version, cfg.HTTPListen, cfg.Root)
+	err := http.ListenAndServe(cfg.HTTPListen, mux) // Start the server!
 	if err != nil {
 		log.Fatal("Run ERR: ", err)
 	}
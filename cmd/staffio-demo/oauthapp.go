@@ -10,7 +10,7 @@ import (
 )
 
 type serverMux interface {
-	HandleFunc(string, http.HandlerFunc)
+	HandleFunc(string, func(http.ResponseWriter, *http.Request))
 }
 
 type demo struct {
@@ -61,7 +61,7 @@ func (d *demo) strap(router serverMux) {
 		// if parse, download and parse json
 		if r.Form.Get("doparse") == "1" {
 			err := DownloadAccessToken(fmt.Sprintf("%s%s", d.prefix, aurl),
-				&osin.BasicAuth{demoId, demoSecret}, jr)
+				&osin.BasicAuth{Username: demoId, Password: demoSecret}, jr)
 			if err != nil {
 				w.Write([]byte(err.Error()))
 				w.Write([]byte("<br/>"))
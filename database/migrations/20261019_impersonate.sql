@@ -0,0 +1,9 @@
+-- after 20261019_audit.sql and 20261019_session.sql
+
+ALTER TABLE login_session
+	ADD COLUMN IF NOT EXISTS actor name NOT NULL DEFAULT '';
+
+ALTER TABLE audit_log
+	ADD COLUMN IF NOT EXISTS impersonator name NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_impersonator ON audit_log (impersonator, created);
@@ -0,0 +1,21 @@
+-- outgoing mails, sent by a worker after the request and retried with backoff
+CREATE TABLE IF NOT EXISTS mail_queue (
+	id serial,
+	uid name NOT NULL DEFAULT '', -- staff mailed to
+	template varchar(40) NOT NULL DEFAULT '',
+	rcpt varchar(120) NOT NULL,
+	subject varchar(250) NOT NULL DEFAULT '',
+	body_text text NOT NULL DEFAULT '',
+	body_html text NOT NULL DEFAULT '',
+	status varchar(10) NOT NULL DEFAULT 'pending', -- pending/sent/dead
+	attempts smallint NOT NULL DEFAULT 0,
+	last_error text NOT NULL DEFAULT '',
+	next_try timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	sent timestamptz,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mail_queue_due ON mail_queue (status, next_try);
+CREATE INDEX IF NOT EXISTS idx_mail_queue_rcpt ON mail_queue (rcpt);
@@ -0,0 +1,18 @@
+-- events of changes for subscribers, added in the transaction of the change,
+-- one row for each subscriber, handled by a worker after commit and retried with backoff
+CREATE TABLE IF NOT EXISTS event_outbox (
+	id serial,
+	topic varchar(40) NOT NULL,
+	subscriber varchar(40) NOT NULL,
+	payload text NOT NULL,
+	status varchar(10) NOT NULL DEFAULT 'pending', -- pending/done/dead
+	attempts smallint NOT NULL DEFAULT 0,
+	last_error text NOT NULL DEFAULT '',
+	next_try timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	handled timestamptz,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_outbox_due ON event_outbox (status, next_try);
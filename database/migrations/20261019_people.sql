@@ -0,0 +1,47 @@
+-- people and groups for the sql backend (STAFFIO_BACKEND=sql)
+CREATE TABLE IF NOT EXISTS staff (
+	id serial,
+	uid varchar(64) NOT NULL,
+	cn varchar(64) NOT NULL DEFAULT '',
+	gn varchar(64) NOT NULL DEFAULT '',
+	sn varchar(64) NOT NULL DEFAULT '',
+	nickname varchar(64) NOT NULL DEFAULT '',
+	birthday varchar(20) NOT NULL DEFAULT '',
+	gender varchar(1) NOT NULL DEFAULT '',
+	email varchar(128) NOT NULL DEFAULT '',
+	mobile varchar(32) NOT NULL DEFAULT '',
+	tel varchar(32) NOT NULL DEFAULT '',
+	eid int NOT NULL DEFAULT 0,
+	etype varchar(64) NOT NULL DEFAULT '',
+	avatar_path varchar(255) NOT NULL DEFAULT '',
+	jpeg_photo bytea,
+	description text NOT NULL DEFAULT '',
+	join_date varchar(20) NOT NULL DEFAULT '',
+	idcn varchar(32) NOT NULL DEFAULT '',
+	password_hash varchar(255) NOT NULL DEFAULT '',
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (uid),
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_staff_email ON staff (email);
+CREATE INDEX IF NOT EXISTS idx_staff_mobile ON staff (mobile);
+
+CREATE TABLE IF NOT EXISTS staff_group (
+	id serial,
+	name varchar(64) NOT NULL,
+	description varchar(255) NOT NULL DEFAULT '',
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (name),
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS staff_group_member (
+	group_name varchar(64) NOT NULL,
+	uid varchar(64) NOT NULL,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (group_name, uid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_staff_group_member_uid ON staff_group_member (uid);
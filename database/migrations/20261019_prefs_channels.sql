@@ -0,0 +1,2 @@
+-- channels of notifications to staff, email if none
+ALTER TABLE staff_pref ADD COLUMN IF NOT EXISTS channels jsonb NOT NULL DEFAULT '[]';
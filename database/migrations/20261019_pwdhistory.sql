@@ -0,0 +1,10 @@
+-- used passwords of staff, the newest is the current one
+CREATE TABLE IF NOT EXISTS password_history (
+	id serial,
+	uid varchar(64) NOT NULL,
+	hash varchar(255) NOT NULL,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_uid ON password_history (uid, created);
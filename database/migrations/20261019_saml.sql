@@ -0,0 +1,13 @@
+-- SAML 2.0 service providers
+CREATE TABLE IF NOT EXISTS saml_service_provider (
+	id serial,
+	entity_id varchar(255) NOT NULL,
+	name varchar(120) NOT NULL DEFAULT '',
+	acs_url varchar(255) NOT NULL,
+	nameid_format varchar(120) NOT NULL DEFAULT '',
+	metadata text NOT NULL DEFAULT '',
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (entity_id),
+	PRIMARY KEY (id)
+);
@@ -0,0 +1,11 @@
+-- failed logins of accounts (uid:name) and addresses (ip:addr)
+CREATE TABLE IF NOT EXISTS login_attempt (
+	key varchar(128) NOT NULL,
+	failures int NOT NULL DEFAULT 1,
+	first_failed timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_failed timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	locked_until timestamptz,
+	PRIMARY KEY (key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempt_last ON login_attempt (last_failed);
@@ -0,0 +1,18 @@
+-- TOTP two-factor authentication
+CREATE TABLE IF NOT EXISTS staff_totp (
+	uid varchar(64) NOT NULL,
+	secret varchar(64) NOT NULL,
+	recovery text[] NOT NULL DEFAULT '{}',
+	last_counter bigint NOT NULL DEFAULT 0,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz,
+	PRIMARY KEY (uid)
+);
+
+-- groups whose members must use TOTP, one row only
+CREATE TABLE IF NOT EXISTS staff_totp_policy (
+	id smallint NOT NULL DEFAULT 1 CHECK (id = 1),
+	groups text[] NOT NULL DEFAULT '{}',
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
@@ -0,0 +1,15 @@
+ALTER TABLE password_reset
+	ADD COLUMN IF NOT EXISTS attempts smallint NOT NULL DEFAULT 0;
+
+ALTER TABLE password_reset
+	ADD COLUMN IF NOT EXISTS purpose varchar(20) NOT NULL DEFAULT 'password',
+	DROP CONSTRAINT IF EXISTS password_reset_type_id_target_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS password_reset_uid_purpose_key ON password_reset (uid, purpose);
+
+CREATE TABLE IF NOT EXISTS login_link_policy (
+	id smallint NOT NULL DEFAULT 1 CHECK (id = 1),
+	groups text[] NOT NULL DEFAULT '{}',
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
@@ -0,0 +1,11 @@
+-- codes are kept as HMAC-SHA256 in hex, and used once
+ALTER TABLE password_reset
+	ADD COLUMN IF NOT EXISTS consumed timestamptz;
+
+ALTER TABLE password_reset
+	ALTER COLUMN code_hash DROP DEFAULT,
+	ALTER COLUMN code_hash TYPE varchar(64) USING code_hash::text,
+	ALTER COLUMN code_hash SET DEFAULT '';
+
+-- old rows in crc32 can not be checked any more, they are kept as used, ask for new codes or links
+UPDATE password_reset SET consumed = CURRENT_TIMESTAMP WHERE consumed IS NULL AND length(code_hash) < 64;
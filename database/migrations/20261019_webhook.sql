@@ -0,0 +1,32 @@
+-- endpoints of outbound webhooks, all events if events is empty
+CREATE TABLE IF NOT EXISTS webhook_endpoint (
+	id serial,
+	url varchar(250) NOT NULL,
+	secret varchar(64) NOT NULL, -- key of HMAC-SHA256 signatures
+	events jsonb NOT NULL DEFAULT '[]',
+	description varchar(120) NOT NULL DEFAULT '',
+	active boolean NOT NULL DEFAULT true,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+-- deliveries of events, posted by a worker and retried with backoff
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+	id serial,
+	endpoint_id int NOT NULL REFERENCES webhook_endpoint(id) ON DELETE CASCADE,
+	event varchar(40) NOT NULL,
+	payload text NOT NULL,
+	status varchar(10) NOT NULL DEFAULT 'pending', -- pending/done/dead
+	attempts smallint NOT NULL DEFAULT 0,
+	code smallint NOT NULL DEFAULT 0, -- http status of the last attempt
+	last_error text NOT NULL DEFAULT '',
+	next_try timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	delivered timestamptz,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due ON webhook_delivery (status, next_try);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_endpoint ON webhook_delivery (endpoint_id, id);
@@ -82,18 +82,29 @@ CREATE TABLE IF NOT EXISTS password_reset (
 	id serial,
 	uid name NOT NULL , -- uid
 	type_id smallint NOT NULL, -- 2=email/3=phone
+	purpose varchar(20) NOT NULL DEFAULT 'password', -- password/mobile/email/login
 	target varchar(50) NOT NULL , -- phone_number/email_address
-	code_hash bigint NOT NULL DEFAULT 0, -- value in crc64
+	code_hash varchar(64) NOT NULL DEFAULT '', -- hmac-sha256 in hex
 	life_seconds int NOT NULL DEFAULT 3600,
+	attempts smallint NOT NULL DEFAULT 0, -- tries of codes
+	consumed timestamptz, -- used once
 	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	UNIQUE (type_id, target),
+	UNIQUE (uid, purpose),
 	PRIMARY KEY (id)
 ) WITH (OIDS=FALSE);
 
 CREATE INDEX IF NOT EXISTS idx_password_reset_uid ON password_reset (uid, created);
 CREATE INDEX IF NOT EXISTS idx_password_reset_created ON password_reset (created);
 
+-- groups whose members may sign in with an email link, one row only
+CREATE TABLE IF NOT EXISTS login_link_policy (
+	id smallint NOT NULL DEFAULT 1 CHECK (id = 1),
+	groups text[] NOT NULL DEFAULT '{}',
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
 
 CREATE TABLE IF NOT EXISTS user_log (
 	id serial,
@@ -0,0 +1,19 @@
+
+-- security events, who did what to whom from where
+CREATE TABLE IF NOT EXISTS audit_log (
+	id serial,
+	action varchar(40) NOT NULL,
+	actor name NOT NULL DEFAULT '', -- uid, or the name tried by a failed login
+	target varchar(255) NOT NULL DEFAULT '',
+	ip varchar(64) NOT NULL DEFAULT '',
+	user_agent varchar(255) NOT NULL DEFAULT '',
+	detail text NOT NULL DEFAULT '',
+	impersonator name NOT NULL DEFAULT '', -- keeper signed in as actor
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor, created);
+CREATE INDEX IF NOT EXISTS idx_audit_log_impersonator ON audit_log (impersonator, created);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target, created);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log (created);
@@ -0,0 +1,26 @@
+
+-- events received from third parties like Lark, once for each event id, kept for replay
+CREATE TABLE IF NOT EXISTS inbox_event (
+	id serial,
+	source varchar(20) NOT NULL,
+	event_id varchar(64) NOT NULL,
+	type varchar(60) NOT NULL DEFAULT '',
+	payload text NOT NULL,
+	status varchar(10) NOT NULL DEFAULT 'received', -- received/applied/ignored/failed
+	attempts smallint NOT NULL DEFAULT 0,
+	last_error text NOT NULL DEFAULT '',
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id),
+	UNIQUE (source, event_id)
+);
+
+-- ids of third parties linked to uid of staff or id of team
+CREATE TABLE IF NOT EXISTS inbox_link (
+	source varchar(20) NOT NULL,
+	kind varchar(20) NOT NULL, -- user/department
+	ext_id varchar(64) NOT NULL,
+	local varchar(64) NOT NULL,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (source, kind, ext_id)
+);
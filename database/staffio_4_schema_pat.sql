@@ -0,0 +1,16 @@
+
+-- personal access tokens, only the hash of a token is kept
+CREATE TABLE IF NOT EXISTS personal_token (
+	id serial,
+	uid name NOT NULL,
+	name varchar(64) NOT NULL DEFAULT '',
+	hash varchar(64) NOT NULL, -- sha256 hex
+	scopes text[] NOT NULL DEFAULT '{}',
+	expires timestamptz NOT NULL,
+	last_used timestamptz,
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (hash),
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_token_uid ON personal_token (uid);
@@ -0,0 +1,9 @@
+
+-- preferences of staff, empty for the defaults of site
+CREATE TABLE IF NOT EXISTS staff_pref (
+	uid name NOT NULL,
+	lang varchar(10) NOT NULL DEFAULT '', -- of mails: en/zh-CN
+	channels jsonb NOT NULL DEFAULT '[]', -- of notifications: email/wxwork/lark/webhook/file
+	updated timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (uid)
+);
@@ -0,0 +1,15 @@
+
+-- server-side login sessions, id is the hash of the token in cookie
+CREATE TABLE IF NOT EXISTS login_session (
+	id varchar(64) NOT NULL,
+	uid name NOT NULL,
+	user_agent varchar(255) NOT NULL DEFAULT '',
+	ip varchar(64) NOT NULL DEFAULT '',
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_seen timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	actor name NOT NULL DEFAULT '', -- keeper signed in as uid
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_session_uid ON login_session (uid, last_seen);
+CREATE INDEX IF NOT EXISTS idx_login_session_last_seen ON login_session (last_seen);
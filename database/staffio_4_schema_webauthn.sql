@@ -0,0 +1,15 @@
+
+-- WebAuthn credentials (security keys and passkeys)
+CREATE TABLE IF NOT EXISTS staff_webauthn (
+	id varchar(255) NOT NULL, -- credential id, base64url
+	uid varchar(64) NOT NULL,
+	name varchar(64) NOT NULL DEFAULT '',
+	public_key bytea NOT NULL, -- COSE key
+	sign_count bigint NOT NULL DEFAULT 0,
+	aaguid varchar(36) NOT NULL DEFAULT '',
+	created timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used timestamptz,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_staff_webauthn_uid ON staff_webauthn (uid);
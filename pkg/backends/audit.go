@@ -0,0 +1,38 @@
+package backends
+
+import (
+	"github.com/liut/staffio/pkg/models/audit"
+)
+
+var _ audit.Store = (*auditStore)(nil)
+
+type auditStore struct{}
+
+func (s *auditStore) Add(e *audit.Event) error {
+	return withTxQuery(func(db dbTxer) error {
+		return db.QueryRow(`INSERT INTO audit_log(action, actor, target, ip, user_agent, detail, impersonator)
+		 VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id, created`,
+			e.Action, e.Actor, e.Target, e.IP, e.UserAgent, e.Detail, e.Impersonator).Scan(&e.ID, &e.Created)
+	})
+}
+
+func (s *auditStore) Query(spec *audit.Spec) (data []audit.Event, err error) {
+	w := new(sqlWhere)
+	if spec.Action != "" {
+		w.add("(action = $%d OR action LIKE $%d)", spec.Action, spec.Action+".%")
+	}
+	if spec.Actor != "" {
+		w.add("(actor = $%d OR impersonator = $%[1]d)", spec.Actor)
+	}
+	w.eq("target", spec.Target)
+	w.eq("ip", spec.IP)
+	if !spec.Since.IsZero() {
+		w.add("created >= $%d", spec.Since)
+	}
+	if end := spec.End(); !end.IsZero() {
+		w.add("created < $%d", end)
+	}
+	err = queryPage(&data, "audit_log", "id, action, actor, target, ip, user_agent, detail, impersonator, created",
+		w, &spec.Pager)
+	return
+}
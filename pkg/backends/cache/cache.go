@@ -0,0 +1,113 @@
+// Package cache is a small LRU cache with expiration for lookups of backends
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats of a cache
+type Stats struct {
+	Hits      uint64 `json:"hits"`      // number of times a live entry was found
+	Misses    uint64 `json:"misses"`    // number of times no entry or an expired one was found
+	Evictions uint64 `json:"evictions"` // number of entries removed for the size bound
+	Entries   int    `json:"entries"`   // number of entries currently in the cache
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// Cache holds at most size entries for ttl, it is safe for concurrent use
+type Cache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	stats Stats
+
+	now func() time.Time
+}
+
+// New returns a cache, size < 1 means no size bound
+func New(ttl time.Duration, size int) *Cache {
+	return &Cache{
+		ttl:   ttl,
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Get returns the value of key if it is not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		if c.now().Before(e.expires) {
+			c.ll.MoveToFront(el)
+			c.stats.Hits++
+			return e.value, true
+		}
+		c.removeElement(el)
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+// Set adds or replaces the value of key, the least recently used entry is evicted when full
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, value: value, expires: expires})
+	for c.size > 0 && c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Delete removes the entries of keys
+func (c *Cache) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.removeElement(el)
+		}
+	}
+}
+
+// Purge removes all entries
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Stats returns a snapshot of counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Entries = c.ll.Len()
+	return st
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiration(t *testing.T) {
+	now := time.Now()
+	c := New(time.Minute, 0)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+
+	st := c.Stats()
+	assert.Equal(t, uint64(1), st.Hits)
+	assert.Equal(t, uint64(1), st.Misses)
+	assert.Equal(t, 0, st.Entries)
+}
+
+func TestSizeBound(t *testing.T) {
+	c := New(time.Minute, 2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a") // b is the least recently used now
+	c.Set("c", 3)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+
+	st := c.Stats()
+	assert.Equal(t, uint64(1), st.Evictions)
+	assert.Equal(t, 2, st.Entries)
+}
+
+func TestDeleteAndPurge(t *testing.T) {
+	c := New(time.Minute, 10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 3)
+	v, _ := c.Get("a")
+	assert.Equal(t, 3, v)
+
+	c.Delete("a", "none")
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Purge()
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Stats().Entries)
+}
@@ -0,0 +1,173 @@
+package backends
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/backends/cache"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/group"
+)
+
+// CacheStats of people, groups and membership lookups
+type CacheStats struct {
+	People  cache.Stats `json:"people"`
+	Groups  cache.Stats `json:"groups"`
+	Members cache.Stats `json:"members"`
+}
+
+const allPeopleKey = "*"
+
+// cachedService caches lookups of people, groups and membership in front of a Servicer
+type cachedService struct {
+	Servicer
+	people  *cache.Cache
+	groups  *cache.Cache
+	members *cache.Cache
+}
+
+var _ Servicer = (*cachedService)(nil)
+
+// NewCachedService returns a Servicer caching lookups of svc for ttl, every cache holds size entries at most
+func NewCachedService(svc Servicer, ttl time.Duration, size int) Servicer {
+	return &cachedService{
+		Servicer: svc,
+		people:   cache.New(ttl, size),
+		groups:   cache.New(ttl, size),
+		members:  cache.New(ttl, size),
+	}
+}
+
+// All returns the cached directory when spec is nil
+func (s *cachedService) All(spec *Spec) models.Staffs {
+	if spec != nil {
+		return s.Servicer.All(spec)
+	}
+	if v, ok := s.people.Get(allPeopleKey); ok {
+		return append(models.Staffs{}, v.(models.Staffs)...)
+	}
+	data := s.Servicer.All(nil)
+	s.people.Set(allPeopleKey, data)
+	return append(models.Staffs{}, data...)
+}
+
+func (s *cachedService) Get(uid string) (*models.Staff, error) {
+	if v, ok := s.people.Get(uid); ok {
+		staff := v.(models.Staff)
+		return &staff, nil
+	}
+	staff, err := s.Servicer.Get(uid)
+	if err != nil {
+		return nil, err
+	}
+	s.people.Set(uid, *staff)
+	return staff, nil
+}
+
+func (s *cachedService) GetGroup(name string) (*Group, error) {
+	if v, ok := s.groups.Get(name); ok {
+		g := v.(Group)
+		g.Members = append([]string{}, g.Members...)
+		return &g, nil
+	}
+	g, err := s.Servicer.GetGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	obj := *g
+	obj.Members = append([]string{}, g.Members...)
+	s.groups.Set(name, obj)
+	return g, nil
+}
+
+func (s *cachedService) InGroup(gn, uid string) bool {
+	key := gn + "\x00" + uid
+	if v, ok := s.members.Get(key); ok {
+		return v.(bool)
+	}
+	ok := group.Has(gn, uid, s.GetGroup)
+	s.members.Set(key, ok)
+	return ok
+}
+
+func (s *cachedService) InGroupAny(uid string, names ...string) bool {
+	for _, gn := range names {
+		if s.InGroup(gn, uid) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *cachedService) Save(staff *models.Staff) (isNew bool, err error) {
+	isNew, err = s.Servicer.Save(staff)
+	s.forgetPeople(staff.UID)
+	return
+}
+
+func (s *cachedService) SaveStaff(staff *models.Staff) error {
+	err := s.Servicer.SaveStaff(staff)
+	s.forgetPeople(staff.UID)
+	return err
+}
+
+func (s *cachedService) Delete(uid string) error {
+	err := s.Servicer.Delete(uid)
+	s.forgetPeople(uid)
+	s.members.Purge()
+	return err
+}
+
+func (s *cachedService) ModifyBySelf(uid, password string, staff *models.Staff) error {
+	err := s.Servicer.ModifyBySelf(uid, password, staff)
+	s.forgetPeople(uid)
+	return err
+}
+
+func (s *cachedService) MobileVerifyConfirm(uid, code string) (string, error) {
+	mobile, err := s.Servicer.MobileVerifyConfirm(uid, code)
+	s.forgetPeople(uid)
+	return mobile, err
+}
+
+func (s *cachedService) EmailChangeConfirm(token string) (uid, email string, err error) {
+	uid, email, err = s.Servicer.EmailChangeConfirm(token)
+	if uid != "" {
+		s.forgetPeople(uid)
+	}
+	return
+}
+
+func (s *cachedService) ProfileModify(uid, password string, staff *models.Staff) error {
+	err := s.Servicer.ProfileModify(uid, password, staff)
+	s.forgetPeople(uid)
+	return err
+}
+
+func (s *cachedService) SaveGroup(group *Group) error {
+	err := s.Servicer.SaveGroup(group)
+	s.forgetGroup(group.Name)
+	return err
+}
+
+func (s *cachedService) EraseGroup(name string) error {
+	err := s.Servicer.EraseGroup(name)
+	s.forgetGroup(name)
+	return err
+}
+
+func (s *cachedService) forgetPeople(uid string) {
+	s.people.Delete(uid, allPeopleKey)
+}
+
+func (s *cachedService) forgetGroup(name string) {
+	s.groups.Delete(name)
+	s.members.Purge()
+}
+
+func (s *cachedService) CacheStats() *CacheStats {
+	return &CacheStats{
+		People:  s.people.Stats(),
+		Groups:  s.groups.Stats(),
+		Members: s.members.Stats(),
+	}
+}
@@ -4,13 +4,23 @@ import (
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/liut/staffio/pkg/models/inbox"
+	"github.com/liut/staffio/pkg/models/mailq"
+	"github.com/liut/staffio/pkg/models/outbox"
+	"github.com/liut/staffio/pkg/models/webhook"
 )
 
 const (
 	authorizationExpiration = 60 * 15
 	accessExpiration        = 60 * 60 * 24
-	passwordExpiration      = 60 * 120
 	sessionExpiration       = 60 * 30
+	attemptExpiration       = 60 * 60 * 24
+	loginIdleExpiration     = 60 * 60 * 24
+	mailSentExpiration      = 60 * 60 * 24 * 30
+	hookDoneExpiration      = 60 * 60 * 24 * 30
+	eventDoneExpiration     = 60 * 60 * 24 * 30
+	inboxDoneExpiration     = 60 * 60 * 24 * 30 // long after the retries of lark
 )
 
 // Cleanup 清理过期的数据
@@ -25,14 +35,67 @@ func Cleanup() (err error) {
 	if err != nil {
 		return
 	}
-	err = deleteWithEnd("password_reset", "created", now.Add(-time.Second*passwordExpiration))
+	err = withDbQuery(func(db dber) error {
+		_, err := db.Exec(`DELETE FROM password_reset WHERE updated < $1 - life_seconds * interval '1 second'`, now)
+		return err
+	})
 	if err != nil {
+		log.Printf("clean %q ERR %s", "password_reset", err)
 		return
 	}
 	err = deleteWithEnd("http_sessions", "expires_on", now.Add(-time.Second*sessionExpiration))
 	if err != nil {
 		return
 	}
+	err = deleteWithEnd("login_session", "last_seen", now.Add(-time.Second*loginIdleExpiration))
+	if err != nil {
+		return
+	}
+	err = withDbQuery(func(db dber) error {
+		_, err := db.Exec(`DELETE FROM login_attempt WHERE last_failed < $1
+		 AND (locked_until IS NULL OR locked_until < $2)`, now.Add(-time.Second*attemptExpiration), now)
+		return err
+	})
+	if err != nil {
+		log.Printf("clean %q ERR %s", "login_attempt", err)
+		return
+	}
+	err = withDbQuery(func(db dber) error {
+		_, err := db.Exec(`DELETE FROM mail_queue WHERE status = $1 AND sent < $2`,
+			mailq.StatusSent, now.Add(-time.Second*mailSentExpiration))
+		return err
+	})
+	if err != nil {
+		log.Printf("clean %q ERR %s", "mail_queue", err)
+		return
+	}
+	err = withDbQuery(func(db dber) error {
+		_, err := db.Exec(`DELETE FROM webhook_delivery WHERE status = $1 AND delivered < $2`,
+			webhook.StatusDone, now.Add(-time.Second*hookDoneExpiration))
+		return err
+	})
+	if err != nil {
+		log.Printf("clean %q ERR %s", "webhook_delivery", err)
+		return
+	}
+	err = withDbQuery(func(db dber) error {
+		_, err := db.Exec(`DELETE FROM event_outbox WHERE status = $1 AND handled < $2`,
+			outbox.StatusDone, now.Add(-time.Second*eventDoneExpiration))
+		return err
+	})
+	if err != nil {
+		log.Printf("clean %q ERR %s", "event_outbox", err)
+		return
+	}
+	err = withDbQuery(func(db dber) error {
+		_, err := db.Exec(`DELETE FROM inbox_event WHERE status IN ($1, $2) AND updated < $3`,
+			inbox.StatusApplied, inbox.StatusIgnored, now.Add(-time.Second*inboxDoneExpiration))
+		return err
+	})
+	if err != nil {
+		log.Printf("clean %q ERR %s", "inbox_event", err)
+		return
+	}
 	return
 }
 
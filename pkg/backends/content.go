@@ -8,6 +8,9 @@ import (
 )
 
 func LoadArticle(id int) (*content.Article, error) {
+	if memContent != nil {
+		return memContent.loadArticle(id)
+	}
 	a := new(content.Article)
 
 	qs := func(db dber) error {
@@ -28,6 +31,9 @@ func LoadArticles(limit, offset int) (data []*content.Article, err error) {
 	if offset < 0 {
 		offset = 0
 	}
+	if memContent != nil {
+		return memContent.loadArticles(limit, offset), nil
+	}
 
 	str := `SELECT id, title, content, author, created
 	   FROM articles ORDER BY created DESC`
@@ -53,6 +59,9 @@ func LoadLinks(limit, offset int) (data []*content.Link, err error) {
 	if offset < 0 {
 		offset = 0
 	}
+	if memContent != nil {
+		return memContent.loadLinks(limit, offset), nil
+	}
 
 	str := `SELECT * FROM links ORDER BY position`
 
@@ -71,6 +80,9 @@ func LoadLinks(limit, offset int) (data []*content.Link, err error) {
 }
 
 func SaveArticle(a *content.Article) error {
+	if memContent != nil {
+		return memContent.saveArticle(a)
+	}
 	qs := func(db dbTxer) error {
 		log.Printf("save %d", a.Id)
 		if a.Id > 0 {
@@ -94,6 +106,9 @@ func SaveArticle(a *content.Article) error {
 }
 
 func LoadLink(id int) (*content.Link, error) {
+	if memContent != nil {
+		return memContent.loadLink(id)
+	}
 	link := new(content.Link)
 	qs := func(db dber) (err error) {
 		err = db.Get(link, "SELECT * FROM links WHERE id = $1", id)
@@ -107,6 +122,9 @@ func LoadLink(id int) (*content.Link, error) {
 }
 
 func SaveLink(l *content.Link) error {
+	if memContent != nil {
+		return memContent.saveLink(l)
+	}
 	qs := func(db dbTxer) (err error) {
 		if l.Id > 0 {
 			_, err = db.Exec("UPDATE links SET title = $1, url = $2, position = $3 WHERE id = $4", l.Title, string(l.Url), l.Position, l.Id)
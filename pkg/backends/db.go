@@ -3,10 +3,15 @@ package backends
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	_ "github.com/lib/pq"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/liut/staffio/pkg/models/queue"
 )
 
 var (
@@ -117,6 +122,84 @@ func withTxQuery(query func(tx dbTxer) error) error {
 	return nil
 }
 
+// withTxExec runs a statement in a transaction, ErrNotFound if no row is affected,
+// it is decided after the transaction because withTxQuery returns dbError for any error
+func withTxExec(query string, args ...interface{}) error {
+	var affected int64
+	err := withTxQuery(func(db dbTxer) error {
+		rs, err := db.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		affected, _ = rs.RowsAffected()
+		return nil
+	})
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// claimJobs leases at most limit due jobs of the queue table to a worker, see queue.Job,
+// they are skipped by other workers until the lease ends
+func claimJobs(dest interface{}, table, columns, order string, now time.Time, lease time.Duration, limit int) error {
+	return withTxQuery(func(db dbTxer) error {
+		return db.Select(dest, `UPDATE `+table+` SET next_try = $2, updated = CURRENT_TIMESTAMP
+		 WHERE id IN (SELECT id FROM `+table+` WHERE status = $3 AND next_try <= $1
+		 ORDER BY `+order+` LIMIT $4 FOR UPDATE SKIP LOCKED)
+		 RETURNING `+columns, now, now.Add(lease), queue.StatusPending, limit)
+	})
+}
+
+// resetJob makes the job id of the queue table pending again with attempts cleared,
+// cleared is the assignments of its own result columns
+func resetJob(table, cleared string, id int) error {
+	return withTxExec(`UPDATE `+table+` SET status = $2, attempts = 0, last_error = '', next_try = CURRENT_TIMESTAMP,
+	 `+cleared+`, updated = CURRENT_TIMESTAMP WHERE id = $1`, id, queue.StatusPending)
+}
+
+// sqlWhere builds the conditions of a query, the args are numbered in order
+type sqlWhere struct {
+	conds []string
+	args  []interface{}
+}
+
+// add appends cond with args, each $%d of cond is numbered by its arg, $%[1]d repeats the first
+func (w *sqlWhere) add(cond string, args ...interface{}) {
+	nums := make([]interface{}, len(args))
+	for i := range args {
+		nums[i] = len(w.args) + i + 1
+	}
+	w.args = append(w.args, args...)
+	w.conds = append(w.conds, fmt.Sprintf(cond, nums...))
+}
+
+// eq appends col = v if v is not empty
+func (w *sqlWhere) eq(col, v string) {
+	if v != "" {
+		w.add(col+" = $%d", v)
+	}
+}
+
+func (w *sqlWhere) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// queryPage selects a page of the rows of table matching w, newer first, and counts them all to page.Total
+func queryPage(dest interface{}, table, columns string, w *sqlWhere, page *queue.Pager) error {
+	offset := page.Offset()
+	return withDbQuery(func(db dber) error {
+		if err := db.Get(&page.Total, "SELECT COUNT(id) FROM "+table+w.String(), w.args...); err != nil {
+			return err
+		}
+		return db.Select(dest, fmt.Sprintf(`SELECT %s FROM %s%s ORDER BY id DESC LIMIT %d OFFSET %d`,
+			columns, table, w, page.Limit, offset), w.args...)
+	})
+}
+
 func inArray(k string, fields []string) bool {
 	for _, sf := range fields {
 		if k == sf {
@@ -0,0 +1,19 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLWhere(t *testing.T) {
+	w := new(sqlWhere)
+	assert.Equal(t, "", w.String())
+	w.eq("status", "")
+	w.eq("status", "dead")
+	w.add("(actor = $%d OR impersonator = $%[1]d)", "eagle")
+	w.add("(action = $%d OR action LIKE $%d)", "login", "login.%")
+	assert.Equal(t, " WHERE status = $1 AND (actor = $2 OR impersonator = $2) AND (action = $3 OR action LIKE $4)",
+		w.String())
+	assert.Equal(t, []interface{}{"dead", "eagle", "login", "login.%"}, w.args)
+}
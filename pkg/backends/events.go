@@ -0,0 +1,457 @@
+package backends
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liut/staffio-backend/schema"
+	"github.com/liut/staffio/pkg/backends/mail"
+	"github.com/liut/staffio/pkg/backends/notify"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/outbox"
+	"github.com/liut/staffio/pkg/models/team"
+)
+
+// topics of events
+const (
+	TopicStaffCreated          = "staff.created"
+	TopicStaffUpdated          = "staff.updated"
+	TopicStaffDeleted          = "staff.deleted"
+	TopicTeamSaved             = "team.saved"
+	TopicTeamDeleted           = "team.deleted"
+	TopicTeamMembersChanged    = "team.members"
+	TopicGroupChanged          = "group.changed"
+	TopicPasswordChanged       = "password.changed"
+	TopicWeeklyReportSubmitted = "weekly.submitted"
+	TopicNoteQueued            = "note.queued"
+)
+
+// Event is a change of the directory, published to subscribers of its topic
+type Event interface {
+	Topic() string
+}
+
+// EventStaff is a staff in events and payloads of webhooks, without private fields like idcn and birthday,
+// subscribers get others by UID
+type EventStaff struct {
+	UID            string `json:"uid"`
+	CommonName     string `json:"cn"`
+	GivenName      string `json:"gn"`
+	Surname        string `json:"sn"`
+	Nickname       string `json:"nickname,omitempty"`
+	Email          string `json:"email"`
+	Mobile         string `json:"mobile"`
+	EmployeeNumber int    `json:"eid,omitempty"`
+	EmployeeType   string `json:"etype,omitempty"`
+	JoinDate       string `json:"joinDate,omitempty"`
+}
+
+func newEventStaff(staff *models.Staff) EventStaff {
+	return EventStaff{
+		UID:            staff.UID,
+		CommonName:     staff.GetCommonName(),
+		GivenName:      staff.GivenName,
+		Surname:        staff.Surname,
+		Nickname:       staff.Nickname,
+		Email:          staff.Email,
+		Mobile:         staff.Mobile,
+		EmployeeNumber: staff.EmployeeNumber,
+		EmployeeType:   staff.EmployeeType,
+		JoinDate:       staff.JoinDate,
+	}
+}
+
+// StaffCreated is published when a staff is saved the first time
+type StaffCreated struct {
+	Staff EventStaff `json:"staff"`
+}
+
+// StaffUpdated is published when a staff is changed by keepers or by self
+type StaffUpdated struct {
+	Staff EventStaff `json:"staff"`
+}
+
+// StaffDeleted is published when a staff is deleted
+type StaffDeleted struct {
+	UID string `json:"uid"`
+}
+
+// TeamSaved is published when a team or its managers are changed
+type TeamSaved struct {
+	Team team.Team `json:"team"`
+}
+
+// TeamDeleted is published when a team is deleted
+type TeamDeleted struct {
+	ID int `json:"id"`
+}
+
+// TeamMembersChanged is published when members are added to or removed from a team
+type TeamMembersChanged struct {
+	TeamID  int      `json:"teamID"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// GroupChanged is published when a group is saved or erased, Group is nil if erased
+type GroupChanged struct {
+	Name  string `json:"name"`
+	Group *Group `json:"group,omitempty"`
+}
+
+// PasswordChanged is published when a password is changed by self or reset
+type PasswordChanged struct {
+	UID   string `json:"uid"`
+	Reset bool   `json:"reset,omitempty"`
+}
+
+// WeeklyReportSubmitted is published when a staff adds or rewrites the report of this week
+type WeeklyReportSubmitted struct {
+	ReportID int    `json:"reportID"`
+	UID      string `json:"uid"`
+	Year     int    `json:"year"`
+	Week     int    `json:"week"`
+}
+
+// NoteQueued is published to send a note on a channel of chat or webhook after the request,
+// it is retried like mails, see queuedChannel
+type NoteQueued struct {
+	Channel string      `json:"channel"`
+	Note    notify.Note `json:"note"`
+}
+
+// Topic ...
+func (*StaffCreated) Topic() string { return TopicStaffCreated }
+
+// Topic ...
+func (*StaffUpdated) Topic() string { return TopicStaffUpdated }
+
+// Topic ...
+func (*StaffDeleted) Topic() string { return TopicStaffDeleted }
+
+// Topic ...
+func (*TeamSaved) Topic() string { return TopicTeamSaved }
+
+// Topic ...
+func (*TeamDeleted) Topic() string { return TopicTeamDeleted }
+
+// Topic ...
+func (*TeamMembersChanged) Topic() string { return TopicTeamMembersChanged }
+
+// Topic ...
+func (*GroupChanged) Topic() string { return TopicGroupChanged }
+
+// Topic ...
+func (*PasswordChanged) Topic() string { return TopicPasswordChanged }
+
+// Topic ...
+func (*WeeklyReportSubmitted) Topic() string { return TopicWeeklyReportSubmitted }
+
+// Topic ...
+func (*NoteQueued) Topic() string { return TopicNoteQueued }
+
+// eventTypes makes an empty event of topic to decode a message
+var eventTypes = map[string]func() Event{
+	TopicStaffCreated:          func() Event { return new(StaffCreated) },
+	TopicStaffUpdated:          func() Event { return new(StaffUpdated) },
+	TopicStaffDeleted:          func() Event { return new(StaffDeleted) },
+	TopicTeamSaved:             func() Event { return new(TeamSaved) },
+	TopicTeamDeleted:           func() Event { return new(TeamDeleted) },
+	TopicTeamMembersChanged:    func() Event { return new(TeamMembersChanged) },
+	TopicGroupChanged:          func() Event { return new(GroupChanged) },
+	TopicPasswordChanged:       func() Event { return new(PasswordChanged) },
+	TopicWeeklyReportSubmitted: func() Event { return new(WeeklyReportSubmitted) },
+	TopicNoteQueued:            func() Event { return new(NoteQueued) },
+}
+
+// Topics returns all topics
+func Topics() []string {
+	topics := make([]string, 0, len(eventTypes))
+	for topic := range eventTypes {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Handler handles an event for a subscriber, an error makes it tried again later
+type Handler func(svc Servicer, ev Event) error
+
+type subscriber struct {
+	topics []string
+	handle Handler
+}
+
+var (
+	subsMu      sync.RWMutex
+	subscribers = make(map[string]*subscriber)
+
+	// eventWake tells the worker an event is published
+	eventWake = make(chan struct{}, 1)
+
+	errNoSubscriber = errors.New("no such subscriber")
+)
+
+const (
+	eventBatch = 50
+	eventLease = 5 * time.Minute
+)
+
+func init() {
+	Subscribe("welcome", sendWelcome, TopicStaffCreated)
+	Subscribe("notes", sendQueuedNote, TopicNoteQueued)
+	Subscribe("webhooks", emitWebhooks, TopicStaffCreated, TopicStaffUpdated, TopicStaffDeleted,
+		TopicTeamSaved, TopicTeamDeleted, TopicTeamMembersChanged, TopicGroupChanged)
+}
+
+// Subscribe lets handle get events of topics after they are committed, name is kept in the outbox,
+// so it must be stable and subscribed before any event is published
+func Subscribe(name string, handle Handler, topics ...string) {
+	subsMu.Lock()
+	defer subsMu.Unlock()
+	subscribers[name] = &subscriber{topics: topics, handle: handle}
+}
+
+// Subscribers returns names of all subscribers
+func Subscribers() []string {
+	subsMu.RLock()
+	defer subsMu.RUnlock()
+	names := make([]string, 0, len(subscribers))
+	for name := range subscribers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// outboxMessages returns a message of ev for every subscriber of its topic
+func outboxMessages(ev Event) ([]outbox.Message, error) {
+	var msgs []outbox.Message
+	subsMu.RLock()
+	for name, sub := range subscribers {
+		for _, topic := range sub.topics {
+			if topic == ev.Topic() {
+				msgs = append(msgs, outbox.Message{Topic: topic, Subscriber: name})
+				break
+			}
+		}
+	}
+	subsMu.RUnlock()
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Subscriber < msgs[j].Subscriber })
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	for i := range msgs {
+		msgs[i].Payload = string(body)
+	}
+	return msgs, nil
+}
+
+// publishTx adds ev to the outbox in the transaction of its change, the worker is woken after commit
+// by afterCommit
+func publishTx(db dber, ev Event) error {
+	msgs, err := outboxMessages(ev)
+	if err != nil || len(msgs) == 0 {
+		return err
+	}
+	return dbOutboxAdd(db, msgs)
+}
+
+// afterCommit wakes the worker if the transaction is committed
+func afterCommit(err error) error {
+	if err == nil {
+		WakeEventWorker()
+	}
+	return err
+}
+
+// publish adds ev to the outbox after a change without transaction, like those of LDAP,
+// errors are logged, callers of changes ignore them, the change is done already
+func publish(ob outbox.Store, ev Event) error {
+	msgs, err := outboxMessages(ev)
+	if err == nil && len(msgs) > 0 {
+		if err = ob.Add(msgs...); err == nil {
+			WakeEventWorker()
+		}
+	}
+	if err != nil {
+		logger().Warnw("publish event fail", "topic", ev.Topic(), "err", err)
+	}
+	return err
+}
+
+// publishStaffOf publishes StaffUpdated with the staff saved
+func publishStaffOf(ps schema.PeopleStore, ob outbox.Store, uid string) {
+	staff, err := ps.Get(uid)
+	if err != nil {
+		logger().Infow("get staff for event fail", "uid", uid, "err", err)
+		return
+	}
+	publish(ob, &StaffUpdated{Staff: newEventStaff(staff)})
+}
+
+// publishedPeople publishes the changes of a people store without transaction, like LDAP,
+// after they are done, the sql store publishes in its transactions
+type publishedPeople struct {
+	peopleStorer
+	ob outbox.Store
+}
+
+// Save publishes StaffCreated or StaffUpdated
+func (s *publishedPeople) Save(staff *schema.People) (isNew bool, err error) {
+	if isNew, err = s.peopleStorer.Save(staff); err == nil {
+		if isNew {
+			publish(s.ob, &StaffCreated{Staff: newEventStaff(staff)})
+		} else {
+			publishStaffOf(s.peopleStorer, s.ob, staff.UID)
+		}
+	}
+	return
+}
+
+func (s *publishedPeople) Delete(uid string) error {
+	err := s.peopleStorer.Delete(uid)
+	if err == nil {
+		publish(s.ob, &StaffDeleted{UID: uid})
+	}
+	return err
+}
+
+func (s *publishedPeople) ModifyBySelf(uid, password string, staff *schema.People) error {
+	err := s.peopleStorer.ModifyBySelf(uid, password, staff)
+	if err == nil {
+		publishStaffOf(s.peopleStorer, s.ob, uid)
+	}
+	return err
+}
+
+func (s *publishedPeople) PasswordChange(uid, oldPassword, newPassword string) error {
+	err := s.peopleStorer.PasswordChange(uid, oldPassword, newPassword)
+	if err == nil {
+		publish(s.ob, &PasswordChanged{UID: uid})
+	}
+	return err
+}
+
+func (s *publishedPeople) PasswordReset(uid, newPassword string) error {
+	err := s.peopleStorer.PasswordReset(uid, newPassword)
+	if err == nil {
+		publish(s.ob, &PasswordChanged{UID: uid, Reset: true})
+	}
+	return err
+}
+
+func (s *publishedPeople) SaveGroup(group *Group) error {
+	err := s.peopleStorer.SaveGroup(group)
+	if err == nil {
+		publish(s.ob, &GroupChanged{Name: group.Name, Group: group})
+	}
+	return err
+}
+
+func (s *publishedPeople) EraseGroup(name string) error {
+	err := s.peopleStorer.EraseGroup(name)
+	if err == nil {
+		publish(s.ob, &GroupChanged{Name: name})
+	}
+	return err
+}
+
+// WakeEventWorker tells the worker to dispatch without waiting for the next poll
+func WakeEventWorker() {
+	select {
+	case eventWake <- struct{}{}:
+	default:
+	}
+}
+
+// DispatchEvents hands the messages due to their subscribers until none is due, returns the count handled,
+// a failed one is tried again later with backoff, and is dead after queue.MaxAttempts
+func DispatchEvents(svc Servicer) (done int, err error) {
+	for {
+		var msgs []outbox.Message
+		msgs, err = svc.Outbox().Claim(time.Now(), eventLease, eventBatch)
+		if err != nil || len(msgs) == 0 {
+			return
+		}
+		for i := range msgs {
+			m := &msgs[i]
+			if e := handleMessage(svc, m); e != nil {
+				m.Failed(e, time.Now())
+				if m.Status == outbox.StatusDead {
+					logger().Warnw("event is dead", "id", m.ID, "topic", m.Topic, "subscriber", m.Subscriber, "err", e)
+				} else {
+					logger().Infow("handle event fail", "id", m.ID, "topic", m.Topic, "subscriber", m.Subscriber,
+						"attempts", m.Attempts, "err", e)
+				}
+			} else {
+				m.Done(time.Now())
+				done++
+			}
+			if err = svc.Outbox().Update(m); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func handleMessage(svc Servicer, m *outbox.Message) (err error) {
+	subsMu.RLock()
+	sub, ok := subscribers[m.Subscriber]
+	subsMu.RUnlock()
+	if !ok {
+		return errNoSubscriber
+	}
+	mk, ok := eventTypes[m.Topic]
+	if !ok {
+		return fmt.Errorf("unknown topic %q", m.Topic)
+	}
+	ev := mk()
+	if err = json.Unmarshal([]byte(m.Payload), ev); err != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber panic: %v", r)
+		}
+	}()
+	return sub.handle(svc, ev)
+}
+
+// StartEventWorker dispatches events once one is published or every workerPoll,
+// stop waits for the dispatching pass
+func StartEventWorker(svc Servicer) (stop func()) {
+	return startWorker("events", eventWake, func() (int, error) {
+		return DispatchEvents(svc)
+	})
+}
+
+// sendWelcome mails a new staff the link to set password, to the email saved now
+func sendWelcome(svc Servicer, ev Event) error {
+	uid := ev.(*StaffCreated).Staff.UID
+	staff, err := svc.Get(uid)
+	if err == ErrStoreNotFound {
+		logger().Infow("welcome is not sent", "uid", uid, "err", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = passwordLinkSend(svc, staff, mail.Welcome)
+	switch err {
+	case nil:
+		logger().Infow("welcome sent", "uid", staff.UID)
+	case ErrMailNotReady, ErrEmptyEmail:
+		logger().Infow("welcome is not sent", "uid", staff.UID, "err", err)
+		return nil
+	}
+	return err
+}
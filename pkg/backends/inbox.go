@@ -0,0 +1,83 @@
+package backends
+
+import (
+	"github.com/liut/staffio/pkg/models/inbox"
+)
+
+var _ inbox.Store = (*inboxStore)(nil)
+
+type inboxStore struct{}
+
+const inboxColumns = `id, source, event_id, type, payload, status, attempts, last_error, created, updated`
+
+func (s *inboxStore) Add(e *inbox.Event) (isNew bool, err error) {
+	if e.Status == "" {
+		e.Status = inbox.StatusReceived
+	}
+	err = withTxQuery(func(db dbTxer) error {
+		err := db.QueryRow(`INSERT INTO inbox_event(source, event_id, type, payload, status)
+		 VALUES($1, $2, $3, $4, $5) ON CONFLICT (source, event_id) DO NOTHING RETURNING id, created, updated`,
+			e.Source, e.EventID, e.Type, e.Payload, e.Status).Scan(&e.ID, &e.Created, &e.Updated)
+		if err == nil {
+			isNew = true
+			return nil
+		}
+		if err != ErrNoRows {
+			return err
+		}
+		return db.Get(e, "SELECT "+inboxColumns+" FROM inbox_event WHERE source = $1 AND event_id = $2",
+			e.Source, e.EventID)
+	})
+	return
+}
+
+func (s *inboxStore) Update(e *inbox.Event) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`UPDATE inbox_event SET status = $2, attempts = $3, last_error = $4,
+		 updated = CURRENT_TIMESTAMP WHERE id = $1`, e.ID, e.Status, e.Attempts, e.LastError)
+		return
+	})
+}
+
+func (s *inboxStore) Get(id int) (*inbox.Event, error) {
+	obj := new(inbox.Event)
+	err := withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT "+inboxColumns+" FROM inbox_event WHERE id = $1", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *inboxStore) Query(spec *inbox.Spec) (data []inbox.Event, err error) {
+	w := new(sqlWhere)
+	w.eq("source", spec.Source)
+	w.eq("type", spec.Type)
+	w.eq("status", spec.Status)
+	err = queryPage(&data, "inbox_event", inboxColumns, w, &spec.Pager)
+	return
+}
+
+func (s *inboxStore) Link(source, kind, extID, local string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`INSERT INTO inbox_link(source, kind, ext_id, local) VALUES($1, $2, $3, $4)
+		 ON CONFLICT (source, kind, ext_id) DO UPDATE SET local = EXCLUDED.local`, source, kind, extID, local)
+		return
+	})
+}
+
+func (s *inboxStore) Linked(source, kind, extID string) (local string, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Get(&local, "SELECT local FROM inbox_link WHERE source = $1 AND kind = $2 AND ext_id = $3",
+			source, kind, extID)
+	})
+	return
+}
+
+func (s *inboxStore) Unlink(source, kind, extID string) error {
+	return withDbQuery(func(db dber) (err error) {
+		_, err = db.Exec("DELETE FROM inbox_link WHERE source = $1 AND kind = $2 AND ext_id = $3", source, kind, extID)
+		return
+	})
+}
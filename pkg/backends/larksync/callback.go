@@ -0,0 +1,139 @@
+package larksync
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// errors of callbacks
+var (
+	ErrNoToken      = errors.New("verification token of lark is not set")
+	ErrToken        = errors.New("mismatch verification token")
+	ErrNotEncrypted = errors.New("body is not encrypted")
+)
+
+// headers of signature
+const (
+	HeaderSignature = "X-Lark-Signature"
+	HeaderTimestamp = "X-Lark-Request-Timestamp"
+	HeaderNonce     = "X-Lark-Request-Nonce"
+)
+
+// TypeURLVerification is the type of the challenge when the url is set
+const TypeURLVerification = "url_verification"
+
+// Header of events in schema 2.0
+type Header struct {
+	EventID    string `json:"event_id"`
+	EventType  string `json:"event_type"`
+	CreateTime string `json:"create_time"`
+	Token      string `json:"token"`
+	AppID      string `json:"app_id"`
+	TenantKey  string `json:"tenant_key"`
+}
+
+// Callback is a decrypted request of the event callback
+type Callback struct {
+	Schema string          `json:"schema"`
+	Header Header          `json:"header"`
+	Event  json.RawMessage `json:"event"`
+
+	// fields of schema 1.0 and url_verification
+	UUID      string `json:"uuid"`
+	Type      string `json:"type"`
+	Token     string `json:"token"`
+	Challenge string `json:"challenge"`
+
+	raw []byte
+}
+
+// EventID returns the id of event, unique in lark
+func (cb *Callback) EventID() string {
+	if cb.Header.EventID != "" {
+		return cb.Header.EventID
+	}
+	return cb.UUID
+}
+
+// EventType returns the type of event
+func (cb *Callback) EventType() string {
+	if cb.Header.EventType != "" {
+		return cb.Header.EventType
+	}
+	if cb.Type == "event_callback" && len(cb.Event) > 0 {
+		var ev struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(cb.Event, &ev) == nil && ev.Type != "" {
+			return ev.Type
+		}
+	}
+	return cb.Type
+}
+
+// IsChallenge returns true if it is the url_verification
+func (cb *Callback) IsChallenge() bool {
+	return cb.Type == TypeURLVerification
+}
+
+func (cb *Callback) token() string {
+	if cb.Header.Token != "" {
+		return cb.Header.Token
+	}
+	return cb.Token
+}
+
+// Parse verifies and decrypts the body of a callback request.
+// The signature is checked if lark gives it, the body must be encrypted if encryptKey is set,
+// and the verification token must equal token, which must not be empty.
+func Parse(header http.Header, body []byte, encryptKey, token string) (*Callback, error) {
+	if token == "" {
+		return nil, ErrNoToken
+	}
+	if sig := header.Get(HeaderSignature); sig != "" && encryptKey != "" {
+		expected := Sign(header.Get(HeaderTimestamp), header.Get(HeaderNonce), encryptKey, body)
+		if subtle.ConstantTimeCompare([]byte(sig), []byte(expected)) != 1 {
+			return nil, ErrSignature
+		}
+	}
+
+	var entry struct {
+		Encrypt string `json:"encrypt"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return nil, err
+	}
+	plain := body
+	if entry.Encrypt != "" {
+		if encryptKey == "" {
+			return nil, ErrBadCipher
+		}
+		var err error
+		if plain, err = Decrypt(encryptKey, entry.Encrypt); err != nil {
+			return nil, err
+		}
+	} else if encryptKey != "" {
+		return nil, ErrNotEncrypted
+	}
+
+	cb, err := ParseCallback(plain)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(cb.token()), []byte(token)) != 1 {
+		return nil, ErrToken
+	}
+	return cb, nil
+}
+
+// ParseCallback unmarshals the decrypted json, without verification
+func ParseCallback(plain []byte) (*Callback, error) {
+	cb := new(Callback)
+	if err := json.Unmarshal(plain, cb); err != nil {
+		return nil, err
+	}
+	cb.raw = plain
+	return cb, nil
+}
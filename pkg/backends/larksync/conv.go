@@ -0,0 +1,80 @@
+package larksync
+
+import (
+	"strings"
+
+	"github.com/liut/staffio/pkg/models"
+)
+
+// Avatar of user in contact v3
+type Avatar struct {
+	Avatar72  string `json:"avatar_72"`
+	Avatar240 string `json:"avatar_240"`
+	Avatar640 string `json:"avatar_640"`
+	Origin    string `json:"avatar_origin"`
+}
+
+// UserStatus of user in contact v3
+type UserStatus struct {
+	IsFrozen    bool `json:"is_frozen"`
+	IsResigned  bool `json:"is_resigned"`
+	IsActivated bool `json:"is_activated"`
+}
+
+// User of contact v3 events
+type User struct {
+	OpenID          string      `json:"open_id"`
+	UnionID         string      `json:"union_id"`
+	UserID          string      `json:"user_id"`
+	Name            string      `json:"name"`
+	EnName          string      `json:"en_name"`
+	Nickname        string      `json:"nickname"`
+	Email           string      `json:"email"`
+	EnterpriseEmail string      `json:"enterprise_email"`
+	Mobile          string      `json:"mobile"`
+	Gender          int         `json:"gender"`
+	JobTitle        string      `json:"job_title"`
+	Avatar          *Avatar     `json:"avatar,omitempty"`
+	Status          *UserStatus `json:"status,omitempty"`
+	DepartmentIDs   []string    `json:"department_ids"` // open_department_id
+}
+
+// GetEmail returns the enterprise email first
+func (u *User) GetEmail() string {
+	if u.EnterpriseEmail != "" {
+		return u.EnterpriseEmail
+	}
+	return u.Email
+}
+
+// Department of contact v3 events
+type Department struct {
+	Name               string `json:"name"`
+	ParentDepartmentID string `json:"parent_department_id"` // "0" is the root
+	DepartmentID       string `json:"department_id"`
+	OpenDepartmentID   string `json:"open_department_id"`
+	LeaderUserID       string `json:"leader_user_id"` // open_id
+	Order              string `json:"order"`
+}
+
+// UserToStaff ...
+func UserToStaff(user *User) *models.Staff {
+	staff := &models.Staff{
+		CommonName:   user.Name,
+		Nickname:     user.Nickname,
+		Email:        user.GetEmail(),
+		Mobile:       strings.TrimPrefix(user.Mobile, "+86"),
+		Gender:       models.Gender(user.Gender).String(),
+		EmployeeType: user.JobTitle,
+	}
+	fullname := user.Name
+	if user.EnName != "" {
+		fullname = user.EnName
+	}
+	staff.Surname, staff.GivenName = models.SplitName(fullname)
+	if user.Avatar != nil {
+		staff.AvatarPath = user.Avatar.Avatar240
+	}
+
+	return staff
+}
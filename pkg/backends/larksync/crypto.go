@@ -0,0 +1,73 @@
+package larksync
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// errors of callbacks
+var (
+	ErrBadCipher = errors.New("invalid encrypted body")
+	ErrSignature = errors.New("mismatch signature")
+)
+
+func cipherKey(encryptKey string) []byte {
+	sum := sha256.Sum256([]byte(encryptKey))
+	return sum[:]
+}
+
+// Decrypt the encrypt field of a callback body, AES-256-CBC with sha256 of encryptKey,
+// the first block is the iv
+func Decrypt(encryptKey, encrypted string) ([]byte, error) {
+	buf, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, ErrBadCipher
+	}
+	if len(buf) < 2*aes.BlockSize || len(buf)%aes.BlockSize != 0 {
+		return nil, ErrBadCipher
+	}
+	block, err := aes.NewCipher(cipherKey(encryptKey))
+	if err != nil {
+		return nil, err
+	}
+	iv, data := buf[:aes.BlockSize], buf[aes.BlockSize:]
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+
+	n := int(data[len(data)-1])
+	if n < 1 || n > aes.BlockSize || !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrBadCipher
+	}
+	return data[:len(data)-n], nil
+}
+
+// Encrypt is the reverse of Decrypt, like Lark does, for tests mostly
+func Encrypt(encryptKey string, plain []byte) (string, error) {
+	block, err := aes.NewCipher(cipherKey(encryptKey))
+	if err != nil {
+		return "", err
+	}
+	n := aes.BlockSize - len(plain)%aes.BlockSize
+	buf := make([]byte, aes.BlockSize, aes.BlockSize+len(plain)+n)
+	if _, err = io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	buf = append(buf, plain...)
+	buf = append(buf, bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, buf[:aes.BlockSize]).CryptBlocks(buf[aes.BlockSize:], buf[aes.BlockSize:])
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// Sign returns the X-Lark-Signature of a request
+func Sign(timestamp, nonce, encryptKey string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(timestamp + nonce + encryptKey))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,9 @@
+package larksync
+
+import (
+	zlog "github.com/liut/staffio/pkg/log"
+)
+
+func logger() zlog.Logger {
+	return zlog.GetLogger()
+}
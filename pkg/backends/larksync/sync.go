@@ -0,0 +1,308 @@
+// Package larksync applies contact events of Lark (feishu) to staff and teams
+package larksync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/inbox"
+	"github.com/liut/staffio/pkg/models/team"
+)
+
+// Source of lark events in the inbox
+const Source = "lark"
+
+// types of contact events handled, others are ignored
+const (
+	TypeUserCreated       = "contact.user.created_v3"
+	TypeUserUpdated       = "contact.user.updated_v3"
+	TypeUserDeleted       = "contact.user.deleted_v3"
+	TypeDepartmentCreated = "contact.department.created_v3"
+	TypeDepartmentUpdated = "contact.department.updated_v3"
+	TypeDepartmentDeleted = "contact.department.deleted_v3"
+)
+
+// errors of events
+var (
+	ErrNoEventID = errors.New("empty event id")
+	ErrNoUID     = errors.New("no uid for the user")
+	ErrNoOpenID  = errors.New("empty open id")
+)
+
+type userEvent struct {
+	Object    User  `json:"object"`
+	OldObject *User `json:"old_object,omitempty"`
+}
+
+type departmentEvent struct {
+	Object Department `json:"object"`
+}
+
+// Receive stores the event into the inbox and applies it, once for each event id.
+// The result is kept in the returned event, a failed one is replayed by keepers,
+// so only errors of the inbox are returned.
+func Receive(svc backends.Servicer, cb *Callback) (*inbox.Event, error) {
+	e := &inbox.Event{Source: Source, EventID: cb.EventID(), Type: cb.EventType(), Payload: string(cb.raw)}
+	if e.EventID == "" {
+		return nil, ErrNoEventID
+	}
+	isNew, err := svc.Inbox().Add(e)
+	if err != nil {
+		logger().Infow("add lark event fail", "id", e.EventID, "err", err)
+		return nil, err
+	}
+	if !isNew {
+		logger().Infow("duplicated lark event", "id", e.EventID, "type", e.Type, "status", e.Status)
+		return e, nil
+	}
+	return e, applyEvent(svc, e, cb)
+}
+
+// Replay applies a received event again
+func Replay(svc backends.Servicer, id int) (*inbox.Event, error) {
+	e, err := svc.Inbox().Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Source != Source {
+		return nil, fmt.Errorf("event %d is from %s", id, e.Source)
+	}
+	cb, err := ParseCallback([]byte(e.Payload))
+	if err != nil {
+		e.Applied(err)
+		return e, svc.Inbox().Update(e)
+	}
+	return e, applyEvent(svc, e, cb)
+}
+
+func applyEvent(svc backends.Servicer, e *inbox.Event, cb *Callback) error {
+	err := Apply(svc, cb)
+	if err != nil && err != inbox.ErrIgnored {
+		logger().Infow("apply lark event fail", "id", e.EventID, "type", e.Type, "err", err)
+	}
+	e.Applied(err)
+	return svc.Inbox().Update(e)
+}
+
+// Apply changes staff and teams with the event, returns inbox.ErrIgnored if not handled
+func Apply(svc backends.Servicer, cb *Callback) error {
+	switch typ := cb.EventType(); typ {
+	case TypeUserCreated, TypeUserUpdated, TypeUserDeleted:
+		var ev userEvent
+		if err := json.Unmarshal(cb.Event, &ev); err != nil {
+			return err
+		}
+		if ev.Object.OpenID == "" {
+			return ErrNoOpenID
+		}
+		if typ == TypeUserDeleted {
+			return removeUser(svc, &ev.Object)
+		}
+		return saveUser(svc, &ev)
+	case TypeDepartmentCreated, TypeDepartmentUpdated, TypeDepartmentDeleted:
+		var ev departmentEvent
+		if err := json.Unmarshal(cb.Event, &ev); err != nil {
+			return err
+		}
+		if ev.Object.OpenDepartmentID == "" {
+			return ErrNoOpenID
+		}
+		if typ == TypeDepartmentDeleted {
+			return removeDepartment(svc, &ev.Object)
+		}
+		return saveDepartment(svc, &ev.Object)
+	}
+	return inbox.ErrIgnored
+}
+
+// linked returns the local value of extID, empty if not linked
+func linked(svc backends.Servicer, kind, extID string) (string, error) {
+	local, err := svc.Inbox().Linked(Source, kind, extID)
+	if err == backends.ErrNotFound {
+		return "", nil
+	}
+	return local, err
+}
+
+// linkedTeam returns the id of team linked with the department, 0 if not linked
+func linkedTeam(svc backends.Servicer, deptID string) (int, error) {
+	local, err := linked(svc, inbox.KindDepartment, deptID)
+	if err != nil || local == "" {
+		return 0, err
+	}
+	return strconv.Atoi(local)
+}
+
+// resolveUID returns the uid linked, or of the staff with same email,
+// or the name of email, or the user_id of lark
+func resolveUID(svc backends.Servicer, u *User) (string, error) {
+	uid, err := linked(svc, inbox.KindUser, u.OpenID)
+	if err != nil || uid != "" {
+		return uid, err
+	}
+	if email := u.GetEmail(); email != "" {
+		if data := svc.All(&backends.Spec{Email: email}); len(data) > 0 {
+			return data[0].UID, nil
+		}
+		if i := strings.Index(email, "@"); i > 0 {
+			return strings.ToLower(email[:i]), nil
+		}
+	}
+	if u.UserID != "" {
+		return strings.ToLower(u.UserID), nil
+	}
+	return "", ErrNoUID
+}
+
+func saveUser(svc backends.Servicer, ev *userEvent) error {
+	u := &ev.Object
+	uid, err := resolveUID(svc, u)
+	if err != nil {
+		return err
+	}
+	staff := UserToStaff(u)
+	staff.UID = uid
+	if old, err := svc.Get(uid); err == nil {
+		backends.FillStaff(staff, old)
+	}
+	if err = svc.SaveStaff(staff); err != nil {
+		return err
+	}
+	if err = svc.Inbox().Link(Source, inbox.KindUser, u.OpenID, uid); err != nil {
+		return err
+	}
+
+	// old_object has department_ids only if they are changed
+	if ev.OldObject != nil {
+		for _, deptID := range ev.OldObject.DepartmentIDs {
+			if hasString(u.DepartmentIDs, deptID) {
+				continue
+			}
+			tid, err := linkedTeam(svc, deptID)
+			if err != nil {
+				return err
+			}
+			if tid > 0 {
+				if err = svc.Team().RemoveMember(tid, uid); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, deptID := range u.DepartmentIDs {
+		tid, err := linkedTeam(svc, deptID)
+		if err != nil {
+			return err
+		}
+		if tid == 0 {
+			logger().Infow("department not linked", "dept", deptID, "uid", uid)
+			continue
+		}
+		if err = svc.Team().AddMember(tid, uid); err != nil {
+			return err
+		}
+	}
+	logger().Infow("lark user saved", "uid", uid, "openID", u.OpenID)
+	return nil
+}
+
+func removeUser(svc backends.Servicer, u *User) error {
+	uid, err := linked(svc, inbox.KindUser, u.OpenID)
+	if err != nil {
+		return err
+	}
+	if uid == "" {
+		return inbox.ErrIgnored
+	}
+	for _, role := range []team.RoleType{team.RoleMember, team.RoleManager} {
+		teams, err := svc.Team().All(role)
+		if err != nil {
+			return err
+		}
+		for _, t := range teams {
+			if t.StaffUID != uid {
+				continue
+			}
+			if role == team.RoleMember {
+				err = svc.Team().RemoveMember(t.ID, uid)
+			} else {
+				err = svc.Team().RemoveManager(t.ID, uid)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err = svc.Delete(uid); err != nil && err != backends.ErrStoreNotFound {
+		return err
+	}
+	logger().Infow("lark user deleted", "uid", uid, "openID", u.OpenID)
+	return svc.Inbox().Unlink(Source, inbox.KindUser, u.OpenID)
+}
+
+func saveDepartment(svc backends.Servicer, d *Department) error {
+	tid, err := linkedTeam(svc, d.OpenDepartmentID)
+	if err != nil {
+		return err
+	}
+	parentID, err := linkedTeam(svc, d.ParentDepartmentID)
+	if err != nil {
+		return err
+	}
+	t := &team.Team{Name: d.Name}
+	if tid > 0 {
+		if old, err := svc.Team().Get(tid); err == nil {
+			t = old
+			t.Name = d.Name
+		}
+	}
+	t.OrigName = d.Name
+	t.ParentID = parentID
+	if err = svc.Team().Store(t); err != nil {
+		return err
+	}
+	if err = svc.Inbox().Link(Source, inbox.KindDepartment, d.OpenDepartmentID, strconv.Itoa(t.ID)); err != nil {
+		return err
+	}
+	if d.LeaderUserID != "" {
+		uid, err := linked(svc, inbox.KindUser, d.LeaderUserID)
+		if err != nil {
+			return err
+		}
+		if uid != "" {
+			if err = svc.Team().AddManager(t.ID, uid); err != nil {
+				return err
+			}
+		}
+	}
+	logger().Infow("lark department saved", "team", t.ID, "name", t.Name, "dept", d.OpenDepartmentID)
+	return nil
+}
+
+func removeDepartment(svc backends.Servicer, d *Department) error {
+	tid, err := linkedTeam(svc, d.OpenDepartmentID)
+	if err != nil {
+		return err
+	}
+	if tid == 0 {
+		return inbox.ErrIgnored
+	}
+	if err = svc.Team().Delete(tid); err != nil {
+		return err
+	}
+	logger().Infow("lark department deleted", "team", tid, "dept", d.OpenDepartmentID)
+	return svc.Inbox().Unlink(Source, inbox.KindDepartment, d.OpenDepartmentID)
+}
+
+func hasString(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package larksync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/inbox"
+)
+
+const (
+	testToken      = "rvaYgkND1GOiu5MM0E1rncYC6PLtF7JV"
+	testEncryptKey = "test key"
+
+	deptRD      = "od-4e6ac4d14bcd5071a37a39de902c7141"
+	deptBackend = "od-8756b2c9e5a6c7d1a1b2c3d4e5f60718"
+	openID      = "ou_7dab8a3d3cdcc9da365777c7ad535d62"
+)
+
+func loadPayload(t *testing.T, name string) []byte {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func loadCallback(t *testing.T, name string) *Callback {
+	cb, err := ParseCallback(loadPayload(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cb
+}
+
+func TestCrypto(t *testing.T) {
+	plain := []byte(`{"challenge":"ajls384kdjx98XX"}`)
+	encrypted, err := Encrypt(testEncryptKey, plain)
+	assert.NoError(t, err)
+	decrypted, err := Decrypt(testEncryptKey, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, plain, decrypted)
+
+	_, err = Decrypt("other key", encrypted)
+	assert.Equal(t, ErrBadCipher, err)
+	_, err = Decrypt(testEncryptKey, "bm90IGEgY2lwaGVy")
+	assert.Equal(t, ErrBadCipher, err)
+	_, err = Decrypt(testEncryptKey, "%%%")
+	assert.Equal(t, ErrBadCipher, err)
+}
+
+func TestParse(t *testing.T) {
+	plain := loadPayload(t, "user_created")
+	encrypted, err := Encrypt(testEncryptKey, plain)
+	assert.NoError(t, err)
+	body, _ := json.Marshal(map[string]string{"encrypt": encrypted})
+
+	header := http.Header{}
+	header.Set(HeaderTimestamp, "1608725991")
+	header.Set(HeaderNonce, "14706")
+	header.Set(HeaderSignature, Sign("1608725991", "14706", testEncryptKey, body))
+
+	cb, err := Parse(header, body, testEncryptKey, testToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "f7984f25108f8137722bb63cee927e66", cb.EventID())
+	assert.Equal(t, TypeUserCreated, cb.EventType())
+	assert.False(t, cb.IsChallenge())
+
+	_, err = Parse(header, body, testEncryptKey, "")
+	assert.Equal(t, ErrNoToken, err)
+	_, err = Parse(header, body, testEncryptKey, "other token")
+	assert.Equal(t, ErrToken, err)
+
+	header.Set(HeaderNonce, "14707")
+	_, err = Parse(header, body, testEncryptKey, testToken)
+	assert.Equal(t, ErrSignature, err)
+
+	// plain bodies are accepted only without encrypt key
+	_, err = Parse(http.Header{}, plain, testEncryptKey, testToken)
+	assert.Equal(t, ErrNotEncrypted, err)
+	cb, err = Parse(http.Header{}, loadPayload(t, "url_verification"), "", testToken)
+	assert.NoError(t, err)
+	assert.True(t, cb.IsChallenge())
+	assert.Equal(t, "ajls384kdjx98XX", cb.Challenge)
+
+	cb = loadCallback(t, "v1_message")
+	assert.Equal(t, "bc447199585340d1f3728d26b1c0297a", cb.EventID())
+	assert.Equal(t, "message", cb.EventType())
+}
+
+func receive(t *testing.T, svc backends.Servicer, name string) *inbox.Event {
+	e, err := Receive(svc, loadCallback(t, name))
+	assert.NoError(t, err)
+	if e == nil {
+		t.Fatalf("receive %s got nil", name)
+	}
+	return e
+}
+
+func teamOf(t *testing.T, svc backends.Servicer, deptID string) int {
+	local, err := svc.Inbox().Linked(Source, inbox.KindDepartment, deptID)
+	assert.NoError(t, err)
+	id, err := strconv.Atoi(local)
+	assert.NoError(t, err)
+	return id
+}
+
+func TestReceive(t *testing.T) {
+	svc := backends.NewMemoryService(nil)
+
+	e := receive(t, svc, "department_created")
+	assert.Equal(t, inbox.StatusApplied, e.Status)
+	rd := teamOf(t, svc, deptRD)
+	receive(t, svc, "department_created_child")
+	backend := teamOf(t, svc, deptBackend)
+	tm, err := svc.Team().Get(backend)
+	assert.NoError(t, err)
+	assert.Equal(t, "Backend", tm.Name)
+	assert.Equal(t, rd, tm.ParentID)
+
+	e = receive(t, svc, "user_created")
+	assert.Equal(t, inbox.StatusApplied, e.Status, e.LastError)
+	staff, err := svc.Get("zhangsan")
+	assert.NoError(t, err)
+	assert.Equal(t, "Zhangsan@example.com", staff.Email)
+	assert.Equal(t, "13011111111", staff.Mobile)
+	assert.Equal(t, "Zhang", staff.Surname)
+	eid := staff.EmployeeNumber
+	uid, err := svc.Inbox().Linked(Source, inbox.KindUser, openID)
+	assert.NoError(t, err)
+	assert.Equal(t, "zhangsan", uid)
+	tm, _ = svc.Team().Get(rd)
+	assert.Contains(t, tm.Members, "zhangsan")
+
+	// a redelivered event is not applied again
+	dup := receive(t, svc, "user_created")
+	assert.Equal(t, e.ID, dup.ID)
+	assert.Equal(t, 1, dup.Attempts)
+	spec := &inbox.Spec{Source: Source}
+	_, err = svc.Inbox().Query(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, spec.Total)
+
+	receive(t, svc, "user_updated")
+	staff, _ = svc.Get("zhangsan")
+	assert.Equal(t, "13022222222", staff.Mobile)
+	assert.Equal(t, "Senior Engineer", staff.EmployeeType)
+	assert.Equal(t, eid, staff.EmployeeNumber)
+	tm, _ = svc.Team().Get(rd)
+	assert.NotContains(t, tm.Members, "zhangsan")
+	tm, _ = svc.Team().Get(backend)
+	assert.Contains(t, tm.Members, "zhangsan")
+
+	receive(t, svc, "department_updated")
+	tm, _ = svc.Team().Get(backend)
+	assert.Equal(t, "Server", tm.Name)
+	assert.Contains(t, tm.Leaders, "zhangsan")
+	assert.Equal(t, backend, teamOf(t, svc, deptBackend))
+
+	e = receive(t, svc, "v1_message")
+	assert.Equal(t, inbox.StatusIgnored, e.Status)
+
+	receive(t, svc, "user_deleted")
+	_, err = svc.Get("zhangsan")
+	assert.Error(t, err)
+	tm, _ = svc.Team().Get(backend)
+	assert.NotContains(t, tm.Members, "zhangsan")
+	assert.NotContains(t, tm.Leaders, "zhangsan")
+	_, err = svc.Inbox().Linked(Source, inbox.KindUser, openID)
+	assert.Equal(t, backends.ErrNotFound, err)
+
+	receive(t, svc, "department_deleted")
+	_, err = svc.Team().Get(backend)
+	assert.Error(t, err)
+	_, err = svc.Inbox().Linked(Source, inbox.KindDepartment, deptBackend)
+	assert.Equal(t, backends.ErrNotFound, err)
+}
+
+func TestReplay(t *testing.T) {
+	svc := backends.NewMemoryService(nil)
+
+	// deleted before created is ignored
+	e := receive(t, svc, "user_deleted")
+	assert.Equal(t, inbox.StatusIgnored, e.Status)
+
+	e = receive(t, svc, "user_created")
+	assert.NoError(t, svc.Delete("zhangsan"))
+	e, err := Replay(svc, e.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, inbox.StatusApplied, e.Status)
+	assert.Equal(t, 2, e.Attempts)
+	_, err = svc.Get("zhangsan")
+	assert.NoError(t, err)
+
+	cb, err := ParseCallback([]byte(`{"schema":"2.0","header":{"event_id":"broken","event_type":"contact.user.created_v3"},"event":{"object":"x"}}`))
+	assert.NoError(t, err)
+	e, err = Receive(svc, cb)
+	assert.NoError(t, err)
+	assert.Equal(t, inbox.StatusFailed, e.Status)
+	assert.NotEmpty(t, e.LastError)
+	e, err = Replay(svc, e.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, inbox.StatusFailed, e.Status)
+	assert.Equal(t, 2, e.Attempts)
+
+	_, err = Replay(svc, 999)
+	assert.Equal(t, backends.ErrNotFound, err)
+}
@@ -0,0 +1,71 @@
+// Package mail renders named templates of mails in the language of staff,
+// each one has a subject, a text part and a html part, and sends them with the smtp in settings
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	gomail "gopkg.in/mail.v2"
+
+	"github.com/liut/staffio/pkg/settings"
+)
+
+// ErrNotReady if mail is disabled or the smtp host is empty
+var ErrNotReady = errors.New("email system is not ready")
+
+// Message is a rendered mail
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// Ready returns ErrNotReady if mail can not be sent
+func Ready() error {
+	if !settings.Current.MailEnabled || settings.Current.MailHost == "" {
+		return ErrNotReady
+	}
+	return nil
+}
+
+// Send sends m as multipart/alternative with the smtp in settings
+func Send(m *Message) error {
+	if err := Ready(); err != nil {
+		logger().Warnw("mail disabled or host is empty")
+		return err
+	}
+	var (
+		smtpHost = settings.Current.MailHost
+		smtpPort = settings.Current.MailPort
+		smtpUser = settings.Current.MailSenderEmail
+		smtpPass = settings.Current.MailSenderPassword
+	)
+
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", fmt.Sprintf("%s <%s>", settings.Current.MailSenderName, smtpUser))
+	msg.SetHeader("To", m.To)
+	msg.SetHeader("Subject", m.Subject)
+	msg.SetBody("text/plain", m.Text)
+	if m.HTML != "" {
+		msg.AddAlternative("text/html", m.HTML)
+	}
+
+	logger().Infow("sending email", "email", m.To, "subject", m.Subject, "host", smtpHost, "port", smtpPort, "sender", smtpUser)
+
+	d := gomail.NewDialer(smtpHost, smtpPort, smtpUser, smtpPass)
+
+	if settings.Current.MailTLSEnabled {
+		d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		logger().Infow("enable tls")
+	}
+
+	if err := d.DialAndSend(msg); err != nil {
+		logger().Warnw("send email failed", "host", smtpHost, "err", err)
+		return err
+	}
+	logger().Infow("send email OK", "email", m.To)
+	return nil
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestRender(t *testing.T) {
+	root := settings.Current.Root
+	settings.Current.Root = "../../../"
+	defer func() { settings.Current.Root = root }()
+
+	for _, lang := range prefs.Langs {
+		for _, name := range Names {
+			m, err := Render(name, lang, Sample(name))
+			if !assert.NoError(t, err, name) {
+				continue
+			}
+			assert.NotEmpty(t, m.Subject, name)
+			assert.NotContains(t, m.Subject, "\n", name)
+			assert.Contains(t, m.Text, "Eagle", name)
+			assert.Contains(t, m.HTML, "Eagle", name)
+			assert.NotContains(t, m.Text+m.HTML, "no value", name)
+		}
+	}
+
+	m, err := Render(Reset, "zh", Data{"Name": "<b>张三</b>", "Link": "http://x/?a=1&b=2", "Hours": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "重置密码", m.Subject)
+	assert.Contains(t, m.Text, "<b>张三</b>")
+	assert.Contains(t, m.HTML, "&lt;b&gt;张三&lt;/b&gt;", "escaped in html")
+	assert.Contains(t, m.HTML, `href="http://x/?a=1&amp;b=2"`)
+
+	m, err = Render(Reset, "fr", Sample(Reset))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(m.Subject, "Password reset"), "default language")
+
+	_, err = Render("nope", prefs.LangEN, nil)
+	assert.Error(t, err)
+}
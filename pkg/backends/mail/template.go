@@ -0,0 +1,162 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	htmltpl "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttpl "text/template"
+
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+// names of templates, files are templates/mail/<lang>/<name>.txt and <name>.html,
+// the txt one defines "subject" too
+const (
+	Reset       = "reset"        // link to reset password
+	Welcome     = "welcome"      // new staff, with a link to set password
+	Invitation  = "invitation"   // invited by a keeper, with a link to set password
+	Reminder    = "reminder"     // weekly report not submitted
+	EmailVerify = "email_verify" // link to verify a new email
+	EmailNotice = "email_notice" // the email is changing, to the old one
+	LoginLink   = "login_link"   // link to sign in without password
+)
+
+// Names is all templates
+var Names = []string{Reset, Welcome, Invitation, Reminder, EmailVerify, EmailNotice, LoginLink}
+
+// Data of a template, Name is the name of the receiver
+type Data map[string]interface{}
+
+type parsed struct {
+	text *texttpl.Template
+	html *htmltpl.Template
+}
+
+var (
+	cachedMu  sync.Mutex
+	cachedTpl = map[string]*parsed{}
+)
+
+// Dir of templates
+func Dir() string {
+	return filepath.Join(settings.Current.Root, "templates", "mail")
+}
+
+// DefaultLang of mails to staff who have no preference
+func DefaultLang() string {
+	if lang := prefs.ParseLang(settings.Current.MailLang); lang != "" {
+		return lang
+	}
+	return prefs.LangEN
+}
+
+// Render returns the mail of template name in lang, the default language if lang is unknown or missing
+func Render(name, lang string, data Data) (*Message, error) {
+	if lang = prefs.ParseLang(lang); lang == "" {
+		lang = DefaultLang()
+	}
+	t, err := load(name, lang)
+	if os.IsNotExist(err) && lang != DefaultLang() {
+		t, err = load(name, DefaultLang())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = Data{}
+	}
+	if _, ok := data["BaseURL"]; !ok {
+		data["BaseURL"] = settings.Current.BaseURL
+	}
+	var subject, text, html bytes.Buffer
+	if err = t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err = t.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if t.html != nil {
+		if err = t.html.Execute(&html, data); err != nil {
+			return nil, err
+		}
+	}
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+// load parses the files of name in lang once, the html one is optional
+func load(name, lang string) (*parsed, error) {
+	if !known(name) {
+		return nil, fmt.Errorf("unknown mail template %q", name)
+	}
+	dir := filepath.Join(Dir(), lang)
+	key := filepath.Join(dir, name)
+	cachedMu.Lock()
+	defer cachedMu.Unlock()
+	if t, ok := cachedTpl[key]; ok {
+		return t, nil
+	}
+	b, err := ioutil.ReadFile(key + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	t := new(parsed)
+	if t.text, err = texttpl.New(name).Parse(string(b)); err != nil {
+		return nil, err
+	}
+	if t.text.Lookup("subject") == nil {
+		return nil, fmt.Errorf("no subject in mail template %s", key)
+	}
+	if b, err = ioutil.ReadFile(key + ".html"); err == nil {
+		if t.html, err = htmltpl.New(name).Parse(string(b)); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	cachedTpl[key] = t
+	return t, nil
+}
+
+func known(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Sample returns data of name for previews and tests
+func Sample(name string) Data {
+	data := Data{
+		"Name":    "Eagle",
+		"UID":     "eagle",
+		"Link":    settings.Current.BaseURL + "/password/reset?rt=sample",
+		"Hours":   2,
+		"Minutes": 15,
+	}
+	switch name {
+	case Invitation:
+		data["Inviter"] = "Keeper"
+	case Reminder:
+		data["Week"] = "2026-W42"
+		data["Link"] = settings.Current.BaseURL + "/"
+	case EmailVerify:
+		data["Link"] = settings.Current.BaseURL + "/email/verify?token=sample"
+	case EmailNotice:
+		data["Email"] = "eagle@example.net"
+	case LoginLink:
+		data["Link"] = settings.Current.BaseURL + "/login/link?token=sample"
+	}
+	return data
+}
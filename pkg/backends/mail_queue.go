@@ -0,0 +1,109 @@
+package backends
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/backends/mail"
+	"github.com/liut/staffio/pkg/models/mailq"
+)
+
+const (
+	mailBatch = 20
+	mailLease = 5 * time.Minute // a claimed mail is tried again after it, if the worker is gone while sending
+
+	workerPoll = 30 * time.Second
+)
+
+// mailWake tells the worker a mail is queued
+var mailWake = make(chan struct{}, 1)
+
+// enqueueMail keeps m in the queue and wakes the worker, the request does not wait for smtp
+func enqueueMail(svc Servicer, m *mailq.Message) error {
+	if err := svc.MailQueue().Enqueue(m); err != nil {
+		logger().Warnw("enqueue mail fail", "to", m.To, "template", m.Template, "err", err)
+		return err
+	}
+	logger().Infow("mail queued", "id", m.ID, "to", m.To, "template", m.Template)
+	WakeMailWorker()
+	return nil
+}
+
+// WakeMailWorker tells the worker to send without waiting for the next poll
+func WakeMailWorker() {
+	select {
+	case mailWake <- struct{}{}:
+	default:
+	}
+}
+
+// SendQueuedMails sends the mails due in the queue until none is due, returns the count sent,
+// a failed one is tried again later with backoff, and is dead after queue.MaxAttempts
+func SendQueuedMails(svc Servicer) (sent int, err error) {
+	if err = mail.Ready(); err != nil {
+		return
+	}
+	for {
+		var msgs []mailq.Message
+		msgs, err = svc.MailQueue().Claim(time.Now(), mailLease, mailBatch)
+		if err != nil || len(msgs) == 0 {
+			return
+		}
+		for i := range msgs {
+			m := &msgs[i]
+			e := mail.Send(&mail.Message{To: m.To, Subject: m.Subject, Text: m.Text, HTML: m.HTML})
+			if e != nil {
+				m.Failed(e, time.Now())
+				if m.Status == mailq.StatusDead {
+					logger().Warnw("queued mail is dead", "id", m.ID, "to", m.To, "attempts", m.Attempts, "err", e)
+				} else {
+					logger().Infow("send queued mail fail", "id", m.ID, "to", m.To, "attempts", m.Attempts, "err", e)
+				}
+			} else {
+				m.Done(time.Now())
+				sent++
+			}
+			if err = svc.MailQueue().Update(m); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// StartMailWorker sends queued mails once one is queued or every workerPoll,
+// stop waits for the sending pass
+func StartMailWorker(svc Servicer) (stop func()) {
+	return startWorker("mails", mailWake, func() (int, error) {
+		n, err := SendQueuedMails(svc)
+		if err == mail.ErrNotReady {
+			err = nil
+		}
+		return n, err
+	})
+}
+
+// startWorker calls pass once woken by wake or every workerPoll, stop waits for the pass running
+func startWorker(name string, wake <-chan struct{}, pass func() (int, error)) (stop func()) {
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(workerPoll)
+		defer ticker.Stop()
+		for {
+			if n, err := pass(); err != nil {
+				logger().Warnw("worker pass fail", "worker", name, "err", err)
+			} else if n > 0 {
+				logger().Infow("worker pass done", "worker", name, "count", n)
+			}
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
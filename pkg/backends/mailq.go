@@ -0,0 +1,59 @@
+package backends
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/models/mailq"
+)
+
+var _ mailq.Store = (*mailqStore)(nil)
+
+type mailqStore struct{}
+
+const mailqColumns = `id, uid, template, rcpt, subject, body_text, body_html, status, attempts, last_error,
+ next_try, sent, created, updated`
+
+func (s *mailqStore) Enqueue(m *mailq.Message) error {
+	m.Status = mailq.StatusPending
+	return withTxQuery(func(db dbTxer) error {
+		return db.QueryRow(`INSERT INTO mail_queue(uid, template, rcpt, subject, body_text, body_html, status)
+		 VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id, next_try, created, updated`,
+			m.UID, m.Template, m.To, m.Subject, m.Text, m.HTML, m.Status).Scan(&m.ID, &m.NextTry, &m.Created, &m.Updated)
+	})
+}
+
+func (s *mailqStore) Claim(now time.Time, lease time.Duration, limit int) (data []mailq.Message, err error) {
+	err = claimJobs(&data, "mail_queue", mailqColumns, "next_try", now, lease, limit)
+	return
+}
+
+func (s *mailqStore) Update(m *mailq.Message) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`UPDATE mail_queue SET status = $2, attempts = $3, last_error = $4, next_try = $5, sent = $6,
+		 updated = CURRENT_TIMESTAMP WHERE id = $1`, m.ID, m.Status, m.Attempts, m.LastError, m.NextTry, m.Sent)
+		return
+	})
+}
+
+func (s *mailqStore) Get(id int) (*mailq.Message, error) {
+	obj := new(mailq.Message)
+	err := withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT "+mailqColumns+" FROM mail_queue WHERE id = $1", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *mailqStore) Query(spec *mailq.Spec) (data []mailq.Message, err error) {
+	w := new(sqlWhere)
+	w.eq("status", spec.Status)
+	w.eq("rcpt", spec.To)
+	err = queryPage(&data, "mail_queue", mailqColumns, w, &spec.Pager)
+	return
+}
+
+func (s *mailqStore) Resend(id int) error {
+	return resetJob("mail_queue", "sent = NULL", id)
+}
@@ -0,0 +1,39 @@
+package backends
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/mailq"
+)
+
+func TestMailQueue(t *testing.T) {
+	m := &mailq.Message{Template: "test", To: "test@example.net", Subject: "go test", Text: "hello"}
+	assert.NoError(t, svc.MailQueue().Enqueue(m))
+	assert.NotZero(t, m.ID)
+	now := time.Now().Add(time.Second)
+	list, err := svc.MailQueue().Claim(now, time.Minute, 100)
+	assert.NoError(t, err)
+	var claimed *mailq.Message
+	for i := range list {
+		if list[i].ID == m.ID {
+			claimed = &list[i]
+		}
+	}
+	if !assert.NotNil(t, claimed) {
+		return
+	}
+	assert.False(t, claimed.Due(now), "leased")
+
+	claimed.Failed(errors.New("dial fail"), now)
+	assert.NoError(t, svc.MailQueue().Update(claimed))
+	assert.NoError(t, svc.MailQueue().Resend(m.ID))
+	obj, err := svc.MailQueue().Get(m.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mailq.StatusPending, obj.Status)
+	assert.Zero(t, obj.Attempts)
+	assert.Equal(t, ErrNotFound, svc.MailQueue().Resend(-1))
+}
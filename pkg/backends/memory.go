@@ -0,0 +1,386 @@
+package backends
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liut/staffio-backend/schema"
+	"github.com/liut/staffio/pkg/backends/passwd"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/cas"
+	"github.com/liut/staffio/pkg/models/content"
+	"github.com/liut/staffio/pkg/models/oauth"
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/models/pwdpolicy"
+	"github.com/liut/staffio/pkg/models/saml"
+	"github.com/liut/staffio/pkg/models/sessions"
+	"github.com/liut/staffio/pkg/models/team"
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/models/totp"
+	"github.com/liut/staffio/pkg/models/webauthn"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+// FixturePeople is a staff with plain password
+type FixturePeople struct {
+	models.Staff
+	Password string `json:"password,omitempty"`
+}
+
+// Fixtures seed data of the memory backend
+type Fixtures struct {
+	People   []FixturePeople   `json:"people"`
+	Groups   []Group           `json:"groups"`
+	Clients  []oauth.Client    `json:"clients"`
+	Scopes   []oauth.Scope     `json:"scopes"`
+	Teams    []team.Team       `json:"teams"`
+	Articles []content.Article `json:"articles"`
+	Links    []content.Link    `json:"links"`
+}
+
+// LoadFixtures read fixtures from a JSON file
+func LoadFixtures(name string) (*Fixtures, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	fx := new(Fixtures)
+	if err = json.Unmarshal(data, fx); err != nil {
+		return nil, err
+	}
+	return fx, nil
+}
+
+// DemoFixtures returns a few people, groups and a client for demo
+func DemoFixtures() *Fixtures {
+	return &Fixtures{
+		People: []FixturePeople{
+			{Staff: models.Staff{UID: "eagle", CommonName: "Eagle Liut", GivenName: "Eagle", Surname: "Liut",
+				Email: "eagle@example.net", Mobile: "13800138000", EmployeeType: "Keeper"}, Password: "demo1234"},
+			{Staff: models.Staff{UID: "test", CommonName: "Test User", GivenName: "Test", Surname: "User",
+				Email: "test@example.net", Mobile: "13900139000", EmployeeType: "Engineer"}, Password: "test"},
+		},
+		Groups: []Group{
+			{Name: "keeper", Description: "administrators", Members: []string{"eagle"}},
+			{Name: "develop", Description: "developers", Members: []string{"eagle", "test"}},
+		},
+		Clients: []oauth.Client{
+			{Name: "demo", Code: "1234", Secret: "aabbccdda", RedirectURI: "http://localhost:3000/appauth",
+				AllowedGrantTypes: []string{"authorization_code", "password"}, AllowedScopes: []string{"basic"}},
+		},
+		Scopes: []oauth.Scope{
+			{Name: "basic", Label: "Basic", Description: "Basic Topic", IsDefault: true},
+		},
+		Teams: []team.Team{
+			{ID: 1, Name: "Develop", Leaders: []string{"eagle"}, Members: []string{"eagle", "test"}},
+		},
+		Articles: []content.Article{
+			{Id: 1, Title: "Welcome", Content: "This is a demo of staffio with memory backend.", Author: "eagle"},
+		},
+	}
+}
+
+// NewMemoryService returns a Servicer keeps all data in memory, seeded with fixtures,
+// for tests and demos without LDAP and database
+func NewMemoryService(fx *Fixtures) Servicer {
+	if fx == nil {
+		fx = new(Fixtures)
+	}
+	ps := newMemPeopleStore()
+	ob := &memOutboxStore{}
+	ts := &memTeamStore{teams: make(map[int]*team.Team)}
+	osinStore := newMemOSINStore()
+	var (
+		mu      sync.Mutex
+		lastEID = 1026
+	)
+	for _, p := range fx.People {
+		staff := p.Staff
+		if staff.EmployeeNumber > lastEID {
+			lastEID = staff.EmployeeNumber
+		}
+		ps.Save(&staff)
+		if p.Password != "" {
+			if err := ps.PasswordReset(staff.UID, p.Password); err != nil {
+				logger().Warnw("set fixture password fail", "uid", staff.UID, "err", err)
+			}
+		}
+	}
+	for i := range fx.Groups {
+		ps.SaveGroup(&fx.Groups[i])
+	}
+	for i := range fx.Clients {
+		osinStore.SaveClient(&fx.Clients[i])
+	}
+	osinStore.scopes = append(osinStore.scopes, fx.Scopes...)
+	for i := range fx.Teams {
+		ts.Store(&fx.Teams[i])
+	}
+	ts.ob = ob // fixtures are not events
+	memContent = newMemContentStore(fx.Articles, fx.Links)
+	logger().Infow("new memory service", "people", len(fx.People), "groups", len(fx.Groups),
+		"clients", len(fx.Clients), "teams", len(fx.Teams))
+	return &serviceImpl{
+		peopleStorer: &publishedPeople{peopleStorer: ps, ob: ob},
+		TicketStore:  &memTicketStore{data: make(map[string]cas.Ticket)},
+		osinStore:    osinStore,
+		teamStore:    ts,
+		watchStore:   &memWatchStore{ss: ps, data: make(map[string]team.Butts)},
+		weeklyStore:  &memWeeklyStore{ts: ts, ob: ob, ups: make(map[int][]string)},
+		samlStore:    &memSAMLStore{data: make(map[string]saml.ServiceProvider)},
+		totpStore:    &memTOTPStore{data: make(map[string]totp.Enrollment)},
+		keyStore:     &memWebAuthnStore{data: make(map[string]webauthn.Credential)},
+		limitStore:   &memThrottleStore{data: make(map[string]throttle.Attempt)},
+		pwdStore:     &memPwdHistoryStore{data: make(map[string][]pwdpolicy.Entry)},
+		auditStore:   &memAuditStore{},
+		loginStore:   &memSessionStore{data: make(map[string]sessions.Session)},
+		verifyStore:  &memVerifyStore{data: make(map[string]models.Verify)},
+		patStore:     &memPATStore{},
+		prefStore:    &memPrefStore{data: make(map[string]prefs.Prefs)},
+		mailqStore:   &memMailqStore{},
+		hookStore:    &memWebhookStore{},
+		eventStore:   ob,
+		inboxStore:   &memInboxStore{},
+		nextEID: func() (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lastEID++
+			return lastEID, nil
+		},
+		demo: true,
+	}
+}
+
+var _ peopleStorer = (*memPeopleStore)(nil)
+
+// memPeopleStore keeps people, passwords and groups in memory
+type memPeopleStore struct {
+	mu     sync.RWMutex
+	people map[string]schema.People
+	hashes map[string]string
+	groups map[string]Group
+}
+
+func newMemPeopleStore() *memPeopleStore {
+	return &memPeopleStore{
+		people: make(map[string]schema.People),
+		hashes: make(map[string]string),
+		groups: make(map[string]Group),
+	}
+}
+
+func (s *memPeopleStore) All(spec *Spec) (data schema.Peoples) {
+	if spec == nil {
+		spec = new(Spec)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data = make(schema.Peoples, 0, len(s.people))
+	for _, p := range s.people {
+		if len(spec.UIDs) > 0 {
+			if !schema.UIDs(spec.UIDs).Has(p.UID) {
+				continue
+			}
+		} else if len(spec.Name) > 0 {
+			if p.CommonName != spec.Name {
+				continue
+			}
+		} else if len(spec.Email) > 0 {
+			if p.Email != spec.Email {
+				continue
+			}
+		} else if len(spec.Mobile) > 0 && p.Mobile != spec.Mobile {
+			continue
+		}
+		data = append(data, p)
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].UID < data[j].UID })
+	return
+}
+
+func (s *memPeopleStore) Get(uid string) (*schema.People, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.people[uid]; ok {
+		return &p, nil
+	}
+	return nil, ErrStoreNotFound
+}
+
+func (s *memPeopleStore) GetByDN(dn string) (*schema.People, error) {
+	uid, ok := uidFromDN(dn)
+	if !ok {
+		return nil, ErrStoreNotFound
+	}
+	return s.Get(uid)
+}
+
+func (s *memPeopleStore) Delete(uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.people[uid]; !ok {
+		return ErrStoreNotFound
+	}
+	delete(s.people, uid)
+	delete(s.hashes, uid)
+	for name, g := range s.groups {
+		g.Members = removeString(g.Members, uid)
+		s.groups[name] = g
+	}
+	return nil
+}
+
+func (s *memPeopleStore) Save(staff *schema.People) (isNew bool, err error) {
+	if staff.UID == "" {
+		return false, ErrEmptyVal
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	p, exist := s.people[staff.UID]
+	if !exist {
+		p = *staff
+		p.CommonName = staff.GetCommonName()
+		p.Gender = genderCode(staff.Gender)
+		p.Created = &now
+		p.DN = "uid=" + staff.UID
+	} else {
+		mergePeople(&p, staff)
+		p.EmployeeType = staff.EmployeeType
+		p.JoinDate = staff.JoinDate
+		p.IDCN = staff.IDCN
+		if len(staff.JpegPhoto) > 0 {
+			p.JpegPhoto = staff.JpegPhoto
+		}
+		if staff.EmployeeNumber > 0 {
+			p.EmployeeNumber = staff.EmployeeNumber
+		}
+	}
+	p.Modified = &now
+	s.people[staff.UID] = p
+	return !exist, nil
+}
+
+// mergePeople replace the attributes of profile like the sql store, empty values clear them
+func mergePeople(p, staff *schema.People) {
+	p.CommonName = staff.GetCommonName()
+	p.GivenName = staff.GivenName
+	p.Surname = staff.Surname
+	p.Nickname = staff.Nickname
+	p.Email = staff.Email
+	p.Mobile = staff.Mobile
+	p.AvatarPath = staff.AvatarPath
+	p.Gender = genderCode(staff.Gender)
+	p.Birthday = staff.Birthday
+	p.Description = staff.Description
+	p.Tel = staff.Tel
+}
+
+func (s *memPeopleStore) ModifyBySelf(uid, password string, staff *schema.People) error {
+	if _, err := s.Authenticate(uid, password); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.people[uid]
+	mergePeople(&p, staff)
+	now := time.Now()
+	p.Modified = &now
+	s.people[uid] = p
+	return nil
+}
+
+func (s *memPeopleStore) Authenticate(uid, password string) (*schema.People, error) {
+	s.mu.RLock()
+	hashed := s.hashes[uid]
+	s.mu.RUnlock()
+	if !passwd.Verify(hashed, password) {
+		return nil, ErrLogin
+	}
+	return s.Get(uid)
+}
+
+func (s *memPeopleStore) PasswordChange(uid, oldPassword, newPassword string) error {
+	if _, err := s.Authenticate(uid, oldPassword); err != nil {
+		return err
+	}
+	return s.PasswordReset(uid, newPassword)
+}
+
+func (s *memPeopleStore) PasswordReset(uid, newPassword string) error {
+	hashed, err := passwd.Hash(settings.Current.PasswordHash, newPassword)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.people[uid]; !ok {
+		return ErrStoreNotFound
+	}
+	s.hashes[uid] = hashed
+	return nil
+}
+
+func (s *memPeopleStore) AllGroup() ([]Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := make([]Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		g.Members = append([]string(nil), g.Members...)
+		data = append(data, g)
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Name < data[j].Name })
+	return data, nil
+}
+
+func (s *memPeopleStore) GetGroup(name string) (*Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if g, ok := s.groups[name]; ok {
+		g.Members = append([]string(nil), g.Members...)
+		return &g, nil
+	}
+	return nil, ErrStoreNotFound
+}
+
+func (s *memPeopleStore) SaveGroup(group *Group) error {
+	if group.Name == "" {
+		return ErrEmptyVal
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := *group
+	g.Members = append([]string(nil), group.Members...)
+	s.groups[g.Name] = g
+	return nil
+}
+
+func (s *memPeopleStore) EraseGroup(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.groups, name)
+	return nil
+}
+
+func (s *memPeopleStore) Ready() error {
+	return nil
+}
+
+func (s *memPeopleStore) Close() {}
+
+func (s *memPeopleStore) PoolStats() *PoolStats {
+	return &PoolStats{}
+}
+
+func removeString(arr []string, s string) []string {
+	out := arr[:0]
+	for _, v := range arr {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
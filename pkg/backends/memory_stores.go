@@ -0,0 +1,1802 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio-backend/schema"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/cas"
+	"github.com/liut/staffio/pkg/models/content"
+	"github.com/liut/staffio/pkg/models/inbox"
+	"github.com/liut/staffio/pkg/models/mailq"
+	"github.com/liut/staffio/pkg/models/oauth"
+	"github.com/liut/staffio/pkg/models/outbox"
+	"github.com/liut/staffio/pkg/models/pat"
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/models/pwdpolicy"
+	"github.com/liut/staffio/pkg/models/saml"
+	"github.com/liut/staffio/pkg/models/sessions"
+	"github.com/liut/staffio/pkg/models/team"
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/models/totp"
+	"github.com/liut/staffio/pkg/models/webauthn"
+	"github.com/liut/staffio/pkg/models/webhook"
+	"github.com/liut/staffio/pkg/models/weekly"
+)
+
+var _ OSINStore = (*memOSINStore)(nil)
+
+type memOSINStore struct {
+	mu         sync.RWMutex
+	clients    []oauth.Client
+	authorizes map[string]*osin.AuthorizeData
+	accesses   map[string]*osin.AccessData
+	refresh    map[string]string
+	scopes     []oauth.Scope
+	authorized map[string]time.Time
+}
+
+func newMemOSINStore() *memOSINStore {
+	return &memOSINStore{
+		authorizes: make(map[string]*osin.AuthorizeData),
+		accesses:   make(map[string]*osin.AccessData),
+		refresh:    make(map[string]string),
+		authorized: make(map[string]time.Time),
+	}
+}
+
+func (s *memOSINStore) Clone() osin.Storage {
+	return s
+}
+
+func (s *memOSINStore) Close() {}
+
+func (s *memOSINStore) GetClient(id string) (osin.Client, error) {
+	c, err := s.GetClientWithCode(id)
+	if err != nil {
+		return nil, fmt.Errorf("Client %q not found", id)
+	}
+	return c, nil
+}
+
+func (s *memOSINStore) SaveAuthorize(data *osin.AuthorizeData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorizes[data.Code] = data
+	return nil
+}
+
+func (s *memOSINStore) LoadAuthorize(code string) (*osin.AuthorizeData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.authorizes[code]; ok {
+		return a, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memOSINStore) RemoveAuthorize(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.authorizes, code)
+	return nil
+}
+
+func (s *memOSINStore) SaveAccess(data *osin.AccessData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accesses[data.AccessToken] = data
+	if data.RefreshToken != "" {
+		s.refresh[data.RefreshToken] = data.AccessToken
+	}
+	return nil
+}
+
+func (s *memOSINStore) LoadAccess(code string) (*osin.AccessData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.accesses[code]; ok {
+		return a, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memOSINStore) RemoveAccess(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accesses, code)
+	return nil
+}
+
+func (s *memOSINStore) LoadRefresh(code string) (*osin.AccessData, error) {
+	s.mu.RLock()
+	access, ok := s.refresh[code]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("RefreshToken %q not found", code)
+	}
+	return s.LoadAccess(access)
+}
+
+func (s *memOSINStore) RemoveRefresh(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.refresh, code)
+	return nil
+}
+
+func (s *memOSINStore) GetClientWithCode(code string) (*oauth.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.clients {
+		if c.Code == code {
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memOSINStore) GetClientWithID(id int) (*oauth.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.clients {
+		if int(c.ID) == id {
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memOSINStore) LoadClients(spec *oauth.ClientSpec) ([]oauth.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if spec.Limit < 1 {
+		spec.Limit = 20
+	}
+	if spec.Page < 1 {
+		spec.Page = 1
+	}
+	spec.Total = len(s.clients)
+	data := append([]oauth.Client(nil), s.clients...)
+	if len(spec.Orders) > 0 && strings.HasSuffix(strings.ToUpper(spec.Orders[0]), " DESC") {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+	start := (spec.Page - 1) * spec.Limit
+	if start >= len(data) {
+		return []oauth.Client{}, nil
+	}
+	end := start + spec.Limit
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[start:end], nil
+}
+
+func (s *memOSINStore) CountClients() uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint(len(s.clients))
+}
+
+func (s *memOSINStore) SaveClient(client *oauth.Client) error {
+	if client.Name == "" || client.Code == "" || client.Secret == "" || client.RedirectURI == "" {
+		return valueError
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.clients {
+		if c.ID == client.ID {
+			s.clients[i].Name, s.clients[i].Code = client.Name, client.Code
+			s.clients[i].Secret, s.clients[i].RedirectURI = client.Secret, client.RedirectURI
+			return nil
+		}
+	}
+	client.ID = uint(len(s.clients) + 1)
+	if client.CreatedAt.IsZero() {
+		client.CreatedAt = time.Now()
+	}
+	s.clients = append(s.clients, *client)
+	return nil
+}
+
+func (s *memOSINStore) LoadScopes() ([]oauth.Scope, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]oauth.Scope{}, s.scopes...), nil
+}
+
+func (s *memOSINStore) IsAuthorized(clientID, username string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.authorized[clientID+" "+username]
+	return ok
+}
+
+func (s *memOSINStore) SaveAuthorized(clientID, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorized[clientID+" "+username] = time.Now()
+	return nil
+}
+
+var _ cas.TicketStore = (*memTicketStore)(nil)
+
+// memTicketStore keeps tickets of CAS in memory
+type memTicketStore struct {
+	mu   sync.Mutex
+	data map[string]cas.Ticket
+}
+
+func (s *memTicketStore) GetTicket(value string) (*cas.Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.data[value]; ok {
+		return &t, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTicketStore) DeleteTicket(value string) error {
+	if value == "" {
+		return cas.NewCasError("empty ticket value", cas.ERROR_CODE_INVALID_TICKET_SPEC)
+	}
+	s.mu.Lock()
+	delete(s.data, value)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memTicketStore) SaveTicket(t *cas.Ticket) error {
+	if err := t.Check(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	t.Id = len(s.data) + 1
+	s.data[t.Value] = *t
+	s.mu.Unlock()
+	return nil
+}
+
+var _ team.Store = (*memTeamStore)(nil)
+
+type memTeamStore struct {
+	mu     sync.RWMutex
+	teams  map[int]*team.Team
+	lastID int
+	ob     *memOutboxStore // nil while seeding
+}
+
+// publish adds ev to the outbox under the lock of the change, like a transaction
+func (s *memTeamStore) publish(ev Event) {
+	if s.ob != nil {
+		publish(s.ob, ev)
+	}
+}
+
+func (s *memTeamStore) Get(id int) (*team.Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := s.teams[id]; ok {
+		obj := *t
+		return &obj, nil
+	}
+	return nil, ErrNotFound
+}
+
+// sorted returns teams order by id, must hold the lock
+func (s *memTeamStore) sorted() team.Teams {
+	data := make(team.Teams, 0, len(s.teams))
+	for _, t := range s.teams {
+		data = append(data, *t)
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].ID < data[j].ID })
+	return data
+}
+
+func (s *memTeamStore) GetWithMember(uid string) (*team.Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.sorted() {
+		if schema.UIDs(t.Members).Has(uid) {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTeamStore) All(role team.RoleType) (team.Teams, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	teams := s.sorted()
+	if role != team.RoleMember && role != team.RoleManager {
+		return teams, nil
+	}
+	data := make(team.Teams, 0)
+	for _, t := range teams {
+		uids := t.Members
+		if role == team.RoleManager {
+			uids = t.Leaders
+		}
+		for _, uid := range uids {
+			t.StaffUID = uid
+			data = append(data, t)
+		}
+	}
+	return data, nil
+}
+
+func (s *memTeamStore) Store(t *team.Team) error {
+	if t.Name == "" {
+		return ErrEmptyVal
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if t.ID < 1 {
+		for id, et := range s.teams {
+			if et.Name == t.Name {
+				t.ID = id
+				return nil
+			}
+		}
+		s.lastID++
+		t.ID = s.lastID
+	} else if t.ID > s.lastID {
+		s.lastID = t.ID
+	}
+	obj := *t
+	if et, ok := s.teams[t.ID]; ok {
+		obj.Created = et.Created
+		obj.Updated = &now
+	} else {
+		obj.Created = now
+	}
+	obj.Leaders = lowerUIDs(nil, t.Leaders...)
+	obj.Members = lowerUIDs(nil, t.Members...)
+	s.teams[t.ID] = &obj
+	s.publish(&TeamSaved{Team: obj})
+	return nil
+}
+
+func (s *memTeamStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.teams, id)
+	s.publish(&TeamDeleted{ID: id})
+	return nil
+}
+
+func (s *memTeamStore) AddMember(id int, uids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[id]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Members = lowerUIDs(t.Members, uids...)
+	s.publish(&TeamMembersChanged{TeamID: id, Added: lowerUIDs(nil, uids...)})
+	return nil
+}
+
+func (s *memTeamStore) RemoveMember(id int, uids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.teams[id]; ok {
+		for _, uid := range uids {
+			t.Members = removeString(t.Members, uid)
+		}
+		s.publish(&TeamMembersChanged{TeamID: id, Removed: uids})
+	}
+	return nil
+}
+
+func (s *memTeamStore) AddManager(id int, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[id]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Leaders = lowerUIDs(t.Leaders, uid)
+	s.publish(&TeamSaved{Team: *t})
+	return nil
+}
+
+func (s *memTeamStore) RemoveManager(id int, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.teams[id]; ok {
+		t.Leaders = removeString(t.Leaders, strings.ToLower(uid))
+		s.publish(&TeamSaved{Team: *t})
+	}
+	return nil
+}
+
+// lowerUIDs append lower uids into arr without duplicates
+func lowerUIDs(arr []string, uids ...string) []string {
+	out := append([]string{}, arr...)
+	for _, uid := range uids {
+		uid = strings.ToLower(uid)
+		if !schema.UIDs(out).Has(uid) {
+			out = append(out, uid)
+		}
+	}
+	return out
+}
+
+var _ team.WatchStore = (*memWatchStore)(nil)
+
+type memWatchStore struct {
+	mu   sync.RWMutex
+	ss   schema.PeopleStore
+	data map[string]team.Butts
+}
+
+func (s *memWatchStore) Gets(uid string) team.Butts {
+	s.mu.RLock()
+	data := append(team.Butts{}, s.data[uid]...)
+	s.mu.RUnlock()
+	for i := range data {
+		if staff, err := s.ss.Get(data[i].UID); err == nil {
+			data[i].Name = staff.GetCommonName()
+			data[i].Avatar = staff.AvatarURI()
+		}
+	}
+	return data
+}
+
+func (s *memWatchStore) Watch(uid, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.data[uid] {
+		if b.UID == target {
+			return nil
+		}
+	}
+	now := time.Now()
+	s.data[uid] = append(s.data[uid], team.Butt{UID: target, Created: &now})
+	return nil
+}
+
+func (s *memWatchStore) Unwatch(uid, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var data team.Butts
+	for _, b := range s.data[uid] {
+		if b.UID != target {
+			data = append(data, b)
+		}
+	}
+	s.data[uid] = data
+	return nil
+}
+
+var _ weekly.Store = (*memWeeklyStore)(nil)
+
+type memWeeklyStore struct {
+	mu      sync.RWMutex
+	ts      *memTeamStore
+	ob      *memOutboxStore
+	reports []weekly.Report
+	ups     map[int][]string
+	status  []weekly.ReportStat
+	lastID  int
+}
+
+func (s *memWeeklyStore) Get(id int) (*weekly.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.reports {
+		if r.Id == id {
+			return &r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memWeeklyStore) All(spec weekly.ReportsSpec) (data weekly.Reports, total int, err error) {
+	var members []string
+	if spec.TeamID > 0 {
+		t, err := s.ts.Get(spec.TeamID)
+		if err != nil {
+			return weekly.Reports{}, 0, nil
+		}
+		members = t.Members
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data = make(weekly.Reports, 0)
+	for _, r := range s.reports {
+		if len(spec.UIDs) > 0 && !schema.UIDs(spec.UIDs).Has(r.Uid) ||
+			len(spec.UIDs) == 0 && spec.UID != "" && spec.UID != r.Uid ||
+			spec.TeamID > 0 && !schema.UIDs(members).Has(r.Uid) {
+			continue
+		}
+		data = append(data, r)
+	}
+	total = len(data)
+	if spec.Sort != nil {
+		sorts := *spec.Sort
+		sort.SliceStable(data, func(i, j int) bool {
+			for _, sf := range sorts {
+				a, b := reportSortKey(&data[i], sf.Field), reportSortKey(&data[j], sf.Field)
+				if a == b {
+					continue
+				}
+				return (a < b) != sf.Reverse
+			}
+			return false
+		})
+	}
+	if spec.Pager != nil && spec.Pager.Size > 0 {
+		if spec.Pager.Offset >= len(data) {
+			return weekly.Reports{}, total, nil
+		}
+		data = data[spec.Pager.Offset:]
+		if len(data) > spec.Pager.Size {
+			data = data[:spec.Pager.Size]
+		}
+	}
+	return
+}
+
+func reportSortKey(r *weekly.Report, field string) int64 {
+	switch strings.TrimPrefix(field, "r.") {
+	case "created":
+		return r.Created.UnixNano()
+	case "updated":
+		if r.Updated != nil {
+			return r.Updated.UnixNano()
+		}
+		return 0
+	case "up_count":
+		return int64(r.UpCount)
+	case "iso_year":
+		return int64(r.Year)
+	case "iso_week":
+		return int64(r.Year*100 + r.Week)
+	}
+	return int64(r.Id)
+}
+
+func (s *memWeeklyStore) Add(uid string, content string) error {
+	now := time.Now()
+	year, week := now.ISOWeek()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.reports {
+		if r.Uid == uid && r.Year == year && r.Week == week {
+			s.reports[i].Content = json.RawMessage(content)
+			s.reports[i].Updated = &now
+			publish(s.ob, &WeeklyReportSubmitted{ReportID: r.Id, UID: uid, Year: year, Week: week})
+			return nil
+		}
+	}
+	s.lastID++
+	s.reports = append(s.reports, weekly.Report{
+		Id: s.lastID, Uid: uid, Year: year, Week: week, Content: json.RawMessage(content), Created: &now,
+	})
+	publish(s.ob, &WeeklyReportSubmitted{ReportID: s.lastID, UID: uid, Year: year, Week: week})
+	return nil
+}
+
+func (s *memWeeklyStore) Update(id int, content string) error {
+	if id < 1 {
+		return fmt.Errorf("invalid id value %d", id)
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.reports {
+		if r.Id == id {
+			s.reports[i].Content = json.RawMessage(content)
+			s.reports[i].Updated = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memWeeklyStore) Applaud(id int, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.reports {
+		if r.Id == id {
+			if schema.UIDs(s.ups[id]).Has(uid) {
+				return fmt.Errorf("%s applauded report %d already", uid, id)
+			}
+			s.ups[id] = append(s.ups[id], uid)
+			s.reports[i].UpCount = len(s.ups[id])
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Stat returns reports created between start and end, the status records of same week take precedence
+func (s *memWeeklyStore) Stat(start, end time.Time) (*weekly.ReportStatResponse, error) {
+	rsr := &weekly.ReportStatResponse{
+		Commited: []*weekly.ReportStat{},
+		All:      []*weekly.ReportUser{},
+	}
+	y1, w1 := start.ISOWeek()
+	y2, w2 := end.ISOWeek()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hasStatus := func(uid string, year, week int) bool {
+		for _, st := range s.status {
+			if st.Uid == uid && st.Year == year && st.Week == week {
+				return true
+			}
+		}
+		return false
+	}
+	for _, r := range s.reports {
+		if r.Created.Before(start) || r.Created.After(end) || hasStatus(r.Uid, r.Year, r.Week) {
+			continue
+		}
+		rsr.Commited = append(rsr.Commited, &weekly.ReportStat{
+			Id: r.Id, Uid: r.Uid, Year: r.Year, Week: r.Week, Status: weekly.WRNormal, Created: r.Created})
+	}
+	for i, st := range s.status {
+		yw := st.Year*100 + st.Week
+		if st.Week > 0 && yw >= y1*100+w1 && yw <= y2*100+w2 {
+			rsr.Commited = append(rsr.Commited, &s.status[i])
+		}
+	}
+	return rsr, nil
+}
+
+func (s *memWeeklyStore) StatusRecords(status weekly.Status) ([]*weekly.ReportUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := []*weekly.ReportUser{}
+	for _, st := range s.status {
+		if st.Status == status {
+			data = append(data, &weekly.ReportUser{Id: st.Id, Uid: st.Uid, Created: st.Created})
+		}
+	}
+	return data, nil
+}
+
+func (s *memWeeklyStore) StatusRecordsWithUser(status weekly.Status, uid string) ([]*weekly.ReportStat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := []*weekly.ReportStat{}
+	for i, st := range s.status {
+		if st.Uid == uid && st.Status == status && st.Week > 0 {
+			data = append(data, &s.status[i])
+		}
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].Year*100+data[i].Week < data[j].Year*100+data[j].Week
+	})
+	return data, nil
+}
+
+func (s *memWeeklyStore) AddStatus(uid string, status weekly.Status, year int, weeks ...int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, week := range weeks {
+		found := false
+		for i, st := range s.status {
+			if st.Uid == uid && st.Year == year && st.Week == week {
+				s.status[i].Status = status
+				found = true
+			}
+		}
+		if !found {
+			s.lastID++
+			s.status = append(s.status, weekly.ReportStat{
+				Id: s.lastID, Uid: uid, Year: year, Week: week, Status: status, Created: &now})
+		}
+	}
+	return nil
+}
+
+func (s *memWeeklyStore) RemoveStatus(ids ...int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.status[:0]
+	for _, st := range s.status {
+		keep := true
+		for _, id := range ids {
+			if st.Id == id {
+				keep = false
+			}
+		}
+		if keep {
+			data = append(data, st)
+		}
+	}
+	s.status = data
+	return nil
+}
+
+var _ saml.Store = (*memSAMLStore)(nil)
+
+type memSAMLStore struct {
+	mu     sync.RWMutex
+	data   map[string]saml.ServiceProvider
+	lastID int
+}
+
+func (s *memSAMLStore) Get(entityID string) (*saml.ServiceProvider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sp, ok := s.data[entityID]; ok {
+		return &sp, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memSAMLStore) All() ([]saml.ServiceProvider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := make([]saml.ServiceProvider, 0, len(s.data))
+	for _, sp := range s.data {
+		data = append(data, sp)
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].ID < data[j].ID })
+	return data, nil
+}
+
+func (s *memSAMLStore) Store(sp *saml.ServiceProvider) error {
+	if sp.EntityID == "" || sp.ACSURL == "" {
+		return ErrEmptyVal
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.data[sp.EntityID]; ok {
+		sp.ID, sp.Created = old.ID, old.Created
+	} else {
+		s.lastID++
+		sp.ID, sp.Created = s.lastID, time.Now()
+	}
+	s.data[sp.EntityID] = *sp
+	return nil
+}
+
+func (s *memSAMLStore) Delete(entityID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, entityID)
+	return nil
+}
+
+var _ totp.Store = (*memTOTPStore)(nil)
+
+type memTOTPStore struct {
+	mu     sync.RWMutex
+	data   map[string]totp.Enrollment
+	policy totp.Policy
+}
+
+func (s *memTOTPStore) Get(uid string) (*totp.Enrollment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if e, ok := s.data[uid]; ok {
+		e.Recovery = append(pq.StringArray{}, e.Recovery...)
+		return &e, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTOTPStore) Save(e *totp.Enrollment) error {
+	if e.UID == "" || e.Secret == "" {
+		return ErrEmptyVal
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.data[e.UID]; ok {
+		now := time.Now()
+		e.Created, e.Updated = old.Created, &now
+	} else {
+		e.Created = time.Now()
+	}
+	obj := *e
+	obj.Recovery = append(pq.StringArray{}, e.Recovery...)
+	s.data[e.UID] = obj
+	return nil
+}
+
+func (s *memTOTPStore) Delete(uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, uid)
+	return nil
+}
+
+func (s *memTOTPStore) LoadPolicy() (*totp.Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &totp.Policy{Groups: append([]string{}, s.policy.Groups...)}, nil
+}
+
+func (s *memTOTPStore) SavePolicy(p *totp.Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy.Groups = append([]string{}, p.Groups...)
+	return nil
+}
+
+var _ webauthn.Store = (*memWebAuthnStore)(nil)
+
+type memWebAuthnStore struct {
+	mu   sync.RWMutex
+	data map[string]webauthn.Credential
+}
+
+func (s *memWebAuthnStore) All(uid string) (data []webauthn.Credential, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.data {
+		if c.UID == uid {
+			data = append(data, c)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Created.Before(data[j].Created) })
+	return
+}
+
+func (s *memWebAuthnStore) Get(id string) (*webauthn.Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if c, ok := s.data[id]; ok {
+		return &c, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memWebAuthnStore) Save(c *webauthn.Credential) error {
+	if c.ID == "" || c.UID == "" || len(c.PublicKey) == 0 {
+		return ErrEmptyVal
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[c.ID]; ok {
+		return fmt.Errorf("credential %s exists", c.ID)
+	}
+	c.Created = time.Now()
+	s.data[c.ID] = *c
+	return nil
+}
+
+func (s *memWebAuthnStore) Touch(id string, signCount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.data[id]; ok {
+		now := time.Now()
+		c.SignCount, c.LastUsed = signCount, &now
+		s.data[id] = c
+	}
+	return nil
+}
+
+func (s *memWebAuthnStore) Delete(uid, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.data[id]; ok && c.UID == uid {
+		delete(s.data, id)
+	}
+	return nil
+}
+
+var _ throttle.Store = (*memThrottleStore)(nil)
+
+type memThrottleStore struct {
+	mu   sync.Mutex
+	data map[string]throttle.Attempt
+}
+
+func (s *memThrottleStore) Get(key string) (*throttle.Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.data[key]; ok {
+		return &a, nil
+	}
+	return nil, nil
+}
+
+func (s *memThrottleStore) Fail(key string, window time.Duration) (*throttle.Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	a, ok := s.data[key]
+	if !ok || a.Last.Before(now.Add(-window)) {
+		a.Key, a.Failures, a.First = key, 0, now
+	}
+	a.Failures++
+	a.Last = now
+	s.data[key] = a
+	return &a, nil
+}
+
+func (s *memThrottleStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.data[key]; ok {
+		a.LockedUntil = &until
+		s.data[key] = a
+	}
+	return nil
+}
+
+func (s *memThrottleStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memThrottleStore) Locked() (data []throttle.Attempt, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, a := range s.data {
+		if a.IsLocked(now) {
+			data = append(data, a)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].LockedUntil.After(*data[j].LockedUntil) })
+	return
+}
+
+var _ pwdpolicy.Store = (*memPwdHistoryStore)(nil)
+
+type memPwdHistoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]pwdpolicy.Entry // newest first
+}
+
+func (s *memPwdHistoryStore) Recent(uid string, n int) ([]pwdpolicy.Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := s.data[uid]
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	return append([]pwdpolicy.Entry{}, entries...), nil
+}
+
+func (s *memPwdHistoryStore) Add(uid, hash string, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := append([]pwdpolicy.Entry{{UID: uid, Hash: hash, Created: time.Now()}}, s.data[uid]...)
+	if keep < len(entries) {
+		entries = entries[:keep]
+	}
+	s.data[uid] = entries
+	return nil
+}
+
+var _ audit.Store = (*memAuditStore)(nil)
+
+type memAuditStore struct {
+	mu     sync.RWMutex
+	events []audit.Event
+}
+
+func (s *memAuditStore) Add(e *audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ID = len(s.events) + 1
+	e.Created = time.Now()
+	s.events = append(s.events, *e)
+	return nil
+}
+
+func (s *memAuditStore) Query(spec *audit.Spec) (data []audit.Event, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	offset := spec.Offset()
+	spec.Total = 0
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if e := &s.events[i]; spec.Match(e) {
+			if spec.Total >= offset && len(data) < spec.Limit {
+				data = append(data, *e)
+			}
+			spec.Total++
+		}
+	}
+	return
+}
+
+var _ sessions.Store = (*memSessionStore)(nil)
+
+type memSessionStore struct {
+	mu   sync.RWMutex
+	data map[string]sessions.Session
+}
+
+func (s *memSessionStore) Get(id string) (*sessions.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if obj, ok := s.data[id]; ok {
+		return &obj, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memSessionStore) Save(obj *sessions.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj.Created = time.Now()
+	obj.LastSeen = obj.Created
+	s.data[obj.ID] = *obj
+	return nil
+}
+
+func (s *memSessionStore) Touch(id, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if obj, ok := s.data[id]; ok {
+		obj.LastSeen = time.Now()
+		obj.IP = ip
+		s.data[id] = obj
+	}
+	return nil
+}
+
+func (s *memSessionStore) list(match func(*sessions.Session) bool) (data []sessions.Session) {
+	for _, obj := range s.data {
+		if match(&obj) {
+			data = append(data, obj)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].LastSeen.After(data[j].LastSeen) })
+	return
+}
+
+func (s *memSessionStore) All(uid string) ([]sessions.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list(func(obj *sessions.Session) bool { return obj.UID == uid }), nil
+}
+
+func (s *memSessionStore) Active(limit int) ([]sessions.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := s.list(func(*sessions.Session) bool { return true })
+	if limit < len(data) {
+		data = data[:limit]
+	}
+	return data, nil
+}
+
+func (s *memSessionStore) Delete(uid, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if obj, ok := s.data[id]; ok && obj.UID == uid {
+		delete(s.data, id)
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (s *memSessionStore) Clear(uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, obj := range s.data {
+		if obj.UID == uid {
+			delete(s.data, id)
+		}
+	}
+	return nil
+}
+
+var _ pat.Store = (*memPATStore)(nil)
+
+type memPATStore struct {
+	mu     sync.RWMutex
+	lastID int
+	data   []pat.Token
+}
+
+func (s *memPATStore) All(uid string) (data []pat.Token, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.data) - 1; i >= 0; i-- {
+		if s.data[i].UID == uid {
+			data = append(data, s.data[i])
+		}
+	}
+	return
+}
+
+func (s *memPATStore) Get(hash string) (*pat.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, obj := range s.data {
+		if obj.Hash == hash {
+			return &obj, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memPATStore) Save(obj *pat.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	obj.ID = s.lastID
+	obj.Created = time.Now()
+	s.data = append(s.data, *obj)
+	return nil
+}
+
+func (s *memPATStore) Touch(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if s.data[i].ID == id {
+			now := time.Now()
+			s.data[i].LastUsed = &now
+		}
+	}
+	return nil
+}
+
+func (s *memPATStore) Delete(uid string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, obj := range s.data {
+		if obj.ID == id && obj.UID == uid {
+			s.data = append(s.data[:i], s.data[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memPATStore) Clear(uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.data[:0]
+	for _, obj := range s.data {
+		if obj.UID != uid {
+			data = append(data, obj)
+		}
+	}
+	s.data = data
+	return nil
+}
+
+var _ mailq.Store = (*memMailqStore)(nil)
+
+type memMailqStore struct {
+	mu     sync.Mutex
+	lastID int
+	data   []mailq.Message
+}
+
+func (s *memMailqStore) Enqueue(m *mailq.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	m.ID = s.lastID
+	m.Status = mailq.StatusPending
+	m.Created = time.Now()
+	m.Updated = m.Created
+	m.NextTry = m.Created
+	s.data = append(s.data, *m)
+	return nil
+}
+
+func (s *memMailqStore) Claim(now time.Time, lease time.Duration, limit int) (data []mailq.Message, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if len(data) >= limit {
+			break
+		}
+		if m := &s.data[i]; m.Due(now) {
+			m.Lease(now, lease)
+			data = append(data, *m)
+		}
+	}
+	return
+}
+
+func (s *memMailqStore) Update(m *mailq.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if s.data[i].ID == m.ID {
+			m.Updated = time.Now()
+			s.data[i] = *m
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memMailqStore) Get(id int) (*mailq.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.data {
+		if m.ID == id {
+			return &m, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memMailqStore) Query(spec *mailq.Spec) (data []mailq.Message, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset := spec.Offset()
+	spec.Total = 0
+	for i := len(s.data) - 1; i >= 0; i-- {
+		if !spec.Match(&s.data[i]) {
+			continue
+		}
+		if spec.Total >= offset && len(data) < spec.Limit {
+			data = append(data, s.data[i])
+		}
+		spec.Total++
+	}
+	return
+}
+
+func (s *memMailqStore) Resend(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if m := &s.data[i]; m.ID == id {
+			m.Resend(time.Now())
+			m.Updated = m.NextTry
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+var _ prefs.Store = (*memPrefStore)(nil)
+
+type memPrefStore struct {
+	mu   sync.RWMutex
+	data map[string]prefs.Prefs
+}
+
+func (s *memPrefStore) Get(uid string) (*prefs.Prefs, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if obj, ok := s.data[uid]; ok {
+		return &obj, nil
+	}
+	return &prefs.Prefs{UID: uid}, nil
+}
+
+func (s *memPrefStore) Save(obj *prefs.Prefs) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj.Updated = time.Now()
+	s.data[obj.UID] = *obj
+	return nil
+}
+
+var _ models.VerifyStore = (*memVerifyStore)(nil)
+
+type memVerifyStore struct {
+	mu     sync.Mutex
+	lastID int
+	data   map[string]models.Verify // key uid and purpose
+	policy models.LinkPolicy
+}
+
+func (s *memVerifyStore) Save(uv *models.Verify) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	uv.Id = s.lastID
+	uv.Created = time.Now()
+	uv.Updated = uv.Created
+	s.data[uv.Uid+"/"+uv.Purpose] = *uv
+	return nil
+}
+
+func (s *memVerifyStore) Get(uid, purpose string) (*models.Verify, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if uv, ok := s.data[uid+"/"+purpose]; ok && uv.Consumed == nil {
+		return &uv, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memVerifyStore) Attempt(uv *models.Verify) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := uv.Uid + "/" + uv.Purpose
+	obj, ok := s.data[key]
+	if !ok || obj.Id != uv.Id || obj.Consumed != nil {
+		return 0, ErrNotFound
+	}
+	obj.Attempts++
+	s.data[key] = obj
+	return obj.Attempts, nil
+}
+
+func (s *memVerifyStore) Use(uv *models.Verify) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := uv.Uid + "/" + uv.Purpose
+	obj, ok := s.data[key]
+	if !ok || obj.Id != uv.Id || obj.Consumed != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	obj.Consumed = &now
+	obj.Updated = now
+	s.data[key] = obj
+	return nil
+}
+
+func (s *memVerifyStore) Delete(uid, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, uid+"/"+purpose)
+	return nil
+}
+
+func (s *memVerifyStore) LoadLinkPolicy() (*models.LinkPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &models.LinkPolicy{Groups: append([]string{}, s.policy.Groups...)}, nil
+}
+
+func (s *memVerifyStore) SaveLinkPolicy(p *models.LinkPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy.Groups = append([]string{}, p.Groups...)
+	return nil
+}
+
+// memContent is not nil with the memory backend
+var memContent *memContentStore
+
+type memContentStore struct {
+	mu       sync.RWMutex
+	articles []content.Article
+	links    []content.Link
+}
+
+func newMemContentStore(articles []content.Article, links []content.Link) *memContentStore {
+	s := new(memContentStore)
+	for i := range articles {
+		s.saveArticle(&articles[i])
+	}
+	for i := range links {
+		s.saveLink(&links[i])
+	}
+	return s
+}
+
+func (s *memContentStore) loadArticle(id int) (*content.Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.articles {
+		if a.Id == id {
+			return &a, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// loadArticles returns articles order by created desc
+func (s *memContentStore) loadArticles(limit, offset int) []*content.Article {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := make([]*content.Article, 0)
+	for i := len(s.articles) - 1 - offset; i >= 0 && len(data) < limit; i-- {
+		a := s.articles[i]
+		data = append(data, &a)
+	}
+	return data
+}
+
+func (s *memContentStore) saveArticle(a *content.Article) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.articles {
+		if s.articles[i].Id == a.Id {
+			s.articles[i].Title, s.articles[i].Content, s.articles[i].Updated = a.Title, a.Content, time.Now()
+			return nil
+		}
+	}
+	a.Id = len(s.articles) + 1
+	if a.Created.IsZero() {
+		a.Created = time.Now()
+	}
+	s.articles = append(s.articles, *a)
+	return nil
+}
+
+func (s *memContentStore) loadLink(id int) (*content.Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, l := range s.links {
+		if l.Id == id {
+			return &l, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// loadLinks returns links order by position
+func (s *memContentStore) loadLinks(limit, offset int) []*content.Link {
+	s.mu.RLock()
+	links := append([]content.Link(nil), s.links...)
+	s.mu.RUnlock()
+	sort.SliceStable(links, func(i, j int) bool { return links[i].Position < links[j].Position })
+	data := make([]*content.Link, 0)
+	for i := offset; i < len(links) && len(data) < limit; i++ {
+		data = append(data, &links[i])
+	}
+	return data
+}
+
+func (s *memContentStore) saveLink(l *content.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.links {
+		if s.links[i].Id == l.Id {
+			s.links[i].Title, s.links[i].Url, s.links[i].Position = l.Title, l.Url, l.Position
+			return nil
+		}
+	}
+	l.Id = len(s.links) + 1
+	if l.Created.IsZero() {
+		l.Created = time.Now()
+	}
+	s.links = append(s.links, *l)
+	return nil
+}
+
+var _ webhook.Store = (*memWebhookStore)(nil)
+
+type memWebhookStore struct {
+	mu         sync.Mutex
+	lastID     int
+	endpoints  []webhook.Endpoint
+	deliveries []webhook.Delivery
+}
+
+func (s *memWebhookStore) Endpoints() ([]webhook.Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]webhook.Endpoint(nil), s.endpoints...), nil
+}
+
+func (s *memWebhookStore) GetEndpoint(id int) (*webhook.Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.endpoints {
+		if e.ID == id {
+			return &e, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memWebhookStore) SaveEndpoint(e *webhook.Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Updated = time.Now()
+	if e.ID == 0 {
+		s.lastID++
+		e.ID = s.lastID
+		e.Created = e.Updated
+		s.endpoints = append(s.endpoints, *e)
+		return nil
+	}
+	for i := range s.endpoints {
+		if s.endpoints[i].ID == e.ID {
+			e.Created = s.endpoints[i].Created
+			s.endpoints[i] = *e
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memWebhookStore) DeleteEndpoint(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.endpoints {
+		if s.endpoints[i].ID == id {
+			s.endpoints = append(s.endpoints[:i], s.endpoints[i+1:]...)
+			var data []webhook.Delivery
+			for _, d := range s.deliveries {
+				if d.EndpointID != id {
+					data = append(data, d)
+				}
+			}
+			s.deliveries = data
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memWebhookStore) Enqueue(d *webhook.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	d.ID = s.lastID
+	d.Status = webhook.StatusPending
+	d.Created = time.Now()
+	d.Updated = d.Created
+	d.NextTry = d.Created
+	s.deliveries = append(s.deliveries, *d)
+	return nil
+}
+
+func (s *memWebhookStore) Claim(now time.Time, lease time.Duration, limit int) (data []webhook.Delivery, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		if len(data) >= limit {
+			break
+		}
+		if d := &s.deliveries[i]; d.Due(now) {
+			d.Lease(now, lease)
+			data = append(data, *d)
+		}
+	}
+	return
+}
+
+func (s *memWebhookStore) Update(d *webhook.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == d.ID {
+			d.Updated = time.Now()
+			s.deliveries[i] = *d
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memWebhookStore) Get(id int) (*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.deliveries {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memWebhookStore) Query(spec *webhook.Spec) (data []webhook.Delivery, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset := spec.Offset()
+	spec.Total = 0
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if !spec.Match(&s.deliveries[i]) {
+			continue
+		}
+		if spec.Total >= offset && len(data) < spec.Limit {
+			data = append(data, s.deliveries[i])
+		}
+		spec.Total++
+	}
+	return
+}
+
+func (s *memWebhookStore) Redeliver(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		if d := &s.deliveries[i]; d.ID == id {
+			d.Redeliver(time.Now())
+			d.Updated = d.NextTry
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+var _ outbox.Store = (*memOutboxStore)(nil)
+
+type memOutboxStore struct {
+	mu     sync.Mutex
+	lastID int
+	data   []outbox.Message
+}
+
+func (s *memOutboxStore) Add(msgs ...outbox.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, m := range msgs {
+		s.lastID++
+		m.ID = s.lastID
+		m.Status = outbox.StatusPending
+		m.Created, m.Updated, m.NextTry = now, now, now
+		s.data = append(s.data, m)
+	}
+	return nil
+}
+
+func (s *memOutboxStore) Claim(now time.Time, lease time.Duration, limit int) (data []outbox.Message, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if len(data) >= limit {
+			break
+		}
+		if m := &s.data[i]; m.Due(now) {
+			m.Lease(now, lease)
+			data = append(data, *m)
+		}
+	}
+	return
+}
+
+func (s *memOutboxStore) Update(m *outbox.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if s.data[i].ID == m.ID {
+			m.Updated = time.Now()
+			s.data[i] = *m
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memOutboxStore) Get(id int) (*outbox.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.data {
+		if m.ID == id {
+			return &m, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memOutboxStore) Query(spec *outbox.Spec) (data []outbox.Message, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset := spec.Offset()
+	spec.Total = 0
+	for i := len(s.data) - 1; i >= 0; i-- {
+		if !spec.Match(&s.data[i]) {
+			continue
+		}
+		if spec.Total >= offset && len(data) < spec.Limit {
+			data = append(data, s.data[i])
+		}
+		spec.Total++
+	}
+	return
+}
+
+func (s *memOutboxStore) Retry(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if m := &s.data[i]; m.ID == id {
+			m.Retry(time.Now())
+			m.Updated = m.NextTry
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+var _ inbox.Store = (*memInboxStore)(nil)
+
+type memInboxStore struct {
+	mu     sync.Mutex
+	lastID int
+	data   []inbox.Event
+	links  map[string]string
+}
+
+func (s *memInboxStore) Add(e *inbox.Event) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.data {
+		if o.Source == e.Source && o.EventID == e.EventID {
+			*e = o
+			return false, nil
+		}
+	}
+	s.lastID++
+	e.ID = s.lastID
+	if e.Status == "" {
+		e.Status = inbox.StatusReceived
+	}
+	e.Created = time.Now()
+	e.Updated = e.Created
+	s.data = append(s.data, *e)
+	return true, nil
+}
+
+func (s *memInboxStore) Update(e *inbox.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data {
+		if s.data[i].ID == e.ID {
+			e.Updated = time.Now()
+			s.data[i] = *e
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memInboxStore) Get(id int) (*inbox.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.data {
+		if e.ID == id {
+			return &e, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memInboxStore) Query(spec *inbox.Spec) (data []inbox.Event, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset := spec.Offset()
+	spec.Total = 0
+	for i := len(s.data) - 1; i >= 0; i-- {
+		if !spec.Match(&s.data[i]) {
+			continue
+		}
+		if spec.Total >= offset && len(data) < spec.Limit {
+			data = append(data, s.data[i])
+		}
+		spec.Total++
+	}
+	return
+}
+
+func (s *memInboxStore) Link(source, kind, extID, local string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.links == nil {
+		s.links = make(map[string]string)
+	}
+	s.links[source+" "+kind+" "+extID] = local
+	return nil
+}
+
+func (s *memInboxStore) Linked(source, kind, extID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if local, ok := s.links[source+" "+kind+" "+extID]; ok {
+		return local, nil
+	}
+	return "", ErrNotFound
+}
+
+func (s *memInboxStore) Unlink(source, kind, extID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.links, source+" "+kind+" "+extID)
+	return nil
+}
@@ -0,0 +1,167 @@
+package backends
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+
+	goldap "gopkg.in/ldap.v3"
+
+	"github.com/liut/staffio-backend/ldap"
+	"github.com/liut/staffio/pkg/backends/passwd"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+// MigrateResult ...
+type MigrateResult struct {
+	People    int
+	Groups    int
+	Passwords int
+	// Unsupported are uids whose hash scheme is unknown, like {CRYPT} or {SSHA512},
+	// they can not sign in until the password is reset
+	Unsupported []string
+}
+
+// MigrateFromLDAP copy people and groups from LDAP into the sql store,
+// userPassword of people is copied too if withPassword, they will be rehashed at next login
+func MigrateFromLDAP(withPassword bool) (res MigrateResult, err error) {
+	src, err := NewLDAPStore()
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst := newPeopleStore(settings.Current.PasswordHash, false)
+	if err = dst.Ready(); err != nil {
+		return
+	}
+
+	for _, staff := range src.All(nil) {
+		staff := staff
+		if _, err = dst.Save(&staff); err != nil {
+			return
+		}
+		res.People++
+	}
+	logger().Infow("migrated people", "count", res.People)
+
+	groups, err := src.AllGroup()
+	if err != nil {
+		return
+	}
+	for i := range groups {
+		if err = dst.SaveGroup(&groups[i]); err != nil {
+			return
+		}
+		res.Groups++
+	}
+	logger().Infow("migrated groups", "count", res.Groups)
+
+	if !withPassword {
+		return
+	}
+	cfg := ldap.NewConfig()
+	if ldapcfg != nil {
+		cfg.CopyFrom(*ldapcfg)
+	}
+	var hashes map[string]string
+	hashes, err = ldapPasswords(cfg)
+	if err != nil {
+		return
+	}
+	for uid, hashed := range hashes {
+		if !passwd.Supported(hashed) {
+			logger().Warnw("unsupported password scheme", "uid", uid, "scheme", hashScheme(hashed))
+			res.Unsupported = append(res.Unsupported, uid)
+			continue
+		}
+		if err = dst.SetPasswordHash(uid, hashed); err != nil {
+			return
+		}
+		res.Passwords++
+	}
+	sort.Strings(res.Unsupported)
+	logger().Infow("migrated passwords", "count", res.Passwords, "unsupported", len(res.Unsupported))
+	return
+}
+
+// ldapPasswords returns userPassword of people from the first LDAP host, need a manager bind
+func ldapPasswords(cfg ldap.Config) (map[string]string, error) {
+	addr := strings.Split(cfg.Addr, ",")[0]
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" && u.Path != "" {
+		u.Host, u.Path = u.Path, ""
+	}
+	var conn *goldap.Conn
+	if u.Scheme == "ldaps" {
+		if !strings.Contains(u.Host, ":") {
+			u.Host += ":636"
+		}
+		var tc *tls.Config
+		if tc, err = ldapTLSConfig(u.Hostname()); err != nil {
+			return nil, err
+		}
+		conn, err = goldap.DialTLS("tcp", u.Host, tc)
+	} else {
+		if !strings.Contains(u.Host, ":") {
+			u.Host += ":389"
+		}
+		conn, err = goldap.Dial("tcp", u.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.Bind(cfg.Bind, cfg.Passwd); err != nil {
+		return nil, err
+	}
+
+	search := goldap.NewSearchRequest("ou=people,"+cfg.Base,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		"(objectclass=inetOrgPerson)", []string{"uid", "userPassword"}, nil)
+	sr, err := conn.SearchWithPaging(search, uint32(ldap.DefaultPageSize))
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	for _, entry := range sr.Entries {
+		uid, hashed := entry.GetAttributeValue("uid"), entry.GetAttributeValue("userPassword")
+		if uid != "" && hashed != "" {
+			hashes[uid] = hashed
+		}
+	}
+	return hashes, nil
+}
+
+// ldapTLSConfig verifies the certificate of host with LDAPCAFile or the system pool,
+// unless LDAPInsecure is set
+func ldapTLSConfig(host string) (*tls.Config, error) {
+	tc := &tls.Config{ServerName: host, InsecureSkipVerify: settings.Current.LDAPInsecure}
+	if name := settings.Current.LDAPCAFile; name != "" {
+		pem, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", name)
+		}
+	}
+	return tc, nil
+}
+
+// hashScheme returns the {SCHEME} prefix of an LDAP userPassword
+func hashScheme(hashed string) string {
+	if strings.HasPrefix(hashed, "{") {
+		if pos := strings.Index(hashed, "}"); pos > 0 {
+			return hashed[:pos+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package backends
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/liut/staffio/pkg/backends/mail"
+	"github.com/liut/staffio/pkg/backends/notify"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/mailq"
+	"github.com/liut/staffio/pkg/models/outbox"
+	"github.com/liut/staffio/pkg/models/prefs"
+)
+
+var _ notify.Channel = (*emailChannel)(nil)
+
+// emailChannel queues notes as mails
+type emailChannel struct {
+	svc Servicer
+}
+
+func (e *emailChannel) Name() string { return notify.Email }
+
+func (e *emailChannel) Notify(n *notify.Note) error {
+	if n.Email == "" {
+		return ErrEmptyEmail
+	}
+	if err := mail.Ready(); err != nil {
+		return err
+	}
+	return enqueueMail(e.svc, &mailq.Message{
+		UID:      n.UID,
+		Template: n.Topic,
+		To:       n.Email,
+		Subject:  n.Subject,
+		Text:     n.Text,
+		HTML:     n.HTML,
+	})
+}
+
+var _ notify.Channel = (*queuedChannel)(nil)
+
+// queuedChannel publishes notes of a channel in settings as NoteQueued, so they are sent after the request
+// and retried by the event worker, like mails by the mail worker
+type queuedChannel struct {
+	ob   outbox.Store
+	name string
+}
+
+func (q *queuedChannel) Name() string { return q.name }
+
+func (q *queuedChannel) Notify(n *notify.Note) error {
+	return publish(q.ob, &NoteQueued{Channel: q.name, Note: *n})
+}
+
+// sendQueuedNote sends the note of NoteQueued on its channel, it is dropped if the channel is gone from settings
+func sendQueuedNote(svc Servicer, ev Event) error {
+	e := ev.(*NoteQueued)
+	for _, ch := range notify.Channels() {
+		if ch.Name() == e.Channel {
+			return ch.Notify(&e.Note)
+		}
+	}
+	logger().Infow("note is dropped, the channel is gone", "channel", e.Channel, "uid", e.Note.UID, "topic", e.Note.Topic)
+	return nil
+}
+
+// NewNotifier returns a notifier of email and the channels in settings, email is the fallback,
+// all of them are queued
+func NewNotifier(svc Servicer) *notify.Notifier {
+	chs := []notify.Channel{&emailChannel{svc: svc}}
+	for _, ch := range notify.Channels() {
+		chs = append(chs, &queuedChannel{ob: svc.Outbox(), name: ch.Name()})
+	}
+	return notify.New(chs...)
+}
+
+// notifyStaff renders template name in the language staff prefers
+// and sends it on the channels staff prefers, email if none, for notices without secrets only,
+// links to sign in or to set password are sent by mailTo
+func notifyStaff(svc Servicer, staff *models.Staff, name string, data mail.Data) error {
+	return sendNote(svc, &notify.Note{Topic: name, UID: staff.UID, Name: staff.Name(), Email: staff.Email}, data, false)
+}
+
+// mailTo renders template name in the language uid prefers and queues it to email only,
+// for the mails with links to sign in, to set password or to verify a new email, and notices to the old email
+func mailTo(svc Servicer, uid, email, name string, data mail.Data) error {
+	return sendNote(svc, &notify.Note{Topic: name, UID: uid, Email: email}, data, true)
+}
+
+func sendNote(svc Servicer, n *notify.Note, data mail.Data, mailOnly bool) error {
+	p, err := svc.Prefs().Get(n.UID)
+	if err != nil {
+		logger().Infow("get prefs fail", "uid", n.UID, "err", err)
+		p = &prefs.Prefs{UID: n.UID}
+	}
+	m, err := mail.Render(n.Topic, p.Lang, data)
+	if err != nil {
+		logger().Warnw("render mail fail", "name", n.Topic, "lang", p.Lang, "err", err)
+		return err
+	}
+	n.Subject, n.Text, n.HTML = m.Subject, m.Text, m.HTML
+	nr, prefer := notify.New(&emailChannel{svc: svc}), []string{notify.Email}
+	if !mailOnly {
+		nr, prefer = NewNotifier(svc), p.Channels
+	}
+	sent, err := nr.Notify(n, prefer)
+	if err == nil {
+		logger().Infow("notified", "uid", n.UID, "topic", n.Topic, "channels", sent)
+	}
+	return err
+}
+
+// RemindWeekly notifies staff who have neither a report nor a vacation of the week of now,
+// returns the count notified
+func RemindWeekly(svc Servicer, now time.Time) (count int, err error) {
+	year, week := now.ISOWeek()
+	y, m, d := now.AddDate(0, 0, -(int(now.Weekday())+6)%7).Date()
+	stat, err := svc.Weekly().Stat(time.Date(y, m, d, 0, 0, 0, 0, now.Location()), now)
+	if err != nil {
+		return
+	}
+	done := make(map[string]bool)
+	for _, rs := range stat.Commited {
+		if rs.Year == year && rs.Week == week {
+			done[rs.Uid] = true
+		}
+	}
+	staffs := svc.All(&Spec{})
+	for i := range staffs {
+		staff := &staffs[i]
+		if done[staff.UID] {
+			continue
+		}
+		if e := notifyStaff(svc, staff, mail.Reminder, mail.Data{
+			"Name": staff.Name(),
+			"Week": fmt.Sprintf("%d-W%02d", year, week),
+			"Link": BaseURL + "/",
+		}); e != nil {
+			logger().Infow("remind weekly report fail", "uid", staff.UID, "err", e)
+			continue
+		}
+		count++
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+
+	larkc "github.com/fhyx/lark-api-go/client"
+	wxc "github.com/wealthworks/go-tencent-api/client"
+)
+
+const (
+	uriWxWorkToken = "https://qyapi.weixin.qq.com/cgi-bin/gettoken"
+	uriWxWorkSend  = "https://qyapi.weixin.qq.com/cgi-bin/message/send"
+
+	uriLarkToken = "https://open.feishu.cn/open-apis/auth/v3/tenant_access_token/internal/"
+	uriLarkSend  = "https://open.feishu.cn/open-apis/message/v4/send/"
+)
+
+// wxWork sends app messages of WeChat Work, the staff uid is the userid there
+type wxWork struct {
+	agentID int
+	c       *wxc.Client
+}
+
+func newWxWork(corpID, secret string, agentID int) *wxWork {
+	c := wxc.NewClient(uriWxWorkToken)
+	c.SetContentType("application/json")
+	c.SetCorp(corpID, secret)
+	return &wxWork{agentID: agentID, c: c}
+}
+
+func (w *wxWork) Name() string { return WxWork }
+
+func (w *wxWork) Notify(n *Note) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"touser":  n.UID,
+		"msgtype": "text",
+		"agentid": w.agentID,
+		"text":    map[string]string{"content": n.Message()},
+	})
+	if err != nil {
+		return err
+	}
+	var res struct {
+		InvalidUser string `json:"invaliduser"`
+	}
+	if err = w.c.PostJSON(uriWxWorkSend, body, &res); err != nil {
+		return err
+	}
+	if res.InvalidUser != "" {
+		return fmt.Errorf("invalid user %q of wxwork", res.InvalidUser)
+	}
+	return nil
+}
+
+// lark sends messages of the app bot of Lark, to the staff by email
+type lark struct {
+	c *larkc.Client
+}
+
+func newLark(appID, secret string) *lark {
+	c := larkc.NewClient(uriLarkToken)
+	c.SetContentType("application/json")
+	c.SetCorp(appID, secret)
+	return &lark{c: c}
+}
+
+func (l *lark) Name() string { return Lark }
+
+func (l *lark) Notify(n *Note) error {
+	if n.Email == "" {
+		return fmt.Errorf("empty email of %s for lark", n.UID)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"email":    n.Email,
+		"msg_type": "text",
+		"content":  map[string]string{"text": n.Message()},
+	})
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Data struct {
+			MessageID string `json:"message_id"`
+		} `json:"data"`
+	}
+	return l.c.PostJSON(uriLarkSend, body, &res)
+}
@@ -0,0 +1,149 @@
+// Package notify sends notes to staff on the channels they prefer,
+// like email, WeChat Work, Lark, a webhook or a file for local runs
+package notify
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/liut/staffio/pkg/settings"
+)
+
+// names of channels
+const (
+	Email   = "email"
+	WxWork  = "wxwork"
+	Lark    = "lark"
+	Webhook = "webhook"
+	File    = "file"
+)
+
+// Names is all channels
+var Names = []string{Email, WxWork, Lark, Webhook, File}
+
+// ErrNoChannel is returned if no channel is ready
+var ErrNoChannel = errors.New("no channel to notify")
+
+// Note to a staff, a rendered mail template, HTML is for email only
+type Note struct {
+	Topic   string `json:"topic"` // name of the template, like reset or reminder
+	UID     string `json:"uid"`
+	Name    string `json:"name,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"-"`
+}
+
+// Message returns subject and text for the channels of plain messages
+func (n *Note) Message() string {
+	return n.Subject + "\n\n" + n.Text
+}
+
+// Channel sends notes
+type Channel interface {
+	Name() string
+	Notify(n *Note) error
+}
+
+// Notifier sends notes on channels, the first one is the fallback
+type Notifier struct {
+	chs []Channel
+}
+
+// New returns a notifier of chs
+func New(chs ...Channel) *Notifier {
+	return &Notifier{chs: chs}
+}
+
+// Names returns names of the channels
+func (nr *Notifier) Names() []string {
+	names := make([]string, len(nr.chs))
+	for i, ch := range nr.chs {
+		names[i] = ch.Name()
+	}
+	return names
+}
+
+// Notify sends n on the channels of prefer, on the first channel if none of them is here,
+// it is done if any channel sent, or the last error is returned
+func (nr *Notifier) Notify(n *Note, prefer []string) (sent []string, err error) {
+	var chs []Channel
+	for _, ch := range nr.chs {
+		if contains(prefer, ch.Name()) {
+			chs = append(chs, ch)
+		}
+	}
+	if len(chs) == 0 && len(nr.chs) > 0 {
+		chs = nr.chs[:1]
+	}
+	if len(chs) == 0 {
+		return nil, ErrNoChannel
+	}
+	for _, ch := range chs {
+		if e := ch.Notify(n); e != nil {
+			logger().Infow("notify fail", "channel", ch.Name(), "uid", n.UID, "topic", n.Topic, "err", e)
+			err = e
+			continue
+		}
+		sent = append(sent, ch.Name())
+	}
+	if len(sent) > 0 {
+		err = nil
+	}
+	return
+}
+
+func contains(names []string, name string) bool {
+	for _, s := range names {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	cachedMu sync.Mutex
+	cached   = map[string]Channel{}
+)
+
+// Channels returns the channels configured in settings except email, which needs the mail queue,
+// a channel is kept for the same settings, so are its access tokens
+func Channels() []Channel {
+	cfg := settings.Current
+	cachedMu.Lock()
+	defer cachedMu.Unlock()
+	var chs []Channel
+	if cfg.WechatCorpID != "" && cfg.WechatPortalSecret != "" && cfg.WechatPortalAgentID > 0 {
+		chs = append(chs, channelOf(WxWork, cfg.WechatCorpID+cfg.WechatPortalSecret, func() Channel {
+			return newWxWork(cfg.WechatCorpID, cfg.WechatPortalSecret, cfg.WechatPortalAgentID)
+		}))
+	}
+	if cfg.LarkAppID != "" && cfg.LarkAppSecret != "" {
+		chs = append(chs, channelOf(Lark, cfg.LarkAppID+cfg.LarkAppSecret, func() Channel {
+			return newLark(cfg.LarkAppID, cfg.LarkAppSecret)
+		}))
+	}
+	if cfg.NotifyWebhook != "" {
+		chs = append(chs, channelOf(Webhook, cfg.NotifyWebhook, func() Channel {
+			return newWebhook(cfg.NotifyWebhook)
+		}))
+	}
+	if cfg.NotifyFile != "" {
+		chs = append(chs, channelOf(File, cfg.NotifyFile, func() Channel {
+			return &FileChannel{Path: cfg.NotifyFile}
+		}))
+	}
+	return chs
+}
+
+func channelOf(name, key string, fn func() Channel) Channel {
+	key = name + "\x00" + key
+	if ch, ok := cached[key]; ok {
+		return ch
+	}
+	ch := fn()
+	cached[key] = ch
+	return ch
+}
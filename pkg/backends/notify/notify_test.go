@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/settings"
+)
+
+type fakeChannel struct {
+	name  string
+	err   error
+	notes []*Note
+}
+
+func (f *fakeChannel) Name() string { return f.name }
+
+func (f *fakeChannel) Notify(n *Note) error {
+	f.notes = append(f.notes, n)
+	return f.err
+}
+
+func TestNotifier(t *testing.T) {
+	email, lark := &fakeChannel{name: Email}, &fakeChannel{name: Lark, err: errors.New("down")}
+	file := &fakeChannel{name: File}
+	nr := New(email, lark, file)
+	assert.Equal(t, []string{Email, Lark, File}, nr.Names())
+	n := &Note{Topic: "reset", UID: "eagle", Subject: "s", Text: "t"}
+
+	sent, err := nr.Notify(n, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{Email}, sent, "the first one if none")
+
+	sent, err = nr.Notify(n, []string{WxWork})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{Email}, sent, "the first one if none is here")
+
+	sent, err = nr.Notify(n, []string{Lark, File})
+	assert.NoError(t, err, "done if any sent")
+	assert.Equal(t, []string{File}, sent)
+	assert.Len(t, lark.notes, 1)
+
+	_, err = nr.Notify(n, []string{Lark})
+	assert.Error(t, err)
+	assert.Len(t, email.notes, 2, "no fallback if a preferred one failed")
+
+	_, err = New().Notify(n, nil)
+	assert.Equal(t, ErrNoChannel, err)
+	assert.Equal(t, "s\n\nt", n.Message())
+}
+
+func TestChannels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	var posted Note
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&posted))
+	}))
+	defer ts.Close()
+
+	cfg := *settings.Current
+	defer func() { *settings.Current = cfg }()
+	settings.Current.WechatPortalAgentID = 0
+	settings.Current.LarkAppID = ""
+	settings.Current.NotifyWebhook = ts.URL
+	settings.Current.NotifyFile = filepath.Join(dir, "notify.log")
+	chs := Channels()
+	if !assert.Len(t, chs, 2) {
+		return
+	}
+	assert.Equal(t, Webhook, chs[0].Name())
+	assert.Equal(t, File, chs[1].Name())
+	assert.True(t, chs[1] == Channels()[1], "kept for the same settings")
+
+	n := &Note{Topic: "reminder", UID: "eagle", Email: "eagle@example.net", Subject: "s", Text: "line\nbreak", HTML: "<p>"}
+	for _, ch := range chs {
+		assert.NoError(t, ch.Notify(n))
+	}
+	assert.Equal(t, "eagle", posted.UID)
+	assert.Equal(t, "line\nbreak", posted.Text)
+	assert.Empty(t, posted.HTML)
+	assert.NoError(t, chs[1].Notify(n))
+	b, err := ioutil.ReadFile(settings.Current.NotifyFile)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if assert.Len(t, lines, 2) {
+		var got struct {
+			Note
+			Time string `json:"time"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+		assert.Equal(t, "reminder", got.Topic)
+		assert.Equal(t, "line\nbreak", got.Text)
+		assert.NotEmpty(t, got.Time)
+	}
+
+	settings.Current.NotifyWebhook = ts.URL + "/other"
+	assert.False(t, chs[0] == Channels()[0], "new for new settings")
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// webhookChannel posts notes as json to a url, like a chat bot of the team
+type webhookChannel struct {
+	uri string
+	hc  *http.Client
+}
+
+func newWebhook(uri string) *webhookChannel {
+	return &webhookChannel{uri: uri, hc: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *webhookChannel) Name() string { return Webhook }
+
+func (w *webhookChannel) Notify(n *Note) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := w.hc.Post(w.uri, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook replied %s", resp.Status)
+	}
+	return nil
+}
+
+// FileChannel appends notes to a file as json, a line for each, for local runs and tests
+type FileChannel struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Name of channel
+func (f *FileChannel) Name() string { return File }
+
+// Notify appends n with the time
+func (f *FileChannel) Notify(n *Note) error {
+	b, err := json.Marshal(struct {
+		Time time.Time `json:"time"`
+		*Note
+	}{time.Now(), n})
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fd, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(append(b, '\n'))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package backends
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/models/outbox"
+)
+
+var _ outbox.Store = (*outboxStore)(nil)
+
+type outboxStore struct{}
+
+const outboxColumns = `id, topic, subscriber, payload, status, attempts, last_error, next_try, handled, created, updated`
+
+// dbOutboxAdd adds msgs in the transaction of a change
+func dbOutboxAdd(db dber, msgs []outbox.Message) error {
+	for i := range msgs {
+		m := &msgs[i]
+		m.Status = outbox.StatusPending
+		err := db.QueryRow(`INSERT INTO event_outbox(topic, subscriber, payload, status)
+		 VALUES($1, $2, $3, $4) RETURNING id, next_try, created, updated`,
+			m.Topic, m.Subscriber, m.Payload, m.Status).Scan(&m.ID, &m.NextTry, &m.Created, &m.Updated)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *outboxStore) Add(msgs ...outbox.Message) error {
+	return withTxQuery(func(db dbTxer) error {
+		return dbOutboxAdd(db, msgs)
+	})
+}
+
+func (s *outboxStore) Claim(now time.Time, lease time.Duration, limit int) (data []outbox.Message, err error) {
+	err = claimJobs(&data, "event_outbox", outboxColumns, "id", now, lease, limit)
+	return
+}
+
+func (s *outboxStore) Update(m *outbox.Message) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`UPDATE event_outbox SET status = $2, attempts = $3, last_error = $4, next_try = $5,
+		 handled = $6, updated = CURRENT_TIMESTAMP WHERE id = $1`,
+			m.ID, m.Status, m.Attempts, m.LastError, m.NextTry, m.Handled)
+		return
+	})
+}
+
+func (s *outboxStore) Get(id int) (*outbox.Message, error) {
+	obj := new(outbox.Message)
+	err := withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT "+outboxColumns+" FROM event_outbox WHERE id = $1", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *outboxStore) Query(spec *outbox.Spec) (data []outbox.Message, err error) {
+	w := new(sqlWhere)
+	w.eq("topic", spec.Topic)
+	w.eq("subscriber", spec.Subscriber)
+	w.eq("status", spec.Status)
+	err = queryPage(&data, "event_outbox", outboxColumns, w, &spec.Pager)
+	return
+}
+
+func (s *outboxStore) Retry(id int) error {
+	return resetJob("event_outbox", "handled = NULL", id)
+}
@@ -0,0 +1,29 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/outbox"
+)
+
+func TestOutboxRetry(t *testing.T) {
+	m := outbox.Message{Topic: TopicStaffDeleted, Subscriber: "go-test", Payload: `{"uid":"test"}`}
+	assert.NoError(t, svc.Outbox().Add(m))
+	list, err := svc.Outbox().Query(&outbox.Spec{Subscriber: "go-test", Status: outbox.StatusPending})
+	assert.NoError(t, err)
+	if !assert.NotEmpty(t, list) {
+		return
+	}
+	obj := &list[0]
+	obj.Done(time.Now())
+	assert.NoError(t, svc.Outbox().Update(obj))
+	assert.NoError(t, svc.Outbox().Retry(obj.ID))
+	obj, err = svc.Outbox().Get(obj.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, outbox.StatusPending, obj.Status)
+	assert.Nil(t, obj.Handled)
+	assert.Equal(t, ErrNotFound, svc.Outbox().Retry(-1))
+}
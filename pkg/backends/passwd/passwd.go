@@ -0,0 +1,159 @@
+// Package passwd hash and verify passwords of staff stored in database
+package passwd
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms of new hash
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// params of argon2id, see also RFC 9106
+const (
+	argonTime    uint32 = 1
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 2
+	argonKeyLen  uint32 = 32
+	argonSaltLen        = 16
+)
+
+// vars
+var (
+	ErrEmptyPassword = errors.New("empty password")
+	ErrUnknownAlgo   = errors.New("unknown password hash algorithm")
+	ErrInvalidHash   = errors.New("invalid password hash")
+
+	// BcryptCost is the cost of new bcrypt hash
+	BcryptCost = bcrypt.DefaultCost
+)
+
+// Hash returns a encoded hash of password with algo
+func Hash(algo, password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	switch algo {
+	case Argon2id, "":
+		salt := make([]byte, argonSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+			argonMemory, argonTime, argonThreads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case Bcrypt:
+		b, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", ErrUnknownAlgo
+}
+
+// Verify reports whether password matches the encoded hash,
+// supports argon2id, bcrypt and {SSHA}/{SHA} of LDAP userPassword
+func Verify(hashed, password string) bool {
+	if hashed == "" || password == "" {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(hashed, "$argon2id$"):
+		ok, err := verifyArgon2(hashed, password)
+		return err == nil && ok
+	case strings.HasPrefix(hashed, "$2a$"), strings.HasPrefix(hashed, "$2b$"), strings.HasPrefix(hashed, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+	case hasPrefixFold(hashed, "{SSHA}"):
+		data, err := base64.StdEncoding.DecodeString(hashed[6:])
+		if err != nil || len(data) <= sha1.Size {
+			return false
+		}
+		sum := sha1.Sum(append([]byte(password), data[sha1.Size:]...))
+		return subtle.ConstantTimeCompare(sum[:], data[:sha1.Size]) == 1
+	case hasPrefixFold(hashed, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(sum[:])), []byte(hashed[5:])) == 1
+	}
+	return false
+}
+
+// Supported reports whether the scheme of hashed is known by Verify
+func Supported(hashed string) bool {
+	switch {
+	case strings.HasPrefix(hashed, "$argon2id$"),
+		strings.HasPrefix(hashed, "$2a$"), strings.HasPrefix(hashed, "$2b$"), strings.HasPrefix(hashed, "$2y$"),
+		hasPrefixFold(hashed, "{SSHA}"), hasPrefixFold(hashed, "{SHA}"):
+		return true
+	}
+	return false
+}
+
+// NeedsRehash reports whether the hash should be replaced by a new one of algo
+func NeedsRehash(hashed, algo string) bool {
+	switch algo {
+	case Argon2id, "":
+		p, _, _, err := decodeArgon2(hashed)
+		return err != nil || p != (argonParams{argonMemory, argonTime, argonThreads})
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hashed))
+		return err != nil || cost != BcryptCost
+	}
+	return false
+}
+
+var b64 = base64.RawStdEncoding
+
+type argonParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func decodeArgon2(hashed string) (p argonParams, salt, key []byte, err error) {
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		err = ErrInvalidHash
+		return
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return
+	}
+	if version != argon2.Version {
+		err = ErrInvalidHash
+		return
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return
+	}
+	if salt, err = b64.DecodeString(parts[4]); err != nil {
+		return
+	}
+	key, err = b64.DecodeString(parts[5])
+	return
+}
+
+func verifyArgon2(hashed, password string) (bool, error) {
+	p, salt, key, err := decodeArgon2(hashed)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,37 @@
+package passwd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	for _, algo := range []string{Argon2id, Bcrypt} {
+		hashed, err := Hash(algo, "secret")
+		assert.NoError(t, err)
+		assert.True(t, Verify(hashed, "secret"), algo)
+		assert.False(t, Verify(hashed, "Secret"), algo)
+		assert.False(t, NeedsRehash(hashed, algo), algo)
+	}
+
+	_, err := Hash("md5", "secret")
+	assert.Equal(t, ErrUnknownAlgo, err)
+	_, err = Hash(Argon2id, "")
+	assert.Equal(t, ErrEmptyPassword, err)
+}
+
+func TestVerifyLDAP(t *testing.T) {
+	// {SSHA} of secret with salt 1234
+	assert.True(t, Verify("{SSHA}kRnWqCDFvZFoV7A6cTGBdq1Xv7cxMjM0", "secret"))
+	assert.False(t, Verify("{SSHA}kRnWqCDFvZFoV7A6cTGBdq1Xv7cxMjM0", "wrong"))
+	// slappasswd -h {SHA} -s secret
+	assert.True(t, Verify("{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "secret"))
+	assert.True(t, NeedsRehash("{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", Argon2id))
+	assert.False(t, Verify("", "secret"))
+
+	assert.True(t, Supported("{SSHA}kRnWqCDFvZFoV7A6cTGBdq1Xv7cxMjM0"))
+	assert.True(t, Supported("{sha}5en6G6MezRroT3XKqkdPOmY/BfQ="))
+	assert.False(t, Supported("{CRYPT}$6$salt$hash"))
+	assert.False(t, Supported("{SSHA512}abcd"))
+}
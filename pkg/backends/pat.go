@@ -0,0 +1,55 @@
+package backends
+
+import (
+	"github.com/liut/staffio/pkg/models/pat"
+)
+
+var _ pat.Store = (*patStore)(nil)
+
+type patStore struct{}
+
+const patColumns = "id, uid, name, hash, scopes, expires, last_used, created"
+
+func (s *patStore) All(uid string) (data []pat.Token, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, "SELECT "+patColumns+" FROM personal_token WHERE uid = $1 ORDER BY id DESC", uid)
+	})
+	return
+}
+
+func (s *patStore) Get(hash string) (obj *pat.Token, err error) {
+	obj = new(pat.Token)
+	err = withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT "+patColumns+" FROM personal_token WHERE hash = $1", hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *patStore) Save(obj *pat.Token) error {
+	return withTxQuery(func(db dbTxer) error {
+		return db.QueryRow(`INSERT INTO personal_token(uid, name, hash, scopes, expires)
+		 VALUES($1, $2, $3, $4, $5) RETURNING id, created`,
+			obj.UID, obj.Name, obj.Hash, obj.Scopes, obj.Expires).Scan(&obj.ID, &obj.Created)
+	})
+}
+
+func (s *patStore) Touch(id int) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("UPDATE personal_token SET last_used = CURRENT_TIMESTAMP WHERE id = $1", id)
+		return
+	})
+}
+
+func (s *patStore) Delete(uid string, id int) error {
+	return withTxExec("DELETE FROM personal_token WHERE uid = $1 AND id = $2", uid, id)
+}
+
+func (s *patStore) Clear(uid string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("DELETE FROM personal_token WHERE uid = $1", uid)
+		return
+	})
+}
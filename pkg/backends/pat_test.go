@@ -0,0 +1,20 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/pat"
+)
+
+func TestPersonalToken(t *testing.T) {
+	tok, _, err := pat.New("test", "go test", []string{pat.ScopeStaff}, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, svc.Tokens().Save(tok))
+	assert.NotZero(t, tok.ID)
+	assert.Equal(t, ErrNotFound, svc.Tokens().Delete("eagle", tok.ID), "other's token")
+	assert.NoError(t, svc.Tokens().Delete("test", tok.ID))
+	assert.Equal(t, ErrNotFound, svc.Tokens().Delete("test", tok.ID))
+}
@@ -0,0 +1,463 @@
+package backends
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/liut/staffio-backend/schema"
+	"github.com/liut/staffio/pkg/backends/passwd"
+)
+
+const staffColumns = `uid, cn, gn, sn, nickname, birthday, gender, email, mobile, tel,
+ eid, etype, avatar_path, jpeg_photo, description, join_date, idcn, created, updated`
+
+// peopleStore is the sql implementation of people and group stores, without LDAP
+type peopleStore struct {
+	hashAlgo string
+	// events are published in the transactions of changes, but not while migrating
+	events bool
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+var _ peopleStorer = (*peopleStore)(nil)
+
+func newPeopleStore(hashAlgo string, events bool) *peopleStore {
+	return &peopleStore{hashAlgo: hashAlgo, events: events}
+}
+
+// publishTx publishes ev in the transaction of its change if the store has events
+func (s *peopleStore) publishTx(db dber, ev Event) error {
+	if !s.events {
+		return nil
+	}
+	return publishTx(db, ev)
+}
+
+// publishStaff publishes StaffUpdated of uid as saved in the transaction
+func (s *peopleStore) publishStaff(db dbTxer, uid string) error {
+	if !s.events {
+		return nil
+	}
+	row := new(staffRow)
+	if err := db.Get(row, "SELECT "+staffColumns+" FROM staff WHERE uid = $1", uid); err != nil {
+		return err
+	}
+	return publishTx(db, &StaffUpdated{Staff: newEventStaff(row.toPeople())})
+}
+
+type staffRow struct {
+	UID            string    `db:"uid"`
+	CommonName     string    `db:"cn"`
+	GivenName      string    `db:"gn"`
+	Surname        string    `db:"sn"`
+	Nickname       string    `db:"nickname"`
+	Birthday       string    `db:"birthday"`
+	Gender         string    `db:"gender"`
+	Email          string    `db:"email"`
+	Mobile         string    `db:"mobile"`
+	Tel            string    `db:"tel"`
+	EmployeeNumber int       `db:"eid"`
+	EmployeeType   string    `db:"etype"`
+	AvatarPath     string    `db:"avatar_path"`
+	JpegPhoto      []byte    `db:"jpeg_photo"`
+	Description    string    `db:"description"`
+	JoinDate       string    `db:"join_date"`
+	IDCN           string    `db:"idcn"`
+	Created        time.Time `db:"created"`
+	Updated        time.Time `db:"updated"`
+}
+
+func (r *staffRow) toPeople() *schema.People {
+	created, updated := r.Created, r.Updated
+	return &schema.People{
+		UID:            r.UID,
+		CommonName:     r.CommonName,
+		GivenName:      r.GivenName,
+		Surname:        r.Surname,
+		Nickname:       r.Nickname,
+		Birthday:       r.Birthday,
+		Gender:         r.Gender,
+		Email:          r.Email,
+		Mobile:         r.Mobile,
+		Tel:            r.Tel,
+		EmployeeNumber: r.EmployeeNumber,
+		EmployeeType:   r.EmployeeType,
+		AvatarPath:     r.AvatarPath,
+		JpegPhoto:      r.JpegPhoto,
+		Description:    r.Description,
+		JoinDate:       r.JoinDate,
+		IDCN:           r.IDCN,
+		Created:        &created,
+		Modified:       &updated,
+		DN:             "uid=" + r.UID,
+	}
+}
+
+func storeError(err error) error {
+	if err == ErrNotFound {
+		return ErrStoreNotFound
+	}
+	return err
+}
+
+// All browse people with spec, the Limit of spec is a page size like LDAP, so ignored
+func (s *peopleStore) All(spec *Spec) (data schema.Peoples) {
+	if spec == nil {
+		spec = new(Spec)
+	}
+	var (
+		where string
+		args  []interface{}
+	)
+	if len(spec.UIDs) > 0 {
+		where, args = " WHERE uid = ANY($1)", []interface{}{pq.StringArray(spec.UIDs)}
+	} else if len(spec.Name) > 0 {
+		where, args = " WHERE cn = $1", []interface{}{spec.Name}
+	} else if len(spec.Email) > 0 {
+		where, args = " WHERE email = $1", []interface{}{spec.Email}
+	} else if len(spec.Mobile) > 0 {
+		where, args = " WHERE mobile = $1", []interface{}{spec.Mobile}
+	}
+	var rows []staffRow
+	err := withDbQuery(func(db dber) error {
+		return db.Select(&rows, "SELECT "+staffColumns+" FROM staff"+where+" ORDER BY id", args...)
+	})
+	if err != nil {
+		logger().Infow("list staff fail", "spec", spec, "err", err)
+		return
+	}
+	data = make(schema.Peoples, len(rows))
+	for i := range rows {
+		data[i] = *rows[i].toPeople()
+	}
+	return
+}
+
+// Get with uid
+func (s *peopleStore) Get(uid string) (*schema.People, error) {
+	row := new(staffRow)
+	err := withDbQuery(func(db dber) error {
+		return db.Get(row, "SELECT "+staffColumns+" FROM staff WHERE uid = $1", uid)
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return row.toPeople(), nil
+}
+
+// GetByDN with dn like uid=name or uid=name,ou=people,dc=example,dc=org
+func (s *peopleStore) GetByDN(dn string) (*schema.People, error) {
+	uid, ok := uidFromDN(dn)
+	if !ok {
+		return nil, ErrStoreNotFound
+	}
+	return s.Get(uid)
+}
+
+func uidFromDN(dn string) (string, bool) {
+	if !strings.HasPrefix(dn, "uid=") {
+		return "", false
+	}
+	uid := dn[4:]
+	if pos := strings.Index(uid, ","); pos > 0 {
+		uid = uid[:pos]
+	}
+	return uid, uid != ""
+}
+
+// Delete with uid, memberships of group are removed too
+func (s *peopleStore) Delete(uid string) error {
+	var missing bool
+	err := withTxQuery(func(db dbTxer) error {
+		res, err := db.Exec("DELETE FROM staff WHERE uid = $1", uid)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			missing = true // withTxQuery would report it as a db error
+			return nil
+		}
+		if _, err = db.Exec("DELETE FROM staff_group_member WHERE uid = $1", uid); err != nil {
+			return err
+		}
+		return s.publishTx(db, &StaffDeleted{UID: uid})
+	})
+	if err == nil && missing {
+		return ErrStoreNotFound
+	}
+	return afterCommit(err)
+}
+
+// Save add or update, StaffCreated or StaffUpdated is published
+func (s *peopleStore) Save(staff *schema.People) (isNew bool, err error) {
+	if staff.UID == "" {
+		return false, ErrEmptyVal
+	}
+	err = afterCommit(withTxQuery(func(db dbTxer) error {
+		var id int
+		err := db.Get(&id, "SELECT id FROM staff WHERE uid = $1", staff.UID)
+		if err == ErrNoRows {
+			isNew = true
+			_, err = db.Exec(`INSERT INTO staff(uid, cn, gn, sn, nickname, birthday, gender, email, mobile, tel,
+			 eid, etype, avatar_path, jpeg_photo, description, join_date, idcn)
+			 VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+				staff.UID, staff.GetCommonName(), staff.GivenName, staff.Surname, staff.Nickname,
+				staff.Birthday, genderCode(staff.Gender), staff.Email, staff.Mobile, staff.Tel,
+				staff.EmployeeNumber, staff.EmployeeType, staff.AvatarPath, staff.JpegPhoto,
+				staff.Description, staff.JoinDate, staff.IDCN)
+			if err != nil {
+				return err
+			}
+			return s.publishTx(db, &StaffCreated{Staff: newEventStaff(staff)})
+		}
+		if err != nil {
+			return err
+		}
+		if err = updateStaff(db, staff); err != nil {
+			return err
+		}
+		return s.publishStaff(db, staff.UID)
+	}))
+	if err != nil {
+		logger().Infow("save staff fail", "uid", staff.UID, "err", err)
+	}
+	return
+}
+
+// updateStaff replace all attributes with the given record, empty values clear them,
+// but eid and jpeg_photo are kept if not given
+func updateStaff(db dber, staff *schema.People) error {
+	_, err := db.Exec(`UPDATE staff SET cn = $2, gn = $3, sn = $4, nickname = $5, email = $6, mobile = $7,
+	 avatar_path = $8, gender = $9, birthday = $10, description = $11, tel = $12,
+	 eid = CASE WHEN $13 > 0 THEN $13 ELSE eid END, etype = $14,
+	 jpeg_photo = COALESCE($15, jpeg_photo), join_date = $16, idcn = $17,
+	 updated = CURRENT_TIMESTAMP
+	 WHERE uid = $1`,
+		staff.UID, staff.GetCommonName(), staff.GivenName, staff.Surname, staff.Nickname,
+		staff.Email, staff.Mobile, staff.AvatarPath, genderCode(staff.Gender), staff.Birthday,
+		staff.Description, staff.Tel, staff.EmployeeNumber, staff.EmployeeType,
+		jpegOrNil(staff.JpegPhoto), staff.JoinDate, staff.IDCN)
+	return err
+}
+
+func jpegOrNil(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+func genderCode(s string) string {
+	if s == "" {
+		return s
+	}
+	return s[0:1]
+}
+
+// ModifyBySelf update by self with password, only the attributes of profile are replaced,
+// eid, etype, join_date, idcn and jpeg_photo are left to keepers
+func (s *peopleStore) ModifyBySelf(uid, password string, staff *schema.People) error {
+	if _, err := s.Authenticate(uid, password); err != nil {
+		return err
+	}
+	return afterCommit(withTxQuery(func(db dbTxer) error {
+		_, err := db.Exec(`UPDATE staff SET cn = $2, gn = $3, sn = $4, nickname = $5, email = $6, mobile = $7,
+		 avatar_path = $8, gender = $9, birthday = $10, description = $11, tel = $12,
+		 updated = CURRENT_TIMESTAMP
+		 WHERE uid = $1`,
+			uid, staff.GetCommonName(), staff.GivenName, staff.Surname, staff.Nickname,
+			staff.Email, staff.Mobile, staff.AvatarPath, genderCode(staff.Gender), staff.Birthday,
+			staff.Description, staff.Tel)
+		if err != nil {
+			return err
+		}
+		return s.publishStaff(db, uid)
+	}))
+}
+
+// Authenticate with uid and password, the hash will be upgraded if need
+func (s *peopleStore) Authenticate(uid, password string) (*schema.People, error) {
+	var hashed string
+	err := withDbQuery(func(db dber) error {
+		return db.Get(&hashed, "SELECT password_hash FROM staff WHERE uid = $1", uid)
+	})
+	if err != nil || hashed == "" {
+		// spend the same time as a wrong password, not to tell who exists
+		passwd.Verify(s.dummyHash(), password)
+		logger().Infow("authenticate fail", "uid", uid, "err", err)
+		return nil, ErrLogin
+	}
+	if !passwd.Verify(hashed, password) {
+		logger().Infow("authenticate fail", "uid", uid)
+		return nil, ErrLogin
+	}
+	if passwd.NeedsRehash(hashed, s.hashAlgo) {
+		if err = s.savePassword(uid, password, nil); err != nil {
+			logger().Infow("rehash password fail", "uid", uid, "err", err)
+		}
+	}
+	return s.Get(uid)
+}
+
+// dummyHash is verified for unknown uid
+func (s *peopleStore) dummyHash() string {
+	s.dummyOnce.Do(func() {
+		s.dummy, _ = passwd.Hash(s.hashAlgo, "dummy password")
+	})
+	return s.dummy
+}
+
+// savePassword hashes password of uid, ev is published with it if not nil
+func (s *peopleStore) savePassword(uid, password string, ev Event) error {
+	hashed, err := passwd.Hash(s.hashAlgo, password)
+	if err != nil {
+		return err
+	}
+	var missing bool
+	err = withTxQuery(func(db dbTxer) error {
+		res, err := db.Exec(`UPDATE staff SET password_hash = $1, updated = CURRENT_TIMESTAMP
+		 WHERE uid = $2`, hashed, uid)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			missing = true // withTxQuery would report it as a db error
+			return nil
+		}
+		if ev == nil {
+			return nil
+		}
+		return s.publishTx(db, ev)
+	})
+	if err == nil && missing {
+		return ErrStoreNotFound
+	}
+	return afterCommit(err)
+}
+
+// PasswordChange by self
+func (s *peopleStore) PasswordChange(uid, oldPassword, newPassword string) error {
+	if _, err := s.Authenticate(uid, oldPassword); err != nil {
+		return err
+	}
+	return s.savePassword(uid, newPassword, &PasswordChanged{UID: uid})
+}
+
+// PasswordReset by administrator
+func (s *peopleStore) PasswordReset(uid, newPassword string) error {
+	return s.savePassword(uid, newPassword, &PasswordChanged{UID: uid, Reset: true})
+}
+
+// SetPasswordHash save a hash from other store directly, like userPassword of LDAP
+func (s *peopleStore) SetPasswordHash(uid, hashed string) error {
+	return withTxQuery(func(db dbTxer) error {
+		_, err := db.Exec("UPDATE staff SET password_hash = $1 WHERE uid = $2", hashed, uid)
+		return err
+	})
+}
+
+type groupRow struct {
+	Name        string         `db:"name"`
+	Description string         `db:"description"`
+	Members     pq.StringArray `db:"members"`
+}
+
+const groupSelect = `SELECT g.name, g.description,
+ COALESCE(array_agg(m.uid ORDER BY m.created, m.uid) FILTER (WHERE m.uid IS NOT NULL), '{}') AS members
+ FROM staff_group g LEFT JOIN staff_group_member m ON m.group_name = g.name`
+
+// AllGroup ...
+func (s *peopleStore) AllGroup() (data []Group, err error) {
+	var rows []groupRow
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&rows, groupSelect+" GROUP BY g.id ORDER BY g.id")
+	})
+	if err != nil {
+		return
+	}
+	data = make([]Group, len(rows))
+	for i, row := range rows {
+		data[i] = Group{Name: row.Name, Description: row.Description, Members: []string(row.Members)}
+	}
+	return
+}
+
+// GetGroup ...
+func (s *peopleStore) GetGroup(name string) (*Group, error) {
+	row := new(groupRow)
+	err := withDbQuery(func(db dber) error {
+		return db.Get(row, groupSelect+" WHERE g.name = $1 GROUP BY g.id", name)
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &Group{Name: row.Name, Description: row.Description, Members: []string(row.Members)}, nil
+}
+
+// SaveGroup add or update group and replace its members
+func (s *peopleStore) SaveGroup(group *Group) error {
+	if group.Name == "" {
+		return ErrEmptyVal
+	}
+	return afterCommit(withTxQuery(func(db dbTxer) error {
+		_, err := db.Exec(`INSERT INTO staff_group(name, description) VALUES($1, $2)
+		 ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description`, group.Name, group.Description)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("DELETE FROM staff_group_member WHERE group_name = $1 AND NOT (uid = ANY($2))",
+			group.Name, pq.StringArray(group.Members))
+		if err != nil {
+			return err
+		}
+		for _, uid := range group.Members {
+			_, err = db.Exec(`INSERT INTO staff_group_member(group_name, uid) VALUES($1, $2)
+			 ON CONFLICT DO NOTHING`, group.Name, uid)
+			if err != nil {
+				return err
+			}
+		}
+		return s.publishTx(db, &GroupChanged{Name: group.Name, Group: group})
+	}))
+}
+
+// EraseGroup ...
+func (s *peopleStore) EraseGroup(name string) error {
+	return afterCommit(withTxQuery(func(db dbTxer) error {
+		_, err := db.Exec("DELETE FROM staff_group_member WHERE group_name = $1", name)
+		if err == nil {
+			_, err = db.Exec("DELETE FROM staff_group WHERE name = $1", name)
+		}
+		if err != nil {
+			return err
+		}
+		return s.publishTx(db, &GroupChanged{Name: name})
+	}))
+}
+
+// Ready ...
+func (s *peopleStore) Ready() error {
+	return withDbQuery(func(db dber) error {
+		_, err := db.Exec("SELECT 1 FROM staff LIMIT 1")
+		return err
+	})
+}
+
+// Close ...
+func (s *peopleStore) Close() {}
+
+// PoolStats returns stats of database connections
+func (s *peopleStore) PoolStats() *PoolStats {
+	st := getDb().Stats()
+	return &PoolStats{
+		Misses:     uint32(st.WaitCount),
+		TotalConns: uint32(st.OpenConnections),
+		IdleConns:  uint32(st.Idle),
+		StaleConns: uint32(st.MaxIdleClosed + st.MaxLifetimeClosed),
+	}
+}
@@ -0,0 +1,41 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/outbox"
+)
+
+func TestPeopleStore(t *testing.T) {
+	s := newPeopleStore("argon2id", false)
+	assert.Equal(t, ErrStoreNotFound, s.PasswordReset("nobody", "Quiet-Harbor-1729"))
+	assert.Equal(t, ErrStoreNotFound, s.Delete("nobody"))
+
+	staff := &models.Staff{UID: "sqltest", GivenName: "Sql", Surname: "Test", Email: "sqltest@example.net"}
+	isNew, err := s.Save(staff)
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+	assert.NoError(t, s.PasswordReset(staff.UID, "Quiet-Harbor-1729"))
+	_, err = s.Authenticate(staff.UID, "Quiet-Harbor-1729")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Delete(staff.UID))
+	assert.Equal(t, ErrStoreNotFound, s.Delete(staff.UID))
+}
+
+func TestPeopleStoreEvents(t *testing.T) {
+	s := newPeopleStore("argon2id", true)
+	staff := &models.Staff{UID: "sqlevent", GivenName: "Sql", Surname: "Event", Email: "sqlevent@example.net"}
+	_, err := s.Save(staff)
+	assert.NoError(t, err)
+	defer s.Delete(staff.UID)
+
+	ob := &outboxStore{}
+	data, err := ob.Query(&outbox.Spec{Topic: TopicStaffCreated, Subscriber: "welcome"})
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, data) {
+		assert.Contains(t, data[0].Payload, `"uid":"sqlevent"`)
+	}
+}
@@ -0,0 +1,32 @@
+package backends
+
+import (
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/models/types"
+)
+
+var _ prefs.Store = (*prefStore)(nil)
+
+type prefStore struct{}
+
+func (s *prefStore) Get(uid string) (*prefs.Prefs, error) {
+	obj := &prefs.Prefs{UID: uid}
+	err := withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT uid, lang, channels, updated FROM staff_pref WHERE uid = $1", uid)
+	})
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *prefStore) Save(obj *prefs.Prefs) error {
+	return withTxQuery(func(db dbTxer) error {
+		if obj.Channels == nil {
+			obj.Channels = types.StringSlice{}
+		}
+		return db.QueryRow(`INSERT INTO staff_pref(uid, lang, channels) VALUES($1, $2, $3)
+		 ON CONFLICT (uid) DO UPDATE SET lang = EXCLUDED.lang, channels = EXCLUDED.channels, updated = CURRENT_TIMESTAMP
+		 RETURNING updated`, obj.UID, obj.Lang, obj.Channels).Scan(&obj.Updated)
+	})
+}
@@ -0,0 +1,145 @@
+package backends
+
+import (
+	"sync"
+	"time"
+
+	"github.com/liut/staffio/pkg/backends/passwd"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/pwdpolicy"
+	"github.com/liut/staffio/pkg/models/pwned"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+var _ pwdpolicy.Store = (*pwdHistoryStore)(nil)
+
+type pwdHistoryStore struct{}
+
+func (s *pwdHistoryStore) Recent(uid string, n int) (data []pwdpolicy.Entry, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, `SELECT uid, hash, created FROM password_history
+		 WHERE uid = $1 ORDER BY created DESC, id DESC LIMIT $2`, uid, n)
+	})
+	return
+}
+
+func (s *pwdHistoryStore) Add(uid, hash string, keep int) error {
+	return withTxQuery(func(db dbTxer) error {
+		_, err := db.Exec("INSERT INTO password_history(uid, hash) VALUES($1, $2)", uid, hash)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`DELETE FROM password_history WHERE uid = $1 AND id NOT IN
+		 (SELECT id FROM password_history WHERE uid = $1 ORDER BY created DESC, id DESC LIMIT $2)`, uid, keep)
+		return err
+	})
+}
+
+// PasswordPolicy returns the policy of new passwords in settings
+func PasswordPolicy() pwdpolicy.Policy {
+	return pwdpolicy.Policy{
+		MinLength:  settings.Current.PasswordMinLength,
+		MinClasses: settings.Current.PasswordMinClasses,
+		History:    settings.Current.PasswordHistory,
+		MaxAge:     settings.Current.PasswordMaxAge,
+	}
+}
+
+// PersonalWords returns words of staff those can not be in a password
+func PersonalWords(staff *models.Staff) []string {
+	return []string{staff.UID, staff.CommonName, staff.GivenName, staff.Surname, staff.Nickname, staff.Email}
+}
+
+var (
+	pwnedMu     sync.Mutex
+	pwnedName   string
+	pwnedFilter *pwned.Filter
+)
+
+// pwnedLoaded returns the filter of breached passwords in settings, nil if none,
+// it is loaded again when the file in settings changed
+func pwnedLoaded() *pwned.Filter {
+	pwnedMu.Lock()
+	defer pwnedMu.Unlock()
+	name := settings.Current.PasswordPwnedFile
+	if name != pwnedName {
+		pwnedName, pwnedFilter = name, nil
+		if name != "" {
+			f, err := pwned.Load(name)
+			if err != nil {
+				logger().Warnw("load pwned filter fail", "name", name, "err", err)
+			} else {
+				logger().Infow("loaded pwned filter", "name", name, "count", f.Len())
+				pwnedFilter = f
+			}
+		}
+	}
+	return pwnedFilter
+}
+
+// IsPwned returns true if password is in the breached corpus
+func IsPwned(password string) bool {
+	f := pwnedLoaded()
+	return f != nil && f.Contains(password)
+}
+
+// checkPassword checks a new password of uid with the policy, history and breached corpus, returns *pwdpolicy.Error
+func checkPassword(svc Servicer, uid, password string) error {
+	p := PasswordPolicy()
+	personal := []string{uid}
+	if staff, err := svc.Get(uid); err == nil {
+		personal = PersonalWords(staff)
+	}
+	err := p.Check(password, personal, func(password string) bool {
+		entries, err := svc.PasswordHistory().Recent(uid, p.History)
+		if err != nil {
+			logger().Infow("load password history fail", "uid", uid, "err", err)
+			return false
+		}
+		for _, e := range entries {
+			if passwd.Verify(e.Hash, password) {
+				return true
+			}
+		}
+		return false
+	})
+	if err == nil && IsPwned(password) {
+		err = &pwdpolicy.Error{Violations: []pwdpolicy.Violation{{
+			Rule:    pwdpolicy.RuleBreached,
+			Message: "this password has appeared in a data breach, choose another one",
+		}}}
+	}
+	return err
+}
+
+// rememberPassword adds password of uid into history, the time is the change time for max age
+func rememberPassword(hs pwdpolicy.Store, uid, password string) {
+	hashed, err := passwd.Hash(settings.Current.PasswordHash, password)
+	if err == nil {
+		keep := PasswordPolicy().History
+		if keep < 1 {
+			keep = 1
+		}
+		err = hs.Add(uid, hashed, keep)
+	}
+	if err != nil {
+		logger().Infow("remember password fail", "uid", uid, "err", err)
+	}
+}
+
+// PasswordChangedAt returns the last change time of password of uid, zero if unknown,
+// the current password is remembered as a start when unknown and not empty
+func PasswordChangedAt(svc Servicer, uid, current string) time.Time {
+	entries, err := svc.PasswordHistory().Recent(uid, 1)
+	if err != nil {
+		logger().Infow("load password history fail", "uid", uid, "err", err)
+		return time.Time{}
+	}
+	if len(entries) > 0 {
+		return entries[0].Created
+	}
+	if current != "" {
+		rememberPassword(svc.PasswordHistory(), uid, current)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,54 @@
+package backends
+
+import (
+	"github.com/liut/staffio/pkg/models/saml"
+)
+
+var _ saml.Store = (*samlStore)(nil)
+
+type samlStore struct{}
+
+// Get
+func (s *samlStore) Get(entityID string) (obj *saml.ServiceProvider, err error) {
+	obj = new(saml.ServiceProvider)
+	err = withDbQuery(func(db dber) error {
+		return db.Get(obj, `SELECT id, entity_id, name, acs_url, nameid_format, metadata, created
+		 FROM saml_service_provider WHERE entity_id = $1`, entityID)
+	})
+	return
+}
+
+// 查询
+func (s *samlStore) All() (data []saml.ServiceProvider, err error) {
+	data = make([]saml.ServiceProvider, 0)
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, `SELECT id, entity_id, name, acs_url, nameid_format, metadata, created
+		 FROM saml_service_provider ORDER BY id`)
+	})
+	return
+}
+
+func (s *samlStore) Store(sp *saml.ServiceProvider) error {
+	if sp.EntityID == "" || sp.ACSURL == "" {
+		return ErrEmptyVal
+	}
+	return withTxQuery(func(db dbTxer) error {
+		err := db.Get(&sp.ID, `INSERT INTO saml_service_provider(entity_id, name, acs_url, nameid_format, metadata)
+		 VALUES($1, $2, $3, $4, $5)
+		 ON CONFLICT (entity_id) DO UPDATE SET (name, acs_url, nameid_format, metadata, updated) =
+		 (EXCLUDED.name, EXCLUDED.acs_url, EXCLUDED.nameid_format, EXCLUDED.metadata, CURRENT_TIMESTAMP)
+		 RETURNING id`,
+			sp.EntityID, sp.Name, sp.ACSURL, sp.NameIDFormat, sp.Metadata)
+		if err != nil {
+			logger().Infow("store service provider fail", "entityID", sp.EntityID, "err", err)
+		}
+		return err
+	})
+}
+
+func (s *samlStore) Delete(entityID string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("DELETE FROM saml_service_provider WHERE entity_id = $1", entityID)
+		return
+	})
+}
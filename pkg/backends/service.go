@@ -7,14 +7,29 @@ import (
 	"github.com/liut/staffio-backend/schema"
 	"github.com/liut/staffio/pkg/common"
 	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
 	"github.com/liut/staffio/pkg/models/cas"
+	"github.com/liut/staffio/pkg/models/inbox"
+	"github.com/liut/staffio/pkg/models/mailq"
+	"github.com/liut/staffio/pkg/models/outbox"
+	"github.com/liut/staffio/pkg/models/pat"
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/models/pwdpolicy"
+	"github.com/liut/staffio/pkg/models/saml"
+	"github.com/liut/staffio/pkg/models/sessions"
 	"github.com/liut/staffio/pkg/models/team"
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/models/totp"
+	"github.com/liut/staffio/pkg/models/webauthn"
+	"github.com/liut/staffio/pkg/models/webhook"
 	"github.com/liut/staffio/pkg/models/weekly"
+	"github.com/liut/staffio/pkg/settings"
 )
 
 // vars
 var (
 	ErrStoreNotFound = ldap.ErrNotFound
+	ErrLogin         = ldap.ErrLogin
 )
 
 // PoolStats ...
@@ -48,20 +63,75 @@ type Servicer interface {
 	PasswordForgot(at common.AliasType, target, uid string) error
 	PasswordResetTokenVerify(token string) (uid string, err error)
 	PasswordResetWithToken(login, token, passwd string) (err error)
+	PasswordResetWithCode(login, code, passwd string) error
+	MobileVerifySend(uid, mobile string) error
+	MobileVerifyConfirm(uid, code string) (mobile string, err error)
+	EmailChange(uid, email string) error
+	EmailChangeConfirm(token string) (uid, email string, err error)
+	LoginLinkSend(uid, service string) error
+	LoginLinkConfirm(token string) (uid string, err error)
 
 	Team() team.Store
 	Watch() team.WatchStore
 	Weekly() weekly.Store
+	SAML() saml.Store
+	TOTP() totp.Store
+	WebAuthn() webauthn.Store
+	Throttle() throttle.Store
+	PasswordHistory() pwdpolicy.Store
+	Audit() audit.Store
+	Sessions() sessions.Store
+	Tokens() pat.Store
+	Verify() models.VerifyStore
+	Prefs() prefs.Store
+	MailQueue() mailq.Store
+	Webhooks() webhook.Store
+	Outbox() outbox.Store
+	Inbox() inbox.Store
 
 	PoolStats() *PoolStats
+	CacheStats() *CacheStats
 }
 
+// peopleStorer is the store of people and groups, LDAP or sql
+type peopleStorer interface {
+	schema.Authenticator
+	schema.PeopleStore
+	schema.PasswordStore
+	schema.GroupStore
+
+	Ready() error
+	Close()
+	PoolStats() *PoolStats
+}
+
+// serviceImpl is the Servicer on stores of a backend, sql or memory, with people of LDAP or sql
 type serviceImpl struct {
-	*ldap.Store
-	osinStore   *DbStorage
-	teamStore   *teamStore
-	watchStore  *watchStore
-	weeklyStore *weeklyStore
+	peopleStorer
+	cas.TicketStore
+	osinStore   OSINStore
+	teamStore   team.Store
+	watchStore  team.WatchStore
+	weeklyStore weekly.Store
+	samlStore   saml.Store
+	totpStore   totp.Store
+	keyStore    webauthn.Store
+	limitStore  throttle.Store
+	pwdStore    pwdpolicy.Store
+	auditStore  audit.Store
+	loginStore  sessions.Store
+	verifyStore models.VerifyStore
+	patStore    pat.Store
+	prefStore   prefs.Store
+	mailqStore  mailq.Store
+	hookStore   webhook.Store
+	eventStore  outbox.Store
+	inboxStore  inbox.Store
+
+	// nextEID returns the employee number of a new staff
+	nextEID func() (int, error)
+	// demo logs links if mail is not ready and writes no user log, for the memory backend
+	demo bool
 }
 
 // LDAPConfig ...
@@ -76,31 +146,75 @@ func SetLDAP(c LDAPConfig) {
 
 var _ Servicer = (*serviceImpl)(nil)
 
-// NewService return new Servicer
-func NewService() Servicer {
+// NewLDAPStore returns the LDAP store of people and groups
+func NewLDAPStore() (*ldap.Store, error) {
 	cfg := ldap.NewConfig()
 	if ldapcfg != nil {
 		cfg.CopyFrom(*ldapcfg)
 	}
 	logger().Infow("new ldap config", "addr", cfg.Addr, "base", cfg.Base, "domain", cfg.Domain)
 
-	store, err := ldap.NewStore(cfg)
-	if err != nil {
-		log.Fatalf("new service ERR %s", err)
+	return ldap.NewStore(cfg)
+}
+
+// NewService return new Servicer with backend of settings
+func NewService() Servicer {
+	var store peopleStorer
+	ob := &outboxStore{}
+	switch settings.Current.Backend {
+	case "sql":
+		logger().Infow("new sql people store", "hash", settings.Current.PasswordHash)
+		store = newPeopleStore(settings.Current.PasswordHash, true)
+	case "memory":
+		fx := DemoFixtures()
+		if settings.Current.Fixtures != "" {
+			var err error
+			if fx, err = LoadFixtures(settings.Current.Fixtures); err != nil {
+				log.Fatalf("load fixtures ERR %s", err)
+			}
+		}
+		return NewMemoryService(fx)
+	case "ldap", "":
+		ls, err := NewLDAPStore()
+		if err != nil {
+			log.Fatalf("new service ERR %s", err)
+		}
+		store = &publishedPeople{peopleStorer: ls, ob: ob}
+	default:
+		log.Fatalf("unknown backend %q", settings.Current.Backend)
 	}
-	// LDAP is a special store
-	return &serviceImpl{
-		Store:       store,
-		osinStore:   NewStorage(),
-		teamStore:   &teamStore{},
-		watchStore:  &watchStore{store},
-		weeklyStore: &weeklyStore{},
+	svc := &serviceImpl{
+		peopleStorer: store,
+		TicketStore:  &ticketStore{},
+		osinStore:    NewStorage(),
+		teamStore:    &teamStore{},
+		watchStore:   &watchStore{store},
+		weeklyStore:  &weeklyStore{},
+		samlStore:    &samlStore{},
+		totpStore:    &totpStore{},
+		keyStore:     &webauthnStore{},
+		limitStore:   &throttleStore{},
+		pwdStore:     &pwdHistoryStore{},
+		auditStore:   &auditStore{},
+		loginStore:   &loginSessionStore{},
+		verifyStore:  &verifyStore{},
+		patStore:     &patStore{},
+		prefStore:    &prefStore{},
+		mailqStore:   &mailqStore{},
+		hookStore:    &webhookStore{},
+		eventStore:   ob,
+		inboxStore:   &inboxStore{},
+		nextEID:      NextStaffID,
 	}
-
+	if settings.Current.CacheTTL > 0 {
+		logger().Infow("new cached service", "ttl", settings.Current.CacheTTL, "size", settings.Current.CacheSize)
+		return NewCachedService(svc, settings.Current.CacheTTL, settings.Current.CacheSize)
+	}
+	return svc
 }
 
 func (s *serviceImpl) Ready() error {
-	return s.Store.Ready()
+	return s.peopleStorer.Ready()
 }
 
 func (s *serviceImpl) OSIN() OSINStore {
@@ -108,7 +222,7 @@ func (s *serviceImpl) OSIN() OSINStore {
 }
 
 func (s *serviceImpl) CloseAll() {
-	s.Store.Close()
+	s.peopleStorer.Close()
 	s.osinStore.Close()
 }
 
@@ -123,3 +237,64 @@ func (s *serviceImpl) Watch() team.WatchStore {
 func (s *serviceImpl) Weekly() weekly.Store {
 	return s.weeklyStore
 }
+
+func (s *serviceImpl) SAML() saml.Store {
+	return s.samlStore
+}
+
+func (s *serviceImpl) TOTP() totp.Store {
+	return s.totpStore
+}
+
+func (s *serviceImpl) WebAuthn() webauthn.Store {
+	return s.keyStore
+}
+
+func (s *serviceImpl) Throttle() throttle.Store {
+	return s.limitStore
+}
+
+func (s *serviceImpl) PasswordHistory() pwdpolicy.Store {
+	return s.pwdStore
+}
+
+func (s *serviceImpl) Audit() audit.Store {
+	return s.auditStore
+}
+
+func (s *serviceImpl) Sessions() sessions.Store {
+	return s.loginStore
+}
+
+func (s *serviceImpl) Tokens() pat.Store {
+	return s.patStore
+}
+
+func (s *serviceImpl) Verify() models.VerifyStore {
+	return s.verifyStore
+}
+
+func (s *serviceImpl) Prefs() prefs.Store {
+	return s.prefStore
+}
+
+func (s *serviceImpl) MailQueue() mailq.Store {
+	return s.mailqStore
+}
+
+func (s *serviceImpl) Webhooks() webhook.Store {
+	return s.hookStore
+}
+
+func (s *serviceImpl) Outbox() outbox.Store {
+	return s.eventStore
+}
+
+func (s *serviceImpl) Inbox() inbox.Store {
+	return s.inboxStore
+}
+
+// CacheStats returns nil without cache
+func (s *serviceImpl) CacheStats() *CacheStats {
+	return nil
+}
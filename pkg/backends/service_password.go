@@ -1,87 +1,178 @@
 package backends
 
 import (
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/dchest/passwordreset"
-	"gopkg.in/mail.v2"
 
+	"github.com/liut/staffio/pkg/backends/mail"
 	"github.com/liut/staffio/pkg/common"
 	"github.com/liut/staffio/pkg/models"
-	"github.com/liut/staffio/pkg/settings"
 )
 
 var (
 	ErrInvalidResetToken = errors.New("invalid reset token or not found")
-	ErrMailNotReady      = errors.New("email system is not ready")
+	ErrMailNotReady      = mail.ErrNotReady
 	ErrEmptyEmail        = errors.New("email is empty")
 
 	secret []byte
 )
 
+// SetPasswordSecret sets the key of signed links and of stored codes
 func SetPasswordSecret(s string) {
 	secret = []byte(s)
+	models.SetVerifyKey(secret)
 }
 
-func (s *serviceImpl) getResetHash(uid string) ([]byte, error) {
-	_, err := s.Get(uid)
-	if err != nil {
-		return nil, fmt.Errorf("no such user %s", uid)
+// PasswordChange by self, the new password must follow the policy
+func (s *serviceImpl) PasswordChange(uid, oldPassword, newPassword string) error {
+	if err := checkPassword(s, uid, newPassword); err != nil {
+		return err
 	}
-	uv, err := s.LoadVerify(uid)
-	if err != nil {
+	if err := s.peopleStorer.PasswordChange(uid, oldPassword, newPassword); err != nil {
+		return err
+	}
+	rememberPassword(s.pwdStore, uid, newPassword)
+	return nil
+}
+
+// PasswordReset by administrator or a reset token, the new password must follow the policy
+func (s *serviceImpl) PasswordReset(uid, newPassword string) error {
+	if err := checkPassword(s, uid, newPassword); err != nil {
+		return err
+	}
+	if err := s.peopleStorer.PasswordReset(uid, newPassword); err != nil {
+		return err
+	}
+	rememberPassword(s.pwdStore, uid, newPassword)
+	return nil
+}
+
+func (s *serviceImpl) getResetHash(uid string) ([]byte, error) {
+	uv, err := s.verifyStore.Get(uid, models.VerifyPassword)
+	if err != nil || uv.Type != common.AtEmail {
 		return nil, ErrInvalidResetToken
 	}
 	return uv.CodeHashBytes(), nil
 }
 
+// PasswordForgot sends a reset link to the email, or a code to the mobile of uid
 func (s *serviceImpl) PasswordForgot(at common.AliasType, target, uid string) (err error) {
-	var staff *models.Staff
-	staff, err = s.Get(uid)
+	return passwordForgot(s, s.passwordForgotPrepare, at, target, uid)
+}
+
+// passwordForgot checks target of uid, an unknown uid is the same as a wrong target,
+// prepare sends the link by email
+func passwordForgot(svc Servicer, prepare func(*models.Staff, string) error, at common.AliasType, target, uid string) error {
+	staff, err := svc.Get(uid)
 	if err != nil {
-		return
+		logger().Infow("password forgot fail", "uid", uid, "err", err)
+		return ErrForgotMismatch
 	}
-	if at != common.AtEmail {
-		err = fmt.Errorf("invalid alias type %s", at.String())
-		return
+	switch at {
+	case common.AtEmail:
+		if target != staff.Email {
+			return ErrForgotMismatch
+		}
+		return prepare(staff, mail.Reset)
+	case common.AtPhone:
+		if target != staff.Mobile {
+			return ErrForgotMismatch
+		}
+		return sendVerifyCode(svc.Verify(), models.VerifyPassword, uid, staff.Mobile, "reset password")
 	}
-	if at != common.AtEmail && target != staff.Email {
-		err = fmt.Errorf("incorrect email %s", target)
-		return
+	return fmt.Errorf("invalid alias type %s", at.String())
+}
+
+// passwordForgotPrepare mails staff a link to set password with template name
+func (s *serviceImpl) passwordForgotPrepare(staff *models.Staff, name string) error {
+	link, err := passwordLinkSend(s, staff, name)
+	if err == nil && !s.demo {
+		if e := WriteUserLog(staff.UID, "password forgot", name); e != nil {
+			logger().Warnw("userLog fail", "uid", staff.UID, "err", e)
+		}
 	}
-	return s.passwordForgotPrepare(staff)
+	return s.linkSent(staff.UID, link, err)
 }
 
-func (s *serviceImpl) passwordForgotPrepare(staff *models.Staff) (err error) {
+// linkSent returns err of mailing link to uid, but nil for demos if mail is not ready,
+// the link is logged instead so that demos can go on
+func (s *serviceImpl) linkSent(uid, link string, err error) error {
+	if err == ErrMailNotReady && s.demo {
+		logger().Infow("mail is not ready, go on with link", "uid", uid, "link", link)
+		return nil
+	}
+	return err
+}
+
+// passwordLinkSend mails staff a link to set password with template name, like reset or welcome,
+// the link is returned for logging if mail is not ready
+func passwordLinkSend(svc Servicer, staff *models.Staff, name string) (link string, err error) {
 	if staff.Email == "" {
-		return ErrEmptyEmail
+		return "", ErrEmptyEmail
 	}
-	uv := models.NewVerify(common.AtEmail, staff.Email, staff.UID)
-	err = s.SaveVerify(uv)
-	if err != nil {
+	uv := models.NewVerify(models.VerifyPassword, common.AtEmail, staff.Email, staff.UID)
+	if err = svc.Verify().Save(uv); err != nil {
 		return
 	}
-	err = WriteUserLog(staff.UID, "password forgot", fmt.Sprintf("id %d, ch %d", uv.Id, uv.CodeHash))
-	if err != nil {
-		logger().Warnw("userLog fail", "uid", staff.UID, "err", err)
-	}
-	// Generate reset token that expires in 2 hours
-	token := passwordreset.NewToken(staff.UID, 2*time.Hour, uv.CodeHashBytes(), secret)
-	err = sendResetEmail(staff, token)
+	token := passwordreset.NewToken(staff.UID, passwordLinkLife, uv.CodeHashBytes(), secret)
+	link = BaseURL + "/password/reset?rt=" + token
+	err = mailTo(svc, staff.UID, staff.Email, name, mail.Data{
+		"Name":  staff.Name(),
+		"UID":   staff.UID,
+		"Link":  link,
+		"Hours": int(passwordLinkLife / time.Hour),
+	})
 	return
 }
 
 func (s *serviceImpl) PasswordResetTokenVerify(token string) (uid string, err error) {
 	uid, err = passwordreset.VerifyToken(token, s.getResetHash, secret)
 	if err != nil {
-		logger().Warnw("passwordreset.VerifyToken fail", "token", token, "err", err)
+		logger().Warnw("passwordreset.VerifyToken fail", "err", err)
 	}
 	return
 }
 
+// PasswordResetWithCode resets the password with a code sent to the mobile
+func (s *serviceImpl) PasswordResetWithCode(login, code, passwd string) error {
+	return resetWithCode(s, login, code, passwd)
+}
+
+// MobileVerifySend sends a code to the new mobile of uid
+func (s *serviceImpl) MobileVerifySend(uid, mobile string) error {
+	return sendVerifyCode(s.verifyStore, models.VerifyMobile, uid, mobile, "verify your mobile")
+}
+
+// MobileVerifyConfirm saves the mobile which the code was sent to
+func (s *serviceImpl) MobileVerifyConfirm(uid, code string) (string, error) {
+	return confirmMobile(s, uid, code)
+}
+
+// EmailChange keeps the new email of uid pending until the link mailed to it is visited
+func (s *serviceImpl) EmailChange(uid, email string) error {
+	link, err := changeEmail(s, uid, email)
+	return s.linkSent(uid, link, err)
+}
+
+// EmailChangeConfirm saves the pending email with the token of link
+func (s *serviceImpl) EmailChangeConfirm(token string) (uid, email string, err error) {
+	return confirmEmail(s, token)
+}
+
+// LoginLinkSend mails uid a link to sign in without password
+func (s *serviceImpl) LoginLinkSend(uid, service string) error {
+	link, err := sendLoginLink(s, uid, service)
+	return s.linkSent(uid, link, err)
+}
+
+// LoginLinkConfirm returns the uid of a sign-in link and consumes it
+func (s *serviceImpl) LoginLinkConfirm(token string) (uid string, err error) {
+	return confirmLoginLink(s, token)
+}
+
 func (s *serviceImpl) PasswordResetWithToken(login, token, passwd string) (err error) {
 	var uid string
 	uid, err = s.PasswordResetTokenVerify(token)
@@ -92,108 +183,17 @@ func (s *serviceImpl) PasswordResetWithToken(login, token, passwd string) (err e
 	if login != uid {
 		return fmt.Errorf("invalid login %s", login)
 	}
-	// OK, reset password for uid (e.g. allow to change it)
-	err = s.PasswordReset(uid, passwd)
-	if err == nil {
-		qs := func(db dbTxer) error {
-			rs, de := db.Exec("DELETE FROM password_reset WHERE uid = $1", uid)
-			if de == nil {
-				ra, _ := rs.RowsAffected()
-				logger().Infow("deleted reset", "affect", ra)
-			}
-			return de
-		}
-		err = withTxQuery(qs)
-	}
-	return
-}
-
-func (s *serviceImpl) SaveVerify(uv *models.Verify) error {
-	qs := func(db dbTxer) error {
-		euv, err := s.LoadVerify(uv.Uid)
-		if err == nil {
-			str := `DELETE FROM password_reset WHERE id = $1`
-			_, err = db.Exec(str, euv.Id)
-			if err != nil {
-				logger().Warnw("DELETE password_reset fail", "uid", uv.Uid, "err", err)
-				return err
-			}
-		}
-
-		str := `INSERT INTO password_reset(type_id, target, uid, code_hash, life_seconds)
-		 VALUES($1, $2, $3, $4, $5) RETURNING id`
-		var id int
-		err = db.Get(&id, str, uv.Type, uv.Target, uv.Uid, uv.CodeHash, uv.LifeSeconds)
-		if err == nil {
-			logger().Infow("new password_reset", "id", id, "uid", uv.Uid, "target", uv.Target)
-			if id > 0 {
-				uv.Id = id
-			}
-
-			return nil
-		}
-		logger().Warnw("INSERT password_reset fail", "uid", uv.Uid, "err", err)
-		return err
-	}
-	return withTxQuery(qs)
-}
-
-func (s *serviceImpl) LoadVerify(uid string) (*models.Verify, error) {
-	var uv models.Verify
-	qs := func(db dber) error {
-		return db.Get(&uv, `SELECT id, uid, type_id, target, code_hash, life_seconds, created, updated FROM password_reset
-		 WHERE uid = $1 ORDER BY updated DESC LIMIT 1`, uid)
-	}
-	err := withDbQuery(qs)
+	// OK, reset password for uid (e.g. allow to change it), the token works once
+	uv, err := s.verifyStore.Get(uid, models.VerifyPassword)
 	if err != nil {
-		logger().Infow("query verify fail", "uid", uid, "err", err)
+		return ErrInvalidResetToken
 	}
-	return &uv, err
+	return resetWithVerify(s, uv, passwd, ErrInvalidResetToken)
 }
 
+// passwordLinkLife is how long a link to set password works
+const passwordLinkLife = 2 * time.Hour
+
 var (
 	BaseURL string
 )
-
-func sendResetEmail(staff *models.Staff, token string) error {
-	var (
-		smtpHost = settings.Current.MailHost
-		smtpPort = settings.Current.MailPort
-		smtpUser = settings.Current.MailSenderEmail
-		smtpPass = settings.Current.MailSenderPassword
-	)
-
-	if !settings.Current.MailEnabled || smtpHost == "" {
-		logger().Warnw("mail disabled or host is empty")
-		return ErrMailNotReady
-	}
-
-	m := mail.NewMessage()
-	m.SetHeader("From", fmt.Sprintf("%s <%s>", settings.Current.MailSenderName, smtpUser))
-	m.SetHeader("To", staff.Email)
-	m.SetHeader("Subject", "Password reset request")
-	m.SetBody("text/html", fmt.Sprintf(tplPasswordReset, staff.Name(), BaseURL, token))
-
-	logger().Infow("sending reset email", "email", staff.Email, "host", smtpHost, "port", smtpPort, "sender", smtpUser)
-
-	d := mail.NewDialer(smtpHost, smtpPort, smtpUser, smtpPass)
-
-	if settings.Current.MailTLSEnabled {
-		d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-		logger().Infow("enable tls")
-	}
-
-	if err := d.DialAndSend(m); err != nil {
-		logger().Warnw("send reset email failed", "host", smtpHost, "err", err)
-		return err
-	}
-	logger().Infow("send reset email OK", "email", staff.Email)
-	return nil
-}
-
-const (
-	// tplPasswordReset = `Dear %s: <br/><br/>
-	// To reset your password, pls <a href="%s/password/reset?rt=%s">click here</a>.`
-	tplPasswordReset = `Dear %s: <br/><br/>
-	To reset your password, pls <a href="%s/reset?token=%s">click here</a>.`
-)
@@ -4,13 +4,14 @@ import (
 	"fmt"
 
 	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/group"
 	"github.com/liut/staffio/pkg/models/team"
 )
 
 // save staff
 func (s *serviceImpl) SaveStaff(staff *models.Staff) error {
 	if staff.EmployeeNumber < 1 {
-		newID, err := NextStaffID()
+		newID, err := s.nextEID()
 		if err != nil {
 			return err
 		}
@@ -20,12 +21,6 @@ func (s *serviceImpl) SaveStaff(staff *models.Staff) error {
 	if err == nil {
 		if isNew {
 			logger().Infow("net staff", "staff", staff)
-			err = s.passwordForgotPrepare(staff)
-			if err != nil {
-				logger().Infow("email of new user password send fail", "err", err)
-			} else {
-				logger().Infow("send email OK")
-			}
 		}
 	} else {
 		logger().Warnw("save staff fail", "staff", staff, "err", err)
@@ -33,20 +28,14 @@ func (s *serviceImpl) SaveStaff(staff *models.Staff) error {
 	return err
 }
 
+// InGroup checks uid is a member of group gname or its subgroups
 func (s *serviceImpl) InGroup(gname, uid string) bool {
-	g, err := s.GetGroup(gname)
-	if err != nil {
-		logger().Infow("get group fail", "name", gname, "err", err)
-		return false
-	}
-	// log.Printf("check uid %s in %v", uid, g)
-	return g.Has(uid)
+	return group.Has(gname, uid, s.GetGroup)
 }
 
 func (s *serviceImpl) InGroupAny(uid string, names ...string) bool {
 	for _, gn := range names {
-		g, err := s.GetGroup(gn)
-		if err == nil && g.Has(uid) {
+		if s.InGroup(gn, uid) {
 			return true
 		}
 	}
@@ -81,6 +70,9 @@ func WriteUserLog(uid, subject, message string) error {
 func StoreTeamAndStaffs(svc Servicer, team *team.Team, staffs models.Staffs) (err error) {
 	if staffs != nil {
 		for _, staff := range staffs {
+			if old, e := svc.Get(staff.UID); e == nil {
+				FillStaff(&staff, old)
+			}
 			if err = svc.SaveStaff(&staff); err != nil {
 				logger().Infow("save staff fail", "staff", staff, "err", err)
 				return
@@ -104,3 +96,34 @@ func StoreTeamAndStaffs(svc Servicer, team *team.Team, staffs models.Staffs) (er
 
 	return
 }
+
+// FillStaff copies the attributes of old to the empty ones of staff,
+// for sources which know only a part of them, Save clears the empty attributes
+func FillStaff(staff, old *models.Staff) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&staff.CommonName, old.CommonName},
+		{&staff.GivenName, old.GivenName},
+		{&staff.Surname, old.Surname},
+		{&staff.Nickname, old.Nickname},
+		{&staff.Birthday, old.Birthday},
+		{&staff.Gender, old.Gender},
+		{&staff.Email, old.Email},
+		{&staff.Mobile, old.Mobile},
+		{&staff.Tel, old.Tel},
+		{&staff.EmployeeType, old.EmployeeType},
+		{&staff.AvatarPath, old.AvatarPath},
+		{&staff.Description, old.Description},
+		{&staff.JoinDate, old.JoinDate},
+		{&staff.IDCN, old.IDCN},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+	if staff.EmployeeNumber < 1 {
+		staff.EmployeeNumber = old.EmployeeNumber
+	}
+}
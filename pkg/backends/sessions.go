@@ -0,0 +1,62 @@
+package backends
+
+import (
+	"github.com/liut/staffio/pkg/models/sessions"
+)
+
+var _ sessions.Store = (*loginSessionStore)(nil)
+
+type loginSessionStore struct{}
+
+const loginSessionColumns = "id, uid, user_agent, ip, created, last_seen, actor"
+
+func (s *loginSessionStore) Get(id string) (obj *sessions.Session, err error) {
+	obj = new(sessions.Session)
+	err = withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT "+loginSessionColumns+" FROM login_session WHERE id = $1", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *loginSessionStore) Save(obj *sessions.Session) error {
+	return withTxQuery(func(db dbTxer) error {
+		return db.QueryRow(`INSERT INTO login_session(id, uid, user_agent, ip, actor)
+		 VALUES($1, $2, $3, $4, $5) RETURNING created, last_seen`,
+			obj.ID, obj.UID, obj.UserAgent, obj.IP, obj.Actor).Scan(&obj.Created, &obj.LastSeen)
+	})
+}
+
+func (s *loginSessionStore) Touch(id, ip string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("UPDATE login_session SET last_seen = CURRENT_TIMESTAMP, ip = $2 WHERE id = $1", id, ip)
+		return
+	})
+}
+
+func (s *loginSessionStore) All(uid string) (data []sessions.Session, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, "SELECT "+loginSessionColumns+" FROM login_session WHERE uid = $1 ORDER BY last_seen DESC", uid)
+	})
+	return
+}
+
+func (s *loginSessionStore) Active(limit int) (data []sessions.Session, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, "SELECT "+loginSessionColumns+" FROM login_session ORDER BY last_seen DESC LIMIT $1", limit)
+	})
+	return
+}
+
+func (s *loginSessionStore) Delete(uid, id string) error {
+	return withTxExec("DELETE FROM login_session WHERE uid = $1 AND id = $2", uid, id)
+}
+
+func (s *loginSessionStore) Clear(uid string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("DELETE FROM login_session WHERE uid = $1", uid)
+		return
+	})
+}
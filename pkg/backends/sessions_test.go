@@ -0,0 +1,19 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/sessions"
+)
+
+func TestLoginSession(t *testing.T) {
+	_, id, err := sessions.NewToken()
+	assert.NoError(t, err)
+	obj := &sessions.Session{ID: id, UID: "test", UserAgent: "go test", IP: "127.0.0.1"}
+	assert.NoError(t, svc.Sessions().Save(obj))
+	assert.Equal(t, ErrNotFound, svc.Sessions().Delete("eagle", id), "other's session")
+	assert.NoError(t, svc.Sessions().Delete("test", id))
+	assert.Equal(t, ErrNotFound, svc.Sessions().Delete("test", id))
+}
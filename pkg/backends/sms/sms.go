@@ -0,0 +1,102 @@
+// Package sms sends short text messages such as verification codes,
+// a sender is opened by a dsn like "log" or "file:///var/log/staffio/sms.log",
+// gateways plug in with Register
+package sms
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sender sends a text to a phone number
+type Sender interface {
+	Send(phone, text string) error
+}
+
+// SenderFunc is a func as Sender
+type SenderFunc func(phone, text string) error
+
+// Send calls f
+func (f SenderFunc) Send(phone, text string) error {
+	return f(phone, text)
+}
+
+// Opener returns a sender with the dsn of its scheme
+type Opener func(dsn *url.URL) (Sender, error)
+
+var (
+	mu      sync.RWMutex
+	openers = map[string]Opener{
+		"log":  openLog,
+		"file": openFile,
+	}
+)
+
+// Register adds a sender of scheme, replaces the old one
+func Register(scheme string, fn Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	openers[scheme] = fn
+}
+
+// Open returns a sender with the dsn, a bare name is the scheme
+func Open(dsn string) (Sender, error) {
+	if !strings.Contains(dsn, ":") {
+		dsn += ":"
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	mu.RLock()
+	fn, ok := openers[u.Scheme]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sms sender %q", u.Scheme)
+	}
+	return fn(u)
+}
+
+func openLog(_ *url.URL) (Sender, error) {
+	return SenderFunc(func(phone, text string) error {
+		logger().Infow("sms", "phone", phone, "text", text)
+		return nil
+	}), nil
+}
+
+// FileSender appends messages to a file, a line for each
+type FileSender struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func openFile(u *url.URL) (Sender, error) {
+	name := u.Path
+	if name == "" {
+		name = u.Opaque
+	}
+	if name == "" {
+		return nil, fmt.Errorf("empty path of sms file")
+	}
+	return &FileSender{Path: name}, nil
+}
+
+// Send appends a line of time, phone and text
+func (s *FileSender) Send(phone, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), phone, strings.Replace(text, "\n", " ", -1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
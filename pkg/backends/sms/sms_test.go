@@ -0,0 +1,50 @@
+package sms
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sms")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "sms.log")
+	s, err := Open("file://" + name)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send("13800138000", "code 123456"))
+	assert.NoError(t, s.Send("13800138001", "line\nbreak"))
+	b, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.True(t, strings.HasSuffix(lines[0], "\t13800138000\tcode 123456"))
+		assert.True(t, strings.HasSuffix(lines[1], "\tline break"))
+	}
+
+	_, err = Open("file:")
+	assert.Error(t, err)
+	_, err = Open("log")
+	assert.NoError(t, err)
+	_, err = Open("nope://x")
+	assert.Error(t, err)
+
+	var sent string
+	Register("test", func(u *url.URL) (Sender, error) {
+		return SenderFunc(func(phone, text string) error {
+			sent = u.Host + " " + phone + " " + text
+			return nil
+		}), nil
+	})
+	s, err = Open("test://gw")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send("1", "hi"))
+	assert.Equal(t, "gw 1 hi", sent)
+}
@@ -59,10 +59,11 @@ func (s *teamStore) Store(t *team.Team) error {
 	if t.Name == "" {
 		return ErrEmptyVal
 	}
-	return withTxQuery(func(db dbTxer) (err error) {
+	return afterCommit(withTxQuery(func(db dbTxer) (err error) {
 		if t.ID < 1 {
 			var id int
 			if err = db.Get(&id, "SELECT id FROM teams WHERE name = $1", t.Name); err == nil {
+				t.ID = id
 				return
 			}
 			err = db.Get(&id, "INSERT INTO teams(name, parent_id, leaders, members) VALUES($1, $2, $3, $4) RETURNING id",
@@ -93,12 +94,15 @@ func (s *teamStore) Store(t *team.Team) error {
 		if err == nil {
 			err = dbTeamAddMember(db, t.ID, t.Members)
 		}
+		if err == nil {
+			err = publishTx(db, &TeamSaved{Team: *t})
+		}
 		return
-	})
+	}))
 }
 
 func (s *teamStore) Delete(id int) error {
-	return withTxQuery(func(db dbTxer) (err error) {
+	return afterCommit(withTxQuery(func(db dbTxer) (err error) {
 		_, err = db.Exec("DELETE FROM team_leader WHERE team_id = $1", id)
 		if err == nil {
 			_, err = db.Exec("DELETE FROM team_member WHERE team_id = $1", id)
@@ -106,16 +110,21 @@ func (s *teamStore) Delete(id int) error {
 				_, err = db.Exec("DELETE FROM teams WHERE id = $1", id)
 			}
 		}
-
+		if err == nil {
+			err = publishTx(db, &TeamDeleted{ID: id})
+		}
 		return
-	})
+	}))
 }
 
 // Add members
 func (s *teamStore) AddMember(id int, uids ...string) error {
-	return withTxQuery(func(db dbTxer) (err error) {
-		return dbTeamAddMember(db, id, uids)
-	})
+	return afterCommit(withTxQuery(func(db dbTxer) (err error) {
+		if err = dbTeamAddMember(db, id, uids); err == nil {
+			err = publishTx(db, &TeamMembersChanged{TeamID: id, Added: lowerUIDs(nil, uids...)})
+		}
+		return
+	}))
 }
 
 func dbTeamAddMember(db dbTxer, id int, uids []string) (err error) {
@@ -135,7 +144,7 @@ func dbTeamAddMember(db dbTxer, id int, uids []string) (err error) {
 
 // Remove members
 func (s *teamStore) RemoveMember(id int, uids ...string) error {
-	return withTxQuery(func(db dbTxer) (err error) {
+	return afterCommit(withTxQuery(func(db dbTxer) (err error) {
 		var arr []string
 		var bind = []interface{}{id}
 		for i, s := range uids {
@@ -148,29 +157,44 @@ func (s *teamStore) RemoveMember(id int, uids ...string) error {
 			logger().Infow("delete team member fail", "id", id, "uids", uids, "err", err)
 		} else {
 			logger().Infow("delete team member done", "id", id, "uids", uids)
+			err = publishTx(db, &TeamMembersChanged{TeamID: id, Removed: uids})
 		}
 		return
-	})
+	}))
 }
 
 // Add Manager
 func (s *teamStore) AddManager(id int, uid string) error {
-	return withTxQuery(func(db dbTxer) (err error) {
+	return afterCommit(withTxQuery(func(db dbTxer) (err error) {
 		uid = strings.ToLower(uid)
 		var existID int
 		if db.Get(&existID, "SELECT id FROM team_leader WHERE team_id = $1 AND leader = $2", id, uid) == nil {
 			return
 		}
-		_, err = db.Exec("INSERT INTO team_leader(team_id, leader) VALUES($1, $2)", id, uid)
+		if _, err = db.Exec("INSERT INTO team_leader(team_id, leader) VALUES($1, $2)", id, uid); err == nil {
+			err = dbPublishTeam(db, id)
+		}
 		return
-	})
+	}))
 }
 
 // Remove Manager
 func (s *teamStore) RemoveManager(id int, uid string) error {
-	return withTxQuery(func(db dbTxer) (err error) {
+	return afterCommit(withTxQuery(func(db dbTxer) (err error) {
 		_, err = db.Exec("DELETE FROM team_leader WHERE team_id = $1 AND leader = $2",
 			id, strings.ToLower(uid))
+		if err == nil {
+			err = dbPublishTeam(db, id)
+		}
 		return
-	})
+	}))
+}
+
+// dbPublishTeam publishes TeamSaved of team id in the transaction
+func dbPublishTeam(db dbTxer, id int) error {
+	var t team.Team
+	if err := db.Get(&t, "SELECT id, name, leaders, members, created FROM teams WHERE id = $1", id); err != nil {
+		return err
+	}
+	return publishTx(db, &TeamSaved{Team: t})
 }
@@ -0,0 +1,66 @@
+package backends
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/models/throttle"
+)
+
+var _ throttle.Store = (*throttleStore)(nil)
+
+type throttleStore struct{}
+
+// Get
+func (s *throttleStore) Get(key string) (obj *throttle.Attempt, err error) {
+	obj = new(throttle.Attempt)
+	err = withDbQuery(func(db dber) error {
+		return db.Get(obj, `SELECT key, failures, first_failed, last_failed, locked_until
+		 FROM login_attempt WHERE key = $1`, key)
+	})
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *throttleStore) Fail(key string, window time.Duration) (obj *throttle.Attempt, err error) {
+	obj = new(throttle.Attempt)
+	err = withTxQuery(func(db dbTxer) error {
+		return db.Get(obj, `INSERT INTO login_attempt(key) VALUES($1)
+		 ON CONFLICT (key) DO UPDATE SET
+		 failures = CASE WHEN login_attempt.last_failed < $2 THEN 1 ELSE login_attempt.failures + 1 END,
+		 first_failed = CASE WHEN login_attempt.last_failed < $2 THEN CURRENT_TIMESTAMP ELSE login_attempt.first_failed END,
+		 last_failed = CURRENT_TIMESTAMP
+		 RETURNING key, failures, first_failed, last_failed, locked_until`,
+			key, time.Now().Add(-window))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *throttleStore) Lock(key string, until time.Time) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("UPDATE login_attempt SET locked_until = $2 WHERE key = $1", key, until)
+		return
+	})
+}
+
+func (s *throttleStore) Reset(key string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("DELETE FROM login_attempt WHERE key = $1", key)
+		return
+	})
+}
+
+func (s *throttleStore) Locked() (data []throttle.Attempt, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, `SELECT key, failures, first_failed, last_failed, locked_until
+		 FROM login_attempt WHERE locked_until > CURRENT_TIMESTAMP ORDER BY locked_until DESC`)
+	})
+	return
+}
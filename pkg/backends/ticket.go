@@ -6,7 +6,11 @@ import (
 	"github.com/liut/staffio/pkg/models/cas"
 )
 
-func (s *serviceImpl) GetTicket(value string) (*cas.Ticket, error) {
+var _ cas.TicketStore = (*ticketStore)(nil)
+
+type ticketStore struct{}
+
+func (s *ticketStore) GetTicket(value string) (*cas.Ticket, error) {
 	a := new(cas.Ticket)
 
 	qs := func(db dber) error {
@@ -15,7 +19,7 @@ func (s *serviceImpl) GetTicket(value string) (*cas.Ticket, error) {
 	return a, withDbQuery(qs)
 }
 
-func (s *serviceImpl) DeleteTicket(value string) error {
+func (s *ticketStore) DeleteTicket(value string) error {
 	if value != "" {
 		return withTxQuery(func(db dbTxer) error {
 			_, err := db.Exec("DELETE from cas_ticket WHERE value = $1", value)
@@ -29,7 +33,7 @@ func (s *serviceImpl) DeleteTicket(value string) error {
 	return cas.NewCasError("empty ticket value", cas.ERROR_CODE_INVALID_TICKET_SPEC)
 }
 
-func (s *serviceImpl) SaveTicket(t *cas.Ticket) error {
+func (s *ticketStore) SaveTicket(t *cas.Ticket) error {
 	if err := t.Check(); err != nil {
 		return err
 	}
@@ -0,0 +1,69 @@
+package backends
+
+import (
+	"github.com/lib/pq"
+
+	"github.com/liut/staffio/pkg/models/totp"
+)
+
+var _ totp.Store = (*totpStore)(nil)
+
+type totpStore struct{}
+
+// Get
+func (s *totpStore) Get(uid string) (obj *totp.Enrollment, err error) {
+	obj = new(totp.Enrollment)
+	err = withDbQuery(func(db dber) error {
+		return db.Get(obj, `SELECT uid, secret, recovery, last_counter, created, updated
+		 FROM staff_totp WHERE uid = $1`, uid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *totpStore) Save(e *totp.Enrollment) error {
+	if e.UID == "" || e.Secret == "" {
+		return ErrEmptyVal
+	}
+	return withTxQuery(func(db dbTxer) error {
+		err := db.Get(&e.Created, `INSERT INTO staff_totp(uid, secret, recovery, last_counter)
+		 VALUES($1, $2, $3, $4)
+		 ON CONFLICT (uid) DO UPDATE SET (secret, recovery, last_counter, updated) =
+		 (EXCLUDED.secret, EXCLUDED.recovery, EXCLUDED.last_counter, CURRENT_TIMESTAMP)
+		 RETURNING created`,
+			e.UID, e.Secret, e.Recovery, e.LastCounter)
+		if err != nil {
+			logger().Infow("save totp fail", "uid", e.UID, "err", err)
+		}
+		return err
+	})
+}
+
+func (s *totpStore) Delete(uid string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("DELETE FROM staff_totp WHERE uid = $1", uid)
+		return
+	})
+}
+
+func (s *totpStore) LoadPolicy() (*totp.Policy, error) {
+	var groups pq.StringArray
+	err := withDbQuery(func(db dber) error {
+		return db.Get(&groups, "SELECT groups FROM staff_totp_policy WHERE id = 1")
+	})
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	return &totp.Policy{Groups: groups}, nil
+}
+
+func (s *totpStore) SavePolicy(p *totp.Policy) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`INSERT INTO staff_totp_policy(id, groups) VALUES(1, $1)
+		 ON CONFLICT (id) DO UPDATE SET groups = EXCLUDED.groups, updated = CURRENT_TIMESTAMP`,
+			pq.StringArray(p.Groups))
+		return
+	})
+}
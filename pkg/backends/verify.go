@@ -0,0 +1,380 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dchest/passwordreset"
+	"github.com/lib/pq"
+
+	"github.com/liut/staffio/pkg/backends/mail"
+	"github.com/liut/staffio/pkg/backends/sms"
+	"github.com/liut/staffio/pkg/common"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+// codes by sms
+const (
+	smsCodeLife    = 600
+	smsResendAfter = time.Minute
+)
+
+// loginLinkLife is how long a sign-in link works
+const loginLinkLife = 15 * time.Minute
+
+var (
+	ErrEmptyMobile    = errors.New("mobile is empty")
+	ErrInvalidCode    = errors.New("invalid or expired code")
+	ErrCodeExhausted  = errors.New("too many wrong codes, please request a new one")
+	ErrCodeTooSoon    = errors.New("a code was sent just now, please wait a minute")
+	ErrSMSNotReady    = errors.New("sms sender is not ready")
+	ErrForgotMismatch = errors.New("account, email or mobile do not match")
+	ErrInvalidLink    = errors.New("invalid or expired verification link")
+	ErrEmailTaken     = errors.New("email is used by another one")
+)
+
+var _ models.VerifyStore = (*verifyStore)(nil)
+
+// verifyStore keeps pending verifications in table password_reset
+type verifyStore struct{}
+
+func (s *verifyStore) Save(uv *models.Verify) error {
+	return withTxQuery(func(db dbTxer) error {
+		_, err := db.Exec(`DELETE FROM password_reset WHERE uid = $1 AND purpose = $2`, uv.Uid, uv.Purpose)
+		if err != nil {
+			logger().Warnw("DELETE password_reset fail", "uid", uv.Uid, "err", err)
+			return err
+		}
+		err = db.QueryRow(`INSERT INTO password_reset(type_id, purpose, target, uid, code_hash, life_seconds)
+		 VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created, updated`,
+			uv.Type, uv.Purpose, uv.Target, uv.Uid, uv.CodeHash, uv.LifeSeconds).Scan(&uv.Id, &uv.Created, &uv.Updated)
+		if err != nil {
+			logger().Warnw("INSERT password_reset fail", "uid", uv.Uid, "err", err)
+			return err
+		}
+		logger().Infow("new password_reset", "id", uv.Id, "uid", uv.Uid, "purpose", uv.Purpose, "target", uv.Target)
+		return nil
+	})
+}
+
+func (s *verifyStore) Get(uid, purpose string) (*models.Verify, error) {
+	var uv models.Verify
+	err := withDbQuery(func(db dber) error {
+		return db.Get(&uv, `SELECT id, uid, type_id, purpose, target, code_hash, life_seconds, attempts, consumed, created, updated
+		 FROM password_reset WHERE uid = $1 AND purpose = $2 AND consumed IS NULL`, uid, purpose)
+	})
+	if err != nil {
+		logger().Infow("query verify fail", "uid", uid, "purpose", purpose, "err", err)
+		return nil, err
+	}
+	return &uv, nil
+}
+
+// Attempt is one statement, withDbQuery returns ErrNotFound if the code is consumed or deleted
+func (s *verifyStore) Attempt(uv *models.Verify) (n int, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Get(&n, `UPDATE password_reset SET attempts = attempts + 1
+		 WHERE id = $1 AND consumed IS NULL RETURNING attempts`, uv.Id)
+	})
+	return
+}
+
+func (s *verifyStore) Use(uv *models.Verify) error {
+	err := withTxExec(`UPDATE password_reset SET consumed = CURRENT_TIMESTAMP, updated = CURRENT_TIMESTAMP
+	 WHERE id = $1 AND consumed IS NULL`, uv.Id)
+	if err == nil {
+		logger().Infow("used verify", "id", uv.Id, "uid", uv.Uid, "purpose", uv.Purpose)
+	}
+	return err
+}
+
+func (s *verifyStore) Delete(uid, purpose string) error {
+	return withTxQuery(func(db dbTxer) error {
+		rs, err := db.Exec("DELETE FROM password_reset WHERE uid = $1 AND purpose = $2", uid, purpose)
+		if err == nil {
+			ra, _ := rs.RowsAffected()
+			logger().Infow("deleted verify", "uid", uid, "purpose", purpose, "affect", ra)
+		}
+		return err
+	})
+}
+
+func (s *verifyStore) LoadLinkPolicy() (*models.LinkPolicy, error) {
+	var groups pq.StringArray
+	err := withDbQuery(func(db dber) error {
+		return db.Get(&groups, "SELECT groups FROM login_link_policy WHERE id = 1")
+	})
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	return &models.LinkPolicy{Groups: groups}, nil
+}
+
+func (s *verifyStore) SaveLinkPolicy(p *models.LinkPolicy) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`INSERT INTO login_link_policy(id, groups) VALUES(1, $1)
+		 ON CONFLICT (id) DO UPDATE SET groups = EXCLUDED.groups, updated = CURRENT_TIMESTAMP`,
+			pq.StringArray(p.Groups))
+		return
+	})
+}
+
+var (
+	smsMu     sync.Mutex
+	smsDSN    string
+	smsSender sms.Sender
+)
+
+// smsSend sends text with the sender in settings, it is opened again when the settings changed
+func smsSend(phone, text string) error {
+	smsMu.Lock()
+	dsn := settings.Current.SMSSender
+	if dsn != smsDSN || smsSender == nil {
+		smsDSN, smsSender = dsn, nil
+		if dsn != "" {
+			sender, err := sms.Open(dsn)
+			if err != nil {
+				logger().Warnw("open sms sender fail", "dsn", dsn, "err", err)
+			}
+			smsSender = sender
+		}
+	}
+	sender := smsSender
+	smsMu.Unlock()
+	if sender == nil {
+		return ErrSMSNotReady
+	}
+	if err := sender.Send(phone, text); err != nil {
+		logger().Warnw("send sms fail", "phone", phone, "err", err)
+		return err
+	}
+	return nil
+}
+
+// sendVerifyCode saves a new numeric code of uid and sends it to phone, subject is what it is for,
+// one code a minute for each uid and purpose whatever the phone is
+func sendVerifyCode(vs models.VerifyStore, purpose, uid, phone, subject string) error {
+	if phone == "" {
+		return ErrEmptyMobile
+	}
+	if uv, err := vs.Get(uid, purpose); err == nil && time.Since(uv.Updated) < smsResendAfter {
+		return ErrCodeTooSoon
+	}
+	uv := models.NewVerify(purpose, common.AtPhone, phone, uid)
+	uv.LifeSeconds = smsCodeLife
+	if err := vs.Save(uv); err != nil {
+		return err
+	}
+	return smsSend(phone, fmt.Sprintf(tplSMSCode, uv.Code, subject, smsCodeLife/60))
+}
+
+// checkVerifyCode returns the verify of uid sent by sms if code matches,
+// every try counts before comparing, none is accepted after VerifyMaxAttempts
+func checkVerifyCode(vs models.VerifyStore, purpose, uid, code string) (*models.Verify, error) {
+	uv, err := vs.Get(uid, purpose)
+	if err == ErrNotFound {
+		return nil, ErrInvalidCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uv.Type != common.AtPhone || uv.IsExpired() {
+		return nil, ErrInvalidCode
+	}
+	uv.Attempts, err = vs.Attempt(uv)
+	if err == ErrNotFound {
+		return nil, ErrInvalidCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uv.Exhausted() {
+		return nil, ErrCodeExhausted
+	}
+	if code == "" || !uv.Match(code) {
+		return nil, ErrInvalidCode
+	}
+	return uv, nil
+}
+
+// useVerify consumes uv, a second use of it is invalid
+func useVerify(vs models.VerifyStore, uv *models.Verify, invalid error) error {
+	err := vs.Use(uv)
+	if err == ErrNotFound {
+		return invalid
+	}
+	return err
+}
+
+// resetWithCode checks code sent to the mobile of login and resets the password,
+// an unknown login is the same as a wrong code
+func resetWithCode(svc Servicer, login, code, passwd string) error {
+	staff, err := svc.Get(login)
+	if err != nil {
+		logger().Infow("reset with code fail", "uid", login, "err", err)
+		return ErrInvalidCode
+	}
+	uv, err := checkVerifyCode(svc.Verify(), models.VerifyPassword, login, code)
+	if err != nil {
+		return err
+	}
+	if uv.Target != staff.Mobile {
+		return ErrInvalidCode
+	}
+	return resetWithVerify(svc, uv, passwd, ErrInvalidCode)
+}
+
+// resetWithVerify consumes uv and resets the password of its uid,
+// uv is kept if passwd does not follow the policy
+func resetWithVerify(svc Servicer, uv *models.Verify, passwd string, invalid error) error {
+	if err := checkPassword(svc, uv.Uid, passwd); err != nil {
+		return err
+	}
+	if err := useVerify(svc.Verify(), uv, invalid); err != nil {
+		return err
+	}
+	return svc.PasswordReset(uv.Uid, passwd)
+}
+
+// confirmMobile checks code sent to the new mobile of uid and saves it
+func confirmMobile(svc Servicer, uid, code string) (string, error) {
+	uv, err := checkVerifyCode(svc.Verify(), models.VerifyMobile, uid, code)
+	if err != nil {
+		return "", err
+	}
+	staff, err := svc.Get(uid)
+	if err != nil {
+		return "", err
+	}
+	if err = useVerify(svc.Verify(), uv, ErrInvalidCode); err != nil {
+		return "", err
+	}
+	staff.Mobile = uv.Target
+	if _, err = svc.Save(staff); err != nil {
+		return "", err
+	}
+	return uv.Target, nil
+}
+
+// changeEmail keeps email pending and mails a link to it, and a notice to the old one,
+// the link is returned for logging if mail is not ready
+func changeEmail(svc Servicer, uid, email string) (link string, err error) {
+	if email == "" {
+		return "", ErrEmptyEmail
+	}
+	staff, err := svc.Get(uid)
+	if err != nil {
+		return
+	}
+	for _, p := range svc.All(&Spec{Email: email}) {
+		if p.UID != uid {
+			return "", ErrEmailTaken
+		}
+	}
+	uv := models.NewVerify(models.VerifyEmail, common.AtEmail, email, uid)
+	if err = svc.Verify().Save(uv); err != nil {
+		return
+	}
+	token := passwordreset.NewToken(uid, time.Duration(uv.LifeSeconds)*time.Second, uv.CodeHashBytes(), secret)
+	link = BaseURL + "/email/verify?token=" + token
+	if err = mailTo(svc, uid, email, mail.EmailVerify, mail.Data{"Name": staff.Name(), "Link": link}); err != nil {
+		return
+	}
+	if staff.Email != "" && staff.Email != email {
+		e := mailTo(svc, uid, staff.Email, mail.EmailNotice, mail.Data{"Name": staff.Name(), "Email": email})
+		if e != nil {
+			logger().Infow("send email notice fail", "uid", uid, "err", e)
+		}
+	}
+	return
+}
+
+// confirmEmail checks the link of changeEmail and saves the email
+func confirmEmail(svc Servicer, token string) (uid, email string, err error) {
+	vs := svc.Verify()
+	uid, err = passwordreset.VerifyToken(token, func(login string) ([]byte, error) {
+		uv, err := vs.Get(login, models.VerifyEmail)
+		if err != nil {
+			return nil, err
+		}
+		return uv.CodeHashBytes(), nil
+	}, secret)
+	if err != nil {
+		logger().Infow("verify email token fail", "err", err)
+		return "", "", ErrInvalidLink
+	}
+	uv, err := vs.Get(uid, models.VerifyEmail)
+	if err != nil {
+		return "", "", ErrInvalidLink
+	}
+	staff, err := svc.Get(uid)
+	if err != nil {
+		return
+	}
+	if err = useVerify(vs, uv, ErrInvalidLink); err != nil {
+		return
+	}
+	staff.Email = uv.Target
+	if _, err = svc.Save(staff); err != nil {
+		return
+	}
+	return uid, uv.Target, nil
+}
+
+// sendLoginLink mails a link of signing in to uid, service is kept in the link for CAS,
+// the link is returned for logging if mail is not ready
+func sendLoginLink(svc Servicer, uid, service string) (link string, err error) {
+	staff, err := svc.Get(uid)
+	if err != nil {
+		return
+	}
+	if staff.Email == "" {
+		return "", ErrEmptyEmail
+	}
+	uv := models.NewVerify(models.VerifyLogin, common.AtEmail, staff.Email, uid)
+	uv.LifeSeconds = int(loginLinkLife / time.Second)
+	if err = svc.Verify().Save(uv); err != nil {
+		return
+	}
+	token := passwordreset.NewToken(uid, loginLinkLife, uv.CodeHashBytes(), secret)
+	link = BaseURL + "/login/link?token=" + token
+	if service != "" {
+		link += "&service=" + url.QueryEscape(service)
+	}
+	err = mailTo(svc, uid, staff.Email, mail.LoginLink, mail.Data{
+		"Name":    staff.Name(),
+		"Link":    link,
+		"Minutes": int(loginLinkLife / time.Minute),
+	})
+	return
+}
+
+// confirmLoginLink returns the uid of a link of sendLoginLink, a link works only once
+func confirmLoginLink(svc Servicer, token string) (string, error) {
+	vs := svc.Verify()
+	uid, err := passwordreset.VerifyToken(token, func(login string) ([]byte, error) {
+		uv, err := vs.Get(login, models.VerifyLogin)
+		if err != nil {
+			return nil, err
+		}
+		return uv.CodeHashBytes(), nil
+	}, secret)
+	if err != nil {
+		logger().Infow("verify login token fail", "err", err)
+		return "", ErrInvalidLink
+	}
+	uv, err := vs.Get(uid, models.VerifyLogin)
+	if err != nil {
+		return "", ErrInvalidLink
+	}
+	if err = useVerify(vs, uv, ErrInvalidLink); err != nil {
+		return "", err
+	}
+	return uid, nil
+}
+
+const tplSMSCode = `[staffio] %s is your code to %s, valid for %d minutes.`
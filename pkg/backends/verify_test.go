@@ -0,0 +1,25 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/common"
+	"github.com/liut/staffio/pkg/models"
+)
+
+func TestVerifyUse(t *testing.T) {
+	vs := svc.Verify()
+	uv := models.NewVerify(models.VerifyMobile, common.AtPhone, "13800138000", "test")
+	assert.NoError(t, vs.Save(uv))
+	defer vs.Delete("test", models.VerifyMobile)
+
+	n, err := vs.Attempt(uv)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, useVerify(vs, uv, ErrInvalidCode))
+	assert.Equal(t, ErrInvalidCode, useVerify(vs, uv, ErrInvalidCode), "used twice")
+	_, err = vs.Attempt(uv)
+	assert.Equal(t, ErrNotFound, err)
+}
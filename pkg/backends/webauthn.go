@@ -0,0 +1,60 @@
+package backends
+
+import (
+	"github.com/liut/staffio/pkg/models/webauthn"
+)
+
+var _ webauthn.Store = (*webauthnStore)(nil)
+
+type webauthnStore struct{}
+
+func (s *webauthnStore) All(uid string) (data []webauthn.Credential, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, `SELECT id, uid, name, public_key, sign_count, aaguid, created, last_used
+		 FROM staff_webauthn WHERE uid = $1 ORDER BY created`, uid)
+	})
+	return
+}
+
+// Get
+func (s *webauthnStore) Get(id string) (obj *webauthn.Credential, err error) {
+	obj = new(webauthn.Credential)
+	err = withDbQuery(func(db dber) error {
+		return db.Get(obj, `SELECT id, uid, name, public_key, sign_count, aaguid, created, last_used
+		 FROM staff_webauthn WHERE id = $1`, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *webauthnStore) Save(c *webauthn.Credential) error {
+	if c.ID == "" || c.UID == "" || len(c.PublicKey) == 0 {
+		return ErrEmptyVal
+	}
+	return withTxQuery(func(db dbTxer) error {
+		err := db.Get(&c.Created, `INSERT INTO staff_webauthn(id, uid, name, public_key, sign_count, aaguid)
+		 VALUES($1, $2, $3, $4, $5, $6) RETURNING created`,
+			c.ID, c.UID, c.Name, c.PublicKey, c.SignCount, c.AAGUID)
+		if err != nil {
+			logger().Infow("save webauthn credential fail", "uid", c.UID, "err", err)
+		}
+		return err
+	})
+}
+
+func (s *webauthnStore) Touch(id string, signCount int64) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`UPDATE staff_webauthn SET sign_count = $2, last_used = CURRENT_TIMESTAMP
+		 WHERE id = $1`, id, signCount)
+		return
+	})
+}
+
+func (s *webauthnStore) Delete(uid, id string) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec("DELETE FROM staff_webauthn WHERE uid = $1 AND id = $2", uid, id)
+		return
+	})
+}
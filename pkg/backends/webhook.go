@@ -0,0 +1,111 @@
+package backends
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/models/webhook"
+)
+
+var _ webhook.Store = (*webhookStore)(nil)
+
+type webhookStore struct{}
+
+const (
+	hookEndpointColumns = `id, url, secret, events, description, active, created, updated`
+	hookDeliveryColumns = `id, endpoint_id, event, payload, status, attempts, code, last_error, next_try, delivered,
+ created, updated`
+)
+
+func (s *webhookStore) Endpoints() (data []webhook.Endpoint, err error) {
+	err = withDbQuery(func(db dber) error {
+		return db.Select(&data, "SELECT "+hookEndpointColumns+" FROM webhook_endpoint ORDER BY id")
+	})
+	return
+}
+
+func (s *webhookStore) GetEndpoint(id int) (*webhook.Endpoint, error) {
+	obj := new(webhook.Endpoint)
+	err := withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT "+hookEndpointColumns+" FROM webhook_endpoint WHERE id = $1", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *webhookStore) SaveEndpoint(e *webhook.Endpoint) error {
+	var missing bool
+	err := withTxQuery(func(db dbTxer) error {
+		if e.ID == 0 {
+			return db.QueryRow(`INSERT INTO webhook_endpoint(url, secret, events, description, active)
+			 VALUES($1, $2, $3, $4, $5) RETURNING id, created, updated`,
+				e.URL, e.Secret, e.Events, e.Description, e.Active).Scan(&e.ID, &e.Created, &e.Updated)
+		}
+		err := db.QueryRow(`UPDATE webhook_endpoint SET url = $2, secret = $3, events = $4, description = $5, active = $6,
+		 updated = CURRENT_TIMESTAMP WHERE id = $1 RETURNING created, updated`,
+			e.ID, e.URL, e.Secret, e.Events, e.Description, e.Active).Scan(&e.Created, &e.Updated)
+		if err == ErrNoRows {
+			missing = true // nothing changed, withTxQuery would report it as a db error
+			return nil
+		}
+		return err
+	})
+	if err == nil && missing {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *webhookStore) DeleteEndpoint(id int) error {
+	return withTxExec("DELETE FROM webhook_endpoint WHERE id = $1", id) // deliveries cascade
+}
+
+func (s *webhookStore) Enqueue(d *webhook.Delivery) error {
+	d.Status = webhook.StatusPending
+	return withTxQuery(func(db dbTxer) error {
+		return db.QueryRow(`INSERT INTO webhook_delivery(endpoint_id, event, payload, status)
+		 VALUES($1, $2, $3, $4) RETURNING id, next_try, created, updated`,
+			d.EndpointID, d.Event, d.Payload, d.Status).Scan(&d.ID, &d.NextTry, &d.Created, &d.Updated)
+	})
+}
+
+func (s *webhookStore) Claim(now time.Time, lease time.Duration, limit int) (data []webhook.Delivery, err error) {
+	err = claimJobs(&data, "webhook_delivery", hookDeliveryColumns, "next_try", now, lease, limit)
+	return
+}
+
+func (s *webhookStore) Update(d *webhook.Delivery) error {
+	return withTxQuery(func(db dbTxer) (err error) {
+		_, err = db.Exec(`UPDATE webhook_delivery SET status = $2, attempts = $3, code = $4, last_error = $5, next_try = $6,
+		 delivered = $7, updated = CURRENT_TIMESTAMP WHERE id = $1`,
+			d.ID, d.Status, d.Attempts, d.Code, d.LastError, d.NextTry, d.Delivered)
+		return
+	})
+}
+
+func (s *webhookStore) Get(id int) (*webhook.Delivery, error) {
+	obj := new(webhook.Delivery)
+	err := withDbQuery(func(db dber) error {
+		return db.Get(obj, "SELECT "+hookDeliveryColumns+" FROM webhook_delivery WHERE id = $1", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *webhookStore) Query(spec *webhook.Spec) (data []webhook.Delivery, err error) {
+	w := new(sqlWhere)
+	if spec.EndpointID > 0 {
+		w.add("endpoint_id = $%d", spec.EndpointID)
+	}
+	w.eq("event", spec.Event)
+	w.eq("status", spec.Status)
+	err = queryPage(&data, "webhook_delivery", hookDeliveryColumns, w, &spec.Pager)
+	return
+}
+
+func (s *webhookStore) Redeliver(id int) error {
+	return resetJob("webhook_delivery", "code = 0, delivered = NULL", id)
+}
@@ -0,0 +1,175 @@
+package backends
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liut/staffio/pkg/models/webhook"
+)
+
+const (
+	hookBatch   = 20
+	hookLease   = 5 * time.Minute // a claimed delivery is tried again after it, if the worker is gone while posting
+	hookTimeout = 10 * time.Second
+)
+
+var (
+	// hookWake tells the worker a delivery is queued
+	hookWake = make(chan struct{}, 1)
+
+	hookClient = &http.Client{Timeout: hookTimeout}
+
+	errEndpointInactive = errors.New("endpoint is inactive")
+)
+
+// hookMembers is the payload of members added to or removed from a team
+type hookMembers struct {
+	TeamID int      `json:"teamID"`
+	UIDs   []string `json:"uids"`
+}
+
+// emitWebhooks subscribes changes of staff, teams and groups for webhooks
+func emitWebhooks(svc Servicer, ev Event) (err error) {
+	hs := svc.Webhooks()
+	switch e := ev.(type) {
+	case *StaffCreated:
+		err = emitEvent(hs, webhook.EventStaffCreated, &e.Staff)
+	case *StaffUpdated:
+		err = emitEvent(hs, webhook.EventStaffUpdated, &e.Staff)
+	case *StaffDeleted:
+		err = emitEvent(hs, webhook.EventStaffDeleted, map[string]string{"uid": e.UID})
+	case *TeamSaved:
+		err = emitEvent(hs, webhook.EventTeamSaved, &e.Team)
+	case *TeamDeleted:
+		err = emitEvent(hs, webhook.EventTeamDeleted, map[string]int{"id": e.ID})
+	case *TeamMembersChanged:
+		if len(e.Added) > 0 {
+			err = emitEvent(hs, webhook.EventMemberAdded, &hookMembers{TeamID: e.TeamID, UIDs: e.Added})
+		}
+		if err == nil && len(e.Removed) > 0 {
+			err = emitEvent(hs, webhook.EventMemberRemoved, &hookMembers{TeamID: e.TeamID, UIDs: e.Removed})
+		}
+	case *GroupChanged:
+		if e.Group == nil {
+			err = emitEvent(hs, webhook.EventGroupDeleted, map[string]string{"name": e.Name})
+		} else {
+			err = emitEvent(hs, webhook.EventGroupSaved, e.Group)
+		}
+	}
+	return
+}
+
+// emitEvent queues a delivery of event to every endpoint wants it, a failed enqueue is logged only,
+// so that a retry of the event does not deliver it twice to others
+func emitEvent(hs webhook.Store, event string, data interface{}) error {
+	eps, err := hs.Endpoints()
+	if err != nil {
+		return err
+	}
+	var body []byte
+	for _, ep := range eps {
+		if !ep.Wants(event) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(&webhook.Payload{Event: event, Time: time.Now(), Data: data}); err != nil {
+				return err
+			}
+		}
+		d := &webhook.Delivery{EndpointID: ep.ID, Event: event, Payload: string(body)}
+		if err = hs.Enqueue(d); err != nil {
+			logger().Warnw("enqueue webhook fail", "endpoint", ep.ID, "event", event, "err", err)
+			continue
+		}
+		logger().Debugw("webhook queued", "id", d.ID, "endpoint", ep.ID, "event", event)
+	}
+	if body != nil {
+		WakeWebhookWorker()
+	}
+	return nil
+}
+
+// WakeWebhookWorker tells the worker to post without waiting for the next poll
+func WakeWebhookWorker() {
+	select {
+	case hookWake <- struct{}{}:
+	default:
+	}
+}
+
+// SendWebhooks posts the deliveries due until none is due, returns the count accepted,
+// a failed one is tried again later with backoff, and is dead after queue.MaxAttempts
+func SendWebhooks(svc Servicer) (done int, err error) {
+	for {
+		var ds []webhook.Delivery
+		ds, err = svc.Webhooks().Claim(time.Now(), hookLease, hookBatch)
+		if err != nil || len(ds) == 0 {
+			return
+		}
+		for i := range ds {
+			d := &ds[i]
+			code, e := postDelivery(svc, d)
+			if e != nil {
+				d.Failed(code, e, time.Now())
+				if d.Status == webhook.StatusDead {
+					logger().Warnw("webhook delivery is dead", "id", d.ID, "endpoint", d.EndpointID, "attempts", d.Attempts, "err", e)
+				} else {
+					logger().Infow("post webhook fail", "id", d.ID, "endpoint", d.EndpointID, "attempts", d.Attempts, "err", e)
+				}
+			} else {
+				d.Done(code, time.Now())
+				done++
+			}
+			if err = svc.Webhooks().Update(d); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// postDelivery posts the payload of d signed with the secret of its endpoint, a reply of 2xx is done
+func postDelivery(svc Servicer, d *webhook.Delivery) (int, error) {
+	ep, err := svc.Webhooks().GetEndpoint(d.EndpointID)
+	if err != nil {
+		return 0, err
+	}
+	if !ep.Active {
+		return 0, errEndpointInactive
+	}
+	ts := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, ep.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "staffio-webhook")
+	req.Header.Set(webhook.HeaderEvent, d.Event)
+	req.Header.Set(webhook.HeaderDelivery, strconv.Itoa(d.ID))
+	req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(ep.Secret, ts, []byte(d.Payload)))
+	resp, err := hookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint replied %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// StartWebhookWorker posts deliveries once one is queued or every workerPoll,
+// stop waits for the posting pass
+func StartWebhookWorker(svc Servicer) (stop func()) {
+	return startWorker("webhooks", hookWake, func() (int, error) {
+		return SendWebhooks(svc)
+	})
+}
@@ -0,0 +1,37 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/webhook"
+)
+
+func TestWebhookStore(t *testing.T) {
+	e := &webhook.Endpoint{URL: "https://example.net/hook", Secret: "secret", Active: true}
+	assert.NoError(t, svc.Webhooks().SaveEndpoint(e))
+	assert.NotZero(t, e.ID)
+	defer svc.Webhooks().DeleteEndpoint(e.ID)
+	e.Description = "go test"
+	assert.NoError(t, svc.Webhooks().SaveEndpoint(e))
+	assert.Equal(t, ErrNotFound, svc.Webhooks().SaveEndpoint(&webhook.Endpoint{ID: -1, URL: e.URL}))
+
+	d := &webhook.Delivery{EndpointID: e.ID, Event: webhook.EventStaffDeleted, Payload: "{}"}
+	assert.NoError(t, svc.Webhooks().Enqueue(d))
+	d.Done(204, time.Now())
+	assert.NoError(t, svc.Webhooks().Update(d))
+	assert.NoError(t, svc.Webhooks().Redeliver(d.ID))
+	obj, err := svc.Webhooks().Get(d.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, webhook.StatusPending, obj.Status)
+	assert.Zero(t, obj.Code)
+	assert.Nil(t, obj.Delivered)
+	assert.Equal(t, ErrNotFound, svc.Webhooks().Redeliver(-1))
+
+	assert.NoError(t, svc.Webhooks().DeleteEndpoint(e.ID))
+	assert.Equal(t, ErrNotFound, svc.Webhooks().DeleteEndpoint(e.ID))
+	_, err = svc.Webhooks().Get(d.ID)
+	assert.Equal(t, ErrNotFound, err, "deliveries cascade")
+}
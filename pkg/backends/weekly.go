@@ -83,21 +83,22 @@ func (s *weeklyStore) Add(uid string, content string) error {
 	now := time.Now()
 	year, week := now.ISOWeek()
 
-	return withTxQuery(func(db dbTxer) error {
+	return afterCommit(withTxQuery(func(db dbTxer) error {
 		var id int
 		err := db.Get(&id,
 			"SELECT id FROM weekly_report WHERE uid = $1 AND iso_year = $2 AND iso_week = $3", uid, year, week)
 		if err == ErrNoRows {
-			return db.Get(&id,
+			err = db.Get(&id,
 				"INSERT INTO weekly_report (uid, iso_year, iso_week, content) VALUES ($1,$2,$3,$4)"+
 					" RETURNING id", uid, year, week, content)
-		}
-		if id > 0 {
+		} else if err == nil {
 			_, err = db.Exec("UPDATE weekly_report SET content = $1, updated = now() WHERE id = $2", content, id)
-			return err
+		}
+		if err == nil {
+			err = publishTx(db, &WeeklyReportSubmitted{ReportID: id, UID: uid, Year: year, Week: week})
 		}
 		return err
-	})
+	}))
 }
 
 // 更新
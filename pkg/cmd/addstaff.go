@@ -61,6 +61,19 @@ var addstaffCmd = &cobra.Command{
 			CommonName: cn,
 			Surname:    sn,
 		}
+		if password != "" {
+			if err := backends.PasswordPolicy().Check(password, backends.PersonalWords(staff), nil); err != nil {
+				fmt.Println("weak password:", err)
+				return
+			}
+			if backends.IsPwned(password) {
+				fmt.Println("weak password: breached")
+				return
+			}
+		}
+		if old, err := svc.Get(uid); err == nil {
+			backends.FillStaff(staff, old)
+		}
 		isNew, err := svc.Save(staff)
 		if err != nil {
 			logger().Warnw("save staff fail", "staff", staff, "err", err)
@@ -26,13 +26,14 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/liut/staffio/pkg/backends"
+	nested "github.com/liut/staffio/pkg/models/group"
 )
 
 // groupCmd represents the group command
 var groupCmd = &cobra.Command{
 	Use:   "group",
 	Short: "Operate a group",
-	Long:  `Add or Kick a user into a group, new group will be create`,
+	Long:  `Add or Kick a user or a subgroup into a group, new group will be create`,
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.ParseFlags(args)
 		name, _ := cmd.Flags().GetString("name")
@@ -47,14 +48,28 @@ var groupCmd = &cobra.Command{
 			return
 		}
 
-		if uid, _ := cmd.Flags().GetString("add-member"); uid != "" {
+		member, _ := cmd.Flags().GetString("add-member")
+		if sub, _ := cmd.Flags().GetString("add-subgroup"); sub != "" {
+			if _, err := svc.GetGroup(sub); err != nil {
+				fmt.Printf("get subgroup %s ERR %s\n", sub, err)
+				return
+			}
+			if sub == name || nested.Contains(name, sub, svc.GetGroup) {
+				fmt.Printf("group %s contains %s already\n", sub, name)
+				return
+			}
+			member = nested.Subgroup(sub)
+		}
+		if member != "" {
 			if err == backends.ErrStoreNotFound {
 				group = &backends.Group{
 					Name:    name,
-					Members: []string{uid},
+					Members: []string{member},
 				}
+			} else if group.Has(member) {
+				return
 			} else {
-				group.Members = append(group.Members, uid)
+				group.Members = append(group.Members, member)
 			}
 			err = svc.SaveGroup(group)
 			if err != nil {
@@ -65,10 +80,14 @@ var groupCmd = &cobra.Command{
 			return
 		}
 
-		if uid, _ := cmd.Flags().GetString("kick-member"); uid != "" && err == nil {
+		member, _ = cmd.Flags().GetString("kick-member")
+		if sub, _ := cmd.Flags().GetString("kick-subgroup"); sub != "" {
+			member = nested.Subgroup(sub)
+		}
+		if member != "" && err == nil {
 			var members []string
 			for _, m := range group.Members {
-				if m != uid {
+				if m != member {
 					members = append(members, m)
 				}
 			}
@@ -100,5 +119,7 @@ func init() {
 	groupCmd.Flags().StringP("name", "g", "", "Group name")
 	groupCmd.Flags().StringP("add-member", "a", "", "UID of member will add")
 	groupCmd.Flags().StringP("kick-member", "t", "", "UID of member will kick")
+	groupCmd.Flags().StringP("add-subgroup", "s", "", "Name of subgroup will add")
+	groupCmd.Flags().StringP("kick-subgroup", "k", "", "Name of subgroup will kick")
 	addstaffCmd.MarkFlagRequired("name")
 }
@@ -0,0 +1,58 @@
+// Copyright © 2019 liut <liutao@liut.cc>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/liut/staffio/pkg/backends"
+)
+
+// ldap2sqlCmd represents the ldap2sql command
+var ldap2sqlCmd = &cobra.Command{
+	Use:   "ldap2sql",
+	Short: "Copy people and groups from LDAP into database",
+	Long: `Copy people and groups from an existing LDAP store into database for the sql backend,
+the userPassword hashes are copied too and will be upgraded at next login.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.ParseFlags(args)
+		noPassword, _ := cmd.Flags().GetBool("no-password")
+		res, err := backends.MigrateFromLDAP(!noPassword)
+		if err != nil {
+			fmt.Printf("migrate ERR %s\n", err)
+			return
+		}
+		fmt.Printf("migrate OK, people %d, groups %d, passwords %d\n", res.People, res.Groups, res.Passwords)
+		if len(res.Unsupported) > 0 {
+			fmt.Printf("passwords of %d people are not copied, unsupported scheme, reset them: %s\n",
+				len(res.Unsupported), strings.Join(res.Unsupported, ", "))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ldap2sqlCmd)
+
+	ldap2sqlCmd.Flags().Bool("no-password", false, "do not copy password hashes")
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/liut/staffio/pkg/models/pwned"
+)
+
+// pwnedCmd represents the pwned command
+var pwnedCmd = &cobra.Command{
+	Use:   "pwned",
+	Short: "Breached passwords",
+	Long:  `Breached passwords checked offline by password changes and resets`,
+}
+
+// pwnedImportCmd represents the pwned import command
+var pwnedImportCmd = &cobra.Command{
+	Use:   "import [dump files or range directories]",
+	Short: "Build the filter file of breached passwords",
+	Long: `Build the filter file of breached passwords from HIBP dumps of SHA-1,
+a file of "HASH:COUNT" lines, or a directory of range files named by 5 hex digits with "SUFFIX:COUNT" lines`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("output")
+		if out == "" {
+			out = settings.PasswordPwnedFile
+		}
+		if out == "" {
+			fmt.Println("empty output, set --output or STAFFIO_PASSWORD_PWNED_FILE")
+			return
+		}
+		rate, _ := cmd.Flags().GetFloat64("rate")
+
+		sources, err := pwnedSources(args)
+		if err != nil {
+			fmt.Printf("list dumps ERR %s\n", err)
+			return
+		}
+		// the first pass counts sums to size the filter
+		var count uint64
+		err = scanSources(sources, func(pwned.Sum) { count++ })
+		if err != nil {
+			fmt.Printf("scan ERR %s\n", err)
+			return
+		}
+		f := pwned.New(count, rate)
+		fmt.Printf("%d hashes, filter of %d bytes\n", count, f.Bytes())
+		if err = scanSources(sources, f.Add); err != nil {
+			fmt.Printf("scan ERR %s\n", err)
+			return
+		}
+		if err = f.Save(out); err != nil {
+			fmt.Printf("save %s ERR %s\n", out, err)
+			return
+		}
+		fmt.Printf("saved %s\n", out)
+	},
+}
+
+// pwnedSource is a dump file, prefix is the name of a range file
+type pwnedSource struct {
+	name   string
+	prefix string
+}
+
+func pwnedSources(args []string) (sources []pwnedSource, err error) {
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			sources = append(sources, pwnedSource{name: arg})
+			continue
+		}
+		files, err := ioutil.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+			if !f.IsDir() && pwned.IsRange(name) {
+				sources = append(sources, pwnedSource{name: filepath.Join(arg, f.Name()), prefix: name})
+			}
+		}
+	}
+	return
+}
+
+func scanSources(sources []pwnedSource, fn func(pwned.Sum)) error {
+	for _, src := range sources {
+		fd, err := os.Open(src.name)
+		if err != nil {
+			return err
+		}
+		err = pwned.Scan(fd, src.prefix, fn)
+		fd.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", src.name, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(pwnedCmd)
+	pwnedCmd.AddCommand(pwnedImportCmd)
+
+	pwnedImportCmd.Flags().StringP("output", "o", "", "Filter file, default STAFFIO_PASSWORD_PWNED_FILE")
+	pwnedImportCmd.Flags().Float64("rate", 0.001, "False positive rate")
+}
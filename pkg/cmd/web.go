@@ -49,6 +49,8 @@ var webCmd = &cobra.Command{
 
 var webFS string
 var webRoot string
+var webBackend string
+var webFixtures string
 
 func init() {
 	RootCmd.AddCommand(webCmd)
@@ -63,6 +65,8 @@ func init() {
 	// is called directly, e.g.:
 	webCmd.Flags().StringVar(&webFS, "fs", "bind", "file system [bind | local]")
 	webCmd.Flags().StringVar(&webRoot, "root", "./", "app root directory")
+	webCmd.Flags().StringVar(&webBackend, "backend", "", "backend of people and groups [ldap | sql | memory]")
+	webCmd.Flags().StringVar(&webFixtures, "fixtures", "", "json fixtures for memory backend")
 }
 
 const (
@@ -72,13 +76,22 @@ const (
 
 func webRun() {
 	// web.SetBase("/v1/")
+	if webBackend != "" {
+		settings.Backend = webBackend
+	}
+	if webFixtures != "" {
+		settings.Fixtures = webFixtures
+	}
 	cfg := web.Config{
 		Root:    webRoot,
 		FS:      webFS,
 		BaseURI: settings.BaseURL,
 	}
 	ws := web.New(cfg)
-	defer reaper.Quit(reaper.Run(0, backends.Cleanup))
+	defer ws.StartWorkers()()
+	if settings.Backend != "memory" {
+		defer reaper.Quit(reaper.Run(0, backends.Cleanup))
+	}
 
 	fmt.Printf("Start service %s at addr %s\nRoot: %s\n", settings.Version, settings.HTTPListen, settings.Root)
 
@@ -0,0 +1,152 @@
+// Package audit records security events, who did what to whom from where
+package audit
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liut/staffio/pkg/models/queue"
+)
+
+// actions
+const (
+	ActLogin          = "login"
+	ActLoginFail      = "login.fail"
+	ActLoginLink      = "login.link"
+	ActLogout         = "logout"
+	ActPasswordChange = "password.change"
+	ActPasswordForgot = "password.forgot"
+	ActPasswordReset  = "password.reset"
+	ActProfileUpdate  = "profile.update"
+	ActMobileVerify   = "mobile.verify"
+	ActEmailChange    = "email.change"
+	ActTOTPEnable     = "2fa.enable"
+	ActTOTPDisable    = "2fa.disable"
+	ActKeyAdd         = "webauthn.add"
+	ActKeyDelete      = "webauthn.delete"
+	ActSessionEnd     = "session.terminate"
+	ActTokenCreate    = "token.create"
+	ActTokenRevoke    = "token.revoke"
+	ActStaffCreate    = "staff.create"
+	ActStaffUpdate    = "staff.update"
+	ActStaffDelete    = "staff.delete"
+	ActGroupSave      = "group.save"
+	ActTeamUpdate     = "team.update"
+	ActOAuthConsent   = "oauth.consent"
+	ActOAuthToken     = "oauth.token"
+	ActCASTicket      = "cas.ticket"
+	ActClientSave     = "admin.client"
+	ActSAMLSave       = "admin.saml"
+	ActTOTPPolicy     = "admin.2fa"
+	ActLinkPolicy     = "admin.loginlink"
+	ActUnlock         = "admin.unlock"
+	ActImpersonate    = "admin.impersonate"
+	ActImpersonateEnd = "admin.impersonate.end"
+	ActImpersonateReq = "admin.impersonate.request"
+	ActAuditExport    = "admin.export"
+	ActMailResend     = "admin.mail.resend"
+	ActWebhookSave    = "admin.webhook"
+	ActWebhookResend  = "admin.webhook.redeliver"
+	ActEventRetry     = "admin.event.retry"
+	ActInboxReplay    = "admin.inbox.replay"
+)
+
+// Actions is all actions for filters
+var Actions = []string{
+	ActLogin, ActLoginFail, ActLoginLink, ActLogout,
+	ActPasswordChange, ActPasswordForgot, ActPasswordReset, ActProfileUpdate, ActMobileVerify, ActEmailChange,
+	ActTOTPEnable, ActTOTPDisable, ActKeyAdd, ActKeyDelete, ActSessionEnd, ActTokenCreate, ActTokenRevoke,
+	ActStaffCreate, ActStaffUpdate, ActStaffDelete, ActGroupSave, ActTeamUpdate,
+	ActOAuthConsent, ActOAuthToken, ActCASTicket,
+	ActClientSave, ActSAMLSave, ActTOTPPolicy, ActLinkPolicy, ActUnlock, ActAuditExport, ActMailResend,
+	ActWebhookSave, ActWebhookResend, ActEventRetry, ActInboxReplay,
+	ActImpersonate, ActImpersonateEnd,
+}
+
+// Event is a security event
+type Event struct {
+	ID        int    `json:"id" db:"id"`
+	Action    string `json:"action" db:"action"`
+	Actor     string `json:"actor" db:"actor"`             // uid who did it, or the name tried by a failed login
+	Target    string `json:"target,omitempty" db:"target"` // uid, group, client or service it is done to
+	IP        string `json:"ip" db:"ip"`
+	UserAgent string `json:"userAgent" db:"user_agent"`
+	Detail    string `json:"detail,omitempty" db:"detail"`
+	// keeper signed in as Actor, all the event is done by the keeper
+	Impersonator string    `json:"impersonator,omitempty" db:"impersonator"`
+	Created      time.Time `json:"created" db:"created"`
+}
+
+// Spec filters of events, Action "password" matches all "password.*",
+// Actor matches the impersonator too
+type Spec struct {
+	Action string    `json:"action,omitempty" form:"action"`
+	Actor  string    `json:"actor,omitempty" form:"actor"`
+	Target string    `json:"target,omitempty" form:"target"`
+	IP     string    `json:"ip,omitempty" form:"ip"`
+	Since  time.Time `json:"since,omitempty" form:"since" time_format:"2006-01-02"`
+	Until  time.Time `json:"until,omitempty" form:"until" time_format:"2006-01-02"` // the day is included
+	queue.Pager
+}
+
+// End returns the end of Until, zero if not set
+func (s *Spec) End() time.Time {
+	if s.Until.IsZero() {
+		return s.Until
+	}
+	return s.Until.AddDate(0, 0, 1)
+}
+
+// Match returns true if e matches the filters
+func (s *Spec) Match(e *Event) bool {
+	if s.Action != "" && e.Action != s.Action && !strings.HasPrefix(e.Action, s.Action+".") {
+		return false
+	}
+	if s.Actor != "" && e.Actor != s.Actor && e.Impersonator != s.Actor {
+		return false
+	}
+	if s.Target != "" && e.Target != s.Target {
+		return false
+	}
+	if s.IP != "" && e.IP != s.IP {
+		return false
+	}
+	if !s.Since.IsZero() && e.Created.Before(s.Since) {
+		return false
+	}
+	if end := s.End(); !end.IsZero() && !e.Created.Before(end) {
+		return false
+	}
+	return true
+}
+
+// CSVHeader of WriteCSV
+var CSVHeader = []string{"id", "created", "action", "actor", "target", "ip", "user_agent", "detail", "impersonator"}
+
+// WriteCSV writes events with a header
+func WriteCSV(w io.Writer, data []Event) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVHeader); err != nil {
+		return err
+	}
+	for _, e := range data {
+		err := cw.Write([]string{strconv.Itoa(e.ID), e.Created.Format(time.RFC3339),
+			e.Action, e.Actor, e.Target, e.IP, e.UserAgent, e.Detail, e.Impersonator})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Store interface of events storage
+type Store interface {
+	// Add 记一个
+	Add(e *Event) error
+	// Query 查询, 新的在前, Total of spec is set
+	Query(spec *Spec) ([]Event, error)
+}
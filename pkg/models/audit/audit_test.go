@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.Local)
+	e := &Event{Action: ActPasswordReset, Actor: "eagle", Target: "test", IP: "10.0.0.1", Created: day.Add(10 * time.Hour)}
+
+	assert.True(t, (&Spec{}).Match(e))
+	assert.True(t, (&Spec{Action: "password"}).Match(e))
+	assert.True(t, (&Spec{Action: ActPasswordReset, Actor: "eagle", Target: "test", IP: "10.0.0.1"}).Match(e))
+	assert.False(t, (&Spec{Action: "pass"}).Match(e))
+	assert.False(t, (&Spec{Action: ActLogin}).Match(e))
+	assert.False(t, (&Spec{Actor: "test"}).Match(e))
+	e.Impersonator = "keeper"
+	assert.True(t, (&Spec{Actor: "keeper"}).Match(e), "impersonator")
+	assert.True(t, (&Spec{Actor: "eagle"}).Match(e))
+
+	assert.True(t, (&Spec{Since: day, Until: day}).Match(e), "the day is included")
+	assert.False(t, (&Spec{Since: day.AddDate(0, 0, 1)}).Match(e))
+	assert.False(t, (&Spec{Until: day.AddDate(0, 0, -1)}).Match(e))
+
+	spec := &Spec{}
+	spec.Page = 3
+	assert.Equal(t, 100, spec.Offset())
+	assert.Equal(t, 50, spec.Limit)
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	created := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	err := WriteCSV(&buf, []Event{
+		{ID: 2, Action: ActLoginFail, Actor: "eagle", IP: "10.0.0.1", UserAgent: "curl/7.0", Detail: "a, \"b\"", Created: created},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "id,created,action,actor,target,ip,user_agent,detail,impersonator\n"+
+		"2,2020-03-01T10:00:00Z,login.fail,eagle,,10.0.0.1,curl/7.0,\"a, \"\"b\"\"\",\n", buf.String())
+}
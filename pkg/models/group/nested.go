@@ -0,0 +1,143 @@
+// Package group resolves nested groups, a member starts with "@" is a subgroup
+package group
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/liut/staffio-backend/schema"
+)
+
+// SubgroupPrefix is the prefix of members which are groups
+const SubgroupPrefix = "@"
+
+// ErrNotFound returned by Getter of Map
+var ErrNotFound = errors.New("group not found")
+
+// Getter returns a group by name
+type Getter func(name string) (*schema.Group, error)
+
+// Subgroup returns the member value of a subgroup name
+func Subgroup(name string) string {
+	return SubgroupPrefix + name
+}
+
+// IsSubgroup returns the name of subgroup if member is
+func IsSubgroup(member string) (string, bool) {
+	if strings.HasPrefix(member, SubgroupPrefix) && len(member) > len(SubgroupPrefix) {
+		return member[len(SubgroupPrefix):], true
+	}
+	return "", false
+}
+
+// Subgroups returns the direct subgroup names of g
+func Subgroups(g *schema.Group) []string {
+	var names []string
+	for _, m := range g.Members {
+		if name, ok := IsSubgroup(m); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Has checks uid is a member of group name or any of its subgroups,
+// every group is visited once, so cycles like a -> b -> a are safe
+func Has(name, uid string, get Getter) bool {
+	found := false
+	walk(name, get, func(g *schema.Group) bool {
+		for _, m := range g.Members {
+			if m == uid {
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// Expand returns the sorted uids of group name and all its subgroups
+func Expand(name string, get Getter) []string {
+	seen := make(map[string]bool)
+	uids := []string{}
+	walk(name, get, func(g *schema.Group) bool {
+		for _, m := range g.Members {
+			if _, ok := IsSubgroup(m); !ok && !seen[m] {
+				seen[m] = true
+				uids = append(uids, m)
+			}
+		}
+		return true
+	})
+	sort.Strings(uids)
+	return uids
+}
+
+// Contains checks whether adding sub into group name makes a cycle
+func Contains(name, sub string, get Getter) bool {
+	found := false
+	walk(sub, get, func(g *schema.Group) bool {
+		if g.Name == name {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// walk visits group name and its subgroups breadth first until fn returns false,
+// unknown subgroups are skipped
+func walk(name string, get Getter, fn func(g *schema.Group) bool) {
+	visited := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		g, err := get(queue[0])
+		queue = queue[1:]
+		if err != nil || g == nil {
+			continue
+		}
+		if !fn(g) {
+			return
+		}
+		for _, sub := range Subgroups(g) {
+			if !visited[sub] {
+				visited[sub] = true
+				queue = append(queue, sub)
+			}
+		}
+	}
+}
+
+// Expanded is a group with its transitive members
+type Expanded struct {
+	schema.Group
+	Subgroups []string `json:"subgroups,omitempty"`
+	Expanded  []string `json:"expanded"`
+}
+
+// ExpandAll returns every group of groups with members expanded
+func ExpandAll(groups []schema.Group) []Expanded {
+	get := Map(groups)
+	data := make([]Expanded, len(groups))
+	for i, g := range groups {
+		data[i] = Expanded{Group: g, Subgroups: Subgroups(&g), Expanded: Expand(g.Name, get)}
+	}
+	return data
+}
+
+// Map returns a Getter from the groups in memory
+func Map(groups []schema.Group) Getter {
+	m := make(map[string]*schema.Group, len(groups))
+	for i := range groups {
+		m[groups[i].Name] = &groups[i]
+	}
+	return func(name string) (*schema.Group, error) {
+		if g, ok := m[name]; ok {
+			return g, nil
+		}
+		return nil, ErrNotFound
+	}
+}
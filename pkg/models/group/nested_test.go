@@ -0,0 +1,65 @@
+package group
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/schema"
+)
+
+func testGroups() Getter {
+	return Map([]schema.Group{
+		{Name: "keeper", Members: []string{"eagle"}},
+		{Name: "develop", Members: []string{"john", Subgroup("keeper"), Subgroup("qa")}},
+		{Name: "qa", Members: []string{"mary", Subgroup("develop")}}, // cycle
+		{Name: "all", Members: []string{Subgroup("develop"), Subgroup("missing")}},
+	})
+}
+
+func TestSubgroup(t *testing.T) {
+	name, ok := IsSubgroup("@keeper")
+	assert.True(t, ok)
+	assert.Equal(t, "keeper", name)
+	_, ok = IsSubgroup("eagle")
+	assert.False(t, ok)
+	_, ok = IsSubgroup("@")
+	assert.False(t, ok)
+}
+
+func TestHas(t *testing.T) {
+	get := testGroups()
+	assert.True(t, Has("develop", "eagle", get))
+	assert.True(t, Has("develop", "mary", get))
+	assert.True(t, Has("qa", "eagle", get))
+	assert.True(t, Has("all", "john", get))
+	assert.False(t, Has("keeper", "john", get))
+	assert.False(t, Has("develop", "nobody", get))
+	assert.False(t, Has("missing", "eagle", get))
+}
+
+func TestExpand(t *testing.T) {
+	get := testGroups()
+	assert.Equal(t, []string{"eagle", "john", "mary"}, Expand("all", get))
+	assert.Equal(t, []string{"eagle"}, Expand("keeper", get))
+	assert.Equal(t, []string{}, Expand("missing", get))
+}
+
+func TestContains(t *testing.T) {
+	get := testGroups()
+	assert.True(t, Contains("keeper", "develop", get))
+	assert.True(t, Contains("develop", "develop", get))
+	assert.False(t, Contains("all", "develop", get))
+}
+
+func TestExpandAll(t *testing.T) {
+	data := ExpandAll([]schema.Group{
+		{Name: "keeper", Members: []string{"eagle"}},
+		{Name: "develop", Members: []string{"john", Subgroup("keeper")}},
+	})
+	if assert.Len(t, data, 2) {
+		assert.Empty(t, data[0].Subgroups)
+		assert.Equal(t, []string{"keeper"}, data[1].Subgroups)
+		assert.Equal(t, []string{"eagle", "john"}, data[1].Expanded)
+	}
+}
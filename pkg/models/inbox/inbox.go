@@ -0,0 +1,90 @@
+// Package inbox keeps events received from third parties like Lark, once for each event id,
+// so that a failed one can be replayed, and links ids of the third party to staff and teams
+package inbox
+
+import (
+	"errors"
+	"time"
+
+	"github.com/liut/staffio/pkg/models/queue"
+)
+
+// ErrIgnored is returned by appliers for events not handled
+var ErrIgnored = errors.New("event is ignored")
+
+// status of events
+const (
+	StatusReceived = "received"
+	StatusApplied  = "applied"
+	StatusIgnored  = "ignored" // of types not handled
+	StatusFailed   = "failed"  // kept for keepers to replay
+)
+
+// Statuses of events for filters of keepers
+var Statuses = []string{StatusReceived, StatusApplied, StatusIgnored, StatusFailed}
+
+// kinds of links
+const (
+	KindUser       = "user"       // local is the uid of staff
+	KindDepartment = "department" // local is the id of team
+)
+
+// Event is a received event
+type Event struct {
+	ID        int       `json:"id" db:"id"`
+	Source    string    `json:"source" db:"source"`
+	EventID   string    `json:"eventID" db:"event_id"` // id given by the source, unique in it
+	Type      string    `json:"type" db:"type"`
+	Payload   string    `json:"payload" db:"payload"` // json of the event, decrypted
+	Status    string    `json:"status" db:"status"`
+	Attempts  int       `json:"attempts" db:"attempts"`
+	LastError string    `json:"lastError,omitempty" db:"last_error"`
+	Created   time.Time `json:"created" db:"created"`
+	Updated   time.Time `json:"updated" db:"updated"`
+}
+
+// Applied marks the event done with err, ignored if err is ErrIgnored
+func (e *Event) Applied(err error) {
+	e.Attempts++
+	switch err {
+	case nil:
+		e.Status, e.LastError = StatusApplied, ""
+	case ErrIgnored:
+		e.Status, e.LastError = StatusIgnored, ""
+	default:
+		e.Status, e.LastError = StatusFailed, err.Error()
+	}
+}
+
+// Spec filters of events, newer first
+type Spec struct {
+	Source string `json:"source,omitempty" form:"source"`
+	Type   string `json:"type,omitempty" form:"type"`
+	Status string `json:"status,omitempty" form:"status"`
+	queue.Pager
+}
+
+// Match returns true if e matches the filters
+func (s *Spec) Match(e *Event) bool {
+	return (s.Source == "" || e.Source == s.Source) && (s.Type == "" || e.Type == s.Type) &&
+		(s.Status == "" || e.Status == s.Status)
+}
+
+// Store interface of received events and links
+type Store interface {
+	// Add 保存收到的事件, 同一来源同一 EventID 已有时返回 false 和已有的
+	Add(e *Event) (isNew bool, err error)
+	// Update 保存处理的结果
+	Update(e *Event) error
+	// Get 取一个
+	Get(id int) (*Event, error)
+	// Query 按条件查询, 新的在前
+	Query(spec *Spec) ([]Event, error)
+
+	// Link 关联第三方的 id 与本地的 uid 或 team id, 已有时替换
+	Link(source, kind, extID, local string) error
+	// Linked 取关联的本地值, 没有时返回 ErrNotFound
+	Linked(source, kind, extID string) (string, error)
+	// Unlink 删除关联
+	Unlink(source, kind, extID string) error
+}
@@ -0,0 +1,31 @@
+package inbox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvent(t *testing.T) {
+	e := &Event{Source: "lark", EventID: "5e3702a84e847582be8db7fb73283c02", Type: "contact.user.created_v3", Status: StatusReceived}
+	e.Applied(errors.New("ldap is down"))
+	assert.Equal(t, StatusFailed, e.Status)
+	assert.Equal(t, 1, e.Attempts)
+	assert.Equal(t, "ldap is down", e.LastError)
+	e.Applied(nil)
+	assert.Equal(t, StatusApplied, e.Status)
+	assert.Equal(t, 2, e.Attempts)
+	assert.Empty(t, e.LastError)
+	e.Applied(ErrIgnored)
+	assert.Equal(t, StatusIgnored, e.Status)
+
+	spec := &Spec{Source: "lark", Status: StatusApplied}
+	assert.False(t, spec.Match(e))
+	e.Status = StatusApplied
+	assert.True(t, spec.Match(e))
+	spec.Type = "contact.user.deleted_v3"
+	assert.False(t, spec.Match(e))
+	assert.Equal(t, 0, spec.Offset())
+	assert.Equal(t, 50, spec.Limit)
+}
@@ -0,0 +1,75 @@
+// Package mailq keeps outgoing mails in a queue, a worker sends them after the request
+// and retries failures as a queue.Job
+package mailq
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/models/queue"
+)
+
+// status of messages
+const (
+	StatusPending = queue.StatusPending
+	StatusSent    = "sent"
+	StatusDead    = queue.StatusDead // kept for keepers to resend
+)
+
+// Statuses of messages, a mail is sent instead of done
+var Statuses = []string{StatusPending, StatusSent, StatusDead}
+
+// Message is a rendered mail in the queue, the body is not shown to keepers,
+// it may carry links to sign in or to set password
+type Message struct {
+	ID       int    `json:"id" db:"id"`
+	UID      string `json:"uid,omitempty" db:"uid"` // the staff mailed to
+	Template string `json:"template" db:"template"`
+	To       string `json:"to" db:"rcpt"`
+	Subject  string `json:"subject" db:"subject"`
+	Text     string `json:"-" db:"body_text"`
+	HTML     string `json:"-" db:"body_html"`
+	queue.Job
+	Sent    *time.Time `json:"sent,omitempty" db:"sent"`
+	Created time.Time  `json:"created" db:"created"`
+	Updated time.Time  `json:"updated" db:"updated"`
+}
+
+// Done marks the message sent
+func (m *Message) Done(now time.Time) {
+	m.Finish(StatusSent)
+	m.Sent = &now
+}
+
+// Resend makes the message pending again
+func (m *Message) Resend(now time.Time) {
+	m.Reset(now)
+	m.Sent = nil
+}
+
+// Spec filters of messages, newer first
+type Spec struct {
+	Status string `json:"status,omitempty" form:"status"`
+	To     string `json:"to,omitempty" form:"to"`
+	queue.Pager
+}
+
+// Match returns true if m matches the filters
+func (s *Spec) Match(m *Message) bool {
+	return (s.Status == "" || m.Status == s.Status) && (s.To == "" || m.To == s.To)
+}
+
+// Store interface of the queue
+type Store interface {
+	// Enqueue 加入待发
+	Enqueue(m *Message) error
+	// Claim 取到期待发的, 最多 limit 个, 把它们推迟 lease 以免同时被别的 worker 取到
+	Claim(now time.Time, lease time.Duration, limit int) ([]Message, error)
+	// Update 保存发送的结果
+	Update(m *Message) error
+	// Get 取一个
+	Get(id int) (*Message, error)
+	// Query 按条件查询, 新的在前
+	Query(spec *Spec) ([]Message, error)
+	// Resend 重新待发, 次数清零
+	Resend(id int) error
+}
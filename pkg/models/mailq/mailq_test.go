@@ -0,0 +1,37 @@
+package mailq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage(t *testing.T) {
+	now := time.Now()
+	m := &Message{To: "test@example.net"}
+	m.Status = StatusPending
+	m.Failed(errors.New("dial fail"), now)
+	assert.Equal(t, StatusPending, m.Status)
+	assert.Equal(t, 1, m.Attempts)
+
+	m.Done(now)
+	assert.Equal(t, StatusSent, m.Status)
+	assert.Equal(t, 2, m.Attempts)
+	assert.Empty(t, m.LastError)
+	assert.Equal(t, &now, m.Sent)
+
+	spec := &Spec{Status: StatusSent}
+	assert.True(t, spec.Match(m))
+	spec.To = "other@example.net"
+	assert.False(t, spec.Match(m))
+	assert.Equal(t, 0, spec.Offset())
+	assert.Equal(t, 50, spec.Limit)
+
+	m.Resend(now)
+	assert.Equal(t, StatusPending, m.Status)
+	assert.Zero(t, m.Attempts)
+	assert.Nil(t, m.Sent)
+	assert.True(t, m.Due(now))
+}
@@ -0,0 +1,71 @@
+// Package outbox keeps events of the directory until their subscribers handle them,
+// an event is added in the transaction of its change, one message for each subscriber,
+// and a message is retried as a queue.Job
+package outbox
+
+import (
+	"time"
+
+	"github.com/liut/staffio/pkg/models/queue"
+)
+
+// status of messages
+const (
+	StatusPending = queue.StatusPending
+	StatusDone    = queue.StatusDone
+	StatusDead    = queue.StatusDead // kept for keepers to retry
+)
+
+// Message is an event for a subscriber
+type Message struct {
+	ID         int    `json:"id" db:"id"`
+	Topic      string `json:"topic" db:"topic"`
+	Subscriber string `json:"subscriber" db:"subscriber"`
+	Payload    string `json:"payload" db:"payload"` // json of the event
+	queue.Job
+	Handled *time.Time `json:"handled,omitempty" db:"handled"`
+	Created time.Time  `json:"created" db:"created"`
+	Updated time.Time  `json:"updated" db:"updated"`
+}
+
+// Done marks the message handled by its subscriber
+func (m *Message) Done(now time.Time) {
+	m.Finish(StatusDone)
+	m.Handled = &now
+}
+
+// Retry makes the message pending again
+func (m *Message) Retry(now time.Time) {
+	m.Reset(now)
+	m.Handled = nil
+}
+
+// Spec filters of messages, newer first
+type Spec struct {
+	Topic      string `json:"topic,omitempty" form:"topic"`
+	Subscriber string `json:"subscriber,omitempty" form:"subscriber"`
+	Status     string `json:"status,omitempty" form:"status"`
+	queue.Pager
+}
+
+// Match returns true if m matches the filters
+func (s *Spec) Match(m *Message) bool {
+	return (s.Topic == "" || m.Topic == s.Topic) && (s.Subscriber == "" || m.Subscriber == s.Subscriber) &&
+		(s.Status == "" || m.Status == s.Status)
+}
+
+// Store interface of the outbox
+type Store interface {
+	// Add 加入待处理, 不在变更的事务中时用
+	Add(msgs ...Message) error
+	// Claim 取到期待处理的, 最多 limit 个, 把它们推迟 lease 以免同时被别的 worker 取到
+	Claim(now time.Time, lease time.Duration, limit int) ([]Message, error)
+	// Update 保存处理的结果
+	Update(m *Message) error
+	// Get 取一个
+	Get(id int) (*Message, error)
+	// Query 按条件查询, 新的在前
+	Query(spec *Spec) ([]Message, error)
+	// Retry 重新待处理, 次数清零
+	Retry(id int) error
+}
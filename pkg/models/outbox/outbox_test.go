@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage(t *testing.T) {
+	now := time.Now()
+	m := &Message{Topic: "staff.created", Subscriber: "welcome"}
+	m.Status = StatusPending
+	m.Failed(errors.New("refused"), now)
+	assert.Equal(t, StatusPending, m.Status)
+	assert.Equal(t, "refused", m.LastError)
+
+	m.Done(now)
+	assert.Equal(t, StatusDone, m.Status)
+	assert.Equal(t, 2, m.Attempts)
+	assert.Empty(t, m.LastError)
+	assert.Equal(t, &now, m.Handled)
+
+	spec := &Spec{Subscriber: "webhooks", Status: StatusDone}
+	assert.False(t, spec.Match(m))
+	m.Subscriber = "webhooks"
+	assert.True(t, spec.Match(m))
+	spec.Topic = "team.saved"
+	assert.False(t, spec.Match(m))
+	assert.Equal(t, 0, spec.Offset())
+	assert.Equal(t, 50, spec.Limit)
+
+	m.Retry(now)
+	assert.Equal(t, StatusPending, m.Status)
+	assert.Zero(t, m.Attempts)
+	assert.Nil(t, m.Handled)
+}
@@ -0,0 +1,110 @@
+// Package pat keeps personal access tokens of staff for scripts and CI,
+// only the hash of a token is stored, the token is shown once at creation
+package pat
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Prefix of tokens, so that they are told from other bearer tokens and found by secret scanners
+const Prefix = "stp_"
+
+// scopes of api
+const (
+	ScopeStaff  = "staff"  // contacts and teams
+	ScopeWeekly = "weekly" // weekly reports and problems
+)
+
+// Scopes is all scopes
+var Scopes = []string{ScopeStaff, ScopeWeekly}
+
+// MaxLife of a token
+const MaxLife = 365 * 24 * time.Hour
+
+// Token is a personal access token
+type Token struct {
+	ID       int            `json:"id" db:"id"`
+	UID      string         `json:"uid" db:"uid"`
+	Name     string         `json:"name" db:"name"`
+	Hash     string         `json:"-" db:"hash"`
+	Scopes   pq.StringArray `json:"scopes" db:"scopes"`
+	Expires  time.Time      `json:"expires" db:"expires"`
+	LastUsed *time.Time     `json:"lastUsed,omitempty" db:"last_used"`
+	Created  time.Time      `json:"created" db:"created"`
+}
+
+// New returns a token of uid, the value is returned only here
+func New(uid, name string, scopes []string, life time.Duration) (t *Token, value string, err error) {
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	value = Prefix + base64.RawURLEncoding.EncodeToString(b)
+	t = &Token{
+		UID:     uid,
+		Name:    name,
+		Hash:    Hash(value),
+		Scopes:  scopes,
+		Expires: time.Now().Add(life),
+	}
+	return
+}
+
+// Hash returns the stored hash of a token value
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsToken returns true if value looks like a personal access token
+func IsToken(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// ValidScope returns true if scope is known
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired ...
+func (t Token) IsExpired(now time.Time) bool {
+	return !now.Before(t.Expires)
+}
+
+// Allows returns true if the token has scope
+func (t Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Store interface of tokens storage
+type Store interface {
+	// All 用户的全部, 新的在前
+	All(uid string) ([]Token, error)
+	// Get 用 hash 取一个
+	Get(hash string) (*Token, error)
+	// Save 保存新的
+	Save(t *Token) error
+	// Touch 更新使用时间
+	Touch(id int) error
+	// Delete 吊销 uid 的一个
+	Delete(uid string, id int) error
+	// Clear 吊销 uid 的全部
+	Clear(uid string) error
+}
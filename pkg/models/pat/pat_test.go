@@ -0,0 +1,27 @@
+package pat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tok, value, err := New("eagle", "ci", []string{ScopeWeekly}, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, IsToken(value))
+	assert.False(t, IsToken("abc"))
+	assert.Equal(t, Hash(value), tok.Hash)
+	assert.NotContains(t, tok.Hash, value)
+	_, other, _ := New("eagle", "ci", nil, time.Hour)
+	assert.NotEqual(t, value, other)
+
+	now := time.Now()
+	assert.False(t, tok.IsExpired(now))
+	assert.True(t, tok.IsExpired(now.Add(time.Hour)))
+	assert.True(t, tok.Allows(ScopeWeekly))
+	assert.False(t, tok.Allows(ScopeStaff))
+	assert.True(t, ValidScope(ScopeStaff))
+	assert.False(t, ValidScope("admin"))
+}
@@ -0,0 +1,61 @@
+// Package prefs keeps preferences of staff, like the language of mails to them
+// and the channels of notifications
+package prefs
+
+import (
+	"strings"
+	"time"
+
+	"github.com/liut/staffio/pkg/models/types"
+)
+
+// languages of mails
+const (
+	LangEN = "en"
+	LangZH = "zh-CN"
+)
+
+// Langs is all languages
+var Langs = []string{LangEN, LangZH}
+
+// Prefs of a staff, empty values for the defaults of site
+type Prefs struct {
+	UID  string `json:"uid" db:"uid"`
+	Lang string `json:"lang" db:"lang"`
+	// Channels of notifications, like email and wxwork
+	Channels types.StringSlice `json:"channels" db:"channels"`
+	Updated  time.Time         `json:"updated" db:"updated"`
+}
+
+// SetChannels keeps the names those are in known
+func (p *Prefs) SetChannels(names, known []string) {
+	p.Channels = types.StringSlice{}
+	for _, name := range names {
+		if types.StringSlice(known).Contains(name) && !p.Channels.Contains(name) {
+			p.Channels = append(p.Channels, name)
+		}
+	}
+}
+
+// ParseLang returns a known language of s, like zh, zh_cn or an Accept-Language, empty if unknown
+func ParseLang(s string) string {
+	for _, part := range strings.Split(s, ",") {
+		tag := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		tag = strings.Replace(tag, "_", "-", -1)
+		switch {
+		case tag == "zh" || strings.HasPrefix(tag, "zh-cn") || strings.HasPrefix(tag, "zh-hans"):
+			return LangZH
+		case tag == "en" || strings.HasPrefix(tag, "en-"):
+			return LangEN
+		}
+	}
+	return ""
+}
+
+// Store interface of prefs storage
+type Store interface {
+	// Get 取 uid 的, 没有的返回空的
+	Get(uid string) (*Prefs, error)
+	// Save 保存
+	Save(p *Prefs) error
+}
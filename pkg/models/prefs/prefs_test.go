@@ -0,0 +1,30 @@
+package prefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLang(t *testing.T) {
+	for s, lang := range map[string]string{
+		"zh":                          LangZH,
+		"zh_CN":                       LangZH,
+		"zh-Hans-CN":                  LangZH,
+		"en-US,en;q=0.9":              LangEN,
+		"fr-FR, zh-CN;q=0.8, en;q=.5": LangZH,
+		"zh-TW":                       "",
+		"":                            "",
+	} {
+		assert.Equal(t, lang, ParseLang(s), s)
+	}
+}
+
+func TestSetChannels(t *testing.T) {
+	p := &Prefs{UID: "eagle"}
+	p.SetChannels([]string{"lark", "nope", "email", "lark"}, []string{"email", "lark", "file"})
+	assert.Equal(t, []string{"lark", "email"}, []string(p.Channels))
+	p.SetChannels(nil, []string{"email"})
+	assert.NotNil(t, p.Channels)
+	assert.Len(t, p.Channels, 0)
+}
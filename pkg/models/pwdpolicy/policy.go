@@ -0,0 +1,144 @@
+// Package pwdpolicy checks new passwords of staff with rules of length, character classes,
+// personal words and history, and tells expired passwords
+package pwdpolicy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// rules
+const (
+	RuleEmpty    = "empty"
+	RuleLength   = "length"
+	RuleClasses  = "classes"
+	RulePersonal = "personal"
+	RuleHistory  = "history"
+	RuleBreached = "breached"
+)
+
+// personal words shorter than it are ignored
+const minPersonal = 3
+
+// Violation is a broken rule
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is violations of a password
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Policy of new passwords
+type Policy struct {
+	MinLength  int           `json:"minLength"`
+	MinClasses int           `json:"minClasses"` // of lowercase, uppercase, digits and symbols
+	History    int           `json:"history"`    // the last passwords can not be reused
+	MaxAge     time.Duration `json:"maxAge"`     // zero for never
+}
+
+// Classes returns the number of character classes in s
+func Classes(s string) int {
+	var lower, upper, digit, other int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// Check returns *Error if password breaks the policy, personal are uid, names and email of the staff,
+// reused tells whether password is one of the last History passwords, nil to skip
+func (p Policy) Check(password string, personal []string, reused func(password string) bool) error {
+	if password == "" {
+		return &Error{[]Violation{{RuleEmpty, "password is empty"}}}
+	}
+	var vs []Violation
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		vs = append(vs, Violation{RuleLength, plural(p.MinLength, "at least %d character")})
+	}
+	if Classes(password) < p.MinClasses {
+		vs = append(vs, Violation{RuleClasses,
+			plural(p.MinClasses, "at least %d kind") + " of lowercase, uppercase, digits and symbols"})
+	}
+	lower := strings.ToLower(password)
+	for _, word := range personalWords(personal) {
+		if strings.Contains(lower, word) {
+			vs = append(vs, Violation{RulePersonal, "must not contain your name, login or email"})
+			break
+		}
+	}
+	if len(vs) == 0 && p.History > 0 && reused != nil && reused(password) {
+		vs = append(vs, Violation{RuleHistory, plural(p.History, "must not be one of your last %d password")})
+	}
+	if len(vs) > 0 {
+		return &Error{vs}
+	}
+	return nil
+}
+
+// Expired returns true if the password changed at changed is older than MaxAge
+func (p Policy) Expired(changed, now time.Time) bool {
+	return p.MaxAge > 0 && !changed.IsZero() && now.Sub(changed) > p.MaxAge
+}
+
+// personalWords splits names and the local part of email into lower words
+func personalWords(personal []string) (words []string) {
+	for _, s := range personal {
+		if i := strings.IndexByte(s, '@'); i >= 0 {
+			s = s[:i]
+		}
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return unicode.IsSpace(r) || r == '.' || r == '_' || r == '-'
+		}) {
+			if utf8.RuneCountInString(w) >= minPersonal {
+				words = append(words, w)
+			}
+		}
+	}
+	return
+}
+
+func plural(n int, format string) string {
+	s := fmt.Sprintf(format, n)
+	if n != 1 {
+		s += "s"
+	}
+	return s
+}
+
+// Entry is a used password
+type Entry struct {
+	UID     string    `json:"uid" db:"uid"`
+	Hash    string    `json:"-" db:"hash"`
+	Created time.Time `json:"created" db:"created"`
+}
+
+// Store interface of password history
+type Store interface {
+	// Recent 最近的 n 个, 新的在前
+	Recent(uid string, n int) ([]Entry, error)
+	// Add 记一个, 只保留最近的 keep 个
+	Add(uid, hash string, keep int) error
+}
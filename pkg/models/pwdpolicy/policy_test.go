@@ -0,0 +1,50 @@
+package pwdpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rules(err error) (rs []string) {
+	if e, ok := err.(*Error); ok {
+		for _, v := range e.Violations {
+			rs = append(rs, v.Rule)
+		}
+	}
+	return
+}
+
+func TestCheck(t *testing.T) {
+	p := Policy{MinLength: 8, MinClasses: 3, History: 2}
+	personal := []string{"eagle", "Eagle Liut", "eagle.liut@example.com"}
+
+	assert.Equal(t, []string{RuleEmpty}, rules(p.Check("", personal, nil)))
+	assert.Equal(t, []string{RuleLength, RuleClasses}, rules(p.Check("abc", personal, nil)))
+	assert.Equal(t, []string{RulePersonal}, rules(p.Check("Liut-2020!", personal, nil)))
+	assert.NoError(t, p.Check("Sky-2020!", personal, nil))
+
+	used := func(pw string) bool { return pw == "Sky-2020!" }
+	err := p.Check("Sky-2020!", personal, used)
+	assert.Equal(t, []string{RuleHistory}, rules(err))
+	assert.Equal(t, "must not be one of your last 2 passwords", err.Error())
+	assert.NoError(t, p.Check("Sea-2021!", personal, used))
+}
+
+func TestClasses(t *testing.T) {
+	assert.Equal(t, 1, Classes("abc"))
+	assert.Equal(t, 2, Classes("abc123"))
+	assert.Equal(t, 4, Classes("aB3$"))
+	assert.Equal(t, 2, Classes("密码abc"))
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	p := Policy{}
+	assert.False(t, p.Expired(now.Add(-1000*time.Hour), now))
+	p.MaxAge = 90 * 24 * time.Hour
+	assert.False(t, p.Expired(time.Time{}, now), "unknown")
+	assert.False(t, p.Expired(now.Add(-time.Hour), now))
+	assert.True(t, p.Expired(now.Add(-91*24*time.Hour), now))
+}
@@ -0,0 +1,211 @@
+// Package pwned tells breached passwords offline with a Bloom filter of SHA-1 sums,
+// built from a HIBP dump of Pwned Passwords
+package pwned
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Size of a sum
+const Size = sha1.Size
+
+// Sum is a SHA-1 of password
+type Sum [Size]byte
+
+// errors
+var (
+	ErrFormat = errors.New("not a pwned filter file")
+	ErrEmpty  = errors.New("empty filter")
+)
+
+var magic = [4]byte{'P', 'W', 'N', 'B'}
+
+const version = 1
+
+// Filter is a Bloom filter of sums, false positives at the rate it built with, no false negatives
+type Filter struct {
+	m    uint64 // bits
+	k    uint32 // hashes
+	n    uint64 // sums added
+	bits []uint64
+}
+
+// New returns an empty filter for n sums at false positive rate fp
+func New(n uint64, fp float64) *Filter {
+	if n == 0 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		fp = 0.001
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{m: m, k: k, bits: make([]uint64, m/64)}
+}
+
+// Len returns the number of sums added
+func (f *Filter) Len() uint64 {
+	return f.n
+}
+
+// Bytes returns the size of bits
+func (f *Filter) Bytes() uint64 {
+	return f.m / 8
+}
+
+// the sums are uniform already, two halves of them make the k hashes
+func (f *Filter) index(s Sum, i uint32) uint64 {
+	h1 := binary.BigEndian.Uint64(s[0:8])
+	h2 := binary.BigEndian.Uint64(s[8:16]) | 1
+	return (h1 + uint64(i)*h2) % f.m
+}
+
+// Add adds a sum
+func (f *Filter) Add(s Sum) {
+	for i := uint32(0); i < f.k; i++ {
+		j := f.index(s, i)
+		f.bits[j/64] |= 1 << (j % 64)
+	}
+	f.n++
+}
+
+// Has returns true if the sum is probably added
+func (f *Filter) Has(s Sum) bool {
+	for i := uint32(0); i < f.k; i++ {
+		j := f.index(s, i)
+		if f.bits[j/64]&(1<<(j%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains returns true if the password is probably breached
+func (f *Filter) Contains(password string) bool {
+	return f.Has(sha1.Sum([]byte(password)))
+}
+
+// WriteTo writes the filter in a binary format
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriterSize(w, 1<<16)
+	var head [4 + 1 + 8 + 4 + 8]byte
+	copy(head[:4], magic[:])
+	head[4] = version
+	binary.BigEndian.PutUint64(head[5:], f.m)
+	binary.BigEndian.PutUint32(head[13:], f.k)
+	binary.BigEndian.PutUint64(head[17:], f.n)
+	if _, err := bw.Write(head[:]); err != nil {
+		return 0, err
+	}
+	var b [8]byte
+	for _, v := range f.bits {
+		binary.BigEndian.PutUint64(b[:], v)
+		if _, err := bw.Write(b[:]); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(head)) + int64(f.m/8), bw.Flush()
+}
+
+// Read reads a filter written by WriteTo
+func Read(r io.Reader) (*Filter, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	var head [4 + 1 + 8 + 4 + 8]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		return nil, ErrFormat
+	}
+	if string(head[:4]) != string(magic[:]) || head[4] != version {
+		return nil, ErrFormat
+	}
+	f := &Filter{
+		m: binary.BigEndian.Uint64(head[5:]),
+		k: binary.BigEndian.Uint32(head[13:]),
+		n: binary.BigEndian.Uint64(head[17:]),
+	}
+	if f.m == 0 || f.m%64 != 0 || f.k == 0 {
+		return nil, ErrFormat
+	}
+	f.bits = make([]uint64, f.m/64)
+	var b [8]byte
+	for i := range f.bits {
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			return nil, ErrFormat
+		}
+		f.bits[i] = binary.BigEndian.Uint64(b[:])
+	}
+	return f, nil
+}
+
+// Load reads a filter file
+func Load(name string) (*Filter, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return Read(fd)
+}
+
+// Save writes the filter into a file
+func (f *Filter) Save(name string) error {
+	if f.n == 0 {
+		return ErrEmpty
+	}
+	fd, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteTo(fd); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// ParseLine parses a line of a dump, "HASH:COUNT" of the full list,
+// or "SUFFIX:COUNT" of a range file named by prefix of 5 hex digits
+func ParseLine(prefix, line string) (s Sum, ok bool) {
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	line = prefix + strings.TrimSpace(line)
+	if len(line) != Size*2 {
+		return
+	}
+	if _, err := hex.Decode(s[:], []byte(line)); err != nil {
+		return
+	}
+	return s, true
+}
+
+// IsRange returns true if name is a prefix of range files
+func IsRange(name string) bool {
+	if len(name) != 5 {
+		return false
+	}
+	_, err := hex.DecodeString(name + "0")
+	return err == nil
+}
+
+// Scan calls fn with every sum in r, bad lines are skipped
+func Scan(r io.Reader, prefix string, fn func(Sum)) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if s, ok := ParseLine(prefix, sc.Text()); ok {
+			fn(s)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,58 @@
+package pwned
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(1000, 0.001)
+	for i := 0; i < 1000; i++ {
+		f.Add(sha1.Sum([]byte(fmt.Sprintf("password%d", i))))
+	}
+	assert.Equal(t, uint64(1000), f.Len())
+	for i := 0; i < 1000; i++ {
+		assert.True(t, f.Contains(fmt.Sprintf("password%d", i)))
+	}
+	var fp int
+	for i := 0; i < 10000; i++ {
+		if f.Contains(fmt.Sprintf("other%d", i)) {
+			fp++
+		}
+	}
+	assert.True(t, fp < 50, "false positives %d", fp)
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	g, err := Read(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, f.Len(), g.Len())
+	assert.True(t, g.Contains("password42"))
+	assert.Equal(t, f.Contains("other0"), g.Contains("other0"))
+
+	_, err = Read(strings.NewReader("PWNX\x01"))
+	assert.Equal(t, ErrFormat, err)
+}
+
+func TestScan(t *testing.T) {
+	// sha1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	full := "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\nbad line\n"
+	var sums []Sum
+	assert.NoError(t, Scan(strings.NewReader(full), "", func(s Sum) { sums = append(sums, s) }))
+	assert.Equal(t, []Sum{sha1.Sum([]byte("password"))}, sums)
+
+	sums = nil
+	assert.True(t, IsRange("5BAA6"))
+	assert.False(t, IsRange("5BAAZ"))
+	assert.False(t, IsRange("README"))
+	rng := "1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n"
+	assert.NoError(t, Scan(strings.NewReader(rng), "5BAA6", func(s Sum) { sums = append(sums, s) }))
+	assert.Equal(t, []Sum{sha1.Sum([]byte("password"))}, sums)
+}
@@ -0,0 +1,100 @@
+// Package queue is the retry state shared by the queues of mails, webhook deliveries and events,
+// a job is leased to a worker when claimed, retried with exponential backoff after a failure,
+// and dead after MaxAttempts failures
+package queue
+
+import (
+	"time"
+)
+
+// status of jobs, a queue may name its own done status
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusDead    = "dead" // kept for keepers to retry
+)
+
+// Statuses of jobs ending with StatusDone
+var Statuses = []string{StatusPending, StatusDone, StatusDead}
+
+// MaxAttempts of a job, the last one is about 8 hours after the first with the backoff
+var MaxAttempts = 10
+
+// backoff of retries
+const (
+	BackoffBase = time.Minute
+	BackoffMax  = 6 * time.Hour
+)
+
+// Backoff returns the wait after attempts failures, doubled each time from BackoffBase to BackoffMax
+func Backoff(attempts int) time.Duration {
+	d := BackoffBase
+	for i := 1; i < attempts && d < BackoffMax; i++ {
+		d *= 2
+	}
+	if d > BackoffMax {
+		d = BackoffMax
+	}
+	return d
+}
+
+// Job is the state of an item in a queue, embedded by the items
+type Job struct {
+	Status    string    `json:"status" db:"status"`
+	Attempts  int       `json:"attempts" db:"attempts"`
+	LastError string    `json:"lastError,omitempty" db:"last_error"`
+	NextTry   time.Time `json:"nextTry" db:"next_try"`
+}
+
+// Due returns true if the job is pending and its next try is not after now
+func (j *Job) Due(now time.Time) bool {
+	return j.Status == StatusPending && !j.NextTry.After(now)
+}
+
+// Lease puts off the next try of a claimed job, so other workers do not claim it in the meantime
+func (j *Job) Lease(now time.Time, lease time.Duration) {
+	j.NextTry = now.Add(lease)
+}
+
+// Failed counts a failed attempt, the job is dead after MaxAttempts
+func (j *Job) Failed(err error, now time.Time) {
+	j.Attempts++
+	j.LastError = err.Error()
+	if j.Attempts >= MaxAttempts {
+		j.Status = StatusDead
+		return
+	}
+	j.Status = StatusPending
+	j.NextTry = now.Add(Backoff(j.Attempts))
+}
+
+// Finish counts the successful attempt, the job ends with status
+func (j *Job) Finish(status string) {
+	j.Attempts++
+	j.Status = status
+	j.LastError = ""
+}
+
+// Reset makes the job pending again at now, with attempts cleared
+func (j *Job) Reset(now time.Time) {
+	j.Status, j.Attempts, j.LastError = StatusPending, 0, ""
+	j.NextTry = now
+}
+
+// Pager is the page of a query, newer first
+type Pager struct {
+	Page  int `json:"page,omitempty" form:"page"`
+	Limit int `json:"limit,omitempty" form:"limit"`
+	Total int `json:"total,omitempty"` // for set value
+}
+
+// Offset returns the offset of the Page, defaults of Page and Limit are set
+func (p *Pager) Offset() int {
+	if p.Limit < 1 || p.Limit > 500 {
+		p.Limit = 50
+	}
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	return (p.Page - 1) * p.Limit
+}
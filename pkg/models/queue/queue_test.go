@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, Backoff(0))
+	assert.Equal(t, time.Minute, Backoff(1))
+	assert.Equal(t, 2*time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(3))
+	assert.Equal(t, BackoffMax, Backoff(10))
+	assert.Equal(t, BackoffMax, Backoff(100))
+}
+
+func TestJob(t *testing.T) {
+	now := time.Now()
+	j := &Job{Status: StatusPending, NextTry: now}
+	assert.True(t, j.Due(now))
+	j.Lease(now, time.Minute)
+	assert.False(t, j.Due(now))
+	assert.True(t, j.Due(now.Add(time.Minute)))
+
+	j.Failed(errors.New("dial fail"), now)
+	assert.Equal(t, StatusPending, j.Status)
+	assert.Equal(t, 1, j.Attempts)
+	assert.Equal(t, "dial fail", j.LastError)
+	assert.Equal(t, now.Add(BackoffBase), j.NextTry)
+	for j.Status == StatusPending {
+		j.Failed(errors.New("dial fail"), now)
+	}
+	assert.Equal(t, StatusDead, j.Status)
+	assert.Equal(t, MaxAttempts, j.Attempts)
+	assert.False(t, j.Due(now.Add(BackoffMax)))
+
+	j.Reset(now)
+	assert.Equal(t, StatusPending, j.Status)
+	assert.Zero(t, j.Attempts)
+	assert.Empty(t, j.LastError)
+	assert.True(t, j.Due(now))
+
+	j.Finish(StatusDone)
+	assert.Equal(t, StatusDone, j.Status)
+	assert.Equal(t, 1, j.Attempts)
+	assert.False(t, j.Due(now))
+}
+
+func TestPager(t *testing.T) {
+	p := &Pager{}
+	assert.Equal(t, 0, p.Offset())
+	assert.Equal(t, 1, p.Page)
+	assert.Equal(t, 50, p.Limit)
+	p = &Pager{Page: 3, Limit: 20}
+	assert.Equal(t, 40, p.Offset())
+	p = &Pager{Page: 2, Limit: 501}
+	assert.Equal(t, 50, p.Offset())
+}
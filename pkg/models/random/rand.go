@@ -1,9 +1,9 @@
 package random
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
-	"math/rand"
-	"time"
 )
 
 const (
@@ -13,14 +13,22 @@ const (
 	idxMax  = 63 / idxBits   // # of letter indices fitting in 63 bits
 )
 
+// int63 returns 63 bits from crypto/rand
+func int63() int64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]) >> 1)
+}
+
 // Generate string without number
 func GenString(n int) string {
 	b := make([]byte, n)
-	src := rand.NewSource(time.Now().UnixNano())
-	// A src.Int63() generates 63 random bits, enough for idxMax characters!
-	for i, cache, remain := n-1, src.Int63(), idxMax; i >= 0; {
+	// A int63() generates 63 random bits, enough for idxMax characters!
+	for i, cache, remain := n-1, int63(), idxMax; i >= 0; {
 		if remain == 0 {
-			cache, remain = src.Int63(), idxMax
+			cache, remain = int63(), idxMax
 		}
 		if idx := int(cache & idxMask); idx < len(letters) {
 			b[i] = letters[idx]
@@ -33,9 +41,7 @@ func GenString(n int) string {
 	return string(b)
 }
 
-// Generate string with number
+// Generate string with number, 6 digits from 000000 to 999999
 func GenCode() string {
-	r := rand.New(rand.NewSource(int64(time.Now().Nanosecond())))
-	d := r.Intn(999999)
-	return fmt.Sprintf("%06d", d)
+	return fmt.Sprintf("%06d", int63()%1000000)
 }
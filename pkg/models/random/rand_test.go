@@ -7,4 +7,21 @@ import (
 func TestGenString(t *testing.T) {
 	s := GenString(32)
 	t.Logf("generated randam string %q", s)
+	if len(s) != 32 || s == GenString(32) {
+		t.Errorf("bad string %q", s)
+	}
+}
+
+func TestGenCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code := GenCode()
+		if len(code) != 6 {
+			t.Fatalf("bad code %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 90 {
+		t.Errorf("codes repeat too often: %d of 100", len(seen))
+	}
 }
@@ -0,0 +1,227 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	algExcC14N     = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algSHA256      = "http://www.w3.org/2001/04/xmlenc#sha256"
+	attrNameFormat = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+
+	timeFormat = "2006-01-02T15:04:05Z"
+)
+
+// vars
+var (
+	ErrNotRSAKey = errors.New("the signing key must be RSA")
+
+	// AssertionLife is the valid duration of an assertion
+	AssertionLife = 5 * time.Minute
+)
+
+// Attribute released to SP
+type Attribute struct {
+	Name         string
+	FriendlyName string
+	Values       []string
+}
+
+// Subject of an assertion
+type Subject struct {
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	AuthnInstant time.Time
+	Attributes   []Attribute
+}
+
+// IdentityProvider signs responses with its key
+type IdentityProvider struct {
+	EntityID string
+	SSOURL   string
+
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// NewIdentityProvider load key pair from PEM files
+func NewIdentityProvider(entityID, ssoURL, certFile, keyFile string) (*IdentityProvider, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrNotRSAKey
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return &IdentityProvider{EntityID: entityID, SSOURL: ssoURL, key: key, cert: cert}, nil
+}
+
+func (idp *IdentityProvider) certBase64() string {
+	return base64.StdEncoding.EncodeToString(idp.cert.Raw)
+}
+
+// Metadata returns XML of IdP metadata
+func (idp *IdentityProvider) Metadata() []byte {
+	sso := newNode("md:IDPSSODescriptor",
+		"WantAuthnRequestsSigned", "false",
+		"protocolSupportEnumeration", NSProtocol)
+	sso.add(newNode("md:KeyDescriptor", "use", "signing").add(
+		newNode("ds:KeyInfo").declare("ds", NSSignature).add(
+			newNode("ds:X509Data").add(
+				newNode("ds:X509Certificate").setText(idp.certBase64())))))
+	for _, f := range []string{NameIDFormatEmailAddress, NameIDFormatPersistent, NameIDFormatUnspecified} {
+		sso.add(newNode("md:NameIDFormat").setText(f))
+	}
+	sso.add(
+		newNode("md:SingleSignOnService", "Binding", BindingHTTPRedirect, "Location", idp.SSOURL),
+		newNode("md:SingleSignOnService", "Binding", BindingHTTPPost, "Location", idp.SSOURL),
+	)
+	ed := newNode("md:EntityDescriptor", "entityID", idp.EntityID).declare("md", NSMetadata).add(sso)
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + ed.String())
+}
+
+// NewResponse build a base64 encoded Response with signed assertion for HTTP-POST binding
+func (idp *IdentityProvider) NewResponse(req *AuthnRequest, acsURL string, sub *Subject) (string, error) {
+	now := time.Now().UTC()
+	expire := now.Add(AssertionLife)
+	if sub.AuthnInstant.IsZero() {
+		sub.AuthnInstant = now
+	}
+	assertionID, err := newID()
+	if err != nil {
+		return "", err
+	}
+	responseID, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	nameID := newNode("saml:NameID").setText(sub.NameID)
+	if sub.NameIDFormat != "" {
+		nameID.set("Format", sub.NameIDFormat)
+	}
+	scd := newNode("saml:SubjectConfirmationData",
+		"NotOnOrAfter", expire.Format(timeFormat),
+		"Recipient", acsURL)
+	if req.ID != "" {
+		scd.set("InResponseTo", req.ID)
+	}
+	statement := newNode("saml:AttributeStatement")
+	for _, attr := range sub.Attributes {
+		an := newNode("saml:Attribute", "Name", attr.Name, "NameFormat", attrNameFormat)
+		if attr.FriendlyName != "" {
+			an.set("FriendlyName", attr.FriendlyName)
+		}
+		for _, v := range attr.Values {
+			an.add(newNode("saml:AttributeValue").setText(v))
+		}
+		statement.add(an)
+	}
+
+	assertion := newNode("saml:Assertion",
+		"ID", assertionID,
+		"IssueInstant", now.Format(timeFormat),
+		"Version", "2.0").declare("saml", NSAssertion)
+	assertion.add(
+		newNode("saml:Issuer").setText(idp.EntityID),
+		newNode("saml:Subject").add(
+			nameID,
+			newNode("saml:SubjectConfirmation", "Method", "urn:oasis:names:tc:SAML:2.0:cm:bearer").add(scd),
+		),
+		newNode("saml:Conditions",
+			"NotBefore", now.Add(-30*time.Second).Format(timeFormat),
+			"NotOnOrAfter", expire.Format(timeFormat)).add(
+			newNode("saml:AudienceRestriction").add(
+				newNode("saml:Audience").setText(req.Issuer))),
+		newNode("saml:AuthnStatement",
+			"AuthnInstant", sub.AuthnInstant.UTC().Format(timeFormat),
+			"SessionIndex", sub.SessionIndex).add(
+			newNode("saml:AuthnContext").add(
+				newNode("saml:AuthnContextClassRef").setText(
+					"urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"))),
+	)
+	if len(statement.children) > 0 {
+		assertion.add(statement)
+	}
+
+	signature, err := idp.sign(assertionID, assertion.String())
+	if err != nil {
+		return "", err
+	}
+	assertion.insertAfter("saml:Issuer", signature)
+
+	resp := newNode("samlp:Response",
+		"Destination", acsURL,
+		"ID", responseID,
+		"IssueInstant", now.Format(timeFormat),
+		"Version", "2.0").declare("samlp", NSProtocol).declare("saml", NSAssertion)
+	if req.ID != "" {
+		resp.set("InResponseTo", req.ID)
+	}
+	resp.add(
+		newNode("saml:Issuer").setText(idp.EntityID),
+		newNode("samlp:Status").add(
+			newNode("samlp:StatusCode", "Value", "urn:oasis:names:tc:SAML:2.0:status:Success")),
+		assertion,
+	)
+
+	return base64.StdEncoding.EncodeToString([]byte(resp.String())), nil
+}
+
+// sign returns an enveloped signature of the canonical element with id
+func (idp *IdentityProvider) sign(id, canonical string) (*node, error) {
+	digest := sha256.Sum256([]byte(canonical))
+
+	signedInfo := newNode("ds:SignedInfo").declare("ds", NSSignature).add(
+		newNode("ds:CanonicalizationMethod", "Algorithm", algExcC14N),
+		newNode("ds:SignatureMethod", "Algorithm", algRSASHA256),
+		newNode("ds:Reference", "URI", "#"+id).add(
+			newNode("ds:Transforms").add(
+				newNode("ds:Transform", "Algorithm", algEnveloped),
+				newNode("ds:Transform", "Algorithm", algExcC14N),
+			),
+			newNode("ds:DigestMethod", "Algorithm", algSHA256),
+			newNode("ds:DigestValue").setText(base64.StdEncoding.EncodeToString(digest[:])),
+		),
+	)
+	hashed := sha256.Sum256([]byte(signedInfo.String()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, err
+	}
+	// namespace of SignedInfo is inherited from Signature
+	signedInfo.ns = nil
+
+	return newNode("ds:Signature").declare("ds", NSSignature).add(
+		signedInfo,
+		newNode("ds:SignatureValue").setText(base64.StdEncoding.EncodeToString(sig)),
+		newNode("ds:KeyInfo").add(
+			newNode("ds:X509Data").add(
+				newNode("ds:X509Certificate").setText(idp.certBase64()))),
+	), nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
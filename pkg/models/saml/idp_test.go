@@ -0,0 +1,137 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const spMetadata = `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://sp.example.com/saml">
+  <md:SPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress</md:NameIDFormat>
+    <md:AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Artifact" Location="https://sp.example.com/artifact" index="0"/>
+    <md:AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://sp.example.com/acs2" index="2"/>
+    <md:AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://sp.example.com/acs" index="1"/>
+  </md:SPSSODescriptor>
+</md:EntityDescriptor>`
+
+const authnRequest = `<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"
+ ID="id-abc" Version="2.0" IssueInstant="2020-04-01T08:00:00Z" AssertionConsumerServiceURL="https://sp.example.com/acs">
+  <saml:Issuer>https://sp.example.com/saml</saml:Issuer>
+</samlp:AuthnRequest>`
+
+func TestParseMetadata(t *testing.T) {
+	sp, err := ParseMetadata([]byte(spMetadata))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://sp.example.com/saml", sp.EntityID)
+	assert.Equal(t, "https://sp.example.com/acs", sp.ACSURL)
+	assert.Equal(t, NameIDFormatEmailAddress, sp.NameIDFormat)
+	assert.True(t, sp.AllowACS("https://sp.example.com/acs2"))
+	assert.False(t, sp.AllowACS("https://sp.example.com/artifact"))
+
+	_, err = ParseMetadata([]byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"/>`))
+	assert.Equal(t, ErrNoACS, err)
+}
+
+func TestDecodeRequest(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write([]byte(authnRequest))
+	w.Close()
+
+	data, err := DecodeRequest(base64.StdEncoding.EncodeToString(buf.Bytes()), true)
+	assert.NoError(t, err)
+	req, err := ParseRequest(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "id-abc", req.ID)
+	assert.Equal(t, "https://sp.example.com/saml", req.Issuer)
+	assert.Equal(t, "https://sp.example.com/acs", req.ACSURL)
+
+	data, err = DecodeRequest(base64.StdEncoding.EncodeToString([]byte(authnRequest)), false)
+	assert.NoError(t, err)
+	_, err = ParseRequest(data)
+	assert.NoError(t, err)
+}
+
+func newTestIdP(t *testing.T) *IdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "staffio"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &IdentityProvider{
+		EntityID: "http://localhost:3030/saml/metadata",
+		SSOURL:   "http://localhost:3030/saml/sso",
+		key:      key,
+		cert:     cert,
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	assert.Contains(t, string(idp.Metadata()), `entityID="http://localhost:3030/saml/metadata"`)
+
+	req, _ := ParseRequest([]byte(authnRequest))
+	s, err := idp.NewResponse(req, req.ACSURL, &Subject{
+		NameID:       "eagle@example.com",
+		NameIDFormat: NameIDFormatEmailAddress,
+		SessionIndex: "sess-1",
+		Attributes: []Attribute{
+			{Name: "uid", Values: []string{"eagle"}},
+			{Name: "groups", Values: []string{"keeper", "develop & ops"}},
+		},
+	})
+	assert.NoError(t, err)
+	data, err := base64.StdEncoding.DecodeString(s)
+	assert.NoError(t, err)
+	doc := string(data)
+	assert.Contains(t, doc, `InResponseTo="id-abc"`)
+	assert.Contains(t, doc, `<saml:AttributeValue>develop &amp; ops</saml:AttributeValue>`)
+
+	// verify digest of assertion without signature
+	start := strings.Index(doc, "<saml:Assertion ")
+	end := strings.Index(doc, "</saml:Assertion>") + len("</saml:Assertion>")
+	assertion := doc[start:end]
+	sigStart := strings.Index(assertion, "<ds:Signature ")
+	sigEnd := strings.Index(assertion, "</ds:Signature>") + len("</ds:Signature>")
+	digest := sha256.Sum256([]byte(assertion[:sigStart] + assertion[sigEnd:]))
+	m := regexp.MustCompile(`<ds:DigestValue>([^<]+)</ds:DigestValue>`).FindStringSubmatch(doc)
+	if assert.Len(t, m, 2) {
+		assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), m[1])
+	}
+
+	// verify signature of canonical SignedInfo
+	siStart := strings.Index(doc, "<ds:SignedInfo>")
+	siEnd := strings.Index(doc, "</ds:SignedInfo>") + len("</ds:SignedInfo>")
+	signedInfo := strings.Replace(doc[siStart:siEnd], "<ds:SignedInfo>",
+		`<ds:SignedInfo xmlns:ds="`+NSSignature+`">`, 1)
+	m = regexp.MustCompile(`<ds:SignatureValue>([^<]+)</ds:SignatureValue>`).FindStringSubmatch(doc)
+	if assert.Len(t, m, 2) {
+		sig, _ := base64.StdEncoding.DecodeString(m[1])
+		hashed := sha256.Sum256([]byte(signedInfo))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&idp.key.PublicKey, crypto.SHA256, hashed[:], sig))
+	}
+}
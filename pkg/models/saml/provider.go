@@ -0,0 +1,127 @@
+package saml
+
+import (
+	"encoding/xml"
+	"errors"
+	"time"
+)
+
+// SAML 2.0 names
+const (
+	NSMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	NSAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NSProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NSSignature = "http://www.w3.org/2000/09/xmldsig#"
+
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+)
+
+// vars
+var (
+	ErrEmptyEntityID = errors.New("empty entityID in metadata")
+	ErrNoACS         = errors.New("no AssertionConsumerService with HTTP-POST binding")
+)
+
+// Store interface of service provider storage
+type Store interface {
+	// Get 取一个
+	Get(entityID string) (*ServiceProvider, error)
+	// All 查询全部数据
+	All() (data []ServiceProvider, err error)
+	// Store 保存
+	Store(sp *ServiceProvider) error
+	// Delete 删除
+	Delete(entityID string) error
+}
+
+// ServiceProvider a registered SAML SP
+type ServiceProvider struct {
+	ID           int       `json:"id" db:"id"`
+	EntityID     string    `json:"entity_id" db:"entity_id"`
+	Name         string    `json:"name" db:"name"`
+	ACSURL       string    `json:"acs_url" db:"acs_url"`
+	NameIDFormat string    `json:"nameid_format" db:"nameid_format"`
+	Metadata     string    `json:"-" db:"metadata"`
+	Created      time.Time `json:"created" db:"created"`
+}
+
+// AllowACS reports whether uri is an AssertionConsumerService (HTTP-POST) of the SP
+func (sp *ServiceProvider) AllowACS(uri string) bool {
+	if uri == sp.ACSURL {
+		return true
+	}
+	ed, err := parseEntityDescriptor([]byte(sp.Metadata))
+	if err != nil {
+		return false
+	}
+	for _, acs := range ed.SPSSODescriptor.AssertionConsumerServices {
+		if acs.Binding == BindingHTTPPost && acs.Location == uri {
+			return true
+		}
+	}
+	return false
+}
+
+type entityDescriptor struct {
+	XMLName         xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string   `xml:"entityID,attr"`
+	SPSSODescriptor struct {
+		NameIDFormats             []string `xml:"NameIDFormat"`
+		AssertionConsumerServices []struct {
+			Binding   string `xml:"Binding,attr"`
+			Location  string `xml:"Location,attr"`
+			Index     int    `xml:"index,attr"`
+			IsDefault bool   `xml:"isDefault,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+func parseEntityDescriptor(data []byte) (*entityDescriptor, error) {
+	ed := new(entityDescriptor)
+	if err := xml.Unmarshal(data, ed); err != nil {
+		return nil, err
+	}
+	return ed, nil
+}
+
+// ParseMetadata build a ServiceProvider from SP metadata
+func ParseMetadata(data []byte) (*ServiceProvider, error) {
+	ed, err := parseEntityDescriptor(data)
+	if err != nil {
+		return nil, err
+	}
+	if ed.EntityID == "" {
+		return nil, ErrEmptyEntityID
+	}
+	sp := &ServiceProvider{
+		EntityID:     ed.EntityID,
+		NameIDFormat: NameIDFormatUnspecified,
+		Metadata:     string(data),
+	}
+	if len(ed.SPSSODescriptor.NameIDFormats) > 0 {
+		sp.NameIDFormat = ed.SPSSODescriptor.NameIDFormats[0]
+	}
+	index := -1
+	for _, acs := range ed.SPSSODescriptor.AssertionConsumerServices {
+		if acs.Binding != BindingHTTPPost {
+			continue
+		}
+		if acs.IsDefault {
+			sp.ACSURL = acs.Location
+			break
+		}
+		if index < 0 || acs.Index < index {
+			index = acs.Index
+			sp.ACSURL = acs.Location
+		}
+	}
+	if sp.ACSURL == "" {
+		return nil, ErrNoACS
+	}
+	return sp, nil
+}
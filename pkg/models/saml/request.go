@@ -0,0 +1,60 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+)
+
+// vars
+var (
+	ErrEmptyRequest = errors.New("empty SAMLRequest")
+	ErrEmptyIssuer  = errors.New("empty issuer in AuthnRequest")
+)
+
+// AuthnRequest is the SP-initiated request of SSO
+type AuthnRequest struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID           string   `xml:"ID,attr"`
+	Version      string   `xml:"Version,attr"`
+	IssueInstant string   `xml:"IssueInstant,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	ACSURL       string   `xml:"AssertionConsumerServiceURL,attr"`
+	Binding      string   `xml:"ProtocolBinding,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy *struct {
+		Format string `xml:"Format,attr"`
+	} `xml:"NameIDPolicy"`
+}
+
+// DecodeRequest returns XML of SAMLRequest value, deflated is true for HTTP-Redirect binding
+func DecodeRequest(s string, deflated bool) ([]byte, error) {
+	if s == "" {
+		return nil, ErrEmptyRequest
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if !deflated {
+		return data, nil
+	}
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// ParseRequest parse a AuthnRequest from XML
+func ParseRequest(data []byte) (*AuthnRequest, error) {
+	req := new(AuthnRequest)
+	if err := xml.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	if req.Issuer == "" {
+		return nil, ErrEmptyIssuer
+	}
+	return req, nil
+}
@@ -0,0 +1,122 @@
+package saml
+
+import (
+	"sort"
+	"strings"
+)
+
+// node is a minimal XML element. It always renders itself in the form of
+// Exclusive XML Canonicalization (without comments), so a digest can be
+// taken over the output directly and match what a verifier computes.
+//
+// Only unprefixed attributes are supported, and every namespace must be
+// declared on the element where it is first used.
+type node struct {
+	name     string
+	ns       map[string]string // prefix => uri
+	attrs    map[string]string
+	children []*node
+	text     string
+}
+
+func newNode(name string, attrs ...string) *node {
+	n := &node{name: name}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.set(attrs[i], attrs[i+1])
+	}
+	return n
+}
+
+func (n *node) declare(prefix, uri string) *node {
+	if n.ns == nil {
+		n.ns = make(map[string]string)
+	}
+	n.ns[prefix] = uri
+	return n
+}
+
+func (n *node) set(name, value string) *node {
+	if n.attrs == nil {
+		n.attrs = make(map[string]string)
+	}
+	n.attrs[name] = value
+	return n
+}
+
+func (n *node) add(children ...*node) *node {
+	n.children = append(n.children, children...)
+	return n
+}
+
+func (n *node) setText(s string) *node {
+	n.text = s
+	return n
+}
+
+// insertAfter puts child behind the first child with name
+func (n *node) insertAfter(name string, child *node) {
+	for i, c := range n.children {
+		if c.name == name {
+			n.children = append(n.children[:i+1], append([]*node{child}, n.children[i+1:]...)...)
+			return
+		}
+	}
+	n.children = append([]*node{child}, n.children...)
+}
+
+func (n *node) String() string {
+	var sb strings.Builder
+	n.write(&sb)
+	return sb.String()
+}
+
+func (n *node) write(sb *strings.Builder) {
+	sb.WriteByte('<')
+	sb.WriteString(n.name)
+
+	prefixes := make([]string, 0, len(n.ns))
+	for p := range n.ns {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	for _, p := range prefixes {
+		if p == "" {
+			sb.WriteString(" xmlns")
+		} else {
+			sb.WriteString(" xmlns:")
+			sb.WriteString(p)
+		}
+		sb.WriteString(`="`)
+		sb.WriteString(attrEscaper.Replace(n.ns[p]))
+		sb.WriteByte('"')
+	}
+
+	names := make([]string, 0, len(n.attrs))
+	for k := range n.attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		sb.WriteByte(' ')
+		sb.WriteString(k)
+		sb.WriteString(`="`)
+		sb.WriteString(attrEscaper.Replace(n.attrs[k]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('>')
+
+	sb.WriteString(textEscaper.Replace(n.text))
+	for _, c := range n.children {
+		c.write(sb)
+	}
+
+	sb.WriteString("</")
+	sb.WriteString(n.name)
+	sb.WriteByte('>')
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
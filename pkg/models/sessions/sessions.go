@@ -0,0 +1,119 @@
+// Package sessions keeps server-side login sessions of staff, one per signed in browser or client,
+// so they can be listed and terminated before their cookies expire
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// TouchEvery is the least interval of updating LastSeen
+const TouchEvery = time.Minute
+
+// Session is a login, ID is the hash of the token in cookie
+type Session struct {
+	ID        string    `json:"id" db:"id"`
+	UID       string    `json:"uid" db:"uid"`
+	UserAgent string    `json:"userAgent" db:"user_agent"`
+	IP        string    `json:"ip" db:"ip"`
+	Created   time.Time `json:"created" db:"created"`
+	LastSeen  time.Time `json:"lastSeen" db:"last_seen"`
+	Actor     string    `json:"actor,omitempty" db:"actor"` // keeper signed in as UID, empty for UID self
+}
+
+// NewToken returns a random token for cookie and its hash as ID
+func NewToken() (token, id string, err error) {
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns ID of a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CSRFToken returns the csrf token of a session token, it can not be got from the ID
+func CSRFToken(token string) string {
+	sum := sha256.Sum256([]byte("csrf:" + token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// IsIdle returns true if not seen in idle, zero idle for never
+func (s *Session) IsIdle(idle time.Duration, now time.Time) bool {
+	return idle > 0 && now.Sub(s.LastSeen) > idle
+}
+
+// NeedTouch returns true if LastSeen is older than TouchEvery
+func (s *Session) NeedTouch(now time.Time) bool {
+	return now.Sub(s.LastSeen) >= TouchEvery
+}
+
+// Device returns a short name of browser and system from UserAgent
+func (s *Session) Device() string {
+	ua := s.UserAgent
+	var browser, system string
+	for _, b := range browsers {
+		if strings.Contains(ua, b[0]) {
+			browser = b[1]
+			break
+		}
+	}
+	for _, o := range systems {
+		if strings.Contains(ua, o[0]) {
+			system = o[1]
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case ua == "":
+		return "Unknown"
+	}
+	if i := strings.IndexAny(ua, " /"); i > 0 {
+		return ua[:i]
+	}
+	return ua
+}
+
+// pairs of substring and name, the first match wins
+var browsers = [][2]string{
+	{"Edg/", "Edge"}, {"Edge/", "Edge"}, {"OPR/", "Opera"}, {"MicroMessenger", "WeChat"}, {"Lark", "Lark"},
+	{"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"CriOS/", "Chrome"}, {"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+var systems = [][2]string{
+	{"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Android", "Android"}, {"Windows", "Windows"},
+	{"Mac OS X", "macOS"}, {"CrOS", "Chrome OS"}, {"Linux", "Linux"},
+}
+
+// Store interface of sessions storage
+type Store interface {
+	// Get 取一个
+	Get(id string) (*Session, error)
+	// Save 新建
+	Save(s *Session) error
+	// Touch 更新 last seen and ip
+	Touch(id, ip string) error
+	// All 列出 uid 的, 新的在前
+	All(uid string) ([]Session, error)
+	// Active 列出所有人最近的
+	Active(limit int) ([]Session, error)
+	// Delete 终止 uid 的一个
+	Delete(uid, id string) error
+	// Clear 终止 uid 的全部
+	Clear(uid string) error
+}
@@ -0,0 +1,46 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	token, id, err := NewToken()
+	assert.NoError(t, err)
+	assert.Len(t, token, 32)
+	assert.Equal(t, id, HashToken(token))
+	assert.NotEqual(t, token, id)
+	other, _, _ := NewToken()
+	assert.NotEqual(t, token, other)
+	assert.Equal(t, CSRFToken(token), CSRFToken(token))
+	assert.NotEqual(t, id, CSRFToken(token))
+	assert.NotEqual(t, CSRFToken(other), CSRFToken(token))
+}
+
+func TestIdle(t *testing.T) {
+	now := time.Now()
+	s := &Session{LastSeen: now.Add(-30 * time.Second)}
+	assert.False(t, s.IsIdle(time.Hour, now))
+	assert.False(t, s.IsIdle(0, now.Add(24*time.Hour)))
+	assert.True(t, s.IsIdle(time.Hour, now.Add(time.Hour)))
+	assert.False(t, s.NeedTouch(now))
+	assert.True(t, s.NeedTouch(now.Add(30*time.Second)))
+}
+
+func TestDevice(t *testing.T) {
+	cases := map[string]string{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0 Safari/605.1.15":              "Safari on macOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.75 Safari/537.36 Edg/86.0.622.38": "Edge on Windows",
+		"Mozilla/5.0 (Linux; Android 10; Pixel 3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/86.0.4240.75 Mobile Safari/537.36":           "Chrome on Android",
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:82.0) Gecko/20100101 Firefox/82.0":                                                       "Firefox on Linux",
+		"curl/7.64.1":        "curl",
+		"Go-http-client/1.1": "Go-http-client",
+		"":                   "Unknown",
+	}
+	for ua, want := range cases {
+		assert.Equal(t, want, (&Session{UserAgent: ua}).Device(), ua)
+	}
+}
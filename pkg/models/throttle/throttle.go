@@ -0,0 +1,157 @@
+// Package throttle counts failed logins of accounts and addresses,
+// for progressive delays and temporary lockout
+package throttle
+
+import (
+	"strings"
+	"time"
+)
+
+// key prefixes
+const (
+	PrefixAccount = "uid:"
+	PrefixIP      = "ip:"
+	PrefixRequest = "req:"
+)
+
+// AccountKey returns key of a login name, uids of LDAP are case-insensitive,
+// so other cases and spaces around count as the same account
+func AccountKey(uid string) string {
+	return PrefixAccount + normUID(uid)
+}
+
+// IPKey returns key of a client address
+func IPKey(ip string) string {
+	return PrefixIP + ip
+}
+
+// RequestKey returns key of requests mailing or texting an account, like password forgot,
+// login does not check it, so nobody can lock others out by requests
+func RequestKey(uid string) string {
+	return PrefixRequest + normUID(uid)
+}
+
+func normUID(uid string) string {
+	return strings.ToLower(strings.TrimSpace(uid))
+}
+
+// Attempt is failures of a key in the window
+type Attempt struct {
+	Key         string     `json:"key" db:"key"`
+	Failures    int        `json:"failures" db:"failures"`
+	First       time.Time  `json:"first" db:"first_failed"`
+	Last        time.Time  `json:"last" db:"last_failed"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty" db:"locked_until"`
+}
+
+// IsLocked ...
+func (a *Attempt) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
+
+// IsIP returns true if key is a client address
+func (a *Attempt) IsIP() bool {
+	return strings.HasPrefix(a.Key, PrefixIP)
+}
+
+// IsRequest returns true if key counts requests of mails or texts
+func (a *Attempt) IsRequest() bool {
+	return strings.HasPrefix(a.Key, PrefixRequest)
+}
+
+// Name returns the account or address without prefix
+func (a *Attempt) Name() string {
+	for _, p := range []string{PrefixAccount, PrefixIP, PrefixRequest} {
+		if strings.HasPrefix(a.Key, p) {
+			return a.Key[len(p):]
+		}
+	}
+	return a.Key
+}
+
+// Policy of throttling
+type Policy struct {
+	Window      time.Duration // failures older than it are forgotten
+	MaxFailures int           // lock an account after so many failures
+	IPFailures  int           // lock an address after so many failures
+	LockFor     time.Duration
+	FreeTries   int           // failures of an account without delay
+	IPFreeTries int           // failures of an address without delay, many staff may share one
+	BaseDelay   time.Duration // delay after the free tries, doubled by every failure
+	MaxDelay    time.Duration
+}
+
+// DefaultPolicy ...
+var DefaultPolicy = Policy{
+	Window:      15 * time.Minute,
+	MaxFailures: 10,
+	IPFailures:  50,
+	LockFor:     15 * time.Minute,
+	FreeTries:   3,
+	IPFreeTries: 20,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+}
+
+// Delay returns the wait after failures of an account
+func (p Policy) Delay(failures int) time.Duration {
+	return p.delay(failures, p.FreeTries)
+}
+
+func (p Policy) delay(failures, free int) time.Duration {
+	n := failures - free
+	if n < 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 0; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// Wait returns how long a must wait before the next try, zero if allowed
+func (p Policy) Wait(a *Attempt, now time.Time) time.Duration {
+	if a == nil {
+		return 0
+	}
+	if a.IsLocked(now) {
+		return a.LockedUntil.Sub(now)
+	}
+	if now.Sub(a.Last) > p.Window {
+		return 0
+	}
+	free := p.FreeTries
+	if a.IsIP() {
+		free = p.IPFreeTries
+	}
+	if next := a.Last.Add(p.delay(a.Failures, free)); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// Limit returns the failures to lock key
+func (p Policy) Limit(key string) int {
+	if strings.HasPrefix(key, PrefixIP) {
+		return p.IPFailures
+	}
+	return p.MaxFailures
+}
+
+// Store interface of attempts storage, shared by all replicas
+type Store interface {
+	// Get 取一个, nil without failures
+	Get(key string) (*Attempt, error)
+	// Fail 记一次失败, failures older than window are reset
+	Fail(key string, window time.Duration) (*Attempt, error)
+	// Lock 锁定到 until
+	Lock(key string, until time.Time) error
+	// Reset 清除, on success or unlock by keeper
+	Reset(key string) error
+	// Locked 列出锁定中的
+	Locked() ([]Attempt, error)
+}
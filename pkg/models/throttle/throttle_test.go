@@ -0,0 +1,55 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	p := DefaultPolicy
+	assert.Equal(t, time.Duration(0), p.Delay(0))
+	assert.Equal(t, time.Duration(0), p.Delay(2))
+	assert.Equal(t, time.Second, p.Delay(3))
+	assert.Equal(t, 2*time.Second, p.Delay(4))
+	assert.Equal(t, 8*time.Second, p.Delay(6))
+	assert.Equal(t, time.Minute, p.Delay(20))
+}
+
+func TestWait(t *testing.T) {
+	p := DefaultPolicy
+	now := time.Now()
+	assert.Equal(t, time.Duration(0), p.Wait(nil, now))
+
+	a := &Attempt{Key: AccountKey("eagle"), Failures: 4, First: now.Add(-time.Minute), Last: now}
+	assert.Equal(t, 2*time.Second, p.Wait(a, now))
+	assert.Equal(t, time.Second, p.Wait(a, now.Add(time.Second)))
+	assert.Equal(t, time.Duration(0), p.Wait(a, now.Add(3*time.Second)))
+
+	ip := &Attempt{Key: IPKey("10.0.0.1"), Failures: 4, Last: now}
+	assert.Equal(t, time.Duration(0), p.Wait(ip, now))
+	ip.Failures = p.IPFreeTries
+	assert.Equal(t, time.Second, p.Wait(ip, now))
+
+	until := now.Add(p.LockFor)
+	a.LockedUntil = &until
+	assert.True(t, a.IsLocked(now))
+	assert.Equal(t, p.LockFor, p.Wait(a, now))
+	assert.False(t, a.IsLocked(until))
+}
+
+func TestKeys(t *testing.T) {
+	p := DefaultPolicy
+	a := Attempt{Key: IPKey("10.0.0.1")}
+	assert.Equal(t, "10.0.0.1", a.Name())
+	assert.True(t, a.IsIP())
+	assert.Equal(t, p.IPFailures, p.Limit(a.Key))
+	assert.Equal(t, p.MaxFailures, p.Limit(AccountKey("eagle")))
+	assert.Equal(t, "eagle", (&Attempt{Key: AccountKey("eagle")}).Name())
+	assert.Equal(t, "eagle", (&Attempt{Key: RequestKey("eagle")}).Name())
+	assert.Equal(t, p.MaxFailures, p.Limit(RequestKey("eagle")))
+	assert.Equal(t, AccountKey("eagle"), AccountKey(" Eagle "))
+	assert.Equal(t, AccountKey("eagle"), AccountKey("EAGLE"))
+	assert.Equal(t, RequestKey("eagle"), RequestKey("\tEaGle"))
+}
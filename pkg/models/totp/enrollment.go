@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RecoveryCount is the number of recovery codes of an enrollment
+const RecoveryCount = 10
+
+// Enrollment is a confirmed totp secret of a staff
+type Enrollment struct {
+	UID         string         `json:"uid" db:"uid"`
+	Secret      string         `json:"-" db:"secret"`
+	Recovery    pq.StringArray `json:"-" db:"recovery"` // hashes of unused recovery codes
+	LastCounter int64          `json:"-" db:"last_counter"`
+	Created     time.Time      `json:"created" db:"created"`
+	Updated     *time.Time     `json:"updated,omitempty" db:"updated"`
+}
+
+// Verify checks a totp code or a recovery code, a used code is consumed,
+// the enrollment must be saved when ok
+func (e *Enrollment) Verify(code string, now time.Time) (ok, recovery bool) {
+	if counter, ok := Match(e.Secret, code, now); ok {
+		if counter <= e.LastCounter { // replayed
+			return false, false
+		}
+		e.LastCounter = counter
+		return true, false
+	}
+	hashed := HashRecoveryCode(code)
+	for i, h := range e.Recovery {
+		if h == hashed {
+			e.Recovery = append(e.Recovery[:i:i], e.Recovery[i+1:]...)
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// Policy requires members of groups to use totp
+type Policy struct {
+	Groups []string `json:"groups"`
+}
+
+// Store interface of enrollment storage
+type Store interface {
+	// Get 取一个
+	Get(uid string) (*Enrollment, error)
+	// Save 保存
+	Save(e *Enrollment) error
+	// Delete 删除
+	Delete(uid string) error
+
+	// LoadPolicy 取策略
+	LoadPolicy() (*Policy, error)
+	// SavePolicy 保存策略
+	SavePolicy(p *Policy) error
+}
@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// secret "12345678901234567890" of RFC 6238 appendix B
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	for ts, code := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		c, err := Code(rfcSecret, Counter(time.Unix(ts, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, code, c, ts)
+	}
+
+	_, err := Code("not base32!", 1)
+	assert.Equal(t, ErrInvalidSecret, err)
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	counter, ok := Match(rfcSecret, "005924", now)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), counter)
+
+	_, ok = Match(rfcSecret, "005924", now.Add(Period*time.Second))
+	assert.True(t, ok, "skew")
+	_, ok = Match(rfcSecret, "005924", now.Add(3*Period*time.Second))
+	assert.False(t, ok)
+	_, ok = Match(rfcSecret, "5924", now)
+	assert.False(t, ok)
+}
+
+func TestSecretAndURI(t *testing.T) {
+	secret, err := NewSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+	_, err = Code(secret, 1)
+	assert.NoError(t, err)
+
+	uri := ProvisioningURI("Staffio", "eagle", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Staffio:eagle?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=Staffio")
+}
+
+func TestEnrollmentVerify(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes(3)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 3)
+	e := &Enrollment{UID: "eagle", Secret: rfcSecret, Recovery: hashes}
+	now := time.Unix(1234567890, 0)
+
+	ok, recovery := e.Verify("005924", now)
+	assert.True(t, ok)
+	assert.False(t, recovery)
+	ok, _ = e.Verify("005924", now)
+	assert.False(t, ok, "replay")
+
+	ok, recovery = e.Verify(strings.ToUpper(codes[1]), now)
+	assert.True(t, ok)
+	assert.True(t, recovery)
+	assert.Len(t, e.Recovery, 2)
+	ok, _ = e.Verify(codes[1], now)
+	assert.False(t, ok, "used recovery code")
+}
@@ -1,8 +1,9 @@
 package models
 
 import (
-	"encoding/binary"
-	"hash/crc32"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 
 	"github.com/liut/staffio/pkg/common"
@@ -11,10 +12,33 @@ import (
 
 var (
 	VerifyLifeSeconds = 86400
+	// VerifyMaxAttempts of wrong codes, a new code is required after them
+	VerifyMaxAttempts = 5
 )
 
-func HashCode(code string) int64 {
-	return int64(crc32.ChecksumIEEE([]byte(code)))
+// purposes of Verify, one is pending for each uid
+const (
+	VerifyPassword = "password" // reset password with an email link or sms code
+	VerifyMobile   = "mobile"   // save a new mobile
+	VerifyEmail    = "email"    // save a new email
+	VerifyLogin    = "login"    // sign in with an email link
+)
+
+// codeLength of links by email, a link carries no code, it only makes the signature of the link unique
+const codeLength = 32
+
+var verifyKey []byte
+
+// SetVerifyKey sets the key of HashCode, codes saved with another key do not match any more
+func SetVerifyKey(key []byte) {
+	verifyKey = key
+}
+
+// HashCode returns HMAC-SHA256 of code in hex, only the hash is stored
+func HashCode(code string) string {
+	mac := hmac.New(sha256.New, verifyKey)
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 // 用户验证，如邮箱、手机等
@@ -23,8 +47,11 @@ type Verify struct {
 	Uid         string           `db:"uid" json:"uid"`
 	Target      string           `db:"target" json:"target"`
 	Type        common.AliasType `db:"type_id" json:"type"`
-	CodeHash    int64            `db:"code_hash" json:"-"`
+	Purpose     string           `db:"purpose" json:"purpose"`
+	CodeHash    string           `db:"code_hash" json:"-"`
 	LifeSeconds int              `db:"life_seconds" json:"life_seconds"`
+	Attempts    int              `db:"attempts" json:"attempts"`
+	Consumed    *time.Time       `db:"consumed" json:"consumed,omitempty"`
 	Created     time.Time        `db:"created" json:"created"`
 	Updated     time.Time        `db:"updated" json:"updated"`
 
@@ -35,25 +62,61 @@ func (uv *Verify) IsExpired() bool {
 	return time.Now().Unix() > uv.Updated.Unix()+int64(uv.LifeSeconds)
 }
 
+// Exhausted returns true if tries are more than VerifyMaxAttempts
+func (uv *Verify) Exhausted() bool {
+	return uv.Attempts > VerifyMaxAttempts
+}
+
+// Match compares the hash of code in constant time
 func (uv *Verify) Match(code string) bool {
-	return HashCode(code) == uv.CodeHash
+	return hmac.Equal([]byte(HashCode(code)), []byte(uv.CodeHash))
 }
 
+// CodeHashBytes is the secret of uid in a signed link, the link is void once the verify is replaced
 func (uv *Verify) CodeHashBytes() []byte {
-	b := make([]byte, 8)
-	binary.LittleEndian.PutUint64(b, uint64(uv.CodeHash))
+	b, _ := hex.DecodeString(uv.CodeHash)
 	return b
 }
 
-func NewVerify(at common.AliasType, target, uid string) *Verify {
+// NewVerify returns a verify with a random code, 6 digits for sms, a long one for others
+func NewVerify(purpose string, at common.AliasType, target, uid string) *Verify {
 	code := random.GenCode()
+	if at != common.AtPhone {
+		code = random.GenString(codeLength)
+	}
 	codeHash := HashCode(code)
 	return &Verify{
 		Uid:         uid,
 		Type:        at,
+		Purpose:     purpose,
 		Target:      target,
 		LifeSeconds: VerifyLifeSeconds,
 		CodeHash:    codeHash,
 		Created:     time.Now(),
+		Code:        code,
 	}
 }
+
+// VerifyStore keeps pending verifications, one for each uid and purpose
+type VerifyStore interface {
+	// Save 新建, 替换 uid 和 purpose 的旧的
+	Save(uv *Verify) error
+	// Get 取 uid 和 purpose 的, 用过的不算
+	Get(uid, purpose string) (*Verify, error)
+	// Attempt 记一次尝试, 返回包括这次的次数
+	Attempt(uv *Verify) (int, error)
+	// Use 用掉, 只能一次, 用过的再用是 not found
+	Use(uv *Verify) error
+	// Delete 删除 uid 和 purpose 的
+	Delete(uid, purpose string) error
+
+	// LoadLinkPolicy 取邮件链接登录策略
+	LoadLinkPolicy() (*LinkPolicy, error)
+	// SaveLinkPolicy 保存邮件链接登录策略
+	SaveLinkPolicy(p *LinkPolicy) error
+}
+
+// LinkPolicy allows members of groups to sign in with a link mailed to them
+type LinkPolicy struct {
+	Groups []string `json:"groups"`
+}
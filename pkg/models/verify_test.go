@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/liut/staffio/pkg/common"
+)
+
+func TestVerify(t *testing.T) {
+	SetVerifyKey([]byte("one"))
+	defer SetVerifyKey(nil)
+	uv := NewVerify(VerifyMobile, common.AtPhone, "13800138000", "eagle")
+	if len(uv.Code) != 6 || len(uv.CodeHash) != 64 || len(uv.CodeHashBytes()) != 32 {
+		t.Fatalf("bad verify %q %q", uv.Code, uv.CodeHash)
+	}
+	if !uv.Match(uv.Code) || uv.Match("") || uv.Match(uv.CodeHash) {
+		t.Errorf("match %q fail", uv.Code)
+	}
+	SetVerifyKey([]byte("two"))
+	if uv.Match(uv.Code) {
+		t.Errorf("matched with another key")
+	}
+
+	ev := NewVerify(VerifyEmail, common.AtEmail, "eagle@example.net", "eagle")
+	if len(ev.Code) != codeLength || ev.CodeHash == uv.CodeHash {
+		t.Errorf("bad email verify %q", ev.Code)
+	}
+
+	uv.Attempts = VerifyMaxAttempts
+	if uv.Exhausted() {
+		t.Errorf("the last try is allowed")
+	}
+	uv.Attempts++
+	if !uv.Exhausted() {
+		t.Errorf("not exhausted after %d tries", uv.Attempts)
+	}
+}
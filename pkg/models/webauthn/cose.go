@@ -0,0 +1,90 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/crypto/ed25519"
+)
+
+// COSE algorithms
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+// COSE key types and curves
+const (
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// ErrUnsupportedKey returned for unknown algorithms or curves
+var ErrUnsupportedKey = errors.New("webauthn: unsupported public key")
+
+type coseKey struct {
+	Kty int    `cbor:"1,keyasint"`
+	Alg int    `cbor:"3,keyasint"`
+	Crv int    `cbor:"-1,keyasint,omitempty"`
+	X   []byte `cbor:"-2,keyasint,omitempty"` // x of EC2 and OKP, n of RSA
+	Y   []byte `cbor:"-3,keyasint,omitempty"` // y of EC2, e of RSA
+}
+
+type publicKey struct {
+	alg int
+	ec  *ecdsa.PublicKey
+	rsa *rsa.PublicKey
+	ed  ed25519.PublicKey
+}
+
+func parseKey(b []byte) (*publicKey, error) {
+	var k coseKey
+	if err := cbor.Unmarshal(b, &k); err != nil {
+		return nil, ErrUnsupportedKey
+	}
+	pk := &publicKey{alg: k.Alg}
+	switch {
+	case k.Kty == ktyEC2 && k.Alg == algES256 && k.Crv == crvP256:
+		pk.ec = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(k.X), Y: new(big.Int).SetBytes(k.Y)}
+		if !pk.ec.Curve.IsOnCurve(pk.ec.X, pk.ec.Y) {
+			return nil, ErrUnsupportedKey
+		}
+	case k.Kty == ktyOKP && k.Alg == algEdDSA && k.Crv == crvEd25519 && len(k.X) == ed25519.PublicKeySize:
+		pk.ed = ed25519.PublicKey(k.X)
+	case k.Kty == ktyRSA && k.Alg == algRS256 && len(k.X) > 0 && len(k.Y) > 0:
+		pk.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(k.X), E: int(new(big.Int).SetBytes(k.Y).Int64())}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return pk, nil
+}
+
+func (pk *publicKey) verify(data, sig []byte) bool {
+	switch {
+	case pk.ec != nil:
+		var es struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &es); err != nil || len(rest) > 0 {
+			return false
+		}
+		hash := sha256.Sum256(data)
+		return ecdsa.Verify(pk.ec, hash[:], es.R, es.S)
+	case pk.ed != nil:
+		return ed25519.Verify(pk.ed, data, sig)
+	case pk.rsa != nil:
+		hash := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(pk.rsa, crypto.SHA256, hash[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,362 @@
+// Package webauthn implements the relying party of Web Authentication (security keys and passkeys),
+// attestation statements are not verified, "none" attestation is requested
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// errors
+var (
+	ErrInvalidClientData = errors.New("webauthn: invalid client data")
+	ErrChallenge         = errors.New("webauthn: challenge mismatch")
+	ErrOrigin            = errors.New("webauthn: origin mismatch")
+	ErrInvalidAuthData   = errors.New("webauthn: invalid authenticator data")
+	ErrRPID              = errors.New("webauthn: relying party id mismatch")
+	ErrUserPresence      = errors.New("webauthn: user not present")
+	ErrUserVerification  = errors.New("webauthn: user not verified")
+	ErrSignature         = errors.New("webauthn: invalid signature")
+	ErrSignCount         = errors.New("webauthn: sign count did not increase, the authenticator may be cloned")
+)
+
+// flags of authenticator data
+const (
+	flagUP = 0x01 // user present
+	flagUV = 0x04 // user verified
+	flagAT = 0x40 // attested credential data included
+
+	timeout = 60000 // milliseconds
+)
+
+// Encoding of ids, challenges and binary fields in JSON
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty is this site
+type RelyingParty struct {
+	ID     string `json:"id"` // domain
+	Name   string `json:"name"`
+	Origin string `json:"-"` // scheme://host[:port]
+}
+
+// NewRelyingParty returns a relying party of base URL
+func NewRelyingParty(name, baseURL string) (*RelyingParty, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RelyingParty{ID: u.Hostname(), Name: name, Origin: u.Scheme + "://" + u.Host}, nil
+}
+
+// Credential is a public key credential of staff
+type Credential struct {
+	ID        string     `json:"id" db:"id"` // credential id, base64url
+	UID       string     `json:"uid" db:"uid"`
+	Name      string     `json:"name" db:"name"`
+	PublicKey []byte     `json:"-" db:"public_key"` // COSE key
+	SignCount int64      `json:"-" db:"sign_count"`
+	AAGUID    string     `json:"aaguid,omitempty" db:"aaguid"`
+	Created   time.Time  `json:"created" db:"created"`
+	LastUsed  *time.Time `json:"lastUsed,omitempty" db:"last_used"`
+}
+
+// Store interface of credentials storage
+type Store interface {
+	// All 用户的全部
+	All(uid string) ([]Credential, error)
+	// Get 取一个
+	Get(id string) (*Credential, error)
+	// Save 保存新的
+	Save(c *Credential) error
+	// Touch 更新计数和使用时间
+	Touch(id string, signCount int64) error
+	// Delete 删除
+	Delete(uid, id string) error
+}
+
+// NewChallenge returns a random challenge, base64url
+func NewChallenge() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return Encoding.EncodeToString(buf), nil
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type credParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type userEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CreationOptions is publicKey of navigator.credentials.create(), binary fields in base64url
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credParam            `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection map[string]interface{} `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is publicKey of navigator.credentials.get(), binary fields in base64url
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+func descriptors(creds []Credential) []credentialDescriptor {
+	data := make([]credentialDescriptor, len(creds))
+	for i, c := range creds {
+		data[i] = credentialDescriptor{Type: "public-key", ID: c.ID}
+	}
+	return data
+}
+
+// NewCreationOptions returns options to register a credential of uid, exist credentials are excluded
+func (rp *RelyingParty) NewCreationOptions(challenge, uid, displayName string, exist []Credential) *CreationOptions {
+	return &CreationOptions{
+		Challenge: challenge,
+		RP:        *rp,
+		User:      userEntity{ID: Encoding.EncodeToString([]byte(uid)), Name: uid, DisplayName: displayName},
+		PubKeyCredParams: []credParam{
+			{Type: "public-key", Alg: algES256},
+			{Type: "public-key", Alg: algEdDSA},
+			{Type: "public-key", Alg: algRS256},
+		},
+		Timeout:            timeout,
+		ExcludeCredentials: descriptors(exist),
+		AuthenticatorSelection: map[string]interface{}{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// NewRequestOptions returns options to get an assertion, empty allow for discoverable credentials
+func (rp *RelyingParty) NewRequestOptions(challenge string, allow []Credential, userVerification string) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          timeout,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	}
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, typ, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil || cd.Type != typ {
+		return ErrInvalidClientData
+	}
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return ErrChallenge
+	}
+	if cd.Origin != rp.Origin {
+		return ErrOrigin
+	}
+	return nil
+}
+
+type authData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	aaguid    []byte
+	credID    []byte
+	publicKey []byte
+}
+
+func parseAuthData(b []byte) (*authData, error) {
+	if len(b) < 37 {
+		return nil, ErrInvalidAuthData
+	}
+	ad := &authData{rpIDHash: b[:32], flags: b[32], signCount: binary.BigEndian.Uint32(b[33:37])}
+	if ad.flags&flagAT == 0 {
+		return ad, nil
+	}
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidAuthData
+	}
+	ad.aaguid = rest[:16]
+	n := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < n {
+		return nil, ErrInvalidAuthData
+	}
+	ad.credID, rest = rest[:n], rest[n:]
+	// the COSE key is followed by extensions maybe
+	var key cbor.RawMessage
+	if err := cbor.NewDecoder(bytes.NewReader(rest)).Decode(&key); err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	ad.publicKey = []byte(key)
+	return ad, nil
+}
+
+func (rp *RelyingParty) verifyAuthData(ad *authData, requireUV bool) error {
+	hash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, hash[:]) {
+		return ErrRPID
+	}
+	if ad.flags&flagUP == 0 {
+		return ErrUserPresence
+	}
+	if requireUV && ad.flags&flagUV == 0 {
+		return ErrUserVerification
+	}
+	return nil
+}
+
+// Attestation is the response of navigator.credentials.create(), binary fields in base64url
+type Attestation struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+}
+
+// VerifyAttestation checks a new credential and returns it without UID and Name
+func (rp *RelyingParty) VerifyAttestation(challenge string, att *Attestation) (*Credential, error) {
+	cdj, err := Encoding.DecodeString(att.ClientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidClientData
+	}
+	if err = rp.verifyClientData(cdj, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	raw, err := Encoding.DecodeString(att.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	var obj struct {
+		Fmt      string `cbor:"fmt"`
+		AuthData []byte `cbor:"authData"`
+	}
+	if err = cbor.Unmarshal(raw, &obj); err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	ad, err := parseAuthData(obj.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err = rp.verifyAuthData(ad, false); err != nil {
+		return nil, err
+	}
+	if ad.flags&flagAT == 0 {
+		return nil, ErrInvalidAuthData
+	}
+	if _, err = parseKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        Encoding.EncodeToString(ad.credID),
+		PublicKey: ad.publicKey,
+		SignCount: int64(ad.signCount),
+		AAGUID:    formatAAGUID(ad.aaguid),
+	}, nil
+}
+
+// Assertion is the response of navigator.credentials.get(), binary fields in base64url
+type Assertion struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// UID returns uid in user handle, empty if absent
+func (a *Assertion) UID() string {
+	b, err := Encoding.DecodeString(a.UserHandle)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// VerifyAssertion checks an assertion with the stored credential, returns the new sign count to keep
+func (rp *RelyingParty) VerifyAssertion(challenge string, cred *Credential, a *Assertion, requireUV bool) (int64, error) {
+	cdj, err := Encoding.DecodeString(a.ClientDataJSON)
+	if err != nil {
+		return 0, ErrInvalidClientData
+	}
+	if err = rp.verifyClientData(cdj, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	rawAD, err := Encoding.DecodeString(a.AuthenticatorData)
+	if err != nil {
+		return 0, ErrInvalidAuthData
+	}
+	ad, err := parseAuthData(rawAD)
+	if err != nil {
+		return 0, err
+	}
+	if err = rp.verifyAuthData(ad, requireUV); err != nil {
+		return 0, err
+	}
+	sig, err := Encoding.DecodeString(a.Signature)
+	if err != nil {
+		return 0, ErrSignature
+	}
+	key, err := parseKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	hash := sha256.Sum256(cdj)
+	if !key.verify(append(rawAD, hash[:]...), sig) {
+		return 0, ErrSignature
+	}
+	count := int64(ad.signCount)
+	if (count != 0 || cred.SignCount != 0) && count <= cred.SignCount {
+		return 0, ErrSignCount
+	}
+	return count, nil
+}
+
+func formatAAGUID(b []byte) string {
+	if len(b) != 16 || bytes.Equal(b, make([]byte, 16)) {
+		return ""
+	}
+	const hex = "0123456789abcdef"
+	out := make([]byte, 0, 36)
+	for i, c := range b {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			out = append(out, '-')
+		}
+		out = append(out, hex[c>>4], hex[c&0x0f])
+	}
+	return string(out)
+}
@@ -0,0 +1,183 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+)
+
+// authenticator simulates a security key
+type authenticator struct {
+	rpID   string
+	origin string
+	id     []byte
+	ec     *ecdsa.PrivateKey
+	ed     ed25519.PrivateKey
+	count  uint32
+	flags  byte
+}
+
+func newAuthenticator(t *testing.T, rp *RelyingParty, ed bool) *authenticator {
+	a := &authenticator{rpID: rp.ID, origin: rp.Origin, id: make([]byte, 16), flags: flagUP | flagUV}
+	rand.Read(a.id)
+	var err error
+	if ed {
+		_, a.ed, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		a.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	assert.NoError(t, err)
+	return a
+}
+
+func pad32(i *big.Int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func (a *authenticator) authData(attested bool) []byte {
+	hash := sha256.Sum256([]byte(a.rpID))
+	b := append(hash[:], a.flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:], a.count)
+	if !attested {
+		return b
+	}
+	b[32] |= flagAT
+	b = append(b, make([]byte, 16)...) // aaguid
+	b = append(b, byte(len(a.id)>>8), byte(len(a.id)))
+	b = append(b, a.id...)
+	var k coseKey
+	if a.ed != nil {
+		k = coseKey{Kty: ktyOKP, Alg: algEdDSA, Crv: crvEd25519, X: a.ed.Public().(ed25519.PublicKey)}
+	} else {
+		k = coseKey{Kty: ktyEC2, Alg: algES256, Crv: crvP256, X: pad32(a.ec.X), Y: pad32(a.ec.Y)}
+	}
+	key, _ := cbor.Marshal(k)
+	return append(b, key...)
+}
+
+func (a *authenticator) clientData(typ, challenge string) []byte {
+	b, _ := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: a.origin})
+	return b
+}
+
+func (a *authenticator) attest(challenge string) *Attestation {
+	obj, _ := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(true),
+	})
+	return &Attestation{
+		ID:                Encoding.EncodeToString(a.id),
+		ClientDataJSON:    Encoding.EncodeToString(a.clientData("webauthn.create", challenge)),
+		AttestationObject: Encoding.EncodeToString(obj),
+	}
+}
+
+func (a *authenticator) assert(challenge string) *Assertion {
+	a.count++
+	ad := a.authData(false)
+	cdj := a.clientData("webauthn.get", challenge)
+	hash := sha256.Sum256(cdj)
+	data := append(append([]byte{}, ad...), hash[:]...)
+	var sig []byte
+	if a.ed != nil {
+		sig = ed25519.Sign(a.ed, data)
+	} else {
+		digest := sha256.Sum256(data)
+		r, s, _ := ecdsa.Sign(rand.Reader, a.ec, digest[:])
+		sig, _ = asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	}
+	return &Assertion{
+		ID:                Encoding.EncodeToString(a.id),
+		ClientDataJSON:    Encoding.EncodeToString(cdj),
+		AuthenticatorData: Encoding.EncodeToString(ad),
+		Signature:         Encoding.EncodeToString(sig),
+		UserHandle:        Encoding.EncodeToString([]byte("eagle")),
+	}
+}
+
+func TestRelyingParty(t *testing.T) {
+	rp, err := NewRelyingParty("Staffio", "https://sso.example.com:8443/base/")
+	assert.NoError(t, err)
+	assert.Equal(t, "sso.example.com", rp.ID)
+	assert.Equal(t, "https://sso.example.com:8443", rp.Origin)
+
+	opts := rp.NewCreationOptions("abc", "eagle", "Eagle", []Credential{{ID: "k1"}})
+	assert.Equal(t, Encoding.EncodeToString([]byte("eagle")), opts.User.ID)
+	assert.Len(t, opts.ExcludeCredentials, 1)
+	assert.Equal(t, "none", opts.Attestation)
+
+	ropts := rp.NewRequestOptions("abc", nil, "required")
+	assert.Equal(t, "sso.example.com", ropts.RPID)
+	assert.NotNil(t, ropts.AllowCredentials)
+}
+
+func TestCeremony(t *testing.T) {
+	rp, _ := NewRelyingParty("Staffio", "https://sso.example.com")
+	for _, ed := range []bool{false, true} {
+		a := newAuthenticator(t, rp, ed)
+		challenge, err := NewChallenge()
+		assert.NoError(t, err)
+
+		_, err = rp.VerifyAttestation("other", a.attest(challenge))
+		assert.Equal(t, ErrChallenge, err)
+		cred, err := rp.VerifyAttestation(challenge, a.attest(challenge))
+		assert.NoError(t, err)
+		assert.Equal(t, Encoding.EncodeToString(a.id), cred.ID)
+		assert.Empty(t, cred.AAGUID)
+
+		as := a.assert(challenge)
+		assert.Equal(t, "eagle", as.UID())
+		count, err := rp.VerifyAssertion(challenge, cred, as, true)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		cred.SignCount = count
+
+		_, err = rp.VerifyAssertion(challenge, cred, as, true)
+		assert.Equal(t, ErrSignCount, err, "replayed")
+
+		as = a.assert(challenge)
+		as.Signature = Encoding.EncodeToString([]byte("bad"))
+		_, err = rp.VerifyAssertion(challenge, cred, as, true)
+		assert.Equal(t, ErrSignature, err)
+	}
+}
+
+func TestAssertionChecks(t *testing.T) {
+	rp, _ := NewRelyingParty("Staffio", "https://sso.example.com")
+	a := newAuthenticator(t, rp, false)
+	cred, err := rp.VerifyAttestation("c1", a.attest("c1"))
+	assert.NoError(t, err)
+
+	a.flags = flagUP
+	_, err = rp.VerifyAssertion("c1", cred, a.assert("c1"), true)
+	assert.Equal(t, ErrUserVerification, err)
+	_, err = rp.VerifyAssertion("c1", cred, a.assert("c1"), false)
+	assert.NoError(t, err)
+
+	a.flags = 0
+	_, err = rp.VerifyAssertion("c1", cred, a.assert("c1"), false)
+	assert.Equal(t, ErrUserPresence, err)
+
+	a.flags, a.origin = flagUP, "https://evil.example.com"
+	_, err = rp.VerifyAssertion("c1", cred, a.assert("c1"), false)
+	assert.Equal(t, ErrOrigin, err)
+
+	a.origin, a.rpID = rp.Origin, "evil.example.com"
+	_, err = rp.VerifyAssertion("c1", cred, a.assert("c1"), false)
+	assert.Equal(t, ErrRPID, err)
+
+	_, err = rp.VerifyAttestation("c1", &Attestation{ClientDataJSON: a.attest("c1").ClientDataJSON, AttestationObject: "AA"})
+	assert.Equal(t, ErrInvalidAuthData, err)
+}
@@ -0,0 +1,160 @@
+// Package webhook posts changes of the directory to endpoints registered by keepers,
+// a delivery is signed with the secret of its endpoint and retried as a queue.Job
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/liut/staffio/pkg/models/queue"
+	"github.com/liut/staffio/pkg/models/types"
+)
+
+// events
+const (
+	EventStaffCreated  = "staff.created"
+	EventStaffUpdated  = "staff.updated"
+	EventStaffDeleted  = "staff.deleted"
+	EventTeamSaved     = "team.saved"
+	EventTeamDeleted   = "team.deleted"
+	EventMemberAdded   = "team.member.added"
+	EventMemberRemoved = "team.member.removed"
+	EventGroupSaved    = "group.saved"
+	EventGroupDeleted  = "group.deleted"
+)
+
+// Events is all events for filters
+var Events = []string{
+	EventStaffCreated, EventStaffUpdated, EventStaffDeleted,
+	EventTeamSaved, EventTeamDeleted, EventMemberAdded, EventMemberRemoved,
+	EventGroupSaved, EventGroupDeleted,
+}
+
+// headers of deliveries
+const (
+	HeaderEvent     = "X-Staffio-Event"
+	HeaderDelivery  = "X-Staffio-Delivery"
+	HeaderTimestamp = "X-Staffio-Timestamp"
+	HeaderSignature = "X-Staffio-Signature"
+)
+
+// status of deliveries
+const (
+	StatusPending = queue.StatusPending
+	StatusDone    = queue.StatusDone
+	StatusDead    = queue.StatusDead // kept for keepers to redeliver
+)
+
+// Sign returns the signature of body at ts with secret, it is
+// "sha256=" and the hex of HMAC-SHA256 of the unix seconds, a dot and the body
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of body at ts, for receivers and tests
+func Verify(secret string, ts int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// Endpoint is a url to post events, all events if Events is empty
+type Endpoint struct {
+	ID          int               `json:"id" db:"id"`
+	URL         string            `json:"url" db:"url" form:"url"`
+	Secret      string            `json:"-" db:"secret"`
+	Events      types.StringSlice `json:"events" db:"events" form:"events"`
+	Description string            `json:"description,omitempty" db:"description" form:"description"`
+	Active      bool              `json:"active" db:"active" form:"active"`
+	Created     time.Time         `json:"created" db:"created"`
+	Updated     time.Time         `json:"updated" db:"updated"`
+}
+
+// Wants returns true if the endpoint is active and event is in its filters
+func (e *Endpoint) Wants(event string) bool {
+	return e.Active && (len(e.Events) == 0 || e.Events.Contains(event))
+}
+
+// Payload is the body posted
+type Payload struct {
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// Delivery of an event to an endpoint
+type Delivery struct {
+	ID         int    `json:"id" db:"id"`
+	EndpointID int    `json:"endpointID" db:"endpoint_id"`
+	Event      string `json:"event" db:"event"`
+	Payload    string `json:"payload" db:"payload"` // json of Payload
+	queue.Job
+	Code      int        `json:"code,omitempty" db:"code"` // http status of the last attempt
+	Delivered *time.Time `json:"delivered,omitempty" db:"delivered"`
+	Created   time.Time  `json:"created" db:"created"`
+	Updated   time.Time  `json:"updated" db:"updated"`
+}
+
+// Failed counts a failed attempt with the http status, code is 0 if the request is not sent
+func (d *Delivery) Failed(code int, err error, now time.Time) {
+	d.Job.Failed(err, now)
+	d.Code = code
+}
+
+// Done marks the delivery accepted by the endpoint
+func (d *Delivery) Done(code int, now time.Time) {
+	d.Finish(StatusDone)
+	d.Code = code
+	d.Delivered = &now
+}
+
+// Redeliver makes the delivery pending again
+func (d *Delivery) Redeliver(now time.Time) {
+	d.Reset(now)
+	d.Code = 0
+	d.Delivered = nil
+}
+
+// Spec filters of deliveries, newer first
+type Spec struct {
+	EndpointID int    `json:"endpointID,omitempty" form:"endpoint"`
+	Event      string `json:"event,omitempty" form:"event"`
+	Status     string `json:"status,omitempty" form:"status"`
+	queue.Pager
+}
+
+// Match returns true if d matches the filters
+func (s *Spec) Match(d *Delivery) bool {
+	return (s.EndpointID == 0 || d.EndpointID == s.EndpointID) &&
+		(s.Event == "" || d.Event == s.Event) && (s.Status == "" || d.Status == s.Status)
+}
+
+// Store interface of endpoints and deliveries
+type Store interface {
+	// Endpoints 取全部 endpoint
+	Endpoints() ([]Endpoint, error)
+	// GetEndpoint 取一个
+	GetEndpoint(id int) (*Endpoint, error)
+	// SaveEndpoint 新建或更新, ID 为 0 时新建
+	SaveEndpoint(e *Endpoint) error
+	// DeleteEndpoint 删除, 连同它的投递记录
+	DeleteEndpoint(id int) error
+
+	// Enqueue 加入待投递
+	Enqueue(d *Delivery) error
+	// Claim 取到期待投递的, 最多 limit 个, 把它们推迟 lease 以免同时被别的 worker 取到
+	Claim(now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	// Update 保存投递的结果
+	Update(d *Delivery) error
+	// Get 取一个投递
+	Get(id int) (*Delivery, error)
+	// Query 按条件查询, 新的在前
+	Query(spec *Spec) ([]Delivery, error)
+	// Redeliver 重新待投递, 次数清零
+	Redeliver(id int) error
+}
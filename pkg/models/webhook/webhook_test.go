@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"staff.created"}`)
+	sig := Sign("secret", 1792390610, body)
+	assert.Equal(t, "sha256=", sig[:7])
+	assert.Len(t, sig, 7+64)
+	assert.True(t, Verify("secret", 1792390610, body, sig))
+	assert.False(t, Verify("other", 1792390610, body, sig))
+	assert.False(t, Verify("secret", 1792390611, body, sig))
+	assert.False(t, Verify("secret", 1792390610, []byte(`{}`), sig))
+}
+
+func TestWants(t *testing.T) {
+	e := &Endpoint{Active: true}
+	assert.True(t, e.Wants(EventStaffCreated), "all if no filter")
+	e.Events = []string{EventStaffDeleted}
+	assert.False(t, e.Wants(EventStaffCreated))
+	assert.True(t, e.Wants(EventStaffDeleted))
+	e.Active = false
+	assert.False(t, e.Wants(EventStaffDeleted))
+}
+
+func TestDelivery(t *testing.T) {
+	now := time.Now()
+	d := &Delivery{}
+	d.Status = StatusPending
+	d.Failed(500, errors.New("bad"), now)
+	assert.Equal(t, StatusPending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, 500, d.Code)
+	assert.Equal(t, "bad", d.LastError)
+
+	d.Done(204, now)
+	assert.Equal(t, StatusDone, d.Status)
+	assert.Equal(t, 204, d.Code)
+	assert.Empty(t, d.LastError)
+	assert.Equal(t, &now, d.Delivered)
+
+	spec := &Spec{Event: EventStaffCreated, Status: StatusDone}
+	assert.False(t, spec.Match(d))
+	d.Event = EventStaffCreated
+	assert.True(t, spec.Match(d))
+	assert.Equal(t, 0, spec.Offset())
+	assert.Equal(t, 50, spec.Limit)
+
+	d.Redeliver(now)
+	assert.Equal(t, StatusPending, d.Status)
+	assert.Zero(t, d.Attempts)
+	assert.Zero(t, d.Code)
+	assert.Nil(t, d.Delivered)
+}
@@ -1,6 +1,8 @@
 package settings
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -12,6 +14,28 @@ type Config struct {
 	BackendDSN string `envconfig:"BACKEND_DSN"`
 	SentryDSN  string `envconfig:"SENTRY_DSN"`
 
+	// Backend of people and groups: ldap, sql or memory
+	Backend      string `envconfig:"BACKEND" default:"ldap"`
+	PasswordHash string `envconfig:"PASSWORD_HASH" default:"argon2id"`
+	// Policy of new passwords, zero max age for never expired
+	PasswordMinLength  int           `envconfig:"PASSWORD_MIN_LENGTH" default:"8"`
+	PasswordMinClasses int           `envconfig:"PASSWORD_MIN_CLASSES" default:"2"`
+	PasswordHistory    int           `envconfig:"PASSWORD_HISTORY" default:"5"`
+	PasswordMaxAge     time.Duration `envconfig:"PASSWORD_MAX_AGE" default:"0"`
+	PasswordPwnedFile  string        `envconfig:"PASSWORD_PWNED_FILE"` // filter built by pwned import
+	// Fixtures is a json file to seed the memory backend, empty for demo data
+	Fixtures string `envconfig:"FIXTURES"`
+	// Cache of people and groups lookups, zero TTL to disable
+	CacheTTL  time.Duration `envconfig:"CACHE_TTL" default:"30s"`
+	CacheSize int           `envconfig:"CACHE_SIZE" default:"1000"`
+	// Throttle of failed logins, per account and per client address
+	LoginMaxFailures int           `envconfig:"LOGIN_MAX_FAILURES" default:"10"`
+	LoginIPFailures  int           `envconfig:"LOGIN_IP_FAILURES" default:"50"`
+	LoginLockFor     time.Duration `envconfig:"LOGIN_LOCK_FOR" default:"15m"`
+	// CSRFTrusted origins of legacy clients posting with cookies but no csrf token,
+	// like https://weekly.example.com
+	CSRFTrusted []string `envconfig:"CSRF_TRUSTED"`
+
 	Root  string `default:"./"`
 	Debug bool
 
@@ -27,6 +51,21 @@ type Config struct {
 	MailSenderEmail    string `envconfig:"SMTP_SENDER_EMAIL"`
 	MailSenderPassword string `envconfig:"SMTP_SENDER_PASSWORD"`
 	MailTLSEnabled     bool   `envconfig:"SMTP_TLS" default:"true"`
+	// MailLang of mails to staff who have no preference: en or zh-CN
+	MailLang string `envconfig:"MAIL_LANG" default:"en"`
+
+	// SMSSender of verification codes: log, file:///path/to/sms.log or a registered gateway
+	SMSSender string `envconfig:"SMS_SENDER" default:"log"`
+
+	// NotifyWebhook is a url where notes to staff are posted as json
+	NotifyWebhook string `envconfig:"NOTIFY_WEBHOOK"`
+	// NotifyFile is a file where notes to staff are appended, for local runs
+	NotifyFile string `envconfig:"NOTIFY_FILE"`
+
+	// LDAPCAFile is a PEM file of CA to verify ldaps hosts, the system pool is used if empty
+	LDAPCAFile string `envconfig:"LDAP_CA_FILE"`
+	// LDAPInsecure skips verifying the certificate of ldaps hosts, for tests only
+	LDAPInsecure bool `envconfig:"LDAP_INSECURE"`
 
 	// LDAPHosts    string `envconfig:"LDAP_HOSTS" default:"localhost"`
 	// LDAPBase     string `envconfig:"LDAP_BASE"`
@@ -42,6 +81,11 @@ type Config struct {
 	LarkAppID      string `envconfig:"lark_app_id"`
 	LarkAppSecret  string `envconfig:"lark_app_secret"`
 	LarkEncryptKey string `envconfig:"LARK_ENCRYPT_KEY"`
+	// LarkVerifyToken is the verification token of event subscriptions, events without it are refused
+	LarkVerifyToken string `envconfig:"LARK_VERIFY_TOKEN"`
+
+	SAMLCertFile string `envconfig:"SAML_CERT_FILE"`
+	SAMLKeyFile  string `envconfig:"SAML_KEY_FILE"`
 
 	InDevelop bool   `envconfig:"-"`
 	Version   string `envconfig:"-"`
@@ -1,20 +1,31 @@
 package web
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	auth "github.com/liut/simpauth"
 
+	"github.com/liut/staffio/pkg/backends"
 	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/sessions"
 )
 
 const (
-	kAuthUser = "user"
+	kAuthUser     = "user"
+	kLoginSession = "login_session" // current session in context
+	kAudited      = "audited"       // the request has an audit event
+
+	sessionCookie = "_sid"
+	sessionMaxAge = 86400 * 30 // the server-side session expires by idle first
 )
 
+var errSessionEnded = errors.New("session is terminated or expired")
+
 type User = auth.User
 
 func UserFromStaff(staff *models.Staff) *auth.User {
@@ -24,11 +35,31 @@ func UserFromStaff(staff *models.Staff) *auth.User {
 	}
 }
 
-func AuthUserMiddleware(redirect bool) gin.HandlerFunc {
+// AuthUserMiddleware requires a signed in user with a live server-side session,
+// or a personal access token as Bearer credentials, which never redirects
+func (s *server) AuthUserMiddleware(redirect bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user, err := auth.UserFromRequest(c.Request)
+		if value, ok := bearerToken(c.Request); ok {
+			user, err := s.userFromToken(c, value)
+			if err != nil {
+				logger().Infow("token auth fail", "uri", c.Request.RequestURI, "ip", c.ClientIP(), "err", err)
+				code := http.StatusUnauthorized
+				if err == errTokenScope {
+					code = http.StatusForbidden
+				}
+				c.AbortWithStatusJSON(code, map[string]interface{}{"status": ERROR_PARAM, "message": err.Error()})
+				return
+			}
+			c.Set(kAuthUser, user)
+			c.Next()
+			return
+		}
+		user, err := s.userFromRequest(c)
 		if err != nil {
 			log.Printf("user from request ERR %s", err)
+			if err == errSessionEnded {
+				auth.Signout(c.Writer)
+			}
 			if redirect {
 				markReferer(c)
 				c.Redirect(302, UrlFor("login"))
@@ -42,8 +73,11 @@ func AuthUserMiddleware(redirect bool) gin.HandlerFunc {
 		// log.Printf("got user %q", user.UID)
 		c.Set(kAuthUser, user)
 		c.Next()
-		user.Refresh()
-		user.Signin(c.Writer)
+		// the handler may sign in as another one
+		if v, _ := c.Get(kAuthUser); v == user {
+			user.Refresh()
+			user.Signin(c.Writer)
+		}
 	}
 }
 
@@ -75,12 +109,105 @@ func UserWithContext(c *gin.Context) (user *User) {
 	return
 }
 
-func signinStaffGin(c *gin.Context, staff *models.Staff) {
+// userFromRequest returns the user in cookie if the session of the request is live
+func (s *server) userFromRequest(c *gin.Context) (*User, error) {
+	user, err := auth.UserFromRequest(c.Request)
+	if err != nil {
+		return nil, err
+	}
+	ls, err := s.loginSession(c)
+	if err != nil {
+		return nil, err
+	}
+	if ls.UID != user.UID {
+		return nil, errSessionEnded
+	}
+	return user, nil
+}
+
+// loginSession returns the live session of the request, last seen is updated
+func (s *server) loginSession(c *gin.Context) (*sessions.Session, error) {
+	if v, ok := c.Get(kLoginSession); ok {
+		return v.(*sessions.Session), nil
+	}
+	ck, err := c.Request.Cookie(sessionCookie)
+	if err != nil || ck.Value == "" {
+		return nil, errSessionEnded
+	}
+	ls, err := s.service.Sessions().Get(sessions.HashToken(ck.Value))
+	if err == backends.ErrNotFound {
+		return nil, errSessionEnded
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if ls.IsIdle(time.Duration(auth.UserLifetime)*time.Second, now) {
+		return nil, errSessionEnded
+	}
+	if ls.NeedTouch(now) {
+		if err = s.service.Sessions().Touch(ls.ID, c.ClientIP()); err != nil {
+			logger().Infow("touch session fail", "uid", ls.UID, "err", err)
+		}
+	}
+	c.Set(kLoginSession, ls)
+	return ls, nil
+}
+
+// signinStaffGin signs staff in with a new server-side session
+func (s *server) signinStaffGin(c *gin.Context, staff *models.Staff) error {
+	return s.startSession(c, staff, "")
+}
+
+// startSession signs staff in with a new server-side session, actor is the keeper signing in as staff,
+// nothing is signed in if the session can not be saved
+func (s *server) startSession(c *gin.Context, staff *models.Staff, actor string) error {
 	user := UserFromStaff(staff)
 	user.Refresh()
-	log.Printf("login ok %v", user)
+	token, id, err := sessions.NewToken()
+	if err != nil {
+		return err
+	}
+	ua := c.Request.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	ls := &sessions.Session{ID: id, UID: staff.UID, UserAgent: ua, IP: c.ClientIP(), Actor: actor}
+	if err = s.service.Sessions().Save(ls); err != nil {
+		logger().Warnw("new session fail", "uid", staff.UID, "err", err)
+		return err
+	}
+	c.Set(kLoginSession, ls)
+	logger().Debugw("login ok", "uid", staff.UID, "actor", actor)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		MaxAge:   sessionMaxAge,
+		Path:     auth.CookiePath,
+		HttpOnly: true,
+	})
+	setCSRFToken(c, token)
 	sess := ginSession(c)
 	sess.Set(kAuthUser, user)
 	user.Signin(c.Writer)
+	c.Set(kAuthUser, user)
 	SessionSave(sess, c.Writer)
+	return nil
+}
+
+// signout ends the session of the request and clears cookies
+func (s *server) signout(c *gin.Context) {
+	if ls, err := s.loginSession(c); err == nil {
+		if err = s.service.Sessions().Delete(ls.UID, ls.ID); err != nil {
+			logger().Infow("delete session fail", "uid", ls.UID, "err", err)
+		}
+	}
+	auth.Signout(c.Writer)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     auth.CookiePath,
+		HttpOnly: true,
+	})
 }
@@ -0,0 +1,104 @@
+package web
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	auth "github.com/liut/simpauth"
+
+	"github.com/liut/staffio/pkg/models/sessions"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+const (
+	kCSRFToken = "csrf_token" // token of a session started in the request
+
+	csrfCookie = "_csrf" // readable by scripts, for the header of api calls
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "_csrf"
+)
+
+var errCSRF = errors.New("invalid or missing csrf token")
+
+// csrfToken returns the csrf token of the session of the request, empty if not signed in
+func csrfToken(c *gin.Context) string {
+	if v, ok := c.Get(kCSRFToken); ok {
+		return v.(string)
+	}
+	ck, err := c.Request.Cookie(sessionCookie)
+	if err != nil || ck.Value == "" {
+		return ""
+	}
+	return sessions.CSRFToken(ck.Value)
+}
+
+// setCSRFToken keeps the csrf token of a session token for the request and in cookie
+func setCSRFToken(c *gin.Context, token string) {
+	csrf := sessions.CSRFToken(token)
+	c.Set(kCSRFToken, csrf)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:   csrfCookie,
+		Value:  csrf,
+		MaxAge: sessionMaxAge,
+		Path:   auth.CookiePath,
+	})
+}
+
+// csrfMiddleware requires the csrf token of the session in header or form for unsafe methods,
+// must be after AuthUserMiddleware
+func (s *server) csrfMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := csrfToken(c)
+		if ck, err := c.Request.Cookie(csrfCookie); token != "" && (err != nil || ck.Value != token) {
+			if sk, err := c.Request.Cookie(sessionCookie); err == nil {
+				setCSRFToken(c, sk.Value)
+			}
+		}
+		switch c.Request.Method {
+		case "GET", "HEAD", "OPTIONS":
+			return
+		}
+		if csrfExempt(c.Request) {
+			return
+		}
+		got := c.GetHeader(csrfHeader)
+		if got == "" {
+			got = c.Request.PostFormValue(csrfField)
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			logger().Infow("csrf check fail", "uri", c.Request.RequestURI, "ip", c.ClientIP(), "origin", c.GetHeader("Origin"))
+			c.AbortWithStatusJSON(http.StatusForbidden, map[string]interface{}{
+				"status":  ERROR_PARAM,
+				"message": errCSRF.Error(),
+			})
+		}
+	}
+}
+
+// csrfExempt returns true for calls with a bearer token, which browsers do not add to forged requests,
+// and for requests from the trusted origins in settings
+func csrfExempt(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		if u, err := url.Parse(r.Referer()); err == nil && u.Host != "" {
+			origin = u.Scheme + "://" + u.Host
+		}
+	}
+	if origin == "" || origin == "null" {
+		return false
+	}
+	for _, o := range settings.Current.CSRFTrusted {
+		if strings.EqualFold(strings.TrimRight(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
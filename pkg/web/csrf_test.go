@@ -0,0 +1,63 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryCSRF(t *testing.T) {
+	root := settings.Current.Root
+	settings.Current.Root = "../../"
+	defer func() { settings.Current.Root = root }()
+	s := newMemoryServer()
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	var token string
+	u, _ := url.Parse("https://example.com/")
+	for _, ck := range tc.jar.Cookies(u) {
+		if ck.Name == csrfCookie {
+			token = ck.Value
+		}
+	}
+	if !assert.NotEmpty(t, token) {
+		return
+	}
+	w := tc.get("/sessions")
+	assert.Contains(t, w.Body.String(), `<meta name="csrf-token" content="`+token+`">`)
+
+	// post without the scripts of pages
+	post := func(form url.Values, header ...string) int {
+		req := httptest.NewRequest("POST", "https://example.com/api/sessions/delete", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		for _, ck := range tc.jar.Cookies(req.URL) {
+			req.AddCookie(ck)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+	form := url.Values{"id": {"none"}}
+	assert.Equal(t, http.StatusForbidden, post(form))
+	assert.Equal(t, http.StatusForbidden, post(form, csrfHeader, "x"+token))
+	assert.Equal(t, http.StatusOK, post(form, csrfHeader, token))
+	assert.Equal(t, http.StatusOK, post(url.Values{"id": {"none"}, csrfField: {token}}))
+	assert.Equal(t, http.StatusUnauthorized, post(form, "Authorization", "Bearer abc"), "bearer only, cookies ignored")
+
+	trusted := settings.Current.CSRFTrusted
+	settings.Current.CSRFTrusted = []string{"https://weekly.example.com/"}
+	defer func() { settings.Current.CSRFTrusted = trusted }()
+	assert.Equal(t, http.StatusOK, post(form, "Origin", "https://weekly.example.com"))
+	assert.Equal(t, http.StatusOK, post(form, "Referer", "https://weekly.example.com/report"))
+	assert.Equal(t, http.StatusForbidden, post(form, "Origin", "https://evil.example.net"))
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/liut/staffio/pkg/backends/qqexmail"
 	"github.com/liut/staffio/pkg/backends/wechatwork"
 	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/group"
 	"github.com/liut/staffio/pkg/models/oauth"
 	"github.com/liut/staffio/pkg/settings"
 )
@@ -80,6 +82,7 @@ func (s *server) clientsPost(c *gin.Context) {
 			apiError(c, 1, err)
 			return
 		}
+		s.audit(c, audit.ActClientSave, "", client.Code, "new")
 		res["ok"] = true
 		res["id"] = client.ID
 		c.JSON(http.StatusOK, res)
@@ -140,6 +143,7 @@ func (s *server) clientsPost(c *gin.Context) {
 			c.JSON(http.StatusOK, res)
 			return
 		}
+		s.audit(c, audit.ActClientSave, "", client.Code, "update")
 		res["ok"] = true
 		res["id"] = client.ID
 		c.JSON(http.StatusOK, res)
@@ -277,6 +281,10 @@ func (s *server) staffPost(c *gin.Context) {
 	if op == "store" {
 		fb := binding.Form
 		staff = new(models.Staff)
+		if estaff != nil {
+			// attributes out of the form are kept, the empty ones in it are cleared
+			*staff = *estaff
+		}
 		err = fb.Bind(req, staff)
 		if err != nil {
 			logger().Infow("bind fail", "staff", staff, "err", err)
@@ -285,6 +293,11 @@ func (s *server) staffPost(c *gin.Context) {
 
 		err = s.service.SaveStaff(staff)
 		if err == nil {
+			if estaff == nil {
+				s.audit(c, audit.ActStaffCreate, "", staff.UID, "")
+			} else {
+				s.audit(c, audit.ActStaffUpdate, "", staff.UID, "")
+			}
 			res["ok"] = true
 			res["referer"] = "/contacts"
 			c.JSON(http.StatusOK, res)
@@ -327,6 +340,13 @@ func (s *server) staffDelete(c *gin.Context) {
 		logger().Infow("delete fail", "uid", uid, "err", err)
 		return
 	}
+	s.audit(c, audit.ActStaffDelete, user.UID, uid, "")
+	if err = s.service.Sessions().Clear(uid); err != nil {
+		logger().Infow("clear sessions fail", "uid", uid, "err", err)
+	}
+	if err = s.service.Tokens().Clear(uid); err != nil {
+		logger().Infow("clear tokens fail", "uid", uid, "err", err)
+	}
 
 	res["ok"] = true
 	c.JSON(http.StatusOK, res)
@@ -335,7 +355,8 @@ func (s *server) staffDelete(c *gin.Context) {
 
 func (s *server) groupList(c *gin.Context) {
 
-	data, _ := s.service.AllGroup()
+	groups, _ := s.service.AllGroup()
+	data := group.ExpandAll(groups)
 
 	if strings.HasPrefix(c.Request.RequestURI, "/api/") || IsAjax(c.Request) {
 		apiOk(c, data, len(data))
@@ -361,6 +382,7 @@ func (s *server) groupStore(c *gin.Context) {
 		apiError(c, http.StatusServiceUnavailable, err)
 		return
 	}
+	s.audit(c, audit.ActGroupSave, "", group.Name, strings.Join(group.Members, ","))
 
 	apiOk(c, true, 0)
 }
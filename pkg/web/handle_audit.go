@@ -0,0 +1,102 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/sessions"
+)
+
+// audit pages of CSV export
+const auditExportMax = 200 // pages of the largest limit
+
+// audit records an event of the request, actor is the signed in user if empty,
+// the keeper is kept too if the session is impersonated, a failed record is logged only
+func (s *server) audit(c *gin.Context, action, actor, target, detail string) {
+	if actor == "" {
+		if v, ok := c.Get(kAuthUser); ok {
+			actor = v.(*User).UID
+		}
+	}
+	ua := c.Request.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	e := &audit.Event{
+		Action:    action,
+		Actor:     actor,
+		Target:    target,
+		IP:        c.ClientIP(),
+		UserAgent: ua,
+		Detail:    detail,
+	}
+	if v, ok := c.Get(kLoginSession); ok {
+		if ls := v.(*sessions.Session); ls.Actor != "" && ls.Actor != actor {
+			e.Impersonator = ls.Actor
+		}
+	}
+	c.Set(kAudited, true)
+	if err := s.service.Audit().Add(e); err != nil {
+		logger().Warnw("audit fail", "event", e, "err", err)
+	}
+}
+
+// auditList lists events with filters, as JSON for ajax and api, CSV with format=csv
+func (s *server) auditList(c *gin.Context) {
+	spec := new(audit.Spec)
+	if err := c.Bind(spec); err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	if c.Query("format") == "csv" {
+		s.auditExport(c, spec)
+		return
+	}
+	data, err := s.service.Audit().Query(spec)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if isAPI(c) {
+		apiOk(c, data, spec.Total)
+		return
+	}
+	var pages []int
+	for i := 1; i <= (spec.Total+spec.Limit-1)/spec.Limit; i++ {
+		pages = append(pages, i)
+	}
+	s.Render(c, "dust_audit.html", map[string]interface{}{
+		"ctx":     c,
+		"events":  data,
+		"spec":    spec,
+		"pages":   pages,
+		"actions": audit.Actions,
+	})
+}
+
+func (s *server) auditExport(c *gin.Context, spec *audit.Spec) {
+	spec.Limit = 500
+	var all []audit.Event
+	for spec.Page = 1; spec.Page <= auditExportMax; spec.Page++ {
+		data, err := s.service.Audit().Query(spec)
+		if err != nil {
+			apiError(c, ERROR_DB, err)
+			return
+		}
+		all = append(all, data...)
+		if len(all) >= spec.Total || len(data) < spec.Limit {
+			break
+		}
+	}
+	s.audit(c, audit.ActAuditExport, "", "", fmt.Sprintf("%d events", len(all)))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.csv"`, time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+	if err := audit.WriteCSV(c.Writer, all); err != nil {
+		logger().Infow("write audit csv fail", "err", err)
+	}
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+)
+
+func TestMemoryAudit(t *testing.T) {
+	s := newMemoryServer()
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"wrong"}})
+	assert.Equal(t, false, res["ok"])
+	res = tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	w := tc.get("/api/audit")
+	assert.Equal(t, http.StatusForbidden, w.Code, "keepers only")
+
+	kc := newTestClient(s)
+	res = kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = kc.postJSON("/dust/group", backends.Group{Name: "audit", Members: []string{"test"}})
+	assert.Equal(t, float64(0), res["status"])
+
+	var list struct {
+		Data  []audit.Event `json:"data"`
+		Count int           `json:"count"`
+	}
+	w = kc.get("/api/audit?action=login&actor=test")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.True(t, len(list.Data) >= 2) {
+		assert.Equal(t, audit.ActLogin, list.Data[0].Action, "newest first")
+		assert.Equal(t, audit.ActLoginFail, list.Data[1].Action)
+		assert.Equal(t, "192.0.2.1", list.Data[1].IP)
+		assert.Equal(t, list.Count, len(list.Data))
+	}
+
+	w = kc.get("/api/audit?action=group.save&target=audit")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, "eagle", list.Data[0].Actor)
+		assert.Equal(t, "test", list.Data[0].Detail)
+	}
+
+	w = kc.get("/dust/audit?actor=test&format=csv")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+	assert.True(t, strings.HasPrefix(w.Body.String(), strings.Join(audit.CSVHeader, ",")+"\n"))
+	assert.Contains(t, w.Body.String(), ",login.fail,test,")
+
+	w = kc.get("/api/audit?action=admin.export")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.NotEmpty(t, list.Data, "export is audited")
+}
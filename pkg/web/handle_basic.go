@@ -8,28 +8,35 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	"github.com/openshift/osin"
 
-	auth "github.com/liut/simpauth"
-
+	"github.com/liut/staffio/pkg/backends"
 	"github.com/liut/staffio/pkg/common"
 	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
 	"github.com/liut/staffio/pkg/models/cas"
+	"github.com/liut/staffio/pkg/models/prefs"
 )
 
 func (s *server) loginForm(c *gin.Context) {
 	service := c.Request.FormValue("service")
 	tgc := GetTGC(c)
-	if service != "" && tgc != nil {
+	// a terminated session can not issue tickets
+	if _, err := s.loginSession(c); service != "" && tgc != nil && err == nil {
+		if s.forbidImpersonated(c) {
+			return
+		}
 		st := cas.NewTicket("ST", service, tgc.UID, false)
 		err := s.service.SaveTicket(st)
 		if err != nil {
 			return
 		}
+		s.audit(c, audit.ActCASTicket, tgc.UID, service, "")
 		c.Redirect(302, service+"?ticket="+st.Value)
 		return
 	}
 	s.Render(c, "login.html", map[string]interface{}{
 		"ctx":     c,
 		"service": service,
+		"link":    s.linkEnabled(),
 	})
 }
 
@@ -50,28 +57,44 @@ func (s *server) loginPost(c *gin.Context) {
 		staff *models.Staff
 		err   error
 	)
-	if staff, err = s.service.Authenticate(param.Username, param.Password); err != nil {
-		res["ok"] = false
-		res["error"] = map[string]string{"message": "Invalid Username/Password", "field": "password"}
-		res["status"] = ERROR_PARAM
-		res["message"] = "Invalid Username/Password"
-		c.JSON(http.StatusOK, res)
+	if staff, err = s.authenticate(c, param.Username, param.Password); err != nil {
+		authReplyError(c, err, "password")
+		return
+	}
+
+	// the current password starts the history if unknown
+	backends.PasswordChangedAt(s.service, staff.UID, param.Password)
+
+	if s.totpPending(c, staff.UID, param.Service, param.Referer) {
 		return
 	}
 
+	s.signinReply(c, res, staff, param.Service, param.Referer)
+}
+
+// signinReply signs staff in, issues a CAS ticket if service is not empty
+func (s *server) signinReply(c *gin.Context, res osin.ResponseData, staff *models.Staff, service, referer string) {
+	if s.passwordPending(c, res, staff.UID, service, referer) {
+		return
+	}
+	s.passThrottle(staff.UID)
 	//store the user id in the values and redirect to welcome
-	signinStaffGin(c, staff)
-	referer := param.Referer
+	if err := s.signinStaffGin(c, staff); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	s.audit(c, audit.ActLogin, staff.UID, "", c.Request.URL.Path)
 	res["ok"] = true
-	if param.Service != "" {
-		st := cas.NewTicket("ST", param.Service, staff.UID, true)
-		err = s.service.SaveTicket(st)
+	if service != "" {
+		st := cas.NewTicket("ST", service, staff.UID, true)
+		err := s.service.SaveTicket(st)
 		if err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
+		s.audit(c, audit.ActCASTicket, staff.UID, service, "")
 		NewTGC(c, st)
-		res["referer"] = param.Service + "?ticket=" + st.Value
+		res["referer"] = service + "?ticket=" + st.Value
 		log.Printf("ref: %q", res["referer"])
 	} else {
 		if referer == "" {
@@ -86,7 +109,7 @@ func (s *server) loginPost(c *gin.Context) {
 
 // for staff/verify
 func (s *server) me(c *gin.Context) {
-	user, err := auth.UserFromRequest(c.Request)
+	user, err := s.userFromRequest(c)
 	if err != nil {
 		apiError(c, 1, nil)
 		return
@@ -108,7 +131,10 @@ func (s *server) me(c *gin.Context) {
 }
 
 func (s *server) logout(c *gin.Context) {
-	auth.Signout(c.Writer)
+	if user, err := s.userFromRequest(c); err == nil {
+		s.audit(c, audit.ActLogout, user.UID, "", "")
+	}
+	s.signout(c)
 	DeleteTGC(c)
 	if IsAjax(c.Request) {
 		apiOk(c, true, 0)
@@ -119,7 +145,8 @@ func (s *server) logout(c *gin.Context) {
 
 func (s *server) passwordForm(c *gin.Context) {
 	s.Render(c, "password.html", map[string]interface{}{
-		"ctx": c,
+		"ctx":    c,
+		"policy": backends.PasswordPolicy(),
 	})
 }
 
@@ -134,22 +161,18 @@ func (s *server) passwordChange(c *gin.Context) {
 		return
 	}
 	user := UserWithContext(c)
-	if _, err := s.service.Authenticate(user.UID, param.OldPassword); err != nil {
-		res["ok"] = false
-		res["error"] = map[string]string{"message": "Invalid Username/Password", "field": "old_password"}
-		res["status"] = ERROR_PARAM
-		c.JSON(http.StatusOK, res)
+	if _, err := s.authenticate(c, user.UID, param.OldPassword); err != nil {
+		authReplyError(c, err, "old_password")
 		return
 	}
 	err := s.service.PasswordChange(user.UID, param.OldPassword, param.NewPassword)
 	if err != nil {
-		res["ok"] = false
-		res["error"] = map[string]string{"message": err.Error(), "field": "old_password"}
-		res["status"] = ERROR_DB
-	} else {
-		res["ok"] = true
-		res["status"] = 0
+		passwordReplyError(c, err, "new_password", ERROR_DB)
+		return
 	}
+	s.audit(c, audit.ActPasswordChange, user.UID, user.UID, "")
+	res["ok"] = true
+	res["status"] = 0
 
 	c.JSON(http.StatusOK, res)
 }
@@ -170,35 +193,47 @@ func (s *server) passwordForgot(c *gin.Context) {
 		c.JSON(400, res)
 		return
 	}
-
-	staff, err := s.service.Get(param.Username)
-	if err != nil {
+	at, target := common.AtEmail, param.Email
+	if param.Via == "sms" {
+		at, target = common.AtPhone, param.Mobile
+	} else if param.Email == "" {
 		res["ok"] = false
-		res["error"] = map[string]string{"message": "Invalid Username", "field": "username"}
+		res["error"] = map[string]string{"message": "email is required", "field": "email"}
+		res["status"] = ERROR_PARAM
 		c.JSON(http.StatusOK, res)
 		return
 	}
-	if staff.Email != param.Email {
-		res["ok"] = false
-		res["error"] = map[string]string{"message": "No such email address", "field": "email"}
-		c.JSON(http.StatusOK, res)
+
+	// every request counts, the reply is the same whether the account matches or not
+	keys := requestKeys(c, param.Username)
+	if err := s.throttleCheck(keys...); err != nil {
+		authReplyError(c, err, "username")
 		return
 	}
-	if staff.Mobile != param.Mobile {
-		res["ok"] = false
-		res["error"] = map[string]string{"message": "The mobile number is a mismatch", "field": "mobile"}
-		c.JSON(http.StatusOK, res)
+	s.throttleFail(keys...)
+
+	staff, err := s.service.Get(param.Username)
+	if err != nil && err != backends.ErrStoreNotFound {
+		apiError(c, ERROR_DB, err)
 		return
 	}
-	err = s.service.PasswordForgot(common.AtEmail, param.Email, param.Username)
-	if err != nil {
-		res["ok"] = false
-		res["error"] = map[string]string{"message": err.Error(), "field": "username"}
-	} else {
+	if err != nil || staff.Mobile != param.Mobile || (at == common.AtEmail && staff.Email != param.Email) {
+		logger().Infow("password forgot mismatch", "uid", param.Username, "ip", c.ClientIP())
+		s.audit(c, audit.ActPasswordForgot, param.Username, param.Username, "mismatch")
 		res["ok"] = true
 		res["status"] = 0
+		c.JSON(http.StatusOK, res)
+		return
 	}
-
+	// errors after matched are logged only, or they tell the account exists
+	if err = s.service.PasswordForgot(at, target, param.Username); err != nil {
+		logger().Infow("password forgot fail", "uid", param.Username, "via", at.String(), "err", err)
+		s.audit(c, audit.ActPasswordForgot, param.Username, param.Username, "fail "+at.String())
+	} else {
+		s.audit(c, audit.ActPasswordForgot, param.Username, param.Username, "sent "+at.String())
+	}
+	res["ok"] = true
+	res["status"] = 0
 	c.JSON(http.StatusOK, res)
 }
 
@@ -206,6 +241,15 @@ func (s *server) passwordResetForm(c *gin.Context) {
 	req := c.Request
 
 	token := req.FormValue("rt")
+	if token == "" && req.FormValue("via") == "sms" {
+		s.Render(c, "password_reset.html", map[string]interface{}{
+			"ctx":    c,
+			"uid":    req.FormValue("username"),
+			"sms":    true,
+			"policy": backends.PasswordPolicy(),
+		})
+		return
+	}
 	if token == "" {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -218,9 +262,10 @@ func (s *server) passwordResetForm(c *gin.Context) {
 		return
 	}
 	s.Render(c, "password_reset.html", map[string]interface{}{
-		"ctx":   c,
-		"token": token,
-		"uid":   uid,
+		"ctx":    c,
+		"token":  token,
+		"uid":    uid,
+		"policy": backends.PasswordPolicy(),
 	})
 }
 
@@ -242,15 +287,40 @@ func (s *server) passwordReset(c *gin.Context) {
 		c.JSON(http.StatusOK, res)
 		return
 	}
-	err := s.service.PasswordResetWithToken(param.Username, param.Token, param.Password)
-	if err != nil {
-		res["ok"] = false
-		res["status"] = ERROR_DB
-		res["error"] = map[string]string{"message": err.Error(), "field": "password"}
-	} else {
+	if param.Code != "" {
+		err := s.service.PasswordResetWithCode(param.Username, param.Code, param.Password)
+		if err == backends.ErrInvalidCode || err == backends.ErrCodeExhausted || err == backends.ErrStoreNotFound {
+			passwordReplyError(c, backends.ErrInvalidCode, "code", ERROR_PARAM)
+			if err == backends.ErrCodeExhausted {
+				s.audit(c, audit.ActPasswordReset, param.Username, param.Username, "code exhausted")
+			}
+			return
+		}
+		if err != nil {
+			passwordReplyError(c, err, "password", ERROR_DB)
+			return
+		}
+		s.audit(c, audit.ActPasswordReset, param.Username, param.Username, "code")
 		res["ok"] = true
 		res["status"] = 0
+		c.JSON(http.StatusOK, res)
+		return
 	}
+	if param.Token == "" {
+		res["ok"] = false
+		res["error"] = map[string]string{"message": "token or code is required", "field": "password"}
+		res["status"] = ERROR_PARAM
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	err := s.service.PasswordResetWithToken(param.Username, param.Token, param.Password)
+	if err != nil {
+		passwordReplyError(c, err, "password", ERROR_DB)
+		return
+	}
+	s.audit(c, audit.ActPasswordReset, param.Username, param.Username, "token")
+	res["ok"] = true
+	res["status"] = 0
 	c.JSON(http.StatusOK, res)
 }
 
@@ -262,9 +332,25 @@ func (s *server) profileForm(c *gin.Context) {
 		return
 	}
 
+	keys, err := s.service.WebAuthn().All(user.UID)
+	if err != nil && err != backends.ErrNotFound {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+
+	p, err := s.service.Prefs().Get(user.UID)
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+
 	s.Render(c, "profile.html", map[string]interface{}{
-		"ctx":   c,
-		"staff": staff,
+		"ctx":      c,
+		"staff":    staff,
+		"keys":     keys,
+		"prefs":    p,
+		"langs":    prefs.Langs,
+		"channels": backends.NewNotifier(s.service).Names(),
 	})
 }
 
@@ -274,20 +360,69 @@ func (s *server) profilePost(c *gin.Context) {
 	req := c.Request
 	password := req.PostFormValue("password")
 
+	cur, err := s.service.Get(user.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	// attributes out of the form are kept, the empty ones in it are cleared
 	staff := new(models.Staff)
-	err := binding.Form.Bind(req, staff)
+	*staff = *cur
+	err = binding.Form.Bind(req, staff)
 	if err != nil {
 		log.Printf("bind %v: %s", staff, err)
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
+	if _, err = s.authenticate(c, user.UID, password); err != nil {
+		authReplyError(c, err, "password")
+		return
+	}
+	// a new mobile is saved only by verifying it with a code, a new email by the link mailed to it
+	staff.Mobile = cur.Mobile
+	email := staff.Email
+	staff.Email = cur.Email
 	err = s.service.ProfileModify(user.UID, password, staff)
 	if err != nil {
 		res["ok"] = false
 		res["error"] = map[string]string{"message": err.Error(), "field": "password"}
-	} else {
-		res["ok"] = true
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	s.audit(c, audit.ActProfileUpdate, user.UID, user.UID, "")
+	res["ok"] = true
+	if lang, ok := req.PostForm["lang"]; ok {
+		p := &prefs.Prefs{UID: user.UID, Lang: prefs.ParseLang(lang[0])}
+		p.SetChannels(req.PostForm["channels"], backends.NewNotifier(s.service).Names())
+		if err = s.service.Prefs().Save(p); err != nil {
+			apiError(c, ERROR_DB, err)
+			return
+		}
+	}
+	if email != "" && email != cur.Email {
+		if err = s.service.EmailChange(user.UID, email); err != nil {
+			res["ok"] = false
+			res["error"] = map[string]string{"message": err.Error(), "field": "email"}
+		} else {
+			s.audit(c, audit.ActEmailChange, user.UID, user.UID, "pending "+email)
+			res["email_pending"] = email
+		}
 	}
 
 	c.JSON(http.StatusOK, res)
 }
+
+// emailVerify saves the pending email with the link mailed to it
+func (s *server) emailVerify(c *gin.Context) {
+	uid, email, err := s.service.EmailChangeConfirm(c.Query("token"))
+	if err == nil {
+		s.audit(c, audit.ActEmailChange, uid, uid, email)
+	} else {
+		logger().Infow("email verify fail", "err", err)
+	}
+	s.Render(c, "email_verify.html", map[string]interface{}{
+		"ctx":   c,
+		"email": email,
+		"err":   err,
+	})
+}
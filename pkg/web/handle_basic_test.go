@@ -0,0 +1,58 @@
+package web
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dchest/passwordreset"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryEmailChange(t *testing.T) {
+	backends.SetPasswordSecret("email-change")
+	root := settings.Current.Root
+	settings.Current.Root = "../../"
+	defer func() { settings.Current.Root = root }()
+	s := newMemoryServer()
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+
+	profile := url.Values{"uid": {"test"}, "cn": {"Test"}, "gn": {"Test"}, "sn": {"Test"}, "nickname": {"tester"},
+		"email": {"eagle@example.net"}, "mobile": {"1"}, "password": {"test"}}
+	res = tc.post("/profile", profile)
+	if e, ok := res["error"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, "email", e["field"], "taken")
+	}
+	profile.Set("email", "new@example.net")
+	res = tc.post("/profile", profile)
+	assert.Equal(t, true, res["ok"])
+	assert.Equal(t, "new@example.net", res["email_pending"])
+	staff, err := s.service.Get("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "test@example.net", staff.Email, "pending")
+	assert.Equal(t, "13900139000", staff.Mobile, "kept")
+	assert.Equal(t, "tester", staff.Nickname)
+
+	uv, err := s.service.Verify().Get("test", models.VerifyEmail)
+	assert.NoError(t, err)
+	token := passwordreset.NewToken("test", time.Hour, uv.CodeHashBytes(), []byte("email-change"))
+	w := tc.get("/email/verify?token=x" + token)
+	assert.Contains(t, w.Body.String(), "invalid")
+	w = tc.get("/email/verify?token=" + token)
+	assert.Contains(t, w.Body.String(), "new@example.net")
+	staff, err = s.service.Get("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "new@example.net", staff.Email)
+	w = tc.get("/email/verify?token=" + token)
+	assert.Contains(t, w.Body.String(), "invalid", "used once")
+
+	staff.Email = "test@example.net"
+	_, err = s.service.Save(staff)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/outbox"
+	"github.com/liut/staffio/pkg/models/queue"
+)
+
+// eventsList lists the outbox for keepers, payloads are not shown, they may have private fields of staff
+func (s *server) eventsList(c *gin.Context) {
+	spec := new(outbox.Spec)
+	if err := c.Bind(spec); err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	data, err := s.service.Outbox().Query(spec)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	for i := range data {
+		data[i].Payload = ""
+	}
+	if isAPI(c) {
+		apiOk(c, data, spec.Total)
+		return
+	}
+	var pages []int
+	for i := 1; i <= (spec.Total+spec.Limit-1)/spec.Limit; i++ {
+		pages = append(pages, i)
+	}
+	s.Render(c, "dust_events.html", map[string]interface{}{
+		"ctx":         c,
+		"messages":    data,
+		"spec":        spec,
+		"pages":       pages,
+		"topics":      backends.Topics(),
+		"subscribers": backends.Subscribers(),
+		"statuses":    queue.Statuses,
+	})
+}
+
+// eventRetry hands an event to its subscriber again, with attempts cleared
+func (s *server) eventRetry(c *gin.Context) {
+	id, err := strconv.Atoi(c.Request.PostFormValue("id"))
+	if err != nil || id < 1 {
+		apiError(c, ERROR_PARAM, "invalid id")
+		return
+	}
+	m, err := s.service.Outbox().Get(id)
+	if err == nil {
+		err = s.service.Outbox().Retry(id)
+	}
+	if err == backends.ErrNotFound {
+		apiError(c, ERROR_PARAM, "event not found")
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	backends.WakeEventWorker()
+	logger().Infow("event retry", "id", id, "subscriber", m.Subscriber, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActEventRetry, "", m.Subscriber, strconv.Itoa(id)+" "+m.Topic)
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
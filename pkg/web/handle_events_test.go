@@ -0,0 +1,109 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/backends/mail"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/mailq"
+	"github.com/liut/staffio/pkg/models/outbox"
+	"github.com/liut/staffio/pkg/models/team"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryEvents(t *testing.T) {
+	cfg := *settings.Current
+	settings.Current.Root = "../../"
+	settings.Current.MailEnabled = true
+	settings.Current.MailHost = "127.0.0.1"
+	settings.Current.MailPort = 1 // refused, kept in the queue
+	defer func() { *settings.Current = cfg }()
+	s := newMemoryServer()
+	backends.DispatchEvents(s.service) // of other tests
+
+	var got []backends.Event
+	fail := true
+	backends.Subscribe("test-events", func(svc backends.Servicer, ev backends.Event) error {
+		if fail {
+			fail = false
+			return errors.New("not yet")
+		}
+		got = append(got, ev)
+		return nil
+	}, backends.TopicStaffCreated, backends.TopicTeamMembersChanged, backends.TopicPasswordChanged,
+		backends.TopicWeeklyReportSubmitted)
+
+	staff := &models.Staff{UID: "evented", GivenName: "Event", Surname: "Li", Email: "evented@example.net",
+		IDCN: "110101199001011234", Birthday: "1990-01-01"}
+	assert.NoError(t, s.service.SaveStaff(staff))
+	defer s.service.Delete(staff.UID)
+	welcome := &mailq.Spec{To: staff.Email}
+	mails, _ := s.service.MailQueue().Query(welcome)
+	assert.Len(t, mails, 0, "sent after commit by the subscriber")
+	tm := &team.Team{Name: "events"}
+	assert.NoError(t, s.service.Team().Store(tm))
+	defer s.service.Team().Delete(tm.ID)
+	assert.NoError(t, s.service.Team().AddMember(tm.ID, "Evented"))
+	assert.NoError(t, s.service.PasswordReset(staff.UID, "Quiet-Harbor-1729"))
+	assert.NoError(t, s.service.Weekly().Add(staff.UID, `{"done":"events"}`))
+
+	n, err := backends.DispatchEvents(s.service)
+	assert.NoError(t, err)
+	assert.True(t, n >= 6, "welcome, webhooks and test-events")
+	mails, _ = s.service.MailQueue().Query(welcome)
+	if assert.Len(t, mails, 1) {
+		assert.Equal(t, mail.Welcome, mails[0].Template)
+	}
+	list, err := s.service.Outbox().Query(&outbox.Spec{Subscriber: "test-events", Status: outbox.StatusPending})
+	assert.NoError(t, err)
+	if !assert.Len(t, list, 1, "the first one failed") {
+		return
+	}
+	m := list[0]
+	assert.Equal(t, backends.TopicStaffCreated, m.Topic)
+	assert.Equal(t, 1, m.Attempts)
+	assert.Equal(t, "not yet", m.LastError)
+	assert.Contains(t, m.Payload, `"uid":"evented"`)
+	assert.NotContains(t, m.Payload, staff.IDCN, "no private fields in the outbox")
+	assert.NotContains(t, m.Payload, staff.Birthday)
+	if assert.Len(t, got, 3) {
+		assert.Equal(t, &backends.TeamMembersChanged{TeamID: tm.ID, Added: []string{"evented"}}, got[0])
+		assert.Equal(t, &backends.PasswordChanged{UID: staff.UID, Reset: true}, got[1])
+		wr, ok := got[2].(*backends.WeeklyReportSubmitted)
+		if assert.True(t, ok) {
+			assert.Equal(t, staff.UID, wr.UID)
+			assert.NotZero(t, wr.ReportID)
+		}
+	}
+
+	m.Status = outbox.StatusDead
+	assert.NoError(t, s.service.Outbox().Update(&m))
+	kc := newTestClient(s)
+	res := kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	w := kc.get("/dust/events?subscriber=test-events&status=dead")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "not yet")
+	assert.NotContains(t, w.Body.String(), staff.Email, "no payloads for keepers")
+	res = kc.post("/dust/events/retry", url.Values{"id": {strconv.Itoa(m.ID)}})
+	assert.Equal(t, true, res["ok"])
+	_, err = backends.DispatchEvents(s.service)
+	assert.NoError(t, err)
+	mm, _ := s.service.Outbox().Get(m.ID)
+	assert.Equal(t, outbox.StatusDone, mm.Status)
+	if assert.Len(t, got, 4) {
+		sc, ok := got[3].(*backends.StaffCreated)
+		if assert.True(t, ok) {
+			assert.Equal(t, staff.Email, sc.Staff.Email)
+		}
+	}
+	res = kc.post("/dust/events/retry", url.Values{"id": {"99999"}})
+	assert.NotEqual(t, true, res["ok"])
+}
@@ -0,0 +1,175 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	auth "github.com/liut/simpauth"
+
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/sessions"
+)
+
+// ownSessionCookie keeps the token of the keeper's own session while signed in as another one
+const ownSessionCookie = "_sid_own"
+
+var errImpersonating = errors.New("not allowed while signed in as another user")
+
+// impersonator returns the keeper signed in as the user of the request, empty if not impersonated
+func (s *server) impersonator(c *gin.Context) string {
+	if ls, err := s.loginSession(c); err == nil {
+		return ls.Actor
+	}
+	return ""
+}
+
+// forbidImpersonated replies forbidden if the session is impersonated,
+// no ticket or grant is issued on behalf of another one
+func (s *server) forbidImpersonated(c *gin.Context) bool {
+	actor := s.impersonator(c)
+	if actor == "" {
+		return false
+	}
+	logger().Infow("forbidden while impersonating", "actor", actor, "uri", c.Request.RequestURI)
+	if isAPI(c) {
+		apiError(c, ERROR_PARAM, errImpersonating)
+	} else {
+		c.String(http.StatusForbidden, errImpersonating.Error())
+		c.Abort()
+	}
+	return true
+}
+
+// notImpersonated is a middleware of credential routes, see forbidImpersonated,
+// a keeper signed in as another user can not add or remove credentials of that one
+func (s *server) notImpersonated(c *gin.Context) {
+	if s.forbidImpersonated(c) {
+		c.Abort()
+	}
+}
+
+// auditImpersonated records changing requests of an impersonated session,
+// those without their own audit event too, so every action keeps both identities
+func (s *server) auditImpersonated(c *gin.Context) {
+	if c.Request.Method == "GET" || c.Request.Method == "HEAD" || c.Request.Method == "OPTIONS" {
+		return
+	}
+	ls, err := s.loginSession(c)
+	if err != nil || ls.Actor == "" {
+		return
+	}
+	c.Next()
+	if _, ok := c.Get(kAudited); !ok {
+		s.audit(c, audit.ActImpersonateReq, ls.UID, ls.UID,
+			fmt.Sprintf("%s %s %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status()))
+	}
+}
+
+// impersonateStart signs the keeper in as uid, the own session is kept to return to
+func (s *server) impersonateStart(c *gin.Context) {
+	user := UserWithContext(c)
+	uid := c.Request.PostFormValue("uid")
+	if uid == "" || uid == user.UID {
+		apiError(c, ERROR_PARAM, "invalid uid")
+		return
+	}
+	if s.IsKeeper(uid) {
+		apiError(c, ERROR_PARAM, "can not sign in as a keeper")
+		return
+	}
+	staff, err := s.service.Get(uid)
+	if err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	ck, err := c.Request.Cookie(sessionCookie)
+	if err != nil {
+		apiError(c, ERROR_PARAM, errSessionEnded)
+		return
+	}
+	if err = s.startSession(c, staff, user.UID); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("impersonate", "actor", user.UID, "uid", uid)
+	s.audit(c, audit.ActImpersonate, user.UID, uid, "")
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ownSessionCookie,
+		Value:    ck.Value,
+		MaxAge:   sessionMaxAge,
+		Path:     auth.CookiePath,
+		HttpOnly: true,
+	})
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["referer"] = base
+	c.JSON(http.StatusOK, res)
+}
+
+// impersonateStop ends the impersonated session and returns to the keeper's own,
+// the keeper has to sign in again if that is ended meanwhile
+func (s *server) impersonateStop(c *gin.Context) {
+	ls, err := s.loginSession(c)
+	if err != nil || ls.Actor == "" {
+		apiError(c, ERROR_PARAM, "not signed in as another user")
+		return
+	}
+	s.audit(c, audit.ActImpersonateEnd, ls.Actor, ls.UID, "")
+	if err = s.service.Sessions().Delete(ls.UID, ls.ID); err != nil {
+		logger().Infow("delete session fail", "uid", ls.UID, "err", err)
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ownSessionCookie,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     auth.CookiePath,
+		HttpOnly: true,
+	})
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	if !s.resumeOwnSession(c, ls.Actor) {
+		s.signout(c)
+		res["referer"] = UrlFor("login")
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	logger().Infow("impersonate end", "actor", ls.Actor, "uid", ls.UID)
+	res["referer"] = UrlFor("staff/" + ls.UID)
+	c.JSON(http.StatusOK, res)
+}
+
+// resumeOwnSession signs actor in with the session kept by impersonateStart if it is live
+func (s *server) resumeOwnSession(c *gin.Context, actor string) bool {
+	ck, err := c.Request.Cookie(ownSessionCookie)
+	if err != nil || ck.Value == "" {
+		return false
+	}
+	own, err := s.service.Sessions().Get(sessions.HashToken(ck.Value))
+	if err != nil || own.UID != actor || own.Actor != "" ||
+		own.IsIdle(time.Duration(auth.UserLifetime)*time.Second, time.Now()) {
+		return false
+	}
+	staff, err := s.service.Get(actor)
+	if err != nil {
+		return false
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    ck.Value,
+		MaxAge:   sessionMaxAge,
+		Path:     auth.CookiePath,
+		HttpOnly: true,
+	})
+	setCSRFToken(c, ck.Value)
+	user := UserFromStaff(staff)
+	user.Refresh()
+	user.Signin(c.Writer)
+	c.Set(kAuthUser, user)
+	c.Set(kLoginSession, own)
+	return true
+}
@@ -0,0 +1,85 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryImpersonate(t *testing.T) {
+	root := settings.Current.Root
+	settings.Current.Root = "../../"
+	defer func() { settings.Current.Root = root }()
+	s := newMemoryServer()
+	me := func(tc *testClient) string {
+		res := tc.do(httptest.NewRequest("GET", "https://example.com/api/me", nil))
+		if data, ok := res["data"].(map[string]interface{}); ok {
+			return data["uid"].(string)
+		}
+		return ""
+	}
+
+	other := newTestClient(s)
+	res := other.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	w := other.serve(httptest.NewRequest("POST", "https://example.com/dust/impersonate?uid=eagle", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, "keepers only")
+
+	admin := newTestClient(s)
+	res = admin.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = admin.post("/dust/impersonate", url.Values{"uid": {"eagle"}})
+	assert.NotEqual(t, float64(0), res["status"], "self")
+	res = admin.post("/dust/impersonate", url.Values{"uid": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	assert.Equal(t, "test", me(admin))
+	w = admin.get("/")
+	assert.Contains(t, w.Body.String(), "Return to your account")
+
+	w = admin.get("/authorize?response_type=code&client_id=1234&redirect_uri=" + url.QueryEscape("http://localhost:3000/appauth"))
+	assert.Equal(t, http.StatusForbidden, w.Code, "no grants")
+
+	res = admin.post("/api/sessions/delete", url.Values{"others": {"1"}})
+	assert.Equal(t, true, res["ok"])
+	data, err := s.service.Audit().Query(&audit.Spec{Action: audit.ActSessionEnd, Actor: "eagle"})
+	if assert.NoError(t, err) && assert.NotEmpty(t, data) {
+		assert.Equal(t, "test", data[0].Actor)
+		assert.Equal(t, "eagle", data[0].Impersonator)
+	}
+	list, err := s.service.Sessions().All("test")
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, "eagle", list[0].Actor)
+	}
+
+	// credentials of the user can not be added or removed
+	for _, uri := range []string{"/2fa/setup", "/2fa/disable", "/webauthn/register", "/webauthn/delete", "/api/tokens", "/api/password"} {
+		res = admin.post(uri, url.Values{"name": {"mine"}})
+		assert.NotEqual(t, true, res["ok"], uri)
+	}
+	// changes without their own event are recorded with both identities
+	res = admin.postJSON("/api/watch", map[string]string{"uid": "eagle"})
+	assert.Equal(t, float64(0), res["status"])
+	defer s.service.Watch().Unwatch("test", "eagle")
+	data, err = s.service.Audit().Query(&audit.Spec{Action: audit.ActImpersonateReq})
+	if assert.NoError(t, err) && assert.NotEmpty(t, data) {
+		assert.Equal(t, "test", data[0].Actor)
+		assert.Equal(t, "eagle", data[0].Impersonator)
+		assert.Equal(t, "POST /api/watch 200", data[0].Detail)
+	}
+
+	res = admin.post("/api/impersonate/stop", nil)
+	assert.Equal(t, true, res["ok"])
+	assert.Equal(t, "/staff/test", res["referer"])
+	assert.Equal(t, "eagle", me(admin))
+	list, err = s.service.Sessions().All("test")
+	assert.NoError(t, err)
+	assert.Empty(t, list, "ended")
+	res = admin.post("/api/impersonate/stop", nil)
+	assert.NotEqual(t, float64(0), res["status"])
+}
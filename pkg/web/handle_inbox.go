@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/backends/larksync"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/inbox"
+)
+
+// inboxList lists events received from third parties, payloads are not shown like the outbox
+func (s *server) inboxList(c *gin.Context) {
+	spec := new(inbox.Spec)
+	if err := c.Bind(spec); err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	data, err := s.service.Inbox().Query(spec)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	for i := range data {
+		data[i].Payload = ""
+	}
+	if isAPI(c) {
+		apiOk(c, data, spec.Total)
+		return
+	}
+	var pages []int
+	for i := 1; i <= (spec.Total+spec.Limit-1)/spec.Limit; i++ {
+		pages = append(pages, i)
+	}
+	s.Render(c, "dust_inbox.html", map[string]interface{}{
+		"ctx":      c,
+		"events":   data,
+		"spec":     spec,
+		"pages":    pages,
+		"statuses": inbox.Statuses,
+	})
+}
+
+// inboxReplay applies a received event again, the result is kept in the event
+func (s *server) inboxReplay(c *gin.Context) {
+	id, err := strconv.Atoi(c.Request.PostFormValue("id"))
+	if err != nil || id < 1 {
+		apiError(c, ERROR_PARAM, "invalid id")
+		return
+	}
+	e, err := larksync.Replay(s.service, id)
+	if err == backends.ErrNotFound {
+		apiError(c, ERROR_PARAM, "event not found")
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("inbox replay", "id", id, "status", e.Status, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActInboxReplay, "", e.Source, strconv.Itoa(id)+" "+e.Type)
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["status"] = e.Status
+	res["lastError"] = e.LastError
+	c.JSON(http.StatusOK, res)
+}
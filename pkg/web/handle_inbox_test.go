@@ -0,0 +1,85 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends/larksync"
+	"github.com/liut/staffio/pkg/models/inbox"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryLarkEvents(t *testing.T) {
+	cfg := *settings.Current
+	settings.Current.Root = "../../"
+	settings.Current.LarkEncryptKey = "lark key"
+	settings.Current.LarkVerifyToken = "rvaYgkND1GOiu5MM0E1rncYC6PLtF7JV"
+	defer func() { *settings.Current = cfg }()
+	s := newMemoryServer()
+	tc := newTestClient(s)
+
+	callback := func(name string, sign bool) *httptest.ResponseRecorder {
+		plain, err := ioutil.ReadFile(filepath.Join("../backends/larksync/testdata", name+".json"))
+		assert.NoError(t, err)
+		encrypted, err := larksync.Encrypt(settings.Current.LarkEncryptKey, plain)
+		assert.NoError(t, err)
+		body, _ := json.Marshal(map[string]string{"encrypt": encrypted})
+		req := httptest.NewRequest("POST", "https://example.com/api/third/feishu/event/callback", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sign {
+			req.Header.Set(larksync.HeaderTimestamp, "1608725989")
+			req.Header.Set(larksync.HeaderNonce, "161")
+			req.Header.Set(larksync.HeaderSignature, larksync.Sign("1608725989", "161", settings.Current.LarkEncryptKey, body))
+		}
+		return tc.serve(req)
+	}
+
+	w := callback("url_verification", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ajls384kdjx98XX")
+
+	w = callback("department_created", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	local, err := s.service.Inbox().Linked(larksync.Source, inbox.KindDepartment, "od-4e6ac4d14bcd5071a37a39de902c7141")
+	assert.NoError(t, err)
+	tid, _ := strconv.Atoi(local)
+	defer s.service.Team().Delete(tid)
+	tm, err := s.service.Team().Get(tid)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "R&D", tm.Name)
+	}
+	w = callback("department_created", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	spec := &inbox.Spec{Source: larksync.Source}
+	list, _ := s.service.Inbox().Query(spec)
+	if !assert.Len(t, list, 1, "deduplicated") {
+		return
+	}
+
+	settings.Current.LarkVerifyToken = "other"
+	w = callback("department_created", true)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	kc := newTestClient(s)
+	res := kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	w = kc.get("/dust/inbox?status=applied")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), larksync.TypeDepartmentCreated)
+	res = kc.post("/dust/inbox/replay", url.Values{"id": {strconv.Itoa(list[0].ID)}})
+	assert.Equal(t, true, res["ok"])
+	assert.Equal(t, inbox.StatusApplied, res["status"])
+	e, _ := s.service.Inbox().Get(list[0].ID)
+	assert.Equal(t, 2, e.Attempts)
+	res = kc.post("/dust/inbox/replay", url.Values{"id": {"99999"}})
+	assert.NotEqual(t, true, res["ok"])
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
+)
+
+// linkAllowed returns true if uid may sign in with an email link,
+// only members of groups in the policy can
+func (s *server) linkAllowed(uid string) (bool, error) {
+	p, err := s.service.Verify().LoadLinkPolicy()
+	if err != nil {
+		return false, err
+	}
+	return len(p.Groups) > 0 && s.InGroupAny(uid, p.Groups...), nil
+}
+
+// linkEnabled returns true if any group may sign in with an email link
+func (s *server) linkEnabled() bool {
+	p, err := s.service.Verify().LoadLinkPolicy()
+	return err == nil && len(p.Groups) > 0
+}
+
+// loginLinkSend mails a sign-in link to the user,
+// every request counts, the reply is the same whether the account may use it or not
+func (s *server) loginLinkSend(c *gin.Context) {
+	var param linkParam
+	res := make(osin.ResponseData)
+	if err := c.Bind(&param); err != nil {
+		res["ok"] = false
+		res["error"] = err.Error()
+		res["status"] = ERROR_PARAM
+		c.JSON(400, res)
+		return
+	}
+	keys := requestKeys(c, param.Username)
+	if err := s.throttleCheck(keys...); err != nil {
+		authReplyError(c, err, "username")
+		return
+	}
+	s.throttleFail(keys...)
+
+	ok, err := s.linkAllowed(param.Username)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if !ok {
+		logger().Infow("login link denied", "uid", param.Username, "ip", c.ClientIP())
+		s.audit(c, audit.ActLoginLink, param.Username, param.Username, "denied")
+	} else if err = s.service.LoginLinkSend(param.Username, param.Service); err != nil {
+		logger().Infow("login link send fail", "uid", param.Username, "err", err)
+		s.audit(c, audit.ActLoginLink, param.Username, param.Username, "fail")
+	} else {
+		s.audit(c, audit.ActLoginLink, param.Username, param.Username, "sent")
+	}
+	res["ok"] = true
+	res["status"] = 0
+	c.JSON(http.StatusOK, res)
+}
+
+// loginLinkForm asks to continue, so that a mail scanner visiting the link does not use it up
+func (s *server) loginLinkForm(c *gin.Context) {
+	s.Render(c, "login_link.html", map[string]interface{}{
+		"ctx":     c,
+		"token":   c.Query("token"),
+		"service": c.Query("service"),
+	})
+}
+
+// loginLinkPost signs in with the token of a link, then goes on like a password login
+func (s *server) loginLinkPost(c *gin.Context) {
+	req := c.Request
+	token, service := req.PostFormValue("token"), req.PostFormValue("service")
+	uid, err := s.service.LoginLinkConfirm(token)
+	if err == backends.ErrInvalidLink {
+		res := make(osin.ResponseData)
+		res["ok"] = false
+		res["error"] = map[string]string{"message": err.Error(), "field": "token"}
+		res["status"] = ERROR_PARAM
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	// the policy may be changed after the link is sent
+	if ok, err := s.linkAllowed(uid); err != nil || !ok {
+		s.audit(c, audit.ActLoginFail, uid, "", req.URL.Path+" denied")
+		apiError(c, ERROR_PARAM, "sign-in link is not allowed")
+		return
+	}
+	var staff *models.Staff
+	if staff, err = s.service.Get(uid); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if s.totpPending(c, uid, service, "") {
+		return
+	}
+	s.signinReply(c, make(osin.ResponseData), staff, service, "")
+}
+
+func (s *server) linkPolicyForm(c *gin.Context) {
+	p, err := s.service.Verify().LoadLinkPolicy()
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	if IsAjax(c.Request) {
+		apiOk(c, p, 0)
+		return
+	}
+	groups, _ := s.service.AllGroup()
+	allowed := make(map[string]bool)
+	for _, gn := range p.Groups {
+		allowed[gn] = true
+	}
+	s.Render(c, "dust_login_link.html", map[string]interface{}{
+		"ctx":     c,
+		"groups":  groups,
+		"allowed": allowed,
+	})
+}
+
+func (s *server) linkPolicyPost(c *gin.Context) {
+	c.Request.ParseForm()
+	p := &models.LinkPolicy{Groups: c.Request.PostForm["groups"]}
+	if err := s.service.Verify().SaveLinkPolicy(p); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("login link policy saved", "groups", p.Groups, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActLinkPolicy, "", "", strings.Join(p.Groups, ","))
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
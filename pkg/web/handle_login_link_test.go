@@ -0,0 +1,69 @@
+package web
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dchest/passwordreset"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryLoginLink(t *testing.T) {
+	backends.SetPasswordSecret("login-link")
+	root := settings.Current.Root
+	settings.Current.Root = "../../"
+	defer func() { settings.Current.Root = root }()
+	s := newMemoryServer()
+	defer func() {
+		for _, key := range []string{throttle.RequestKey("test"), throttle.IPKey("192.0.2.1")} {
+			s.service.Throttle().Reset(key)
+		}
+	}()
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login/link", url.Values{"username": {"test"}})
+	assert.Equal(t, true, res["ok"], "same reply")
+	_, err := s.service.Verify().Get("test", models.VerifyLogin)
+	assert.Equal(t, backends.ErrNotFound, err, "not allowed")
+
+	admin := newTestClient(s)
+	res = admin.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = admin.post("/dust/login-link", url.Values{"groups": {"develop"}})
+	assert.Equal(t, true, res["ok"])
+	defer s.service.Verify().SaveLinkPolicy(&models.LinkPolicy{})
+	w := tc.get("/login")
+	assert.Contains(t, w.Body.String(), "link-login")
+
+	service := "http://app.example.net/"
+	res = tc.post("/api/login/link", url.Values{"username": {"test"}, "service": {service}})
+	assert.Equal(t, true, res["ok"])
+	uv, err := s.service.Verify().Get("test", models.VerifyLogin)
+	if !assert.NoError(t, err) {
+		return
+	}
+	token := passwordreset.NewToken("test", time.Minute, uv.CodeHashBytes(), []byte("login-link"))
+	w = tc.get("/login/link?token=" + token + "&service=" + url.QueryEscape(service))
+	assert.Contains(t, w.Body.String(), token, "continue form")
+
+	res = tc.post("/api/login/link/finish", url.Values{"token": {"x" + token}})
+	if e, ok := res["error"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, "token", e["field"])
+	}
+	res = tc.post("/api/login/link/finish", url.Values{"token": {token}, "service": {service}})
+	assert.Equal(t, true, res["ok"])
+	assert.True(t, strings.HasPrefix(res["referer"].(string), service+"?ticket=ST-"))
+	res = tc.do(httptest.NewRequest("GET", "https://example.com/api/me", nil))
+	assert.Equal(t, float64(0), res["status"])
+
+	res = newTestClient(s).post("/api/login/link/finish", url.Values{"token": {token}})
+	assert.Equal(t, false, res["ok"], "used once")
+}
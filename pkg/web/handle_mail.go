@@ -0,0 +1,113 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/backends/mail"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/mailq"
+	"github.com/liut/staffio/pkg/models/prefs"
+)
+
+// mailPreview renders a mail template with sample data for keepers,
+// part=html replies the html part only, for the frame of the page
+func (s *server) mailPreview(c *gin.Context) {
+	name, lang := c.Query("name"), c.Query("lang")
+	if name == "" {
+		name = mail.Names[0]
+	}
+	if lang == "" {
+		lang = mail.DefaultLang()
+	}
+	m, err := mail.Render(name, lang, mail.Sample(name))
+	if err != nil {
+		logger().Infow("render mail fail", "name", name, "lang", lang, "err", err)
+	}
+	if c.Query("part") == "html" {
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src *")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(m.HTML))
+		return
+	}
+	if IsAjax(c.Request) {
+		if err != nil {
+			apiError(c, ERROR_PARAM, err)
+			return
+		}
+		apiOk(c, m, 0)
+		return
+	}
+	s.Render(c, "dust_mail.html", map[string]interface{}{
+		"ctx":   c,
+		"names": mail.Names,
+		"langs": prefs.Langs,
+		"name":  name,
+		"lang":  lang,
+		"mail":  m,
+		"err":   err,
+	})
+}
+
+// mailQueue lists the queued mails for keepers, bodies are not shown, they may have links to sign in
+func (s *server) mailQueue(c *gin.Context) {
+	spec := new(mailq.Spec)
+	if err := c.Bind(spec); err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	data, err := s.service.MailQueue().Query(spec)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if isAPI(c) {
+		apiOk(c, data, spec.Total)
+		return
+	}
+	var pages []int
+	for i := 1; i <= (spec.Total+spec.Limit-1)/spec.Limit; i++ {
+		pages = append(pages, i)
+	}
+	s.Render(c, "dust_mail_queue.html", map[string]interface{}{
+		"ctx":      c,
+		"mails":    data,
+		"spec":     spec,
+		"pages":    pages,
+		"statuses": mailq.Statuses,
+	})
+}
+
+// mailResend queues a mail again, with attempts cleared
+func (s *server) mailResend(c *gin.Context) {
+	id, err := strconv.Atoi(c.Request.PostFormValue("id"))
+	if err != nil || id < 1 {
+		apiError(c, ERROR_PARAM, "invalid id")
+		return
+	}
+	m, err := s.service.MailQueue().Get(id)
+	if err == nil {
+		err = s.service.MailQueue().Resend(id)
+	}
+	if err == backends.ErrNotFound {
+		apiError(c, ERROR_PARAM, "mail not found")
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	backends.WakeMailWorker()
+	logger().Infow("mail resend", "id", id, "to", m.To, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActMailResend, "", m.UID, strconv.Itoa(id)+" "+m.Template)
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/backends/mail"
+	"github.com/liut/staffio/pkg/common"
+	"github.com/liut/staffio/pkg/models/mailq"
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/models/queue"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryMail(t *testing.T) {
+	root := settings.Current.Root
+	settings.Current.Root = "../../"
+	defer func() { settings.Current.Root = root }()
+	s := newMemoryServer()
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	w := tc.get("/profile")
+	assert.Contains(t, w.Body.String(), `name="lang"`)
+	profile := url.Values{"uid": {"test"}, "cn": {"Test"}, "gn": {"Test"}, "sn": {"Test"}, "nickname": {"tester"},
+		"email": {"test@example.net"}, "mobile": {"1"}, "password": {"test"}, "lang": {"zh_CN"}}
+	res = tc.post("/profile", profile)
+	assert.Equal(t, true, res["ok"])
+	p, err := s.service.Prefs().Get("test")
+	assert.NoError(t, err)
+	assert.Equal(t, prefs.LangZH, p.Lang)
+	defer s.service.Prefs().Save(&prefs.Prefs{UID: "test"})
+	w = tc.get("/dust/mail")
+	assert.NotEqual(t, http.StatusOK, w.Code, "keepers only")
+
+	kc := newTestClient(s)
+	res = kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	w = kc.get("/dust/mail?name=reset&lang=zh-CN")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "重置密码")
+	w = kc.get("/dust/mail?name=login_link&lang=en&part=html")
+	assert.Contains(t, w.Body.String(), "/login/link?token=sample")
+	assert.NotEmpty(t, w.Header().Get("Content-Security-Policy"))
+	w = kc.get("/dust/mail?name=nope")
+	assert.Contains(t, w.Body.String(), "unknown mail template")
+}
+
+func TestMemoryMailQueue(t *testing.T) {
+	cfg := *settings.Current
+	settings.Current.Root = "../../"
+	settings.Current.MailEnabled = true
+	settings.Current.MailHost = "127.0.0.1"
+	settings.Current.MailPort = 1 // refused at once
+	defer func() { *settings.Current = cfg }()
+	s := newMemoryServer()
+
+	err := s.service.PasswordForgot(common.AtEmail, "test@example.net", "test")
+	assert.NoError(t, err, "queued, not sent in the request")
+	list, err := s.service.MailQueue().Query(&mailq.Spec{To: "test@example.net", Status: mailq.StatusPending})
+	assert.NoError(t, err)
+	if !assert.Len(t, list, 1) {
+		return
+	}
+	id := list[0].ID
+	assert.Equal(t, mail.Reset, list[0].Template)
+	assert.Contains(t, list[0].Text, "/password/reset?rt=")
+
+	_, err = backends.SendQueuedMails(s.service)
+	assert.NoError(t, err)
+	m, err := s.service.MailQueue().Get(id)
+	assert.NoError(t, err)
+	assert.Equal(t, mailq.StatusPending, m.Status)
+	assert.Equal(t, 1, m.Attempts)
+	assert.NotEmpty(t, m.LastError)
+	assert.True(t, m.NextTry.After(time.Now()), "backoff")
+
+	m.Attempts = queue.MaxAttempts - 1
+	m.NextTry = time.Now().Add(-time.Second)
+	assert.NoError(t, s.service.MailQueue().Update(m))
+	_, err = backends.SendQueuedMails(s.service)
+	assert.NoError(t, err)
+	m, _ = s.service.MailQueue().Get(id)
+	assert.Equal(t, mailq.StatusDead, m.Status)
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	w := tc.get("/dust/mail/queue")
+	assert.NotEqual(t, http.StatusOK, w.Code, "keepers only")
+
+	kc := newTestClient(s)
+	res = kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	w = kc.get("/dust/mail/queue?status=dead")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "test@example.net")
+	assert.NotContains(t, w.Body.String(), "rt=", "no bodies for keepers")
+	assert.NoError(t, s.service.MailQueue().Enqueue(&mailq.Message{Template: mail.Reset, To: "test@example.net"}))
+	w = kc.get("/dust/mail/queue?to=test@example.net&limit=1&page=2")
+	assert.Contains(t, w.Body.String(), `<li class="active"><a href="#" data-page="2">`, "the current page")
+	res = kc.post("/dust/mail/resend", url.Values{"id": {strconv.Itoa(id)}})
+	assert.Equal(t, true, res["ok"])
+	m, _ = s.service.MailQueue().Get(id)
+	assert.Equal(t, mailq.StatusPending, m.Status)
+	assert.Equal(t, 0, m.Attempts)
+	res = kc.post("/dust/mail/resend", url.Values{"id": {"99999"}})
+	assert.NotEqual(t, true, res["ok"])
+}
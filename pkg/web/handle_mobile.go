@@ -0,0 +1,56 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+)
+
+// mobileSend sends a code to the new mobile of the user
+func (s *server) mobileSend(c *gin.Context) {
+	user := UserWithContext(c)
+	mobile := c.Request.PostFormValue("mobile")
+	if mobile == "" {
+		apiError(c, ERROR_PARAM, "mobile is empty")
+		return
+	}
+	res := make(osin.ResponseData)
+	if err := s.service.MobileVerifySend(user.UID, mobile); err != nil {
+		res["ok"] = false
+		res["error"] = map[string]string{"message": err.Error(), "field": "mobile"}
+		res["status"] = ERROR_LIMIT
+		if err != backends.ErrCodeTooSoon {
+			res["status"] = ERROR_INTERNAL
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
+
+// mobileVerify saves the new mobile with the code sent to it
+func (s *server) mobileVerify(c *gin.Context) {
+	user := UserWithContext(c)
+	res := make(osin.ResponseData)
+	mobile, err := s.service.MobileVerifyConfirm(user.UID, c.Request.PostFormValue("code"))
+	if err == backends.ErrInvalidCode || err == backends.ErrCodeExhausted {
+		res["ok"] = false
+		res["error"] = map[string]string{"message": err.Error(), "field": "code"}
+		res["status"] = ERROR_PARAM
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	s.audit(c, audit.ActMobileVerify, user.UID, user.UID, mobile)
+	res["ok"] = true
+	res["mobile"] = mobile
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemorySMS(t *testing.T) {
+	name := filepath.Join(os.TempDir(), "staffio-test-sms.log")
+	os.Remove(name)
+	defer os.Remove(name)
+	sender := settings.Current.SMSSender
+	settings.Current.SMSSender = "file://" + name
+	defer func() { settings.Current.SMSSender = sender }()
+	lastCode := func() string {
+		b, _ := ioutil.ReadFile(name)
+		m := regexp.MustCompile(`(\d{6}) is your code`).FindAllStringSubmatch(string(b), -1)
+		if len(m) == 0 {
+			return ""
+		}
+		return m[len(m)-1][1]
+	}
+
+	s := newMemoryServer()
+	defer func() {
+		for _, key := range []string{throttle.RequestKey("eagle"), throttle.IPKey("192.0.2.1")} {
+			s.service.Throttle().Reset(key)
+		}
+	}()
+	tc := newTestClient(s)
+	forgot := url.Values{"via": {"sms"}, "username": {"eagle"}, "mobile": {"13800138000"}}
+	res := tc.post("/password/forgot", forgot)
+	assert.Equal(t, true, res["ok"])
+	code := lastCode()
+	assert.Len(t, code, 6)
+	res = tc.post("/password/forgot", forgot)
+	assert.Equal(t, true, res["ok"], "same reply")
+	assert.Equal(t, code, lastCode(), "one code a minute")
+	res = tc.post("/password/reset", url.Values{"username": {"nobody"}, "code": {code}, "password": {"Sms-reset-42"}, "password_confirm": {"Sms-reset-42"}})
+	if e, ok := res["error"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, backends.ErrInvalidCode.Error(), e["message"], "same as a wrong code")
+	}
+
+	reset := url.Values{"username": {"eagle"}, "code": {"x"}, "password": {"Sms-reset-42"}, "password_confirm": {"Sms-reset-42"}}
+	res = tc.post("/password/reset", reset)
+	assert.Equal(t, float64(ERROR_PARAM), res["status"])
+	reset.Set("code", code)
+	res = tc.post("/password/reset", reset)
+	assert.Equal(t, true, res["ok"])
+	res = tc.post("/password/reset", reset)
+	assert.NotEqual(t, true, res["ok"], "used once")
+	res = tc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"Sms-reset-42"}})
+	assert.Equal(t, true, res["ok"])
+
+	// a new mobile of eagle, wrong codes exhaust it
+	res = tc.post("/api/mobile", url.Values{"mobile": {"13700137000"}})
+	assert.Equal(t, true, res["ok"])
+	for i := 0; i < models.VerifyMaxAttempts; i++ {
+		res = tc.post("/api/mobile/verify", url.Values{"code": {"x"}})
+		assert.Equal(t, float64(ERROR_PARAM), res["status"])
+	}
+	res = tc.post("/api/mobile/verify", url.Values{"code": {lastCode()}})
+	if e, ok := res["error"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, backends.ErrCodeExhausted.Error(), e["message"])
+	}
+	staff, err := s.service.Get("eagle")
+	assert.NoError(t, err)
+	assert.Equal(t, "13800138000", staff.Mobile)
+
+	// a new mobile of test, saved after verified
+	uc := newTestClient(s)
+	res = uc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	res = uc.post("/api/mobile", url.Values{"mobile": {"13600136000"}})
+	assert.Equal(t, true, res["ok"])
+	res = uc.post("/api/mobile/verify", url.Values{"code": {lastCode()}})
+	assert.Equal(t, "13600136000", res["mobile"])
+	staff, err = s.service.Get("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "13600136000", staff.Mobile)
+
+	staff.Mobile = "13900139000"
+	_, err = s.service.Save(staff)
+	assert.NoError(t, err)
+	history := settings.Current.PasswordHistory
+	settings.Current.PasswordHistory = 0
+	defer func() { settings.Current.PasswordHistory = history }()
+	assert.NoError(t, s.service.PasswordReset("eagle", "demo1234"))
+}
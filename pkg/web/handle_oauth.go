@@ -7,11 +7,15 @@ import (
 	"github.com/openshift/osin"
 
 	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
 	"github.com/liut/staffio/pkg/models/oauth"
 )
 
 // Authorization code endpoint
 func (s *server) oauth2Authorize(c *gin.Context) {
+	if s.forbidImpersonated(c) {
+		return
+	}
 	resp := s.osvr.NewResponse()
 	defer resp.Close()
 
@@ -46,6 +50,7 @@ func (s *server) oauth2Authorize(c *gin.Context) {
 				ar.UserData = user.UID
 				ar.Authorized = true
 				s.osvr.FinishAuthorizeRequest(resp, r, ar)
+				s.audit(c, audit.ActOAuthConsent, user.UID, ar.Client.GetId(), ar.Scope)
 				if r.PostForm.Get("remember") != "" {
 					err := store.SaveAuthorized(ar.Client.GetId(), user.UID)
 					if err != nil {
@@ -102,8 +107,26 @@ func (s *server) oauth2Token(c *gin.Context) {
 			ar.Authorized = true
 		case osin.PASSWORD:
 			var staff *models.Staff
-			if staff, err = s.service.Authenticate(ar.Username, ar.Password); err != nil {
-				resp.SetError("authentication_failed", err.Error())
+			if staff, err = s.authenticate(c, ar.Username, ar.Password); err != nil {
+				if _, ok := err.(errThrottled); ok {
+					resp.SetError("slow_down", err.Error())
+				} else {
+					resp.SetError("authentication_failed", "invalid username or password")
+				}
+				break
+			}
+			// the throttle is checked by authenticate, failures of code are counted like passwords
+			if err = s.totpVerify(staff.UID, r.FormValue("otp")); err != nil {
+				if err == errTOTPInvalid {
+					s.throttleFail(throttleKeys(c, staff.UID)...)
+					s.audit(c, audit.ActLoginFail, staff.UID, "", c.Request.URL.Path+" otp")
+				}
+				resp.SetError("mfa_required", err.Error())
+				break
+			}
+			s.passThrottle(staff.UID)
+			if s.passwordExpired(staff.UID) {
+				resp.SetError("password_expired", "password expired, change it on the web first")
 				break
 			}
 			ar.Authorized = true
@@ -120,6 +143,10 @@ func (s *server) oauth2Token(c *gin.Context) {
 			}
 		}
 		s.osvr.FinishAccessRequest(resp, r, ar)
+		if !resp.IsError {
+			actor, _ := ar.UserData.(string)
+			s.audit(c, audit.ActOAuthToken, actor, ar.Client.GetId(), string(ar.Type))
+		}
 	}
 
 	if resp.IsError && resp.InternalError != nil {
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/pwdpolicy"
+)
+
+const (
+	kPasswordExpired = "password_expired" // login waiting for a new password
+
+	passwordExpiredLife = 10 * time.Minute
+)
+
+var errPasswordConfirm = errors.New("the two passwords are different")
+
+// passwordReplyError replies err of a new password in field, violations of the policy are listed
+func passwordReplyError(c *gin.Context, err error, field string, status int) {
+	res := make(osin.ResponseData)
+	res["ok"] = false
+	if pe, ok := err.(*pwdpolicy.Error); ok {
+		res["error"] = map[string]interface{}{"message": pe.Error(), "field": field, "violations": pe.Violations}
+		res["status"] = ERROR_PARAM
+	} else {
+		res["error"] = map[string]string{"message": err.Error(), "field": field}
+		res["status"] = status
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// passwordExpired returns true if the password of uid is older than the max age
+func (s *server) passwordExpired(uid string) bool {
+	p := backends.PasswordPolicy()
+	if p.MaxAge <= 0 {
+		return false
+	}
+	return p.Expired(backends.PasswordChangedAt(s.service, uid, ""), time.Now())
+}
+
+// expiredLogin is a login passed all factors, waiting for a new password
+type expiredLogin struct {
+	UID     string `json:"uid"`
+	Service string `json:"service,omitempty"`
+	Referer string `json:"referer,omitempty"`
+	Expires int64  `json:"expires"`
+}
+
+func loadExpiredLogin(c *gin.Context) *expiredLogin {
+	v, ok := ginSession(c).Get(kPasswordExpired).(string)
+	if !ok {
+		return nil
+	}
+	el := new(expiredLogin)
+	if err := json.Unmarshal([]byte(v), el); err != nil || el.Expires < time.Now().Unix() {
+		return nil
+	}
+	return el
+}
+
+// passwordPending holds the login if the password expired, it replies res when true
+func (s *server) passwordPending(c *gin.Context, res osin.ResponseData, uid, service, referer string) bool {
+	if !s.passwordExpired(uid) {
+		return false
+	}
+	b, _ := json.Marshal(&expiredLogin{
+		UID:     uid,
+		Service: service,
+		Referer: referer,
+		Expires: time.Now().Add(passwordExpiredLife).Unix(),
+	})
+	sess := ginSession(c)
+	sess.Set(kPasswordExpired, string(b))
+	SessionSave(sess, c.Writer)
+	logger().Infow("password expired", "uid", uid)
+	res["ok"] = true
+	res["expired"] = true
+	res["referer"] = UrlFor("password/expired")
+	res["status"] = 0
+	c.JSON(http.StatusOK, res)
+	return true
+}
+
+func (s *server) passwordExpiredForm(c *gin.Context) {
+	el := loadExpiredLogin(c)
+	if el == nil {
+		c.Redirect(302, UrlFor("login"))
+		return
+	}
+	s.Render(c, "password_expired.html", map[string]interface{}{
+		"ctx":    c,
+		"uid":    el.UID,
+		"policy": backends.PasswordPolicy(),
+	})
+}
+
+func (s *server) passwordExpiredPost(c *gin.Context) {
+	el := loadExpiredLogin(c)
+	if el == nil {
+		apiError(c, ERROR_PARAM, "login first")
+		return
+	}
+	req := c.Request
+	password := req.PostFormValue("new_password")
+	if password != req.PostFormValue("password_confirm") {
+		passwordReplyError(c, errPasswordConfirm, "password_confirm", ERROR_PARAM)
+		return
+	}
+	if err := s.service.PasswordReset(el.UID, password); err != nil {
+		passwordReplyError(c, err, "new_password", ERROR_DB)
+		return
+	}
+	logger().Infow("expired password changed", "uid", el.UID)
+	s.audit(c, audit.ActPasswordChange, el.UID, el.UID, "expired")
+	staff, err := s.service.Get(el.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	sess := ginSession(c)
+	sess.Set(kPasswordExpired, nil)
+	SessionSave(sess, c.Writer)
+	s.signinReply(c, make(osin.ResponseData), staff, el.Service, el.Referer)
+}
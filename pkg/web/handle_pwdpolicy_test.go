@@ -0,0 +1,84 @@
+package web
+
+import (
+	"crypto/sha1"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/pwned"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryPasswordPolicy(t *testing.T) {
+	s := newMemoryServer()
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+
+	res = tc.post("/api/password", url.Values{"old_password": {"demo1234"}, "new_password": {"eagle1"}, "password_confirm": {"eagle1"}})
+	assert.Equal(t, float64(ERROR_PARAM), res["status"])
+	if e, ok := res["error"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, "new_password", e["field"])
+		assert.Len(t, e["violations"], 2, "length and personal")
+	}
+
+	res = tc.post("/api/password", url.Values{"old_password": {"demo1234"}, "new_password": {"Blue-sky-42"}, "password_confirm": {"Blue-sky-42"}})
+	assert.Equal(t, true, res["ok"])
+	res = tc.post("/api/password", url.Values{"old_password": {"Blue-sky-42"}, "new_password": {"demo1234"}, "password_confirm": {"demo1234"}})
+	assert.Equal(t, float64(ERROR_PARAM), res["status"], "reused")
+
+	maxAge := settings.Current.PasswordMaxAge
+	settings.Current.PasswordMaxAge = time.Nanosecond
+	defer func() { settings.Current.PasswordMaxAge = maxAge }()
+
+	ec := newTestClient(s)
+	res = ec.post("/api/login", url.Values{"username": {"eagle"}, "password": {"Blue-sky-42"}})
+	assert.Equal(t, true, res["expired"])
+	res = ec.post("/api/password/expired", url.Values{"new_password": {"Green-sea-7"}, "password_confirm": {"Green-sea"}})
+	assert.Equal(t, float64(ERROR_PARAM), res["status"])
+	settings.Current.PasswordMaxAge = time.Hour
+	res = ec.post("/api/password/expired", url.Values{"new_password": {"Green-sea-7"}, "password_confirm": {"Green-sea-7"}})
+	assert.Equal(t, true, res["ok"])
+	assert.Nil(t, res["expired"])
+	res = ec.post("/api/password/expired", url.Values{"new_password": {"Green-sea-8"}, "password_confirm": {"Green-sea-8"}})
+	assert.NotEqual(t, true, res["ok"], "taken once")
+
+	// the server is shared by tests, restore the password without history
+	history := settings.Current.PasswordHistory
+	settings.Current.PasswordHistory = 0
+	defer func() { settings.Current.PasswordHistory = history }()
+	res = ec.post("/api/password", url.Values{"old_password": {"Green-sea-7"}, "new_password": {"demo1234"}, "password_confirm": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+}
+
+func TestMemoryPwned(t *testing.T) {
+	f := pwned.New(10, 0.001)
+	f.Add(sha1.Sum([]byte("Blue-sky-42")))
+	name := filepath.Join(os.TempDir(), "staffio-test.pwned")
+	assert.NoError(t, f.Save(name))
+	defer os.Remove(name)
+	settings.Current.PasswordPwnedFile = name
+	defer func() { settings.Current.PasswordPwnedFile = "" }()
+
+	s := newMemoryServer()
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = tc.post("/api/password", url.Values{"old_password": {"demo1234"}, "new_password": {"Blue-sky-42"}, "password_confirm": {"Blue-sky-42"}})
+	if e, ok := res["error"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Contains(t, e["message"], "breach")
+	}
+	res = tc.post("/api/password", url.Values{"old_password": {"demo1234"}, "new_password": {"Blue-sky-43"}, "password_confirm": {"Blue-sky-43"}})
+	assert.Equal(t, true, res["ok"])
+
+	history := settings.Current.PasswordHistory
+	settings.Current.PasswordHistory = 0
+	defer func() { settings.Current.PasswordHistory = history }()
+	res = tc.post("/api/password", url.Values{"old_password": {"Blue-sky-43"}, "new_password": {"demo1234"}, "password_confirm": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+}
@@ -0,0 +1,261 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/group"
+	"github.com/liut/staffio/pkg/models/saml"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+const (
+	cKeySAMLRequest = "samlReq"
+	cKeySAMLRelay   = "samlRelay"
+)
+
+func newSAMLIdP() *saml.IdentityProvider {
+	if settings.Current.SAMLCertFile == "" || settings.Current.SAMLKeyFile == "" {
+		return nil
+	}
+	prefix := strings.TrimRight(settings.Current.BaseURL, "/")
+	idp, err := saml.NewIdentityProvider(prefix+UrlFor("saml/metadata"), prefix+UrlFor("saml/sso"),
+		settings.Current.SAMLCertFile, settings.Current.SAMLKeyFile)
+	if err != nil {
+		logger().Warnw("load saml key pair fail", "err", err)
+		return nil
+	}
+	return idp
+}
+
+func (s *server) samlReady(c *gin.Context) bool {
+	if s.samlIdP == nil {
+		logger().Infow("saml idp is not configured")
+		c.AbortWithStatus(http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func (s *server) samlMetadata(c *gin.Context) {
+	if !s.samlReady(c) {
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", s.samlIdP.Metadata())
+}
+
+// samlSSO accept AuthnRequest with HTTP-Redirect or HTTP-POST binding
+func (s *server) samlSSO(c *gin.Context) {
+	if !s.samlReady(c) {
+		return
+	}
+	var (
+		value, relay string
+		deflated     bool
+	)
+	if c.Request.Method == "GET" {
+		value, relay, deflated = c.Query("SAMLRequest"), c.Query("RelayState"), true
+	} else {
+		value, relay = c.PostForm("SAMLRequest"), c.PostForm("RelayState")
+	}
+	data, err := saml.DecodeRequest(value, deflated)
+	if err != nil {
+		logger().Infow("decode SAMLRequest fail", "err", err)
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := s.userFromRequest(c)
+	if err != nil {
+		// keep the request until signed in
+		sess := ginSession(c)
+		sess.Set(cKeySAMLRequest, string(data))
+		sess.Set(cKeySAMLRelay, relay)
+		SessionSave(sess, c.Writer)
+		c.SetCookie(kReferer, UrlFor("saml/resume"), 60, "/", "", false, true)
+		c.Redirect(http.StatusFound, UrlFor("login"))
+		return
+	}
+
+	s.samlRespond(c, user, data, relay)
+}
+
+// samlResume continue the pending AuthnRequest after login
+func (s *server) samlResume(c *gin.Context) {
+	if !s.samlReady(c) {
+		return
+	}
+	sess := ginSession(c)
+	data, ok := sess.Get(cKeySAMLRequest).(string)
+	if !ok || data == "" {
+		c.Redirect(http.StatusFound, base)
+		return
+	}
+	relay, _ := sess.Get(cKeySAMLRelay).(string)
+	sess.Set(cKeySAMLRequest, nil)
+	sess.Set(cKeySAMLRelay, nil)
+	SessionSave(sess, c.Writer)
+
+	s.samlRespond(c, UserWithContext(c), []byte(data), relay)
+}
+
+func (s *server) samlRespond(c *gin.Context, user *User, data []byte, relay string) {
+	if s.forbidImpersonated(c) {
+		return
+	}
+	req, err := saml.ParseRequest(data)
+	if err != nil {
+		logger().Infow("parse AuthnRequest fail", "err", err)
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	sp, err := s.service.SAML().Get(req.Issuer)
+	if err != nil {
+		logger().Infow("unknown service provider", "issuer", req.Issuer, "err", err)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	acsURL := sp.ACSURL
+	if req.ACSURL != "" {
+		if !sp.AllowACS(req.ACSURL) {
+			logger().Infow("invalid acs url", "issuer", req.Issuer, "acs", req.ACSURL)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		acsURL = req.ACSURL
+	}
+
+	staff, err := s.service.Get(user.UID)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	format := sp.NameIDFormat
+	if req.NameIDPolicy != nil && req.NameIDPolicy.Format != "" {
+		format = req.NameIDPolicy.Format
+	}
+	sub := s.samlSubject(staff, format)
+	sub.SessionIndex = ginSession(c).ID()
+
+	resp, err := s.samlIdP.NewResponse(req, acsURL, sub)
+	if err != nil {
+		logger().Warnw("build saml response fail", "issuer", req.Issuer, "err", err)
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	logger().Infow("saml response", "uid", staff.UID, "sp", sp.EntityID, "acs", acsURL)
+
+	s.Render(c, "saml_post.html", map[string]interface{}{
+		"ctx":          c,
+		"acsURL":       acsURL,
+		"samlResponse": resp,
+		"relayState":   relay,
+	})
+}
+
+// samlSubject release attributes of staff and groups
+func (s *server) samlSubject(staff *models.Staff, format string) *saml.Subject {
+	sub := &saml.Subject{NameID: staff.UID, NameIDFormat: format}
+	switch format {
+	case saml.NameIDFormatEmailAddress:
+		if staff.Email != "" {
+			sub.NameID = staff.Email
+		} else {
+			sub.NameIDFormat = saml.NameIDFormatUnspecified
+		}
+	case saml.NameIDFormatPersistent:
+	default:
+		sub.NameIDFormat = saml.NameIDFormatUnspecified
+	}
+
+	add := func(name, value string) {
+		if value != "" {
+			sub.Attributes = append(sub.Attributes, saml.Attribute{Name: name, Values: []string{value}})
+		}
+	}
+	add("uid", staff.UID)
+	add("cn", staff.GetCommonName())
+	add("displayName", staff.GetName())
+	add("givenName", staff.GivenName)
+	add("sn", staff.Surname)
+	add("mail", staff.Email)
+	add("mobile", staff.Mobile)
+	add("title", staff.EmployeeType)
+
+	var groups []string
+	if data, err := s.service.AllGroup(); err == nil {
+		get := group.Map(data)
+		for _, g := range data {
+			if group.Has(g.Name, staff.UID, get) {
+				groups = append(groups, g.Name)
+			}
+		}
+	}
+	if len(groups) > 0 {
+		sub.Attributes = append(sub.Attributes, saml.Attribute{Name: "groups", Values: groups})
+	}
+	return sub
+}
+
+func (s *server) samlProvidersGet(c *gin.Context) {
+	data, err := s.service.SAML().All()
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	if IsAjax(c.Request) {
+		apiOk(c, data, len(data))
+		return
+	}
+	var metadataURI string
+	if s.samlIdP != nil {
+		metadataURI = s.samlIdP.EntityID
+	}
+	s.Render(c, "saml_providers.html", map[string]interface{}{
+		"ctx":       c,
+		"providers": data,
+		"metadata":  metadataURI,
+	})
+}
+
+func (s *server) samlProvidersPost(c *gin.Context) {
+	res := make(osin.ResponseData)
+	req := c.Request
+
+	if req.PostFormValue("op") == "delete" {
+		if err := s.service.SAML().Delete(req.PostFormValue("entity_id")); err != nil {
+			apiError(c, ERROR_DB, err)
+			return
+		}
+		s.audit(c, audit.ActSAMLSave, "", req.PostFormValue("entity_id"), "delete")
+		res["ok"] = true
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	sp, err := saml.ParseMetadata([]byte(req.PostFormValue("metadata")))
+	if err != nil {
+		res["ok"] = false
+		res["error"] = map[string]string{"message": err.Error(), "field": "metadata"}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	sp.Name = req.PostFormValue("name")
+	if sp.Name == "" {
+		sp.Name = sp.EntityID
+	}
+	if err = s.service.SAML().Store(sp); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("saml service provider saved", "entityID", sp.EntityID, "acs", sp.ACSURL)
+	s.audit(c, audit.ActSAMLSave, "", sp.EntityID, "store")
+	res["ok"] = true
+	res["id"] = sp.ID
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/sessions"
+)
+
+// keeper lists the latest sessions of all without uid
+const sessionsActiveMax = 200
+
+// sessionView is a session with its device, current is the session of the request
+type sessionView struct {
+	sessions.Session
+	Device  string `json:"device"`
+	Current bool   `json:"current,omitempty"`
+}
+
+func (s *server) sessionViews(c *gin.Context, data []sessions.Session) []sessionView {
+	var current string
+	if ls, err := s.loginSession(c); err == nil {
+		current = ls.ID
+	}
+	views := make([]sessionView, len(data))
+	for i := range data {
+		views[i] = sessionView{Session: data[i], Device: data[i].Device(), Current: data[i].ID == current}
+	}
+	return views
+}
+
+func isAPI(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/api/") || IsAjax(c.Request)
+}
+
+// sessionsForm lists sessions of the user
+func (s *server) sessionsForm(c *gin.Context) {
+	user := UserWithContext(c)
+	data, err := s.service.Sessions().All(user.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	views := s.sessionViews(c, data)
+	if isAPI(c) {
+		apiOk(c, views, len(views))
+		return
+	}
+	s.Render(c, "sessions.html", map[string]interface{}{
+		"ctx":      c,
+		"sessions": views,
+	})
+}
+
+// sessionDelete terminates a session of the user by id, or all others with others=1
+func (s *server) sessionDelete(c *gin.Context) {
+	user := UserWithContext(c)
+	req := c.Request
+	current, _ := s.loginSession(c)
+	if req.PostFormValue("others") != "" {
+		data, err := s.service.Sessions().All(user.UID)
+		if err != nil {
+			apiError(c, ERROR_DB, err)
+			return
+		}
+		for _, ls := range data {
+			if current != nil && ls.ID == current.ID {
+				continue
+			}
+			if err = s.service.Sessions().Delete(user.UID, ls.ID); err != nil {
+				apiError(c, ERROR_DB, err)
+				return
+			}
+		}
+		s.audit(c, audit.ActSessionEnd, user.UID, user.UID, "others")
+	} else {
+		id := req.PostFormValue("id")
+		if err := s.service.Sessions().Delete(user.UID, id); err != nil {
+			if err == backends.ErrNotFound {
+				apiError(c, ERROR_PARAM, "session not found")
+			} else {
+				apiError(c, ERROR_DB, err)
+			}
+			return
+		}
+		s.audit(c, audit.ActSessionEnd, user.UID, user.UID, id)
+		if current != nil && id == current.ID {
+			s.signout(c)
+		}
+	}
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
+
+// sessionsAdmin lists sessions of uid, or the latest of all
+func (s *server) sessionsAdmin(c *gin.Context) {
+	uid := c.Query("uid")
+	var (
+		data []sessions.Session
+		err  error
+	)
+	if uid != "" {
+		data, err = s.service.Sessions().All(uid)
+	} else {
+		data, err = s.service.Sessions().Active(sessionsActiveMax)
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	views := s.sessionViews(c, data)
+	if isAPI(c) {
+		apiOk(c, views, len(views))
+		return
+	}
+	s.Render(c, "dust_sessions.html", map[string]interface{}{
+		"ctx":      c,
+		"uid":      uid,
+		"sessions": views,
+	})
+}
+
+// sessionsAdminPost terminates a session of anyone by uid and id, or all of uid with all=1
+func (s *server) sessionsAdminPost(c *gin.Context) {
+	req := c.Request
+	uid, id := req.PostFormValue("uid"), req.PostFormValue("id")
+	if uid == "" {
+		apiError(c, ERROR_PARAM, "uid is empty")
+		return
+	}
+	var err error
+	if req.PostFormValue("all") != "" {
+		id = "all"
+		err = s.service.Sessions().Clear(uid)
+	} else {
+		err = s.service.Sessions().Delete(uid, id)
+	}
+	if err == backends.ErrNotFound {
+		apiError(c, ERROR_PARAM, "session not found")
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("session terminated", "uid", uid, "id", id, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActSessionEnd, "", uid, id)
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/audit"
+)
+
+func TestMemorySessions(t *testing.T) {
+	s := newMemoryServer()
+	assert.NoError(t, s.service.Sessions().Clear("test"))
+
+	a, b := newTestClient(s), newTestClient(s)
+	for _, tc := range []*testClient{a, b} {
+		res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+		assert.Equal(t, true, res["ok"])
+	}
+
+	var list struct {
+		Data []sessionView `json:"data"`
+	}
+	w := a.get("/api/sessions")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if !assert.Len(t, list.Data, 2) {
+		return
+	}
+	var other string
+	for _, v := range list.Data {
+		assert.Equal(t, "192.0.2.1", v.IP)
+		if !v.Current {
+			other = v.ID
+		}
+	}
+	assert.NotEmpty(t, other)
+
+	res := a.post("/api/sessions/delete", url.Values{"id": {other}})
+	assert.Equal(t, true, res["ok"])
+	res = a.post("/api/sessions/delete", url.Values{"id": {other}})
+	assert.Equal(t, float64(ERROR_PARAM), res["status"], "gone")
+	w = b.get("/api/sessions")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "terminated remotely")
+	res = b.do(httptest.NewRequest("GET", "https://example.com/api/me", nil))
+	assert.Equal(t, float64(1), res["status"])
+	res = a.do(httptest.NewRequest("GET", "https://example.com/api/me", nil))
+	assert.Equal(t, float64(0), res["status"])
+
+	kc := newTestClient(s)
+	res = kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	req := httptest.NewRequest("GET", "https://example.com/dust/sessions?uid=test", nil)
+	req.Header.Set("Accept", "application/json")
+	w = kc.serve(req)
+	list.Data = nil
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
+	res = kc.post("/dust/sessions", url.Values{"uid": {"test"}, "all": {"1"}})
+	assert.Equal(t, true, res["ok"])
+	assert.Equal(t, http.StatusUnauthorized, a.get("/api/sessions").Code, "cleared by keeper")
+
+	var events struct {
+		Data []audit.Event `json:"data"`
+	}
+	w = kc.get("/api/audit?action=session.terminate&target=test")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	if assert.True(t, len(events.Data) >= 2, "newer first, others may be of other tests") {
+		assert.Equal(t, "eagle", events.Data[0].Actor)
+		assert.Equal(t, "all", events.Data[0].Detail)
+		assert.Equal(t, "test", events.Data[1].Actor)
+		assert.Equal(t, other, events.Data[1].Detail)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/liut/keeper"
+
+	"github.com/liut/staffio/pkg/backends"
 )
 
 func (s *server) handleStatus(c *gin.Context) {
@@ -26,6 +28,8 @@ func (s *server) handleStatus(c *gin.Context) {
 }
 
 func (s *server) handleServiceStats(c *gin.Context) {
-	stats := s.service.PoolStats()
-	c.JSON(200, stats)
+	c.JSON(200, struct {
+		*backends.PoolStats
+		Cache *backends.CacheStats `json:"cache,omitempty"`
+	}{s.service.PoolStats(), s.service.CacheStats()})
 }
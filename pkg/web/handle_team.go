@@ -2,9 +2,11 @@ package web
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/liut/staffio/pkg/models/audit"
 	"github.com/liut/staffio/pkg/models/team"
 )
 
@@ -57,6 +59,7 @@ func (s *server) teamAdd(c *gin.Context) {
 		apiError(c, ERROR_DB, err)
 		return
 	}
+	s.audit(c, audit.ActTeamUpdate, "", strconv.Itoa(team.ID), "add "+team.Name)
 	apiOk(c, true, 0)
 }
 
@@ -71,9 +74,17 @@ func (s *server) teamDelete(c *gin.Context) {
 		apiError(c, ERROR_DB, err)
 		return
 	}
+	s.audit(c, audit.ActTeamUpdate, "", strconv.Itoa(param.ID), "delete")
 	apiOk(c, true, 0)
 }
 
+func teamOpName(op team.TeamOpType) string {
+	if op == team.TeamOpRemove {
+		return "remove"
+	}
+	return "add"
+}
+
 func (s *server) teamMemberOp(c *gin.Context) {
 	var param team.TeamOpParam
 	if err := c.Bind(&param); err != nil {
@@ -95,6 +106,7 @@ func (s *server) teamMemberOp(c *gin.Context) {
 		apiError(c, ERROR_PARAM, "unknown operate")
 		return
 	}
+	s.audit(c, audit.ActTeamUpdate, "", strconv.Itoa(param.TeamID), teamOpName(param.Op)+" members "+strings.Join(param.UIDs, ","))
 	apiOk(c, true, 0)
 }
 
@@ -119,6 +131,7 @@ func (s *server) teamManagerOp(c *gin.Context) {
 		apiError(c, ERROR_PARAM, "unknown operate")
 		return
 	}
+	s.audit(c, audit.ActTeamUpdate, "", strconv.Itoa(param.TeamID), teamOpName(param.Op)+" manager "+param.UIDs[0])
 	apiOk(c, true, 0)
 }
 
@@ -2,6 +2,7 @@ package web
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strings"
 
@@ -9,7 +10,9 @@ import (
 
 	"github.com/fhyx/lark-api-go/lark"
 
+	"github.com/liut/staffio/pkg/backends/larksync"
 	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
 	"github.com/liut/staffio/pkg/models/random"
 	"github.com/liut/staffio/pkg/settings"
 )
@@ -19,8 +22,6 @@ const (
 	cKeyStateLk = "lkState"
 )
 
-var larkDecr = lark.NewCrypto(settings.Current.LarkEncryptKey)
-
 func inAPPLark(req *http.Request) bool {
 	return strings.Contains(req.UserAgent(), "Lark/")
 }
@@ -100,7 +101,14 @@ func (s *server) larkOAuth2Callback(c *gin.Context) {
 		return
 	}
 	logger().Infow("found ", "data", data)
-	signinStaffGin(c, &data[0])
+	if s.totpRedirect(c, data[0].UID) {
+		return
+	}
+	if err = s.signinStaffGin(c, &data[0]); err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	s.audit(c, audit.ActLogin, data[0].UID, "", "lark")
 	// OK
 	if c.Request.Method == "POST" {
 		apiOk(c, nil, 0)
@@ -119,33 +127,31 @@ const (
 	</html>`
 )
 
+// larkEventCallback verifies and decrypts events of lark, contact events are applied by larksync,
+// once for each event id
 func (s *server) larkEventCallback(c *gin.Context) {
-	var data lark.EncryptEntry
-	if err := c.Bind(&data); err != nil {
-		logger().Infow("bind fail", "err", err)
-		apiError(c, 400, err)
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
-	// logger().Infow("decrypt ok", "body", data.EncryptedBody)
-
-	decryptedText, err := larkDecr.DecryptString(data.EncryptedBody)
+	cb, err := larksync.Parse(c.Request.Header, body, settings.Current.LarkEncryptKey, settings.Current.LarkVerifyToken)
 	if err != nil {
-		logger().Infow("decrypt fail", "err", err)
-		apiError(c, 400, err)
+		logger().Infow("parse lark callback fail", "err", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	cr, err := lark.UnmarsalCallback(decryptedText)
-	if err != nil {
-		logger().Infow("unmarshal fail", "decryptedText", decryptedText, "err", err)
-		apiError(c, 400, err)
+	if cb.IsChallenge() {
+		c.JSON(http.StatusOK, lark.CallbackResp{Challenge: cb.Challenge})
 		return
 	}
+	logger().Infow("got lark event callback", "id", cb.EventID(), "type", cb.EventType())
 
-	if cr.Type == "url_verification" {
-		c.JSON(200, lark.CallbackResp{Challenge: cr.Challenge})
+	// failed events are kept for keepers to replay, lark retries only if the inbox is down
+	if _, err = larksync.Receive(s.service, cb); err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
 		return
 	}
-	logger().Infow("got lark event callback", "type", cr.Type)
-
+	c.JSON(http.StatusOK, gin.H{})
 }
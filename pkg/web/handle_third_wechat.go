@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/liut/staffio/pkg/models/audit"
 	"github.com/liut/staffio/pkg/models/random"
 	"github.com/liut/staffio/pkg/settings"
 )
@@ -102,7 +103,14 @@ func (s *server) wechatOAuth2Callback(c *gin.Context) {
 		c.AbortWithError(http.StatusServiceUnavailable, err)
 		return
 	}
-	signinStaffGin(c, staff)
+	if s.totpRedirect(c, staff.UID) {
+		return
+	}
+	if err = s.signinStaffGin(c, staff); err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	s.audit(c, audit.ActLogin, staff.UID, "", "wechat")
 	// OK
 	if c.Request.Method == "POST" {
 		apiOk(c, nil, 0)
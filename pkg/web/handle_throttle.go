@@ -0,0 +1,158 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+// errThrottled is returned before the password is checked
+type errThrottled time.Duration
+
+func (e errThrottled) Error() string {
+	secs := int((time.Duration(e) + time.Second - 1) / time.Second)
+	return fmt.Sprintf("Too many failed attempts, try again in %d seconds", secs)
+}
+
+func loginPolicy() throttle.Policy {
+	p := throttle.DefaultPolicy
+	if n := settings.Current.LoginMaxFailures; n > 0 {
+		p.MaxFailures = n
+	}
+	if n := settings.Current.LoginIPFailures; n > 0 {
+		p.IPFailures = n
+	}
+	if d := settings.Current.LoginLockFor; d > 0 {
+		p.LockFor = d
+	}
+	return p
+}
+
+func throttleKeys(c *gin.Context, uid string) []string {
+	return []string{throttle.AccountKey(uid), throttle.IPKey(c.ClientIP())}
+}
+
+// requestKeys are keys of requests which mail or text uid, apart from the account key of login
+func requestKeys(c *gin.Context, uid string) []string {
+	return []string{throttle.RequestKey(uid), throttle.IPKey(c.ClientIP())}
+}
+
+// throttleCheck returns errThrottled if any of keys must wait
+func (s *server) throttleCheck(keys ...string) error {
+	p, now := loginPolicy(), time.Now()
+	for _, key := range keys {
+		a, err := s.service.Throttle().Get(key)
+		if err != nil {
+			return err
+		}
+		if wait := p.Wait(a, now); wait > 0 {
+			return errThrottled(wait)
+		}
+	}
+	return nil
+}
+
+// throttleFail counts a failure of keys, locks them at the limit
+func (s *server) throttleFail(keys ...string) {
+	p := loginPolicy()
+	for _, key := range keys {
+		a, err := s.service.Throttle().Fail(key, p.Window)
+		if err != nil {
+			logger().Infow("throttle fail ERR", "key", key, "err", err)
+			continue
+		}
+		if a.Failures >= p.Limit(key) && !a.IsLocked(a.Last) {
+			until := a.Last.Add(p.LockFor)
+			if err = s.service.Throttle().Lock(key, until); err != nil {
+				logger().Infow("throttle lock ERR", "key", key, "err", err)
+				continue
+			}
+			logger().Infow("locked", "key", key, "failures", a.Failures, "until", until)
+		}
+	}
+}
+
+// authenticate checks the password with throttling of the account and the client address,
+// all paths calling Authenticate must use it, failures of the account are kept until
+// passThrottle after the second factor
+func (s *server) authenticate(c *gin.Context, uid, password string) (*models.Staff, error) {
+	keys := throttleKeys(c, uid)
+	if err := s.throttleCheck(keys...); err != nil {
+		s.audit(c, audit.ActLoginFail, uid, "", c.Request.URL.Path+" throttled")
+		return nil, err
+	}
+	staff, err := s.service.Authenticate(uid, password)
+	if err != nil {
+		s.throttleFail(keys...)
+		s.audit(c, audit.ActLoginFail, uid, "", c.Request.URL.Path)
+		return nil, err
+	}
+	return staff, nil
+}
+
+// passThrottle clears failures of the account when all factors passed,
+// addresses are kept, a valid login of one account does not clear failures of others
+func (s *server) passThrottle(uid string) {
+	if err := s.service.Throttle().Reset(throttle.AccountKey(uid)); err != nil {
+		logger().Infow("throttle reset ERR", "uid", uid, "err", err)
+	}
+}
+
+// authReplyError replies a failed authenticate to field, same for unknown accounts
+func authReplyError(c *gin.Context, err error, field string) {
+	res := make(osin.ResponseData)
+	res["ok"] = false
+	if te, ok := err.(errThrottled); ok {
+		res["error"] = map[string]string{"message": te.Error(), "field": field}
+		res["message"] = te.Error()
+		res["status"] = ERROR_LIMIT
+		res["retry_after"] = int((time.Duration(te) + time.Second - 1) / time.Second)
+	} else {
+		res["error"] = map[string]string{"message": "Invalid Username/Password", "field": field}
+		res["message"] = "Invalid Username/Password"
+		res["status"] = ERROR_PARAM
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *server) lockoutForm(c *gin.Context) {
+	data, err := s.service.Throttle().Locked()
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	if IsAjax(c.Request) {
+		apiOk(c, data, len(data))
+		return
+	}
+	s.Render(c, "dust_lockout.html", map[string]interface{}{
+		"ctx":      c,
+		"attempts": data,
+	})
+}
+
+// lockoutPost unlocks a key before the lock expires
+func (s *server) lockoutPost(c *gin.Context) {
+	key := c.Request.PostFormValue("key")
+	if key == "" {
+		apiError(c, ERROR_PARAM, "key is empty")
+		return
+	}
+	if err := s.service.Throttle().Reset(key); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("unlocked", "key", key, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActUnlock, "", key, "")
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryThrottle(t *testing.T) {
+	s := newMemoryServer()
+	max := settings.Current.LoginMaxFailures
+	settings.Current.LoginMaxFailures = 3
+	defer func() {
+		settings.Current.LoginMaxFailures = max
+		for _, key := range []string{throttle.AccountKey("nobody"), throttle.RequestKey("eagle"), throttle.IPKey("192.0.2.1")} {
+			s.service.Throttle().Reset(key)
+		}
+	}()
+
+	tc := newTestClient(s)
+	for _, name := range []string{"test", "Test", " TEST "} {
+		res := tc.post("/api/login", url.Values{"username": {name}, "password": {"wrong"}})
+		assert.Equal(t, float64(ERROR_PARAM), res["status"])
+	}
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, float64(ERROR_LIMIT), res["status"], "locked, whatever the case of the uid")
+	assert.NotNil(t, res["retry_after"])
+
+	// unknown accounts look the same
+	for i := 0; i < 3; i++ {
+		res = tc.post("/api/login", url.Values{"username": {"nobody"}, "password": {"wrong"}})
+		assert.Equal(t, float64(ERROR_PARAM), res["status"])
+	}
+	res = tc.post("/api/login", url.Values{"username": {"nobody"}, "password": {"wrong"}})
+	assert.Equal(t, float64(ERROR_LIMIT), res["status"])
+
+	// requests of forgot are counted apart, they can not lock others out of login
+	forgot := url.Values{"username": {"eagle"}, "email": {"x@example.com"}, "mobile": {"13800138000"}}
+	for i := 0; i < 3; i++ {
+		res = tc.post("/password/forgot", forgot)
+		assert.Equal(t, true, res["ok"], "mismatch replies the same")
+	}
+	res = tc.post("/password/forgot", forgot)
+	assert.Equal(t, float64(ERROR_LIMIT), res["status"])
+
+	locked, err := s.service.Throttle().Locked()
+	assert.NoError(t, err)
+	assert.Len(t, locked, 3)
+
+	// unlocked by a keeper
+	kc := newTestClient(s)
+	res = kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = kc.post("/dust/lockout", url.Values{"key": {"uid:test"}})
+	assert.Equal(t, true, res["ok"])
+	res = tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+}
@@ -0,0 +1,184 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/pat"
+	"github.com/liut/staffio/pkg/models/sessions"
+)
+
+const (
+	kPersonalToken = "personal_token" // token of the request
+
+	tokenDefaultDays = 30
+)
+
+var (
+	errTokenInvalid = errors.New("invalid or revoked token")
+	errTokenExpired = errors.New("token is expired")
+	errTokenScope   = errors.New("token is not allowed for this api")
+)
+
+// tokenScopes maps paths of api to the scope a token needs, others can not be called with tokens
+var tokenScopes = []struct{ prefix, scope string }{
+	{"/api/staffs", pat.ScopeStaff},
+	{"/api/teams", pat.ScopeStaff},
+	{"/api/watching", pat.ScopeStaff},
+	{"/api/watch", pat.ScopeStaff},
+	{"/api/unwatch", pat.ScopeStaff},
+	{"/api/weekly/", pat.ScopeWeekly},
+}
+
+func tokenScope(path string) string {
+	path = strings.TrimPrefix(path, strings.TrimRight(base, "/"))
+	for _, ts := range tokenScopes {
+		if strings.HasPrefix(path, ts.prefix) {
+			return ts.scope
+		}
+	}
+	return ""
+}
+
+// bearerToken returns the credential of header Authorization: Bearer
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+// userFromToken returns the owner of a personal access token if it is allowed for the request
+func (s *server) userFromToken(c *gin.Context, value string) (*User, error) {
+	if !pat.IsToken(value) {
+		return nil, errTokenInvalid
+	}
+	t, err := s.service.Tokens().Get(pat.Hash(value))
+	if err == backends.ErrNotFound {
+		return nil, errTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if t.IsExpired(now) {
+		return nil, errTokenExpired
+	}
+	if scope := tokenScope(c.Request.URL.Path); scope == "" || !t.Allows(scope) {
+		return nil, errTokenScope
+	}
+	staff, err := s.service.Get(t.UID)
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+	if t.LastUsed == nil || now.Sub(*t.LastUsed) >= sessions.TouchEvery {
+		if err = s.service.Tokens().Touch(t.ID); err != nil {
+			logger().Infow("touch token fail", "id", t.ID, "err", err)
+		}
+	}
+	c.Set(kPersonalToken, t)
+	return UserFromStaff(staff), nil
+}
+
+// tokensForm lists tokens of the user
+func (s *server) tokensForm(c *gin.Context) {
+	user := UserWithContext(c)
+	data, err := s.service.Tokens().All(user.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if isAPI(c) {
+		apiOk(c, data, len(data))
+		return
+	}
+	s.Render(c, "tokens.html", map[string]interface{}{
+		"ctx":    c,
+		"tokens": data,
+		"scopes": pat.Scopes,
+		"now":    time.Now(),
+	})
+}
+
+// tokenCreate creates a token with name, scopes and days, the value is replied only once
+func (s *server) tokenCreate(c *gin.Context) {
+	user := UserWithContext(c)
+	req := c.Request
+	req.ParseForm()
+	name := strings.TrimSpace(req.PostFormValue("name"))
+	if name == "" || len(name) > 64 {
+		tokenReplyError(c, "name is required, at most 64 characters", "name")
+		return
+	}
+	scopes := req.PostForm["scopes"]
+	if len(scopes) == 0 {
+		tokenReplyError(c, "choose one scope at least", "scopes")
+		return
+	}
+	for _, scope := range scopes {
+		if !pat.ValidScope(scope) {
+			tokenReplyError(c, "unknown scope "+scope, "scopes")
+			return
+		}
+	}
+	days := tokenDefaultDays
+	if v := req.PostFormValue("days"); v != "" {
+		days, _ = strconv.Atoi(v)
+	}
+	life := time.Duration(days) * 24 * time.Hour
+	if days < 1 || life > pat.MaxLife {
+		tokenReplyError(c, "expiry must be 1 to 365 days", "days")
+		return
+	}
+	t, value, err := pat.New(user.UID, name, scopes, life)
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	if err = s.service.Tokens().Save(t); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("token created", "uid", user.UID, "id", t.ID, "scopes", scopes)
+	s.audit(c, audit.ActTokenCreate, user.UID, user.UID, name+" "+strings.Join(scopes, ","))
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["token"] = value
+	res["data"] = t
+	c.JSON(http.StatusOK, res)
+}
+
+// tokenDelete revokes a token of the user by id
+func (s *server) tokenDelete(c *gin.Context) {
+	user := UserWithContext(c)
+	id, _ := strconv.Atoi(c.Request.PostFormValue("id"))
+	if err := s.service.Tokens().Delete(user.UID, id); err != nil {
+		if err == backends.ErrNotFound {
+			apiError(c, ERROR_PARAM, "token not found")
+		} else {
+			apiError(c, ERROR_DB, err)
+		}
+		return
+	}
+	s.audit(c, audit.ActTokenRevoke, user.UID, user.UID, strconv.Itoa(id))
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
+
+func tokenReplyError(c *gin.Context, message, field string) {
+	res := make(osin.ResponseData)
+	res["ok"] = false
+	res["error"] = map[string]string{"message": message, "field": field}
+	res["status"] = ERROR_PARAM
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/pat"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryTokens(t *testing.T) {
+	root := settings.Current.Root
+	settings.Current.Root = "../../"
+	defer func() { settings.Current.Root = root }()
+	s := newMemoryServer()
+	defer s.service.Tokens().Clear("test")
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+
+	res = tc.post("/api/tokens", url.Values{"name": {"ci"}, "scopes": {"admin"}})
+	assert.Equal(t, false, res["ok"])
+	res = tc.post("/api/tokens", url.Values{"name": {"ci"}, "scopes": {pat.ScopeWeekly}, "days": {"400"}})
+	assert.Equal(t, false, res["ok"])
+	res = tc.post("/api/tokens", url.Values{"name": {"ci"}, "scopes": {pat.ScopeStaff}, "days": {"7"}})
+	assert.Equal(t, true, res["ok"])
+	value, _ := res["token"].(string)
+	assert.True(t, pat.IsToken(value))
+	w := tc.get("/tokens")
+	assert.Contains(t, w.Body.String(), "ci")
+	assert.NotContains(t, w.Body.String(), value, "shown once")
+
+	call := func(method, uri, token string) int {
+		req := httptest.NewRequest(method, "https://example.com"+uri, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, call("GET", "/api/staffs", value))
+	assert.Equal(t, http.StatusForbidden, call("POST", "/api/weekly/report/self", value), "scope")
+	assert.Equal(t, http.StatusForbidden, call("GET", "/api/tokens", value), "no tokens by tokens")
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/staffs", value+"x"))
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/staffs", ""))
+
+	list, err := s.service.Tokens().All("test")
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.NotNil(t, list[0].LastUsed)
+		assert.NotEqual(t, value, list[0].Hash)
+		res = tc.post("/api/tokens/delete", url.Values{"id": {strconv.Itoa(list[0].ID)}})
+		assert.Equal(t, true, res["ok"])
+	}
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/staffs", value), "revoked")
+
+	tok, expired, err := pat.New("test", "old", []string{pat.ScopeStaff}, -time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, s.service.Tokens().Save(tok))
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/staffs", expired))
+}
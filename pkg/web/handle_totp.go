@@ -0,0 +1,474 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/totp"
+)
+
+const (
+	totpIssuer = "Staffio"
+
+	kTOTPPending = "totp_pending" // login waiting for the second step
+	kTOTPSecret  = "totp_secret"  // secret waiting for confirm
+
+	totpPendingLife = 5 * time.Minute
+)
+
+var (
+	errTOTPRequired = errors.New("two-factor code is required")
+	errTOTPEnroll   = errors.New("two-factor authentication must be enabled first")
+	errTOTPInvalid  = errors.New("invalid two-factor code")
+)
+
+// totpLogin is a login passed the password, waiting for the code
+type totpLogin struct {
+	UID     string `json:"uid"`
+	Service string `json:"service,omitempty"`
+	Referer string `json:"referer,omitempty"`
+	Expires int64  `json:"expires"`
+}
+
+func loadTOTPLogin(c *gin.Context) *totpLogin {
+	v, ok := ginSession(c).Get(kTOTPPending).(string)
+	if !ok {
+		return nil
+	}
+	tl := new(totpLogin)
+	if err := json.Unmarshal([]byte(v), tl); err != nil || tl.Expires < time.Now().Unix() {
+		return nil
+	}
+	return tl
+}
+
+func saveTOTPLogin(c *gin.Context, tl *totpLogin) {
+	sess := ginSession(c)
+	if tl == nil {
+		sess.Set(kTOTPPending, nil)
+		sess.Set(kTOTPSecret, nil)
+	} else {
+		b, _ := json.Marshal(tl)
+		sess.Set(kTOTPPending, string(b))
+	}
+	SessionSave(sess, c.Writer)
+}
+
+// totpState returns the enrollment of uid (nil if not enrolled) and whether policy requires it
+func (s *server) totpState(uid string) (e *totp.Enrollment, required bool, err error) {
+	e, err = s.service.TOTP().Get(uid)
+	if err == backends.ErrNotFound {
+		e, err = nil, nil
+	}
+	if err != nil {
+		return
+	}
+	p, err := s.service.TOTP().LoadPolicy()
+	if err != nil {
+		return
+	}
+	required = len(p.Groups) > 0 && s.InGroupAny(uid, p.Groups...)
+	return
+}
+
+// totpStart saves the pending login if uid has totp or security keys, or must have one,
+// returns the reply of the second step, nil if not needed
+func (s *server) totpStart(c *gin.Context, uid, service, referer string) (osin.ResponseData, error) {
+	e, required, err := s.totpState(uid)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.keyCount(uid)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil && keys == 0 && !required {
+		return nil, nil
+	}
+	saveTOTPLogin(c, &totpLogin{
+		UID:     uid,
+		Service: service,
+		Referer: referer,
+		Expires: time.Now().Add(totpPendingLife).Unix(),
+	})
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["mfa"] = "totp"
+	if e == nil && keys > 0 {
+		res["mfa"] = "webauthn"
+	}
+	res["webauthn"] = keys > 0
+	res["enroll"] = e == nil && keys == 0
+	res["referer"] = UrlFor("login/2fa")
+	res["status"] = 0
+	return res, nil
+}
+
+// totpPending starts the second step of login if need, it replies when true
+func (s *server) totpPending(c *gin.Context, uid, service, referer string) bool {
+	res, err := s.totpStart(c, uid, service, referer)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return true
+	}
+	if res == nil {
+		return false
+	}
+	c.JSON(http.StatusOK, res)
+	return true
+}
+
+// totpRedirect is totpPending for callbacks of third parties, a browser is redirected to the second step
+func (s *server) totpRedirect(c *gin.Context, uid string) bool {
+	if c.Request.Method == "POST" {
+		return s.totpPending(c, uid, "", "/")
+	}
+	res, err := s.totpStart(c, uid, "", "/")
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return true
+	}
+	if res == nil {
+		return false
+	}
+	c.Redirect(http.StatusFound, UrlFor("login/2fa"))
+	return true
+}
+
+// totpVerify checks code of uid without session, for the password grant
+func (s *server) totpVerify(uid, code string) error {
+	e, required, err := s.totpState(uid)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		if keys, err := s.keyCount(uid); err != nil {
+			return err
+		} else if keys > 0 {
+			return errKeyGrant
+		}
+		if required {
+			return errTOTPEnroll
+		}
+		return nil
+	}
+	if code == "" {
+		return errTOTPRequired
+	}
+	if ok, _ := e.Verify(code, time.Now()); !ok {
+		return errTOTPInvalid
+	}
+	return s.service.TOTP().Save(e)
+}
+
+// sessionSecret returns the pending secret in session, a new one is created if empty
+func sessionSecret(c *gin.Context, create bool) (string, error) {
+	sess := ginSession(c)
+	if secret, ok := sess.Get(kTOTPSecret).(string); ok && secret != "" {
+		return secret, nil
+	}
+	if !create {
+		return "", errTOTPEnroll
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	sess.Set(kTOTPSecret, secret)
+	SessionSave(sess, c.Writer)
+	return secret, nil
+}
+
+// enroll saves a new enrollment if code matches the secret in session, returns plain recovery codes
+func (s *server) totpEnroll(c *gin.Context, uid, code string) ([]string, error) {
+	secret, err := sessionSecret(c, false)
+	if err != nil {
+		return nil, err
+	}
+	counter, ok := totp.Match(secret, code, time.Now())
+	if !ok {
+		return nil, errTOTPInvalid
+	}
+	codes, hashes, err := totp.NewRecoveryCodes(totp.RecoveryCount)
+	if err != nil {
+		return nil, err
+	}
+	e := &totp.Enrollment{UID: uid, Secret: secret, Recovery: hashes, LastCounter: counter}
+	if err = s.service.TOTP().Save(e); err != nil {
+		return nil, err
+	}
+	sess := ginSession(c)
+	sess.Set(kTOTPSecret, nil)
+	SessionSave(sess, c.Writer)
+	logger().Infow("totp enabled", "uid", uid)
+	return codes, nil
+}
+
+func totpReplyError(c *gin.Context, err error) {
+	res := make(osin.ResponseData)
+	res["ok"] = false
+	res["error"] = map[string]string{"message": err.Error(), "field": "code"}
+	res["status"] = ERROR_PARAM
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *server) loginTOTPForm(c *gin.Context) {
+	tl := loadTOTPLogin(c)
+	if tl == nil {
+		c.Redirect(302, UrlFor("login"))
+		return
+	}
+	e, _, err := s.totpState(tl.UID)
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	keys, err := s.keyCount(tl.UID)
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	enroll := e == nil && keys == 0
+	data := map[string]interface{}{
+		"ctx":      c,
+		"uid":      tl.UID,
+		"enroll":   enroll,
+		"totp":     e != nil || enroll,
+		"webauthn": keys > 0,
+	}
+	if enroll {
+		secret, err := sessionSecret(c, true)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		data["secret"] = secret
+	}
+	s.Render(c, "login_2fa.html", data)
+}
+
+func (s *server) loginTOTPPost(c *gin.Context) {
+	tl := loadTOTPLogin(c)
+	if tl == nil {
+		apiError(c, ERROR_PARAM, "login first")
+		return
+	}
+	// failures of code are counted with the ones of password
+	keys := throttleKeys(c, tl.UID)
+	if err := s.throttleCheck(keys...); err != nil {
+		s.audit(c, audit.ActLoginFail, tl.UID, "", c.Request.URL.Path+" throttled")
+		authReplyError(c, err, "code")
+		return
+	}
+
+	code := c.Request.PostFormValue("code")
+	res := make(osin.ResponseData)
+	e, _, err := s.totpState(tl.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if e == nil {
+		codes, err := s.totpEnroll(c, tl.UID, code)
+		if err != nil {
+			if err == errTOTPInvalid {
+				s.throttleFail(keys...)
+			}
+			totpReplyError(c, err)
+			return
+		}
+		res["recovery"] = codes
+	} else {
+		ok, recovery := e.Verify(code, time.Now())
+		if !ok {
+			s.throttleFail(keys...)
+			s.audit(c, audit.ActLoginFail, tl.UID, "", c.Request.URL.Path)
+			totpReplyError(c, errTOTPInvalid)
+			return
+		}
+		if err = s.service.TOTP().Save(e); err != nil {
+			apiError(c, ERROR_DB, err)
+			return
+		}
+		if recovery {
+			logger().Infow("recovery code used", "uid", tl.UID, "remain", len(e.Recovery))
+			res["recovery_remain"] = len(e.Recovery)
+		}
+	}
+
+	staff, err := s.service.Get(tl.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	saveTOTPLogin(c, nil)
+	s.signinReply(c, res, staff, tl.Service, tl.Referer)
+}
+
+// totpQR writes QR code of the secret waiting for confirm
+func (s *server) totpQR(c *gin.Context) {
+	var uid string
+	if tl := loadTOTPLogin(c); tl != nil {
+		uid = tl.UID
+	} else if user, err := s.userFromRequest(c); err == nil {
+		uid = user.UID
+	} else {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	secret, err := sessionSecret(c, false)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	png, err := qrcode.Encode(totp.ProvisioningURI(totpIssuer, uid, secret), qrcode.Medium, 256)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+func (s *server) totpForm(c *gin.Context) {
+	user := UserWithContext(c)
+	e, required, err := s.totpState(user.UID)
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	s.Render(c, "totp.html", map[string]interface{}{
+		"ctx":        c,
+		"enrollment": e,
+		"required":   required,
+	})
+}
+
+func (s *server) totpSetup(c *gin.Context) {
+	user := UserWithContext(c)
+	sess := ginSession(c)
+	sess.Set(kTOTPSecret, nil)
+	secret, err := sessionSecret(c, true)
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["secret"] = secret
+	res["uri"] = totp.ProvisioningURI(totpIssuer, user.UID, secret)
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *server) totpEnable(c *gin.Context) {
+	user := UserWithContext(c)
+	codes, err := s.totpEnroll(c, user.UID, c.Request.PostFormValue("code"))
+	if err != nil {
+		totpReplyError(c, err)
+		return
+	}
+	s.audit(c, audit.ActTOTPEnable, user.UID, user.UID, "")
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["recovery"] = codes
+	c.JSON(http.StatusOK, res)
+}
+
+// totpRecovery replaces recovery codes after a valid code
+func (s *server) totpRecovery(c *gin.Context) {
+	user := UserWithContext(c)
+	e, _, err := s.totpState(user.UID)
+	if err != nil || e == nil {
+		apiError(c, ERROR_PARAM, errTOTPEnroll)
+		return
+	}
+	if ok, _ := e.Verify(c.Request.PostFormValue("code"), time.Now()); !ok {
+		totpReplyError(c, errTOTPInvalid)
+		return
+	}
+	codes, hashes, err := totp.NewRecoveryCodes(totp.RecoveryCount)
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	e.Recovery = hashes
+	if err = s.service.TOTP().Save(e); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["recovery"] = codes
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *server) totpDisable(c *gin.Context) {
+	user := UserWithContext(c)
+	res := make(osin.ResponseData)
+	if _, err := s.authenticate(c, user.UID, c.Request.PostFormValue("password")); err != nil {
+		authReplyError(c, err, "password")
+		return
+	}
+	_, required, err := s.totpState(user.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if required {
+		apiError(c, ERROR_PARAM, "two-factor authentication is required for your groups")
+		return
+	}
+	if err = s.service.TOTP().Delete(user.UID); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("totp disabled", "uid", user.UID)
+	s.audit(c, audit.ActTOTPDisable, user.UID, user.UID, "")
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *server) totpPolicyForm(c *gin.Context) {
+	p, err := s.service.TOTP().LoadPolicy()
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
+	if IsAjax(c.Request) {
+		apiOk(c, p, 0)
+		return
+	}
+	groups, _ := s.service.AllGroup()
+	required := make(map[string]bool)
+	for _, gn := range p.Groups {
+		required[gn] = true
+	}
+	s.Render(c, "dust_2fa.html", map[string]interface{}{
+		"ctx":      c,
+		"groups":   groups,
+		"required": required,
+	})
+}
+
+func (s *server) totpPolicyPost(c *gin.Context) {
+	c.Request.ParseForm()
+	p := &totp.Policy{Groups: c.Request.PostForm["groups"]}
+	if err := s.service.TOTP().SavePolicy(p); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("totp policy saved", "groups", p.Groups, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActTOTPPolicy, "", "", strings.Join(p.Groups, ","))
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/throttle"
+	"github.com/liut/staffio/pkg/models/totp"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryTOTP(t *testing.T) {
+	s := newMemoryServer()
+	defer s.service.TOTP().Delete("eagle")
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	assert.Nil(t, res["mfa"])
+
+	res = tc.post("/2fa/setup", nil)
+	assert.Equal(t, true, res["ok"])
+	secret, _ := res["secret"].(string)
+	code, err := totp.Code(secret, totp.Counter(time.Now()))
+	assert.NoError(t, err)
+	res = tc.post("/2fa/enable", url.Values{"code": {"000000x"}})
+	assert.Equal(t, false, res["ok"])
+	res = tc.post("/2fa/enable", url.Values{"code": {code}})
+	assert.Equal(t, true, res["ok"])
+	recovery, _ := res["recovery"].([]interface{})
+	assert.Len(t, recovery, totp.RecoveryCount)
+
+	// login again need the second step
+	tc = newTestClient(s)
+	res = tc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, "totp", res["mfa"])
+	assert.Equal(t, false, res["enroll"])
+	res = tc.post("/api/login/2fa", url.Values{"code": {code}})
+	assert.Equal(t, false, res["ok"], "replayed code")
+	res = tc.post("/api/login/2fa", url.Values{"code": {recovery[0].(string)}})
+	assert.Equal(t, true, res["ok"])
+	assert.Equal(t, float64(totp.RecoveryCount-1), res["recovery_remain"])
+	res = tc.post("/api/login/2fa", url.Values{"code": {recovery[1].(string)}})
+	assert.NotEqual(t, true, res["ok"], "no pending login")
+}
+
+func TestMemoryTOTPPolicy(t *testing.T) {
+	s := newMemoryServer()
+	assert.NoError(t, s.service.TOTP().SavePolicy(&totp.Policy{Groups: []string{"develop"}}))
+	defer s.service.TOTP().SavePolicy(&totp.Policy{})
+	defer s.service.TOTP().Delete("test")
+
+	assert.Equal(t, errTOTPEnroll, s.totpVerify("test", ""))
+
+	max := settings.Current.LoginMaxFailures
+	settings.Current.LoginMaxFailures = 3
+	defer func() {
+		settings.Current.LoginMaxFailures = max
+		for _, key := range []string{throttle.AccountKey("test"), throttle.IPKey("192.0.2.1")} {
+			s.service.Throttle().Reset(key)
+		}
+	}()
+
+	// wrong codes are counted with passwords, a new login does not start them again
+	tc := newTestClient(s)
+	for i := 0; i < 3; i++ {
+		res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+		assert.Equal(t, "totp", res["mfa"])
+		assert.Equal(t, true, res["enroll"])
+		tc.get("/login/2fa")
+		res = tc.post("/api/login/2fa", url.Values{"code": {"000000"}})
+		assert.Equal(t, false, res["ok"])
+	}
+	res := tc.post("/api/login/2fa", url.Values{"code": {"000000"}})
+	assert.Equal(t, float64(ERROR_LIMIT), res["status"])
+	res = tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, float64(ERROR_LIMIT), res["status"])
+}
@@ -0,0 +1,266 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/webauthn"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+const (
+	kKeyRegister = "webauthn_register" // challenge of a registration
+	kKeyLogin    = "webauthn_login"    // challenge and context of a login
+
+	keyCeremonyLife = 2 * time.Minute
+	keyNameMax      = 64
+)
+
+var (
+	errKeyNotFound = errors.New("unknown security key")
+	errKeyExpired  = errors.New("security key request expired, try again")
+	errKeyGrant    = errors.New("security keys can not be used with the password grant")
+)
+
+// keyCeremony is a challenge waiting for the authenticator
+type keyCeremony struct {
+	Challenge string `json:"challenge"`
+	UID       string `json:"uid,omitempty"`    // expected owner, empty for discoverable credentials
+	Second    bool   `json:"second,omitempty"` // second step after the password
+	Service   string `json:"service,omitempty"`
+	Referer   string `json:"referer,omitempty"`
+	Expires   int64  `json:"expires"`
+}
+
+// takeKeyCeremony loads and removes a ceremony from session, a challenge is used once only
+func takeKeyCeremony(c *gin.Context, key string) *keyCeremony {
+	sess := ginSession(c)
+	v, ok := sess.Get(key).(string)
+	if !ok {
+		return nil
+	}
+	sess.Set(key, nil)
+	SessionSave(sess, c.Writer)
+	kc := new(keyCeremony)
+	if err := json.Unmarshal([]byte(v), kc); err != nil || kc.Expires < time.Now().Unix() {
+		return nil
+	}
+	return kc
+}
+
+func saveKeyCeremony(c *gin.Context, key string, kc *keyCeremony) {
+	kc.Expires = time.Now().Add(keyCeremonyLife).Unix()
+	b, _ := json.Marshal(kc)
+	sess := ginSession(c)
+	sess.Set(key, string(b))
+	SessionSave(sess, c.Writer)
+}
+
+func relyingParty() (*webauthn.RelyingParty, error) {
+	return webauthn.NewRelyingParty(totpIssuer, settings.Current.BaseURL)
+}
+
+// keyCount returns the number of security keys of uid
+func (s *server) keyCount(uid string) (int, error) {
+	keys, err := s.service.WebAuthn().All(uid)
+	if err != nil && err != backends.ErrNotFound {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+func keyReplyError(c *gin.Context, err error) {
+	res := make(osin.ResponseData)
+	res["ok"] = false
+	res["error"] = map[string]string{"message": err.Error(), "field": "webauthn"}
+	res["status"] = ERROR_PARAM
+	c.JSON(http.StatusOK, res)
+}
+
+// keyRegisterBegin replies options of navigator.credentials.create()
+func (s *server) keyRegisterBegin(c *gin.Context) {
+	user := UserWithContext(c)
+	rp, err := relyingParty()
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	exist, err := s.service.WebAuthn().All(user.UID)
+	if err != nil && err != backends.ErrNotFound {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	saveKeyCeremony(c, kKeyRegister, &keyCeremony{Challenge: challenge, UID: user.UID})
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["publicKey"] = rp.NewCreationOptions(challenge, user.UID, user.Name, exist)
+	c.JSON(http.StatusOK, res)
+}
+
+// keyRegisterFinish verifies the new credential and saves it
+func (s *server) keyRegisterFinish(c *gin.Context) {
+	user := UserWithContext(c)
+	var param struct {
+		webauthn.Attestation
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&param); err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	kc := takeKeyCeremony(c, kKeyRegister)
+	if kc == nil || kc.UID != user.UID {
+		keyReplyError(c, errKeyExpired)
+		return
+	}
+	rp, err := relyingParty()
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	cred, err := rp.VerifyAttestation(kc.Challenge, &param.Attestation)
+	if err != nil {
+		logger().Infow("webauthn register fail", "uid", user.UID, "err", err)
+		keyReplyError(c, err)
+		return
+	}
+	cred.UID = user.UID
+	cred.Name = strings.TrimSpace(param.Name)
+	if cred.Name == "" {
+		cred.Name = "Security key"
+	}
+	if len(cred.Name) > keyNameMax {
+		cred.Name = cred.Name[:keyNameMax]
+	}
+	if err = s.service.WebAuthn().Save(cred); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("webauthn registered", "uid", user.UID, "id", cred.ID, "aaguid", cred.AAGUID)
+	s.audit(c, audit.ActKeyAdd, user.UID, user.UID, cred.Name)
+	apiOk(c, cred, 0)
+}
+
+func (s *server) keyDelete(c *gin.Context) {
+	user := UserWithContext(c)
+	id := c.Request.PostFormValue("id")
+	if err := s.service.WebAuthn().Delete(user.UID, id); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("webauthn deleted", "uid", user.UID, "id", id)
+	s.audit(c, audit.ActKeyDelete, user.UID, user.UID, id)
+	apiOk(c, true, 0)
+}
+
+// keyLoginBegin replies options of navigator.credentials.get(),
+// as the second step of a pending login, or passwordless with user verification
+func (s *server) keyLoginBegin(c *gin.Context) {
+	rp, err := relyingParty()
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	kc := new(keyCeremony)
+	uv := "required"
+	if tl := loadTOTPLogin(c); tl != nil {
+		kc.UID, kc.Second = tl.UID, true
+		uv = "discouraged"
+	} else {
+		req := c.Request
+		kc.UID = req.PostFormValue("username")
+		kc.Service, kc.Referer = req.FormValue("service"), req.PostFormValue("referer")
+	}
+	var allow []webauthn.Credential
+	if kc.UID != "" {
+		allow, err = s.service.WebAuthn().All(kc.UID)
+		if err != nil && err != backends.ErrNotFound {
+			apiError(c, ERROR_DB, err)
+			return
+		}
+		if len(allow) == 0 {
+			keyReplyError(c, errKeyNotFound)
+			return
+		}
+	}
+	if kc.Challenge, err = webauthn.NewChallenge(); err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	saveKeyCeremony(c, kKeyLogin, kc)
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["publicKey"] = rp.NewRequestOptions(kc.Challenge, allow, uv)
+	c.JSON(http.StatusOK, res)
+}
+
+// keyLoginFinish verifies the assertion and signs in like loginPost
+func (s *server) keyLoginFinish(c *gin.Context) {
+	var param webauthn.Assertion
+	if err := c.ShouldBindJSON(&param); err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	kc := takeKeyCeremony(c, kKeyLogin)
+	if kc == nil {
+		keyReplyError(c, errKeyExpired)
+		return
+	}
+	cred, err := s.service.WebAuthn().Get(param.ID)
+	if err == backends.ErrNotFound ||
+		err == nil && (kc.UID != "" && cred.UID != kc.UID || param.UserHandle != "" && param.UID() != cred.UID) {
+		keyReplyError(c, errKeyNotFound)
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	rp, err := relyingParty()
+	if err != nil {
+		apiError(c, ERROR_INTERNAL, err)
+		return
+	}
+	count, err := rp.VerifyAssertion(kc.Challenge, cred, &param, !kc.Second)
+	if err != nil {
+		logger().Infow("webauthn login fail", "uid", cred.UID, "id", cred.ID, "err", err)
+		s.audit(c, audit.ActLoginFail, cred.UID, "", c.Request.URL.Path)
+		keyReplyError(c, err)
+		return
+	}
+	if err = s.service.WebAuthn().Touch(cred.ID, count); err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+
+	service, referer := kc.Service, kc.Referer
+	if kc.Second {
+		tl := loadTOTPLogin(c)
+		if tl == nil || tl.UID != cred.UID {
+			apiError(c, ERROR_PARAM, "login first")
+			return
+		}
+		service, referer = tl.Service, tl.Referer
+		saveTOTPLogin(c, nil)
+	}
+	staff, err := s.service.Get(cred.UID)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("webauthn login", "uid", cred.UID, "id", cred.ID, "second", kc.Second)
+	s.signinReply(c, make(osin.ResponseData), staff, service, referer)
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/models/webauthn"
+)
+
+// testKey simulates a P-256 security key of the default base URL
+type testKey struct {
+	id    []byte
+	key   *ecdsa.PrivateKey
+	count byte
+}
+
+func newTestKey() *testKey {
+	k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return &testKey{id: []byte("test-key-id"), key: k}
+}
+
+func (k *testKey) authData(flags byte, attested bool) []byte {
+	rp, _ := relyingParty()
+	hash := sha256.Sum256([]byte(rp.ID))
+	b := append(hash[:], flags, 0, 0, 0, k.count)
+	if attested {
+		b[32] |= 0x40
+		b = append(b, make([]byte, 16)...)
+		b = append(b, 0, byte(len(k.id)))
+		b = append(b, k.id...)
+		pub, _ := cbor.Marshal(map[int]interface{}{1: 2, 3: -7, -1: 1, -2: k.key.X.Bytes(), -3: k.key.Y.Bytes()})
+		b = append(b, pub...)
+	}
+	return b
+}
+
+func (k *testKey) clientData(typ string, res map[string]interface{}) []byte {
+	rp, _ := relyingParty()
+	pk, _ := res["publicKey"].(map[string]interface{})
+	b, _ := json.Marshal(map[string]string{"type": typ, "challenge": pk["challenge"].(string), "origin": rp.Origin})
+	return b
+}
+
+func (k *testKey) attest(res map[string]interface{}) map[string]string {
+	obj, _ := cbor.Marshal(map[string]interface{}{"fmt": "none", "attStmt": map[string]interface{}{}, "authData": k.authData(0x05, true)})
+	return map[string]string{
+		"id":                webauthn.Encoding.EncodeToString(k.id),
+		"name":              "test key",
+		"clientDataJSON":    webauthn.Encoding.EncodeToString(k.clientData("webauthn.create", res)),
+		"attestationObject": webauthn.Encoding.EncodeToString(obj),
+	}
+}
+
+func (k *testKey) assert(res map[string]interface{}, flags byte) map[string]string {
+	k.count++
+	ad := k.authData(flags, false)
+	cdj := k.clientData("webauthn.get", res)
+	hash := sha256.Sum256(cdj)
+	digest := sha256.Sum256(append(append([]byte{}, ad...), hash[:]...))
+	r, s, _ := ecdsa.Sign(rand.Reader, k.key, digest[:])
+	sig, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	return map[string]string{
+		"id":                webauthn.Encoding.EncodeToString(k.id),
+		"clientDataJSON":    webauthn.Encoding.EncodeToString(cdj),
+		"authenticatorData": webauthn.Encoding.EncodeToString(ad),
+		"signature":         webauthn.Encoding.EncodeToString(sig),
+	}
+}
+
+func TestMemoryWebAuthn(t *testing.T) {
+	s := newMemoryServer()
+	key := newTestKey()
+	defer s.service.WebAuthn().Delete("eagle", webauthn.Encoding.EncodeToString(key.id))
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = tc.post("/webauthn/register", nil)
+	assert.Equal(t, true, res["ok"])
+	res = tc.postJSON("/webauthn/register/finish", key.attest(res))
+	assert.Equal(t, float64(0), res["status"])
+	keys, err := s.service.WebAuthn().All("eagle")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, errKeyGrant, s.totpVerify("eagle", ""))
+
+	// as the second factor
+	tc = newTestClient(s)
+	res = tc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, "webauthn", res["mfa"])
+	assert.Equal(t, false, res["enroll"])
+	res = tc.post("/api/login/webauthn", nil)
+	assert.Equal(t, true, res["ok"])
+	res = tc.postJSON("/api/login/webauthn/finish", key.assert(res, 0x01))
+	assert.Equal(t, true, res["ok"])
+
+	// passwordless needs user verification
+	tc = newTestClient(s)
+	res = tc.post("/api/login/webauthn", url.Values{"referer": {"/profile"}})
+	assert.Equal(t, true, res["ok"])
+	res = tc.postJSON("/api/login/webauthn/finish", key.assert(res, 0x01))
+	assert.Equal(t, false, res["ok"])
+	res = tc.post("/api/login/webauthn", url.Values{"referer": {"/profile"}})
+	assert.Equal(t, true, res["ok"])
+	ar := key.assert(res, 0x05)
+	res = tc.postJSON("/api/login/webauthn/finish", ar)
+	assert.Equal(t, true, res["ok"])
+	assert.Equal(t, "/profile", res["referer"])
+	res = tc.postJSON("/api/login/webauthn/finish", ar)
+	assert.Equal(t, false, res["ok"], "challenge used")
+
+	cred, err := s.service.WebAuthn().Get(webauthn.Encoding.EncodeToString(key.id))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), cred.SignCount)
+	assert.NotNil(t, cred.LastUsed)
+}
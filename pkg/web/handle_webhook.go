@@ -0,0 +1,158 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openshift/osin"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/audit"
+	"github.com/liut/staffio/pkg/models/queue"
+	"github.com/liut/staffio/pkg/models/random"
+	"github.com/liut/staffio/pkg/models/webhook"
+)
+
+const webhookSecretLen = 40
+
+// webhooksList shows endpoints and deliveries for keepers
+func (s *server) webhooksList(c *gin.Context) {
+	spec := new(webhook.Spec)
+	if err := c.Bind(spec); err != nil {
+		apiError(c, ERROR_PARAM, err)
+		return
+	}
+	endpoints, err := s.service.Webhooks().Endpoints()
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	deliveries, err := s.service.Webhooks().Query(spec)
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	if isAPI(c) {
+		apiOk(c, gin.H{"endpoints": endpoints, "deliveries": deliveries}, spec.Total)
+		return
+	}
+	var pages []int
+	for i := 1; i <= (spec.Total+spec.Limit-1)/spec.Limit; i++ {
+		pages = append(pages, i)
+	}
+	s.Render(c, "dust_webhooks.html", map[string]interface{}{
+		"ctx":        c,
+		"endpoints":  endpoints,
+		"deliveries": deliveries,
+		"spec":       spec,
+		"pages":      pages,
+		"events":     webhook.Events,
+		"statuses":   queue.Statuses,
+	})
+}
+
+// webhookSave creates or updates an endpoint, the secret is replied once when created or rotated
+func (s *server) webhookSave(c *gin.Context) {
+	req := c.Request
+	ep := new(webhook.Endpoint)
+	if id, _ := strconv.Atoi(req.PostFormValue("id")); id > 0 {
+		var err error
+		if ep, err = s.service.Webhooks().GetEndpoint(id); err != nil {
+			apiError(c, ERROR_PARAM, "endpoint not found")
+			return
+		}
+	}
+	u, err := url.Parse(req.PostFormValue("url"))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		apiError(c, ERROR_PARAM, "invalid url")
+		return
+	}
+	ep.URL = u.String()
+	ep.Description = req.PostFormValue("description")
+	ep.Active = req.PostFormValue("active") != ""
+	ep.Events = nil
+	for _, ev := range req.PostForm["events"] {
+		for _, known := range webhook.Events {
+			if ev == known && !ep.Events.Contains(ev) {
+				ep.Events = append(ep.Events, ev)
+			}
+		}
+	}
+	if ep.Events == nil {
+		ep.Events = []string{}
+	}
+	isNew, rotate := ep.ID == 0, req.PostFormValue("rotate") != ""
+	if isNew || rotate {
+		ep.Secret = random.GenString(webhookSecretLen)
+	}
+	if err = s.service.Webhooks().SaveEndpoint(ep); err == backends.ErrNotFound {
+		apiError(c, ERROR_PARAM, "endpoint not found") // deleted meanwhile
+		return
+	} else if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	detail := "update"
+	if isNew {
+		detail = "new"
+	} else if rotate {
+		detail = "rotate"
+	}
+	s.audit(c, audit.ActWebhookSave, "", ep.URL, detail)
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	res["id"] = ep.ID
+	if isNew || rotate {
+		res["secret"] = ep.Secret
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *server) webhookDelete(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Request.PostFormValue("id"))
+	ep, err := s.service.Webhooks().GetEndpoint(id)
+	if err == nil {
+		err = s.service.Webhooks().DeleteEndpoint(id)
+	}
+	if err == backends.ErrNotFound {
+		apiError(c, ERROR_PARAM, "endpoint not found")
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	s.audit(c, audit.ActWebhookSave, "", ep.URL, "delete")
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
+
+// webhookRedeliver queues a delivery again, with attempts cleared
+func (s *server) webhookRedeliver(c *gin.Context) {
+	id, err := strconv.Atoi(c.Request.PostFormValue("id"))
+	if err != nil || id < 1 {
+		apiError(c, ERROR_PARAM, "invalid id")
+		return
+	}
+	d, err := s.service.Webhooks().Get(id)
+	if err == nil {
+		err = s.service.Webhooks().Redeliver(id)
+	}
+	if err == backends.ErrNotFound {
+		apiError(c, ERROR_PARAM, "delivery not found")
+		return
+	}
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	backends.WakeWebhookWorker()
+	logger().Infow("webhook redeliver", "id", id, "endpoint", d.EndpointID, "by", UserWithContext(c).UID)
+	s.audit(c, audit.ActWebhookResend, "", strconv.Itoa(d.EndpointID), strconv.Itoa(id)+" "+d.Event)
+	res := make(osin.ResponseData)
+	res["ok"] = true
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models"
+	"github.com/liut/staffio/pkg/models/queue"
+	"github.com/liut/staffio/pkg/models/webhook"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryWebhooks(t *testing.T) {
+	var secret string
+	var got []webhook.Payload
+	fail := false
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if !webhook.Verify(secret, ts, body, r.Header.Get(webhook.HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var p webhook.Payload
+		json.Unmarshal(body, &p)
+		got = append(got, p)
+	}))
+	defer hs.Close()
+	cfg := *settings.Current
+	settings.Current.Root = "../../"
+	defer func() { *settings.Current = cfg }()
+	s := newMemoryServer()
+	backends.DispatchEvents(s.service) // of other tests
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	res = tc.post("/dust/webhooks", url.Values{"url": {hs.URL}})
+	assert.NotEqual(t, true, res["ok"], "keepers only")
+
+	kc := newTestClient(s)
+	res = kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = kc.post("/dust/webhooks", url.Values{"url": {"ftp://example.com/"}, "active": {"1"}})
+	assert.NotEqual(t, true, res["ok"], "http(s) only")
+	res = kc.post("/dust/webhooks", url.Values{"url": {hs.URL}, "active": {"1"},
+		"events": {webhook.EventStaffCreated, webhook.EventStaffDeleted, "unknown"}})
+	assert.Equal(t, true, res["ok"])
+	secret, _ = res["secret"].(string)
+	assert.NotEmpty(t, secret, "shown once")
+	id := int(res["id"].(float64))
+	defer s.service.Webhooks().DeleteEndpoint(id)
+	ep, err := s.service.Webhooks().GetEndpoint(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{webhook.EventStaffCreated, webhook.EventStaffDeleted}, []string(ep.Events))
+
+	staff := &models.Staff{UID: "hooked", GivenName: "Hook", Surname: "Wang", Email: "hooked@example.net", IDCN: "110101199001011234"}
+	assert.NoError(t, s.service.SaveStaff(staff))
+	defer s.service.Delete(staff.UID)
+	staff.Nickname = "hook"
+	assert.NoError(t, s.service.SaveStaff(staff), "staff.updated is not wanted")
+	_, err = backends.DispatchEvents(s.service)
+	assert.NoError(t, err)
+	n, err := backends.SendWebhooks(s.service)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, webhook.EventStaffCreated, got[0].Event)
+		data, _ := got[0].Data.(map[string]interface{})
+		assert.Equal(t, "hooked", data["uid"])
+		assert.Nil(t, data["idcn"], "no private fields")
+	}
+
+	fail = true
+	assert.NoError(t, s.service.Delete(staff.UID))
+	backends.DispatchEvents(s.service)
+	n, err = backends.SendWebhooks(s.service)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	list, err := s.service.Webhooks().Query(&webhook.Spec{EndpointID: id, Event: webhook.EventStaffDeleted})
+	assert.NoError(t, err)
+	if !assert.Len(t, list, 1) {
+		return
+	}
+	d := list[0]
+	assert.Equal(t, webhook.StatusPending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, d.Code)
+	assert.True(t, d.NextTry.After(time.Now()), "backoff")
+
+	d.Attempts = queue.MaxAttempts - 1
+	d.NextTry = time.Now().Add(-time.Second)
+	assert.NoError(t, s.service.Webhooks().Update(&d))
+	backends.SendWebhooks(s.service)
+	dd, _ := s.service.Webhooks().Get(d.ID)
+	assert.Equal(t, webhook.StatusDead, dd.Status)
+
+	w := kc.get("/dust/webhooks?status=dead")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), hs.URL)
+	assert.NotContains(t, w.Body.String(), secret)
+	res = kc.post("/dust/webhooks/redeliver", url.Values{"id": {strconv.Itoa(d.ID)}})
+	assert.Equal(t, true, res["ok"])
+	fail = false
+	n, err = backends.SendWebhooks(s.service)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	dd, _ = s.service.Webhooks().Get(d.ID)
+	assert.Equal(t, webhook.StatusDone, dd.Status)
+	assert.Equal(t, 1, dd.Attempts)
+	res = kc.post("/dust/webhooks/redeliver", url.Values{"id": {"99999"}})
+	assert.NotEqual(t, true, res["ok"])
+
+	res = kc.post("/dust/webhooks", url.Values{"id": {strconv.Itoa(id)}, "url": {hs.URL}})
+	assert.Equal(t, true, res["ok"])
+	assert.Nil(t, res["secret"], "kept unless rotated")
+	ep, _ = s.service.Webhooks().GetEndpoint(id)
+	assert.False(t, ep.Active)
+	assert.Equal(t, secret, ep.Secret)
+	res = kc.post("/dust/webhooks/delete", url.Values{"id": {strconv.Itoa(id)}})
+	assert.Equal(t, true, res["ok"])
+	_, err = s.service.Webhooks().GetEndpoint(id)
+	assert.Equal(t, backends.ErrNotFound, err)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/liut/staffio/pkg/backends"
 	"github.com/liut/staffio/pkg/models"
 	"github.com/liut/staffio/pkg/models/weekly"
 )
@@ -279,6 +280,17 @@ func (s *server) weeklyVacationList(c *gin.Context) {
 	apiOk(c, data, len(data))
 }
 
+// weeklyRemind notifies staff who have not submitted the report of this week
+func (s *server) weeklyRemind(c *gin.Context) {
+	count, err := backends.RemindWeekly(s.service, time.Now())
+	if err != nil {
+		apiError(c, ERROR_DB, err)
+		return
+	}
+	logger().Infow("weekly reminded", "count", count, "by", UserWithContext(c).UID)
+	apiOk(c, gin.H{"count": count}, count)
+}
+
 func (s *server) weeklyVacationAdd(c *gin.Context) { s.weeklyStatusAdd(c, weekly.WRVacation) }
 
 func (s *server) weeklyVacationRemove(c *gin.Context) { s.weeklyStatusRemove(c) }
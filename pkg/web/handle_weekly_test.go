@@ -0,0 +1,64 @@
+package web
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/common"
+	"github.com/liut/staffio/pkg/models/prefs"
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func TestMemoryNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfg := *settings.Current
+	settings.Current.Root = "../../"
+	settings.Current.NotifyFile = filepath.Join(dir, "notify.log")
+	defer func() { *settings.Current = cfg }()
+	s := newMemoryServer()
+
+	tc := newTestClient(s)
+	res := tc.post("/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, true, res["ok"])
+	w := tc.get("/profile")
+	assert.Contains(t, w.Body.String(), `name="channels" value="file"`)
+	profile := url.Values{"uid": {"test"}, "cn": {"Test"}, "gn": {"Test"}, "sn": {"Test"}, "nickname": {"tester"},
+		"email": {"test@example.net"}, "mobile": {"1"}, "password": {"test"}, "lang": {""}, "channels": {"file", "nope"}}
+	res = tc.post("/profile", profile)
+	assert.Equal(t, true, res["ok"])
+	defer s.service.Prefs().Save(&prefs.Prefs{UID: "test"})
+	p, _ := s.service.Prefs().Get("test")
+	assert.Equal(t, []string{"file"}, []string(p.Channels))
+
+	assert.NoError(t, s.service.PasswordForgot(common.AtEmail, "test@example.net", "test"))
+	_, err = backends.DispatchEvents(s.service)
+	assert.NoError(t, err)
+	b, _ := ioutil.ReadFile(settings.Current.NotifyFile)
+	assert.NotContains(t, string(b), "/password/reset?rt=", "links are mailed only")
+
+	res = tc.post("/api/weekly/report/remind", nil)
+	assert.NotEqual(t, float64(0), res["status"], "managers only")
+	kc := newTestClient(s)
+	res = kc.post("/api/login", url.Values{"username": {"eagle"}, "password": {"demo1234"}})
+	assert.Equal(t, true, res["ok"])
+	res = kc.post("/api/weekly/report/remind", nil)
+	assert.Equal(t, float64(0), res["status"])
+	b, _ = ioutil.ReadFile(settings.Current.NotifyFile)
+	assert.NotContains(t, string(b), `"topic":"reminder"`, "queued")
+	_, err = backends.DispatchEvents(s.service)
+	assert.NoError(t, err)
+	b, _ = ioutil.ReadFile(settings.Current.NotifyFile)
+	year, week := time.Now().ISOWeek()
+	assert.Contains(t, string(b), `"topic":"reminder","uid":"test"`)
+	assert.Contains(t, string(b), fmt.Sprintf("%d-W%02d", year, week))
+}
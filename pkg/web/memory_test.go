@@ -0,0 +1,112 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/settings"
+)
+
+func newMemoryServer() *server {
+	settings.Current.Backend = "memory"
+	return New(Config{Root: "../../", FS: "local"})
+}
+
+func postForm(s *server, uri string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", uri, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, ck := range cookies {
+		req.AddCookie(ck)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestMemoryLogin(t *testing.T) {
+	s := newMemoryServer()
+
+	w := postForm(s, "/api/login", url.Values{"username": {"test"}, "password": {"wrong"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var res map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, false, res["ok"])
+
+	w = postForm(s, "/api/login", url.Values{"username": {"test"}, "password": {"test"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	res = nil
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, true, res["ok"])
+	cookies := w.Result().Cookies()
+	assert.NotEmpty(t, cookies)
+
+	req := httptest.NewRequest("GET", "/api/staffs?simple=yes", nil)
+	for _, ck := range cookies {
+		req.AddCookie(ck)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var staffs struct {
+		Data []simpStaff `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &staffs))
+	if assert.Len(t, staffs.Data, 2) {
+		assert.Equal(t, "eagle", staffs.Data[0].UID)
+	}
+}
+
+type testClient struct {
+	s   *server
+	jar http.CookieJar
+}
+
+func newTestClient(s *server) *testClient {
+	jar, _ := cookiejar.New(nil)
+	return &testClient{s: s, jar: jar}
+}
+
+func (tc *testClient) post(uri string, form url.Values) (res map[string]interface{}) {
+	req := httptest.NewRequest("POST", "https://example.com"+uri, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return tc.do(req)
+}
+
+func (tc *testClient) postJSON(uri string, v interface{}) (res map[string]interface{}) {
+	b, _ := json.Marshal(v)
+	req := httptest.NewRequest("POST", "https://example.com"+uri, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	return tc.do(req)
+}
+
+func (tc *testClient) get(uri string) *httptest.ResponseRecorder {
+	return tc.serve(httptest.NewRequest("GET", "https://example.com"+uri, nil))
+}
+
+func (tc *testClient) do(req *http.Request) (res map[string]interface{}) {
+	w := tc.serve(req)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return
+}
+
+// serve sends the request with cookies, and the csrf header like scripts of pages
+func (tc *testClient) serve(req *http.Request) *httptest.ResponseRecorder {
+	for _, ck := range tc.jar.Cookies(req.URL) {
+		req.AddCookie(ck)
+		if ck.Name == csrfCookie && req.Method != "GET" && req.Header.Get(csrfHeader) == "" {
+			req.Header.Set(csrfHeader, ck.Value)
+		}
+	}
+	w := httptest.NewRecorder()
+	tc.s.ServeHTTP(w, req)
+	tc.jar.SetCookies(req.URL, w.Result().Cookies())
+	return w
+}
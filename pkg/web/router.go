@@ -29,18 +29,43 @@ func SetBase(s string) {
 func (s *server) StrapRouter() {
 	gr := s.router.Group(base)
 	gr.GET("/login", s.loginForm).POST("/login", s.loginPost)
+	gr.GET("/login/2fa", s.loginTOTPForm).POST("/login/2fa", s.loginTOTPPost)
+	gr.POST("/login/link", s.loginLinkSend)
+	gr.GET("/login/link", s.loginLinkForm).POST("/login/link/finish", s.loginLinkPost)
+	gr.GET("/password/expired", s.passwordExpiredForm).POST("/password/expired", s.passwordExpiredPost)
+	gr.GET("/2fa/qr.png", s.totpQR)
+	gr.POST("/login/webauthn", s.keyLoginBegin)
+	gr.POST("/login/webauthn/finish", s.keyLoginFinish)
 	gr.GET("/logout", s.logout)
 	gr.GET("/password/forgot", s.passwordForgotForm)
 	gr.POST("/password/forgot", s.passwordForgot)
 	gr.GET("/password/reset", s.passwordResetForm)
 	gr.POST("/password/reset", s.passwordReset)
+	gr.GET("/email/verify", s.emailVerify)
 
-	authed := gr.Group("/", AuthUserMiddleware(true))
+	authed := gr.Group("/", s.AuthUserMiddleware(true), s.csrfMiddleware(), s.auditImpersonated)
 	authed.GET("/password", s.passwordForm)
-	authed.POST("/password", s.passwordChange)
+	authed.POST("/password", s.notImpersonated, s.passwordChange)
+
+	authed.GET("/2fa", s.totpForm)
+	authed.POST("/2fa/setup", s.notImpersonated, s.totpSetup)
+	authed.POST("/2fa/enable", s.notImpersonated, s.totpEnable)
+	authed.POST("/2fa/recovery", s.notImpersonated, s.totpRecovery)
+	authed.POST("/2fa/disable", s.notImpersonated, s.totpDisable)
+	authed.POST("/webauthn/register", s.notImpersonated, s.keyRegisterBegin)
+	authed.POST("/webauthn/register/finish", s.notImpersonated, s.keyRegisterFinish)
+	authed.POST("/webauthn/delete", s.notImpersonated, s.keyDelete)
+	authed.GET("/sessions", s.sessionsForm)
+	authed.POST("/sessions/delete", s.sessionDelete)
+	authed.GET("/tokens", s.tokensForm)
+	authed.POST("/tokens", s.notImpersonated, s.tokenCreate)
+	authed.POST("/tokens/delete", s.notImpersonated, s.tokenDelete)
+	authed.POST("/impersonate/stop", s.impersonateStop)
 
 	authed.GET("/profile", s.profileForm)
 	authed.POST("/profile", s.profilePost)
+	authed.POST("/profile/mobile", s.mobileSend)
+	authed.POST("/profile/mobile/verify", s.mobileVerify)
 	authed.GET("/email/unseen", s.countNewMail)
 	authed.GET("/email/open", s.loginToExmail)
 
@@ -64,6 +89,29 @@ func (s *server) StrapRouter() {
 		keeper.GET("/status/:topic", s.handleStatus)
 		keeper.GET("/groups", s.groupList)
 		keeper.POST("/group", s.groupStore)
+		keeper.GET("/saml", s.samlProvidersGet)
+		keeper.POST("/saml", s.samlProvidersPost)
+		keeper.GET("/2fa", s.totpPolicyForm)
+		keeper.POST("/2fa", s.totpPolicyPost)
+		keeper.GET("/login-link", s.linkPolicyForm)
+		keeper.POST("/login-link", s.linkPolicyPost)
+		keeper.GET("/lockout", s.lockoutForm)
+		keeper.POST("/lockout", s.lockoutPost)
+		keeper.GET("/audit", s.auditList)
+		keeper.GET("/sessions", s.sessionsAdmin)
+		keeper.POST("/sessions", s.sessionsAdminPost)
+		keeper.POST("/impersonate", s.impersonateStart)
+		keeper.GET("/mail", s.mailPreview)
+		keeper.GET("/mail/queue", s.mailQueue)
+		keeper.POST("/mail/resend", s.mailResend)
+		keeper.GET("/webhooks", s.webhooksList)
+		keeper.POST("/webhooks", s.webhookSave)
+		keeper.POST("/webhooks/delete", s.webhookDelete)
+		keeper.POST("/webhooks/redeliver", s.webhookRedeliver)
+		keeper.GET("/events", s.eventsList)
+		keeper.POST("/events/retry", s.eventRetry)
+		keeper.GET("/inbox", s.inboxList)
+		keeper.POST("/inbox/replay", s.inboxReplay)
 	}
 
 	{ // contents
@@ -81,12 +129,25 @@ func (s *server) StrapRouter() {
 		gr.GET("/serviceValidate", s.casValidateV2)
 	}
 
+	{ // SAML 2.0 IdP
+		gr.GET("/saml/metadata", s.samlMetadata)
+		gr.GET("/saml/sso", s.samlSSO)
+		gr.POST("/saml/sso", s.samlSSO)
+		authed.GET("/saml/resume", s.samlResume)
+	}
+
 	gr.GET("/", s.welcome) // home
 
 	{ // apis for unauth
 		gr.GET("/api/me", s.me)
 		gr.POST("/api/verify", s.me)
 		gr.POST("/api/login", s.loginPost)
+		gr.POST("/api/login/2fa", s.loginTOTPPost)
+		gr.POST("/api/login/link", s.loginLinkSend)
+		gr.POST("/api/login/link/finish", s.loginLinkPost)
+		gr.POST("/api/password/expired", s.passwordExpiredPost)
+		gr.POST("/api/login/webauthn", s.keyLoginBegin)
+		gr.POST("/api/login/webauthn/finish", s.keyLoginFinish)
 		gr.POST("/api/logout", s.logout)
 		gr.POST("/api/password/forgot", s.passwordForgot)
 		gr.POST("/api/password/reset", s.passwordReset)
@@ -101,9 +162,17 @@ func (s *server) StrapRouter() {
 		gr.POST("/api/third/feishu/event/callback", s.larkEventCallback)
 	}
 
-	api := gr.Group("/api", AuthUserMiddleware(false))
+	api := gr.Group("/api", s.AuthUserMiddleware(false), s.csrfMiddleware(), s.auditImpersonated)
 	{
-		api.POST("/password", s.passwordChange)
+		api.POST("/password", s.notImpersonated, s.passwordChange)
+		api.POST("/mobile", s.mobileSend)
+		api.POST("/mobile/verify", s.mobileVerify)
+		api.GET("/sessions", s.sessionsForm)
+		api.POST("/sessions/delete", s.sessionDelete)
+		api.GET("/tokens", s.tokensForm)
+		api.POST("/tokens", s.notImpersonated, s.tokenCreate)
+		api.POST("/tokens/delete", s.notImpersonated, s.tokenDelete)
+		api.POST("/impersonate/stop", s.impersonateStop)
 		api.POST("/weekly/report/add", s.weeklyReportAdd)
 		api.POST("/weekly/report/update", s.weeklyReportUpdate)
 		api.POST("/weekly/report/up", s.weeklyReportUp)
@@ -134,10 +203,13 @@ func (s *server) StrapRouter() {
 			apiMan.GET("/weekly/report/vacations", s.weeklyVacationList)
 			apiMan.POST("/weekly/report/vacation/mark", s.weeklyVacationAdd)
 			apiMan.POST("/weekly/report/vacation/unmark", s.weeklyVacationRemove)
+			apiMan.POST("/weekly/report/remind", s.weeklyRemind)
 
 			apiMan.DELETE("/staff/:uid", s.staffDelete)
 		}
 
+		api.GET("/audit", s.authGroup(gnAdmin), s.auditList)
+
 		apiDev := api.Group("/", s.authGroup(gnAdmin, gnDev))
 		{
 			apiDev.GET("/groups", s.groupList)
@@ -11,14 +11,21 @@ type loginParam struct {
 type forgotParam struct {
 	Username string `form:"username" json:"username" binding:"required" description:"用户名"`
 	Mobile   string `form:"mobile" json:"mobile" binding:"required" description:"手机号"`
-	Email    string `form:"email" json:"email" binding:"required" description:"邮箱"`
+	Email    string `form:"email" json:"email" description:"邮箱, sms 时可空"`
+	Via      string `form:"via" json:"via" description:"email or sms"`
+}
+
+type linkParam struct {
+	Username string `form:"username" json:"username" binding:"required" description:"用户名"`
+	Service  string `form:"service" json:"service,omitempty" `
 }
 
 type resetParam struct {
 	Username  string `form:"username" json:"username" binding:"required" description:"用户名"`
 	Password  string `form:"password" json:"password" binding:"required" description:"密码"`
 	Password2 string `form:"password_confirm" json:"password2" binding:"required" description:"密码"`
-	Token     string `form:"rt" json:"token" binding:"required" description:"token"`
+	Token     string `form:"rt" json:"token" description:"token of email"`
+	Code      string `form:"code" json:"code" description:"code of sms"`
 }
 
 // 修改密码，需要在登录后
@@ -13,6 +13,7 @@ import (
 	"github.com/wealthworks/go-tencent-api/exwechat"
 
 	"github.com/liut/staffio/pkg/backends"
+	"github.com/liut/staffio/pkg/models/saml"
 	"github.com/liut/staffio/pkg/settings"
 )
 
@@ -35,6 +36,7 @@ type server struct {
 	wxAuth   *exwechat.API
 	checkin  *exwechat.CAPI
 	larkAPI  *lark.API
+	samlIdP  *saml.IdentityProvider
 }
 
 func (s *server) IsKeeper(uid string) bool {
@@ -78,6 +80,7 @@ func New(c Config) *server {
 		wxAuth:  exwechat.New(settings.Current.WechatCorpID, settings.Current.WechatPortalSecret),
 		checkin: exwechat.NewCAPI(),
 		larkAPI: lark.New(settings.Current.LarkAppID, settings.Current.LarkAppSecret),
+		samlIdP: newSAMLIdP(),
 	}
 
 	if settings.Current.InDevelop {
@@ -97,6 +100,20 @@ func New(c Config) *server {
 	return svr
 }
 
+// StartWorkers runs the background jobs of the service, like the mail queue and webhooks, stop ends them
+func (s *server) StartWorkers() (stop func()) {
+	stops := []func(){
+		backends.StartMailWorker(s.service),
+		backends.StartWebhookWorker(s.service),
+		backends.StartEventWorker(s.service),
+	}
+	return func() {
+		for _, fn := range stops {
+			fn()
+		}
+	}
+}
+
 func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// TODO: refactory
 	s.router.ServeHTTP(w, req)
@@ -0,0 +1,29 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio/pkg/backends"
+)
+
+func TestMemoryNestedGroup(t *testing.T) {
+	s := newMemoryServer()
+
+	assert.False(t, s.InGroup("keeper", "test"))
+	assert.NoError(t, s.service.SaveGroup(&backends.Group{Name: "ops", Members: []string{"test"}}))
+	g, err := s.service.GetGroup("keeper")
+	assert.NoError(t, err)
+	g.Members = append(g.Members, "@ops")
+	assert.NoError(t, s.service.SaveGroup(g))
+	defer func() {
+		g.Members = g.Members[:len(g.Members)-1]
+		s.service.SaveGroup(g)
+		s.service.EraseGroup("ops")
+	}()
+
+	assert.True(t, s.InGroup("keeper", "test"))
+	assert.True(t, s.InGroupAny("test", "hr", "keeper"))
+	assert.False(t, s.InGroup("ops", "eagle"))
+}
@@ -8,8 +8,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 
-	auth "github.com/liut/simpauth"
-
 	"github.com/liut/staffio/pkg/settings"
 )
 
@@ -50,9 +48,13 @@ func (s *server) Render(c *gin.Context, name string, data interface{}) (err erro
 		if exist {
 			user = v.(*User)
 		} else {
-			user, err = auth.UserFromRequest(c.Request)
+			user, err = s.userFromRequest(c)
 		}
 		m["currUser"] = user
+		if user != nil {
+			m["impersonator"] = s.impersonator(c)
+			m["csrf"] = csrfToken(c)
+		}
 		m["checkEmail"] = settings.Current.EmailCheck
 		err = instance.Execute(c.Writer, m)
 	} else {